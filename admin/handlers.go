@@ -0,0 +1,448 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tapBuffer is the number of the records buffered for a tail request, beyond which the records are dropped.
+const tapBuffer = 256
+
+type (
+	// ClientInfo describes a Client in the admin API responses.
+	ClientInfo struct {
+		ID            uint64    `json:"id"`
+		Tenant        string    `json:"tenant,omitempty"`
+		UID           string    `json:"uid,omitempty"`
+		State         string    `json:"state"`
+		Protocol      string    `json:"protocol"`
+		RemoteAddr    string    `json:"remote_addr,omitempty"`
+		ConnectedAt   time.Time `json:"connected_at"`
+		Rooms         []string  `json:"rooms,omitempty"`
+		Tags          []string  `json:"tags,omitempty"`
+		WriteQueueLen int       `json:"write_queue_len"`
+	}
+
+	// KickRequest is the request body of POST /admin/kick, either ClientID or UID is required.
+	KickRequest struct {
+		Tenant   string `json:"tenant,omitempty"`
+		ClientID uint64 `json:"client_id,omitempty"`
+		UID      string `json:"uid,omitempty"`
+		Reason   string `json:"reason,omitempty"`
+	}
+
+	// KickResponse is the response body of POST /admin/kick.
+	KickResponse struct {
+		Kicked int `json:"kicked"`
+	}
+
+	// BroadcastRequest is the request body of POST /admin/broadcast.
+	// The message is pushed to the Room if set, otherwise to the clients with the Tag if set, otherwise to all
+	// the authorized clients, of the Tenant if set, which is the Tenant of the token for a tenant token.
+	BroadcastRequest struct {
+		Tenant string          `json:"tenant,omitempty"`
+		Room   string          `json:"room,omitempty"`
+		Tag    string          `json:"tag,omitempty"`
+		Route  string          `json:"route"`
+		Data   json.RawMessage `json:"data,omitempty"`
+	}
+
+	// DrainRequest is the request body of POST /admin/drain, and also the response body of /admin/drain.
+	DrainRequest struct {
+		Enabled bool `json:"enabled"`
+	}
+
+	// MaintenanceRequest is the request body of POST /admin/maintenance, and also the response body
+	// of /admin/maintenance. The Reason is told to the rejected clients, see connector.SetMaintenance.
+	MaintenanceRequest struct {
+		Enabled bool   `json:"enabled"`
+		Reason  string `json:"reason,omitempty"`
+	}
+
+	// MaxClientsRequest is the request body of POST /admin/max-clients, and also the response body
+	// of /admin/max-clients with the current number of clients, see connector.SetMaxClients.
+	MaxClientsRequest struct {
+		MaxClients int32 `json:"max_clients"`
+		NumClients int   `json:"num_clients,omitempty"`
+	}
+
+	// LogLevelRequest is the request body of POST /admin/loglevel.
+	LogLevelRequest struct {
+		Level string `json:"level"`
+	}
+
+	// LogLevelResponse is the response body of /admin/loglevel.
+	LogLevelResponse struct {
+		Level     string   `json:"level"`
+		DebugUIDs []string `json:"debug_uids"`
+	}
+
+	// DebugUIDRequest is the request body of POST /admin/debug-uid.
+	DebugUIDRequest struct {
+		UID     string `json:"uid"`
+		Enabled bool   `json:"enabled"`
+	}
+
+	// RouteRequest is the request body of POST /admin/routes, either Backend or Remove is required.
+	RouteRequest struct {
+		Route   string `json:"route"`
+		Backend string `json:"backend,omitempty"`
+		Remove  bool   `json:"remove,omitempty"`
+	}
+
+	// RoutesResponse is the response body of /admin/routes.
+	RoutesResponse struct {
+		Routes []string `json:"routes"`
+	}
+
+	errorResponse struct {
+		Error string `json:"error"`
+	}
+)
+
+func newClientInfo(c *connector.Client) ClientInfo {
+	info := ClientInfo{
+		ID:            c.ID(),
+		Tenant:        string(c.Tenant()),
+		UID:           c.UID(),
+		State:         c.State().String(),
+		Protocol:      string(c.Transport().ProtocolType()),
+		ConnectedAt:   c.ConnectedAt(),
+		Tags:          c.Tags(),
+		WriteQueueLen: c.WriteQueueLen(),
+	}
+	if conn := c.Transport().NetConn(); conn != nil {
+		info.RemoteAddr = conn.RemoteAddr().String()
+	}
+	for _, r := range c.Rooms() {
+		info.Rooms = append(info.Rooms, r.Name())
+	}
+	sort.Strings(info.Rooms)
+	return info
+}
+
+// listClients lists the clients matching all the filters in the query, ordered by ID.
+func listClients(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	q := r.URL.Query()
+	state := q.Get("state")
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	tenant, filterTenant := requestTenant(r, q.Get("tenant"))
+	query := connector.ClientQuery{UID: q.Get("uid"), Room: q.Get("room"), Tag: q.Get("tag")}
+	if state != "" {
+		query.Match = func(c *connector.Client) bool { return c.State().String() == state }
+	}
+
+	var clients []*connector.Client
+	if filterTenant {
+		clients = tenant.FindClients(query)
+	} else {
+		clients = connector.FindClients(query.Matches)
+	}
+	infos := make([]ClientInfo, 0, len(clients))
+	for _, c := range clients {
+		infos = append(infos, newClientInfo(c))
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	if limit > 0 && len(infos) > limit {
+		infos = infos[:limit]
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// inspectClient describes the session of the Client with the ID in the path, or tails its messages
+// if the path ends with "/tail".
+func inspectClient(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/admin/clients/")
+	path, tail := strings.CutSuffix(path, "/tail")
+	id, err := strconv.ParseUint(path, 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("invalid client id"))
+		return
+	}
+	c, ok := connector.GetClient(id)
+	if tenant, filterTenant := requestTenant(r, ""); ok && filterTenant && c.Tenant() != tenant {
+		ok = false
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("client not found"))
+		return
+	}
+	if tail {
+		tailClient(w, r, c)
+		return
+	}
+	writeJSON(w, http.StatusOK, newClientInfo(c))
+}
+
+// tailClient streams the messages read from and written to the Client as server-sent events of
+// connector.TapRecord in JSON, until the request is canceled or the Client is closed.
+// The payloads are truncated or redacted by the logging options of the connector.
+func tailClient(w http.ResponseWriter, r *http.Request, c *connector.Client) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming unsupported"))
+		return
+	}
+	records, cancel := c.Tap(tapBuffer)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case rec, ok := <-records:
+			if !ok {
+				_, _ = io.WriteString(w, "event: closed\ndata: {}\n\n")
+				flusher.Flush()
+				return
+			}
+			_, _ = io.WriteString(w, "data: ")
+			// Encode ends the JSON with a newline, followed by the blank line ending the event.
+			if err := enc.Encode(rec); err != nil {
+				return
+			}
+			_, _ = io.WriteString(w, "\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func kick(w http.ResponseWriter, r *http.Request) {
+	var req KickRequest
+	if !decodePost(w, r, &req) {
+		return
+	}
+
+	var clients []*connector.Client
+	tenant, filterTenant := requestTenant(r, req.Tenant)
+	switch {
+	case req.ClientID != 0:
+		if c, ok := connector.GetClient(req.ClientID); ok && (!filterTenant || c.Tenant() == tenant) {
+			clients = append(clients, c)
+		}
+	case req.UID != "":
+		clients = tenant.ClientsByUID(req.UID)
+	default:
+		writeError(w, http.StatusBadRequest, errors.New("client_id or uid is required"))
+		return
+	}
+
+	reason := req.Reason
+	if reason == "" {
+		reason = "kicked by admin"
+	}
+	for _, c := range clients {
+		c.Kick(reason)
+	}
+	writeJSON(w, http.StatusOK, KickResponse{Kicked: len(clients)})
+}
+
+func broadcast(w http.ResponseWriter, r *http.Request) {
+	var req BroadcastRequest
+	if !decodePost(w, r, &req) {
+		return
+	}
+	if req.Route == "" {
+		writeError(w, http.StatusBadRequest, errors.New("route is required"))
+		return
+	}
+
+	var err error
+	tenant, filterTenant := requestTenant(r, req.Tenant)
+	switch {
+	case req.Room != "":
+		room, ok := tenant.GetRoom(req.Room)
+		if !ok {
+			writeError(w, http.StatusNotFound, errors.New("room not found"))
+			return
+		}
+		err = room.Broadcast(req.Route, req.Data)
+	case req.Tag != "":
+		err = tenant.PushToTag(req.Tag, req.Route, req.Data)
+	case filterTenant:
+		err = tenant.Broadcast(req.Route, req.Data)
+	default:
+		err = connector.Broadcast(req.Route, req.Data)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func drain(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, DrainRequest{Enabled: connector.Draining()})
+		return
+	}
+
+	var req DrainRequest
+	if !decodePost(w, r, &req) {
+		return
+	}
+	connector.SetDraining(req.Enabled)
+	writeJSON(w, http.StatusOK, DrainRequest{Enabled: connector.Draining()})
+}
+
+func maintenance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		var req MaintenanceRequest
+		if !decodePost(w, r, &req) {
+			return
+		}
+		connector.SetMaintenance(req.Enabled, req.Reason)
+	}
+	enabled, reason := connector.Maintenance()
+	writeJSON(w, http.StatusOK, MaintenanceRequest{Enabled: enabled, Reason: reason})
+}
+
+func maxClients(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		var req MaxClientsRequest
+		if !decodePost(w, r, &req) {
+			return
+		}
+		if req.MaxClients < 0 {
+			writeError(w, http.StatusBadRequest, errors.New("max_clients must not be negative"))
+			return
+		}
+		connector.SetMaxClients(req.MaxClients)
+	}
+	writeJSON(
+		w, http.StatusOK, MaxClientsRequest{MaxClients: int32(connector.MaxClients()), NumClients: connector.NumClients()},
+	)
+}
+
+func (s *Server) logLevel(w http.ResponseWriter, r *http.Request) {
+	lc, ok := s.opts.Logger.(logging.LevelController)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, errors.New("logger does not support changing level"))
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		var req LogLevelRequest
+		if !decodePost(w, r, &req) {
+			return
+		}
+		level, err := logging.ParseLevel(req.Level)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		lc.SetLevel(level)
+	}
+	writeJSON(
+		w, http.StatusOK, LogLevelResponse{
+			Level:     strings.ToLower(lc.Level().String()),
+			DebugUIDs: connector.DebugUIDs(),
+		},
+	)
+}
+
+func debugUID(w http.ResponseWriter, r *http.Request) {
+	var req DebugUIDRequest
+	if !decodePost(w, r, &req) {
+		return
+	}
+	if req.UID == "" {
+		writeError(w, http.StatusBadRequest, errors.New("uid is required"))
+		return
+	}
+	connector.SetDebugUID(req.UID, req.Enabled)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// services lists the services registered to the Router by connector.Router.RegisterService.
+func (s *Server) services(w http.ResponseWriter, r *http.Request) {
+	if s.opts.Router == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("router is not set"))
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.opts.Router.Services())
+}
+
+func (s *Server) routes(w http.ResponseWriter, r *http.Request) {
+	if s.opts.Router == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("router is not set"))
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		var req RouteRequest
+		if !decodePost(w, r, &req) {
+			return
+		}
+		switch {
+		case req.Route == "":
+			writeError(w, http.StatusBadRequest, errors.New("route is required"))
+			return
+		case req.Remove:
+			s.opts.Router.Remove(req.Route)
+		case req.Backend == "" || s.opts.RouteBackend == nil:
+			writeError(w, http.StatusBadRequest, errors.New("backend or remove is required"))
+			return
+		default:
+			h, err := s.opts.RouteBackend(req.Backend)
+			if err != nil {
+				writeError(w, http.StatusBadGateway, err)
+				return
+			}
+			s.opts.Router.Handle(req.Route, h)
+		}
+	}
+	writeJSON(w, http.StatusOK, RoutesResponse{Routes: s.opts.Router.Routes()})
+}
+
+// decodePost decodes the JSON body of a POST request into v,
+// writes an error response and returns false on failure.
+func decodePost(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,247 @@
+// Package admin provides an authenticated HTTP API for operating a running ppcserver,
+// such as listing and kicking clients, broadcasting messages, and toggling the drain mode.
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"net/http"
+	"strings"
+)
+
+var ErrNoToken = errors.New("ppcserver: admin server requires at least one token")
+
+// tenantKey is the context key of the connector.Tenant a request is scoped to by its tenant token.
+type tenantKey struct{}
+
+type (
+	// Option is a function to apply various configurations to customize an admin Server.
+	Option func(o *Options)
+
+	// Options hold the configurable parts of an admin Server.
+	Options struct {
+		// Addr specifies the TCP address for the admin server to listen on, in the form "host:port".
+		// Default is "localhost:7070" if not set via WithAddr.
+		Addr string
+
+		// Tokens are the bearer tokens accepted in the "Authorization: Bearer <token>" request header.
+		// At least one token is required, set via WithTokens.
+		Tokens []string
+
+		// TenantTokens are the bearer tokens scoped to a connector.Tenant, keyed by token, set via WithTenantTokens.
+		// A tenant token lists, kicks and broadcasts only within its Tenant, and can't access the other endpoints.
+		TenantTokens map[string]connector.Tenant
+
+		// Logger is the Logger whose level is changed via the admin API, it must implement logging.LevelController.
+		// Default is logging.Default() if not set via WithLogger.
+		Logger logging.Logger
+
+		// Router is the Router whose routes are updated via the admin API.
+		// The routes can't be updated if not set via WithRouter.
+		Router *connector.Router
+
+		// RouteBackend returns the HandlerFunc forwarding to the backend target in the POST /admin/routes request,
+		// such as forward.Pool.Handler. Set via WithRouter.
+		RouteBackend func(target string) (connector.HandlerFunc, error)
+	}
+
+	// Server is a Component that serves the admin API:
+	//
+	//	GET  /admin/clients        list clients, filtered by ?tenant=, ?uid=, ?state=, ?room=, ?tag=, limited by ?limit=
+	//	GET  /admin/clients/{id}   inspect the session of a client
+	//	GET  /admin/clients/{id}/tail
+	//	                           tail the messages of a client as server-sent events, with the payloads
+	//	                           truncated or redacted by connector.WithLogPayload
+	//	POST /admin/kick           kick clients, {"client_id": 1} or {"uid": "u1"}, with an optional "reason"
+	//	POST /admin/broadcast      push {"route": "r", "data": {...}} to a "room", a "tag", or all authorized clients
+	//
+	// The clients, kick and broadcast endpoints accept a "tenant" to act within a connector.Tenant, which is fixed
+	// to the Tenant of a tenant token. The other endpoints are only accessible with the tokens of Options.Tokens:
+	//
+	//	GET  /admin/drain          get the drain mode
+	//	POST /admin/drain          toggle the drain mode, {"enabled": true}
+	//	GET  /admin/maintenance    get the maintenance mode
+	//	POST /admin/maintenance    toggle the maintenance mode, {"enabled": true, "reason": "back at 10:00 UTC"}
+	//	GET  /admin/max-clients    get the maximum and the current number of clients
+	//	POST /admin/max-clients    change the maximum number of clients, {"max_clients": 10000}
+	//	GET  /admin/loglevel       get the log level and the uids with debug logging enabled
+	//	POST /admin/loglevel       change the log level, {"level": "debug"}
+	//	POST /admin/debug-uid      toggle debug logging for the clients of a uid, {"uid": "u1", "enabled": true}
+	//	GET  /admin/routes         list the routes of the Router
+	//	POST /admin/routes         point a route to a backend, {"route": "battle.*", "backend": "battle-v2:9000"},
+	//	                           or remove it, {"route": "battle.*", "remove": true}
+	//	GET  /admin/services       list the services registered by connector.Router.RegisterService
+	Server struct {
+		opts   *Options
+		server *http.Server
+	}
+)
+
+func defaultOptions() *Options {
+	return &Options{
+		Addr:   "localhost:7070",
+		Logger: logging.Default(),
+	}
+}
+
+// NewServer creates a new admin Server.
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		opts: defaultOptions(),
+	}
+
+	// Apply opts to customize Server.
+	for _, opt := range opts {
+		opt(s.opts)
+	}
+
+	s.server = &http.Server{
+		Addr:    s.opts.Addr,
+		Handler: s.Handler(),
+	}
+	return s
+}
+
+// Handler returns an http.Handler serving the admin API with authentication,
+// for mounting on a custom server instead of starting an admin Server.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/clients", listClients)
+	mux.HandleFunc("/admin/clients/", inspectClient)
+	mux.HandleFunc("/admin/kick", kick)
+	mux.HandleFunc("/admin/broadcast", broadcast)
+	mux.HandleFunc("/admin/drain", operatorOnly(drain))
+	mux.HandleFunc("/admin/maintenance", operatorOnly(maintenance))
+	mux.HandleFunc("/admin/max-clients", operatorOnly(maxClients))
+	mux.HandleFunc("/admin/loglevel", operatorOnly(s.logLevel))
+	mux.HandleFunc("/admin/debug-uid", operatorOnly(debugUID))
+	mux.HandleFunc("/admin/routes", operatorOnly(s.routes))
+	mux.HandleFunc("/admin/services", operatorOnly(s.services))
+	return s.authenticate(mux)
+}
+
+// Start starts the admin HTTP server and blocks until the server is closed.
+func (s *Server) Start(_ context.Context) error {
+	if len(s.opts.Tokens) == 0 && len(s.opts.TenantTokens) == 0 {
+		return ErrNoToken
+	}
+	if err := s.server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Shutdown gracefully shuts down the admin HTTP server.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// authenticate rejects the requests without a valid bearer token, and scopes the requests with a tenant token
+// to its connector.Tenant.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if token != "" && s.validToken(token) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if t, ok := s.tenantToken(token); token != "" && ok {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tenantKey{}, t)))
+				return
+			}
+			writeError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		},
+	)
+}
+
+// operatorOnly rejects the requests scoped to a connector.Tenant by a tenant token.
+func operatorOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, scoped := r.Context().Value(tenantKey{}).(connector.Tenant); scoped {
+			writeError(w, http.StatusForbidden, errors.New("tenant token is not allowed"))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requestTenant returns the connector.Tenant of the tenant token of the request, or the tenant requested by
+// an operator token, connector.DefaultTenant if not requested, ok is false for an operator requesting no tenant.
+func requestTenant(r *http.Request, requested string) (t connector.Tenant, ok bool) {
+	if t, scoped := r.Context().Value(tenantKey{}).(connector.Tenant); scoped {
+		return t, true
+	}
+	return connector.Tenant(requested), requested != ""
+}
+
+// tenantToken returns the connector.Tenant of the tenant token, comparing in constant time like validToken.
+func (s *Server) tenantToken(token string) (connector.Tenant, bool) {
+	var (
+		tenant connector.Tenant
+		valid  bool
+	)
+	for t, tn := range s.opts.TenantTokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			tenant, valid = tn, true
+		}
+	}
+	return tenant, valid
+}
+
+// validToken compares in constant time to avoid leaking the tokens through timing.
+func (s *Server) validToken(token string) bool {
+	valid := false
+	for _, t := range s.opts.Tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// WithAddr is an Option to set the TCP address for the admin server to listen on.
+func WithAddr(a string) Option {
+	return func(o *Options) {
+		o.Addr = a
+	}
+}
+
+// WithTokens is an Option to set the bearer tokens accepted by the admin API.
+func WithTokens(tokens ...string) Option {
+	return func(o *Options) {
+		o.Tokens = append(o.Tokens, tokens...)
+	}
+}
+
+// WithTenantTokens is an Option to set the bearer tokens scoped to the Tenant t, which can only list, kick and
+// broadcast to the clients of t, so that a game team operates its own namespace on a shared deployment.
+func WithTenantTokens(t connector.Tenant, tokens ...string) Option {
+	return func(o *Options) {
+		if o.TenantTokens == nil {
+			o.TenantTokens = make(map[string]connector.Tenant)
+		}
+		for _, token := range tokens {
+			o.TenantTokens[token] = t
+		}
+	}
+}
+
+// WithLogger is an Option to set the Logger whose level is changed via the admin API.
+func WithLogger(l logging.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
+
+// WithRouter is an Option to update the routes of the Router via the admin API,
+// backend returns the HandlerFunc forwarding to a backend target, such as forward.Pool.Handler.
+func WithRouter(r *connector.Router, backend func(target string) (connector.HandlerFunc, error)) Option {
+	return func(o *Options) {
+		o.Router = r
+		o.RouteBackend = backend
+	}
+}
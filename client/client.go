@@ -0,0 +1,556 @@
+// Package client is a Go client of ppcserver over WebSocket or TCP, which handles the handshake, the auth,
+// and the heartbeat, for the integration tests and as a reference client implementation:
+//
+//	c, err := client.Dial(ctx, "ws://localhost:8080/", client.WithAuth(token))
+//	var resp EchoResponse
+//	err = c.Request(ctx, "echo", EchoRequest{Text: "hi"}, &resp)
+//	push, err := c.Receive(ctx)
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrClosed = errors.New("ppcserver: client is closed")
+
+type (
+	// Option is a function to apply various configurations to customize a Client.
+	Option func(o *Options)
+
+	// Options hold the configurable parts of a Client.
+	Options struct {
+		// Version is the protocol version declared by a connector.HandshakeRequest once connected.
+		// No HandshakeRequest is sent if not set via WithProtocolVersion.
+		Version string
+
+		// AppKey selects the tenant of the Client by a connector.HandshakeRequest once connected,
+		// see connector.WithTenantResolver. No app key is presented if not set via WithAppKey.
+		AppKey string
+
+		// FrameType chooses the type of the WebSocket frames written by the server by a connector.HandshakeRequest
+		// once connected. The server default of its encoding is kept if not set via WithFrameType.
+		FrameType connector.FrameType
+
+		// Auth is the data of the connector.RouteAuth request sent once connected.
+		// No auth request is sent if not set via WithAuth.
+		Auth interface{}
+
+		// SigningSecret is the secret shared with the server to sign the messages, see connector.WithMessageSigning,
+		// a HandshakeRequest with a nonce is sent once connected to derive the signing key.
+		// No message is signed if not set via WithMessageSigning.
+		SigningSecret []byte
+
+		// KeyExchange agrees the session secret with the server by an X25519 key exchange in the handshake,
+		// see connector.WithKeyExchange. Default is false if not set via WithKeyExchange.
+		KeyExchange bool
+
+		// ChallengeSolver answers the challenge data pushed by connector.RouteChallenge when the auth is challenged,
+		// such as by solving a connector.ProofOfWork, the auth request is retried once the answer is accepted.
+		// The challenged auth fails if not set via WithChallengeSolver.
+		ChallengeSolver func(challenge json.RawMessage) (answer interface{}, err error)
+
+		// OnHeartbeatData is called with the application data attached by connector.WithHeartbeatData to the
+		// heartbeat pings and pongs of the server, in the goroutine reading from the server, so it must not block.
+		// The data is ignored if not set via WithOnHeartbeatData.
+		OnHeartbeatData func(data json.RawMessage)
+
+		// PushBuffer is the number of the pushes buffered until received by Client.Receive,
+		// the Client stops reading from the server while the buffer is full.
+		// Default is 256 if not set via WithPushBuffer.
+		PushBuffer int
+	}
+
+	// Client is a connection to ppcserver, its methods are safe for concurrent use.
+	Client struct {
+		opts    *Options
+		conn    conn
+		lastID  uint64     // lastID is the ID of the latest request, accessed atomically.
+		writeMu sync.Mutex // writeMu serializes the writes to conn.
+		mu      sync.Mutex // mu guards pending, handshake, err, and sessionSecret.
+		pending map[uint64]chan *connector.Message
+		// handshake is the latest connector.Handshake received from the server.
+		handshake connector.Handshake
+		err       error // err is the error that closes the Client.
+		// signingKey is the key derived by the handshake when Options.SigningSecret or Options.KeyExchange is set,
+		// guarded by writeMu.
+		signingKey []byte
+		// sessionSecret is the secret agreed by the key exchange, guarded by mu.
+		sessionSecret []byte
+		pushes        chan *connector.Message
+		// challenges receives the data of the connector.RouteChallenge pushes.
+		challenges chan json.RawMessage
+		closed     chan struct{}
+		closeOnce  sync.Once
+	}
+
+	// ResponseError is the error of a response from the server, see connector.Message.Error.
+	ResponseError struct {
+		Route   string
+		Message string
+		// Code is the connector.ErrorCode of the error, to branch on instead of Message.
+		Code connector.ErrorCode
+	}
+)
+
+func defaultOptions() *Options {
+	return &Options{
+		PushBuffer: 256,
+	}
+}
+
+// Dial connects to the server at rawURL, such as "ws://localhost:8080/" or "tcp://localhost:9000",
+// sends the HandshakeRequest and the auth request if set, and returns once they succeed.
+func Dial(ctx context.Context, rawURL string, opts ...Option) (*Client, error) {
+	c := &Client{
+		opts:       defaultOptions(),
+		pending:    make(map[uint64]chan *connector.Message),
+		closed:     make(chan struct{}),
+		challenges: make(chan json.RawMessage, 1),
+	}
+
+	// Apply opts to customize Client.
+	for _, opt := range opts {
+		opt(c.opts)
+	}
+
+	conn, err := dial(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	c.pushes = make(chan *connector.Message, c.opts.PushBuffer)
+	go c.readLoop()
+
+	if c.opts.Version != "" || c.opts.AppKey != "" || c.opts.FrameType != "" || c.signing() {
+		if err := c.handshakeRequest(ctx); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+	}
+	if c.opts.Auth != nil {
+		if err := c.auth(ctx); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// auth sends the auth request, and answers the challenge by Options.ChallengeSolver before retrying it.
+func (c *Client) auth(ctx context.Context) error {
+	err := c.Request(ctx, connector.RouteAuth, c.opts.Auth, nil)
+	var respErr *ResponseError
+	if c.opts.ChallengeSolver == nil || !errors.As(err, &respErr) || respErr.Code != connector.ErrorCodeChallengeRequired {
+		return err
+	}
+
+	// The challenge is pushed before the auth response, so it has been received.
+	var challenge json.RawMessage
+	select {
+	case challenge = <-c.challenges:
+	default:
+		return err
+	}
+	answer, err := c.opts.ChallengeSolver(challenge)
+	if err != nil {
+		return err
+	}
+	if err := c.Request(ctx, connector.RouteChallenge, answer, nil); err != nil {
+		return err
+	}
+	return c.Request(ctx, connector.RouteAuth, c.opts.Auth, nil)
+}
+
+// signing reports whether the messages are signed.
+func (c *Client) signing() bool {
+	return c.opts.SigningSecret != nil || c.opts.KeyExchange
+}
+
+// handshakeRequest declares the protocol version, the app key, and the frame type,
+// and derives the keys if the messages are signed.
+func (c *Client) handshakeRequest(ctx context.Context) error {
+	var (
+		req = connector.HandshakeRequest{
+			Version:   c.opts.Version,
+			AppKey:    c.opts.AppKey,
+			FrameType: c.opts.FrameType,
+		}
+		priv []byte
+		err  error
+	)
+	if c.signing() {
+		req.Nonce = make([]byte, 16)
+		if _, err := rand.Read(req.Nonce); err != nil {
+			return err
+		}
+	}
+	if c.opts.KeyExchange {
+		if priv, req.PublicKey, err = connector.NewKeyExchangeKey(); err != nil {
+			return err
+		}
+	}
+
+	var hs connector.Handshake
+	if err := c.Request(ctx, connector.RouteHandshake, req, &hs); err != nil {
+		return err
+	}
+	c.setHandshake(hs)
+	if !c.signing() {
+		return nil
+	}
+
+	secret := c.opts.SigningSecret
+	if c.opts.KeyExchange {
+		secret, err = connector.DeriveSessionSecret(c.opts.SigningSecret, priv, hs.PublicKey, req.PublicKey, hs.PublicKey)
+		if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.sessionSecret = secret
+		c.mu.Unlock()
+	}
+	c.writeMu.Lock()
+	c.signingKey = connector.DeriveSigningKey(secret, req.Nonce, hs.Nonce)
+	c.writeMu.Unlock()
+	return nil
+}
+
+// SessionKey derives the key for the label from the secret agreed by the key exchange, the same as
+// connector.Client.SessionKey on the server, or nil if Options.KeyExchange is not set.
+func (c *Client) SessionKey(label string) []byte {
+	c.mu.Lock()
+	secret := c.sessionSecret
+	c.mu.Unlock()
+	if secret == nil {
+		return nil
+	}
+	return connector.DeriveSessionKey(secret, label)
+}
+
+// Send sends a one-way Message with the route and the encoded v.
+func (c *Client) Send(route string, v interface{}) error {
+	return c.write(&connector.Message{Route: route}, v)
+}
+
+// Request sends a request with the route and the encoded v, and decodes the data of the response into out
+// unless out is nil. It returns a *ResponseError if the server responds an error.
+func (c *Client) Request(ctx context.Context, route string, v interface{}, out interface{}) error {
+	id := atomic.AddUint64(&c.lastID, 1)
+	ch := make(chan *connector.Message, 1)
+	c.mu.Lock()
+	c.pending[id] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.write(&connector.Message{ID: id, Route: route}, v); err != nil {
+		return err
+	}
+
+	select {
+	case m := <-ch:
+		if m.Error != "" {
+			return &ResponseError{Route: m.Route, Message: m.Error, Code: m.Code}
+		}
+		if out == nil || len(m.Data) == 0 {
+			return nil
+		}
+		return json.Unmarshal(m.Data, out)
+	case <-c.closed:
+		return c.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Receive returns the next one-way Message pushed by the server, except the built-in heartbeat messages.
+// The pushes received before the Client is closed can still be received.
+func (c *Client) Receive(ctx context.Context) (*connector.Message, error) {
+	select {
+	case m := <-c.pushes:
+		return m, nil
+	default:
+	}
+
+	select {
+	case m := <-c.pushes:
+		return m, nil
+	case <-c.closed:
+		select {
+		case m := <-c.pushes:
+			return m, nil
+		default:
+			return nil, c.Err()
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// RefreshAuth sends the refreshed auth data v by a connector.RouteAuthRefresh request, before the current auth expires.
+func (c *Client) RefreshAuth(ctx context.Context, v interface{}) error {
+	return c.Request(ctx, connector.RouteAuthRefresh, v, nil)
+}
+
+// Ack acknowledges the push with the seq sent by connector.Client.PushWithAck.
+func (c *Client) Ack(seq uint64) error {
+	return c.write(&connector.Message{Route: connector.RouteAck, Seq: seq}, nil)
+}
+
+// Handshake returns the latest connector.Handshake received from the server.
+func (c *Client) Handshake() connector.Handshake {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.handshake
+}
+
+// Done returns a channel that is closed once the Client is closed.
+func (c *Client) Done() <-chan struct{} {
+	return c.closed
+}
+
+// Err returns the error that closes the Client, nil if not closed.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Logout closes the Client gracefully by a connector.RouteLogout request, so that the server writes the pending
+// messages, deletes the session, and closes the connection with connector.DisconnectCauseLogout instead of
+// a network failure. The Client is closed even if the request fails.
+func (c *Client) Logout(ctx context.Context) error {
+	err := c.Request(ctx, connector.RouteLogout, nil, nil)
+	if closeErr := c.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.closeWithError(ErrClosed)
+}
+
+func (e *ResponseError) Error() string {
+	return e.Message
+}
+
+func (c *Client) closeWithError(err error) error {
+	var closeErr error
+	c.closeOnce.Do(
+		func() {
+			c.mu.Lock()
+			c.err = err
+			c.mu.Unlock()
+			closeErr = c.conn.close()
+			close(c.closed)
+		},
+	)
+	return closeErr
+}
+
+// write encodes v as the data of the Message m and writes it.
+func (c *Client) write(m *connector.Message, v interface{}) error {
+	if v != nil {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		m.Data = data
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.signingKey != nil {
+		connector.SignMessage(c.signingKey, m)
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-c.closed:
+		return c.Err()
+	default:
+	}
+	return c.conn.write(data)
+}
+
+// readLoop reads the messages from the server until the connection is closed, dispatches the responses to
+// the pending requests, replies the heartbeat, and buffers the other pushes for Receive.
+func (c *Client) readLoop() {
+	for {
+		data, err := c.conn.read()
+		if err != nil {
+			_ = c.closeWithError(err)
+			return
+		}
+		m := &connector.Message{}
+		if err := json.Unmarshal(data, m); err != nil {
+			continue
+		}
+
+		if m.ID != 0 {
+			c.mu.Lock()
+			ch, ok := c.pending[m.ID]
+			c.mu.Unlock()
+			if ok {
+				ch <- m
+			}
+			continue
+		}
+
+		switch m.Route {
+		case connector.RoutePing:
+			_ = c.write(&connector.Message{Route: connector.RoutePong, Data: m.Data}, nil)
+			c.heartbeatData(m.Data)
+			continue
+		case connector.RoutePong:
+			c.heartbeatData(m.Data)
+			continue
+		case connector.RouteHandshake:
+			var hs connector.Handshake
+			if json.Unmarshal(m.Data, &hs) == nil {
+				c.setHandshake(hs)
+			}
+			continue
+		case connector.RouteChallenge:
+			select {
+			case c.challenges <- m.Data:
+			default:
+			}
+			continue
+		}
+
+		select {
+		case c.pushes <- m:
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// heartbeatData calls Options.OnHeartbeatData with the "app" field of the data of a heartbeat, if any.
+func (c *Client) heartbeatData(data json.RawMessage) {
+	if c.opts.OnHeartbeatData == nil || len(data) == 0 {
+		return
+	}
+	var hb struct {
+		App json.RawMessage `json:"app"`
+	}
+	if json.Unmarshal(data, &hb) == nil && len(hb.App) > 0 {
+		c.opts.OnHeartbeatData(hb.App)
+	}
+}
+
+// setHandshake keeps the Handshake, and starts pinging in connector.HeartbeatModeClientPing.
+func (c *Client) setHandshake(hs connector.Handshake) {
+	c.mu.Lock()
+	prev := c.handshake
+	c.handshake = hs
+	c.mu.Unlock()
+
+	if hs.HeartbeatMode == connector.HeartbeatModeClientPing && hs.HeartbeatInterval > 0 &&
+		prev.HeartbeatMode != connector.HeartbeatModeClientPing {
+		go c.pingLoop(time.Duration(hs.HeartbeatInterval) * time.Millisecond)
+	}
+}
+
+// pingLoop sends connector.RoutePing every interval until the Client is closed.
+func (c *Client) pingLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = c.Send(connector.RoutePing, nil)
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// WithProtocolVersion is an Option to declare the protocol version by a HandshakeRequest once connected.
+func WithProtocolVersion(v string) Option {
+	return func(o *Options) {
+		o.Version = v
+	}
+}
+
+// WithOnHeartbeatData is an Option to receive the application data attached to the heartbeats by the server.
+func WithOnHeartbeatData(f func(data json.RawMessage)) Option {
+	return func(o *Options) {
+		o.OnHeartbeatData = f
+	}
+}
+
+// WithAppKey is an Option to present the app key by a HandshakeRequest once connected.
+func WithAppKey(k string) Option {
+	return func(o *Options) {
+		o.AppKey = k
+	}
+}
+
+// WithFrameType is an Option to choose the type of the WebSocket frames written by the server
+// by a HandshakeRequest once connected.
+func WithFrameType(t connector.FrameType) Option {
+	return func(o *Options) {
+		o.FrameType = t
+	}
+}
+
+// WithAuth is an Option to send the auth request with the data v once connected.
+func WithAuth(v interface{}) Option {
+	return func(o *Options) {
+		o.Auth = v
+	}
+}
+
+// WithMessageSigning is an Option to sign the messages by the key derived from secret shared with the server.
+func WithMessageSigning(secret []byte) Option {
+	return func(o *Options) {
+		o.SigningSecret = secret
+	}
+}
+
+// WithKeyExchange is an Option to agree the session secret with the server by an X25519 key exchange,
+// which signs the messages by the key derived from it.
+func WithKeyExchange() Option {
+	return func(o *Options) {
+		o.KeyExchange = true
+	}
+}
+
+// WithChallengeSolver is an Option to answer the challenge of the auth by solve.
+func WithChallengeSolver(solve func(challenge json.RawMessage) (answer interface{}, err error)) Option {
+	return func(o *Options) {
+		o.ChallengeSolver = solve
+	}
+}
+
+// SolveProofOfWork is a solver for WithChallengeSolver answering a connector.ProofOfWork.
+func SolveProofOfWork(challenge json.RawMessage) (interface{}, error) {
+	var pow connector.ProofOfWork
+	if err := json.Unmarshal(challenge, &pow); err != nil {
+		return nil, err
+	}
+	return pow.Solve(), nil
+}
+
+// WithPushBuffer is an Option to set the number of the pushes buffered until received.
+func WithPushBuffer(n int) Option {
+	return func(o *Options) {
+		o.PushBuffer = n
+	}
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"io"
+	"net"
+	"net/url"
+)
+
+// conn is a framed connection to the server.
+type conn interface {
+	write(data []byte) error
+	read() ([]byte, error)
+	close() error
+}
+
+// dial connects to the server by the scheme of rawURL, either ws, wss, or tcp.
+func dial(ctx context.Context, rawURL string) (conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "ws", "wss":
+		c, _, err := websocket.DefaultDialer.DialContext(ctx, rawURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &wsConn{conn: c}, nil
+	case "tcp":
+		var d net.Dialer
+		c, err := d.DialContext(ctx, "tcp", u.Host)
+		if err != nil {
+			return nil, err
+		}
+		return &tcpConn{conn: c, br: bufio.NewReader(c)}, nil
+	default:
+		return nil, fmt.Errorf("ppcserver: unsupported client URL scheme %q", u.Scheme)
+	}
+}
+
+type wsConn struct {
+	conn *websocket.Conn
+}
+
+func (c *wsConn) write(data []byte) error {
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (c *wsConn) read() ([]byte, error) {
+	_, b, err := c.conn.ReadMessage()
+	return b, err
+}
+
+func (c *wsConn) close() error {
+	return c.conn.Close()
+}
+
+// tcpConn frames each message with a 4-byte big-endian length prefix as connector.TCPConnector.
+type tcpConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func (c *tcpConn) write(data []byte) error {
+	b := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(b, uint32(len(data)))
+	copy(b[4:], data)
+	_, err := c.conn.Write(b)
+	return err
+}
+
+func (c *tcpConn) read() ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return nil, err
+	}
+	b := make([]byte, binary.BigEndian.Uint32(header[:]))
+	_, err := io.ReadFull(c.br, b)
+	return b, err
+}
+
+func (c *tcpConn) close() error {
+	return c.conn.Close()
+}
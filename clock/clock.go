@@ -0,0 +1,152 @@
+// Package clock abstracts the time source of the timers, so that the heartbeats, the timeouts, and the scheduled
+// tasks can run on a Fake clock in tests, which are then fast and deterministic.
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// Clock tells the time and schedules the functions.
+	Clock interface {
+		Now() time.Time
+		// AfterFunc calls f in its own goroutine after the duration d, or in the goroutine advancing a Fake clock.
+		AfterFunc(d time.Duration, f func()) Timer
+	}
+
+	// Timer is a function scheduled by Clock.AfterFunc.
+	Timer interface {
+		// Stop prevents the Timer from firing, it returns false if the Timer has already fired or been stopped.
+		Stop() bool
+		// Reset reschedules the Timer to fire after the duration d, it returns false if the Timer
+		// has already fired or been stopped.
+		Reset(d time.Duration) bool
+	}
+
+	realClock struct{}
+
+	// Fake is a Clock whose time only moves by Advance or Set, which runs the due functions in the caller goroutine.
+	Fake struct {
+		mu     sync.Mutex // mu guards now, timers and seq.
+		now    time.Time
+		timers []*fakeTimer
+		seq    uint64
+	}
+
+	fakeTimer struct {
+		c   *Fake
+		at  time.Time
+		seq uint64 // seq orders the timers due at the same time by their scheduling.
+		f   func()
+	}
+)
+
+// Real returns the Clock of the runtime, by time.Now and time.AfterFunc.
+func Real() Clock {
+	return realClock{}
+}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// NewFake creates a Fake clock starting at now.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now returns the current time of the Fake clock.
+func (c *Fake) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// AfterFunc schedules f to be called by Advance or Set once the time reaches now plus d.
+func (c *Fake) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{c: c, f: f}
+	c.schedule(t, d)
+	return t
+}
+
+// Advance moves the time forward by d, and calls the functions due meanwhile in the order of their time,
+// with the time set to the due time of each, so the functions scheduled by them are also called if due.
+func (c *Fake) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set moves the time to t, calling the due functions as Advance, it does nothing if t is before the current time.
+func (c *Fake) Set(t time.Time) {
+	for {
+		c.mu.Lock()
+		if len(c.timers) == 0 || c.timers[0].at.After(t) {
+			if t.After(c.now) {
+				c.now = t
+			}
+			c.mu.Unlock()
+			return
+		}
+		next := c.timers[0]
+		c.timers = c.timers[1:]
+		if next.at.After(c.now) {
+			c.now = next.at
+		}
+		c.mu.Unlock()
+
+		next.f()
+	}
+}
+
+// Len returns the number of the functions scheduled and not called yet.
+func (c *Fake) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// schedule inserts the Timer ordered by its time, c.mu must be held.
+func (c *Fake) schedule(t *fakeTimer, d time.Duration) {
+	c.seq++
+	t.at, t.seq = c.now.Add(d), c.seq
+	i := sort.Search(
+		len(c.timers), func(i int) bool {
+			return c.timers[i].at.After(t.at) || (c.timers[i].at.Equal(t.at) && c.timers[i].seq > t.seq)
+		},
+	)
+	c.timers = append(c.timers, nil)
+	copy(c.timers[i+1:], c.timers[i:])
+	c.timers[i] = t
+}
+
+// remove removes the Timer, it returns false if the Timer is not scheduled, c.mu must be held.
+func (c *Fake) remove(t *fakeTimer) bool {
+	for i, ti := range c.timers {
+		if ti == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	return t.c.remove(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	active := t.c.remove(t)
+	t.c.schedule(t, d)
+	return active
+}
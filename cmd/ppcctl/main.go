@@ -0,0 +1,289 @@
+// Command ppcctl talks to the admin API of a ppcserver deployment, so that the common operations are scriptable:
+//
+//	ppcctl -addr http://localhost:7070 -token $TOKEN clients -uid alice
+//	ppcctl session 42
+//	ppcctl tail 42
+//	ppcctl kick -uid alice -reason banned
+//	ppcctl broadcast -room lobby notice '{"text":"restarting in 5 minutes"}'
+//	ppcctl drain on
+//	ppcctl loglevel debug
+//
+// The token defaults to the PPCCTL_TOKEN environment variable. The responses are printed as indented JSON,
+// and an error response exits with status 1.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/pom-pom-crafts/ppcserver/admin"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const usage = `usage: ppcctl [-addr url] [-token token] <command> [args]
+
+commands:
+  clients [-tenant t] [-uid uid] [-state state] [-room room] [-tag tag] [-limit n]
+                                    list the clients
+  session <client id>               inspect the session of a client
+  tail <client id>                  print the messages of a client as JSON lines until it is closed
+  kick [-tenant t] [-reason r] (-uid uid | -id client id)
+                                    disconnect the clients
+  broadcast [-tenant t] [-room room | -tag tag] <route> [json data]
+                                    push a message to a room, the clients with a tag, or all the clients
+  drain [on|off]                    show or toggle the drain mode
+  loglevel [level]                  show or change the log level
+`
+
+// client is an admin API client.
+type client struct {
+	addr  string
+	token string
+	http  *http.Client
+}
+
+func main() {
+	addr := flag.String("addr", "http://localhost:7070", "base URL of the admin API")
+	token := flag.String("token", os.Getenv("PPCCTL_TOKEN"), "bearer token of the admin API, default $PPCCTL_TOKEN")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout of each request")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage, "\nflags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c := &client{addr: strings.TrimSuffix(*addr, "/"), token: *token, http: &http.Client{Timeout: *timeout}}
+	cmd, args := flag.Arg(0), flag.Args()[1:]
+
+	var err error
+	switch cmd {
+	case "clients":
+		err = c.clients(args)
+	case "session":
+		err = c.session(args)
+	case "tail":
+		err = c.tail(args)
+	case "kick":
+		err = c.kick(args)
+	case "broadcast":
+		err = c.broadcast(args)
+	case "drain":
+		err = c.drain(args)
+	case "loglevel":
+		err = c.logLevel(args)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ppcctl:", err)
+		os.Exit(1)
+	}
+}
+
+func (c *client) clients(args []string) error {
+	fs := flag.NewFlagSet("clients", flag.ExitOnError)
+	tenant := fs.String("tenant", "", "only the clients of the tenant")
+	uid := fs.String("uid", "", "only the clients authorized as the uid")
+	state := fs.String("state", "", "only the clients in the state, such as authorized")
+	room := fs.String("room", "", "only the clients in the room")
+	tag := fs.String("tag", "", "only the clients with the tag")
+	limit := fs.Int("limit", 0, "at most the number of clients, 0 for all")
+	_ = fs.Parse(args)
+
+	q := url.Values{}
+	for k, v := range map[string]string{"tenant": *tenant, "uid": *uid, "state": *state, "room": *room, "tag": *tag} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	if *limit > 0 {
+		q.Set("limit", strconv.Itoa(*limit))
+	}
+	path := "/admin/clients"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	var infos []admin.ClientInfo
+	return c.call(http.MethodGet, path, nil, &infos)
+}
+
+func (c *client) session(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: session <client id>")
+	}
+	if _, err := strconv.ParseUint(args[0], 10, 64); err != nil {
+		return fmt.Errorf("invalid client id %q", args[0])
+	}
+	var info admin.ClientInfo
+	return c.call(http.MethodGet, "/admin/clients/"+args[0], nil, &info)
+}
+
+// tail prints the data of the server-sent events of the client as JSON lines, without the request timeout.
+func (c *client) tail(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: tail <client id>")
+	}
+	if _, err := strconv.ParseUint(args[0], 10, 64); err != nil {
+		return fmt.Errorf("invalid client id %q", args[0])
+	}
+	path := "/admin/clients/" + args[0] + "/tail"
+	res, err := c.do(&http.Client{}, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	sc := bufio.NewScanner(res.Body)
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	event := ""
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: ") && event == "":
+			fmt.Println(strings.TrimPrefix(line, "data: "))
+		case line == "":
+			event = ""
+		}
+	}
+	return sc.Err()
+}
+
+func (c *client) kick(args []string) error {
+	fs := flag.NewFlagSet("kick", flag.ExitOnError)
+	var req admin.KickRequest
+	fs.StringVar(&req.Tenant, "tenant", "", "tenant of the uid")
+	fs.StringVar(&req.UID, "uid", "", "disconnect all the clients authorized as the uid")
+	fs.Uint64Var(&req.ClientID, "id", 0, "disconnect the client with the id")
+	fs.StringVar(&req.Reason, "reason", "", "reason told to the clients")
+	_ = fs.Parse(args)
+	if req.UID == "" && req.ClientID == 0 {
+		return errors.New("kick: -uid or -id is required")
+	}
+	var resp admin.KickResponse
+	return c.call(http.MethodPost, "/admin/kick", req, &resp)
+}
+
+func (c *client) broadcast(args []string) error {
+	fs := flag.NewFlagSet("broadcast", flag.ExitOnError)
+	var req admin.BroadcastRequest
+	fs.StringVar(&req.Tenant, "tenant", "", "only the clients of the tenant")
+	fs.StringVar(&req.Room, "room", "", "push to the room instead of all the clients")
+	fs.StringVar(&req.Tag, "tag", "", "push to the clients with the tag instead of all the clients")
+	_ = fs.Parse(args)
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return errors.New("usage: broadcast [-tenant t] [-room room | -tag tag] <route> [json data]")
+	}
+	req.Route = fs.Arg(0)
+	if data := fs.Arg(1); data != "" {
+		if !json.Valid([]byte(data)) {
+			return errors.New("broadcast: data is not valid JSON")
+		}
+		req.Data = json.RawMessage(data)
+	}
+	return c.call(http.MethodPost, "/admin/broadcast", req, nil)
+}
+
+func (c *client) drain(args []string) error {
+	var resp admin.DrainRequest
+	switch {
+	case len(args) == 0:
+		return c.call(http.MethodGet, "/admin/drain", nil, &resp)
+	case len(args) == 1 && (args[0] == "on" || args[0] == "off"):
+		return c.call(http.MethodPost, "/admin/drain", admin.DrainRequest{Enabled: args[0] == "on"}, &resp)
+	default:
+		return errors.New("usage: drain [on|off]")
+	}
+}
+
+func (c *client) logLevel(args []string) error {
+	var resp admin.LogLevelResponse
+	switch len(args) {
+	case 0:
+		return c.call(http.MethodGet, "/admin/loglevel", nil, &resp)
+	case 1:
+		return c.call(http.MethodPost, "/admin/loglevel", admin.LogLevelRequest{Level: args[0]}, &resp)
+	default:
+		return errors.New("usage: loglevel [level]")
+	}
+}
+
+// call sends the request with the JSON encoded body if not nil, and prints the response decoded into resp
+// as indented JSON.
+func (c *client) call(method, path string, body, resp interface{}) error {
+	res, err := c.do(c.http, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if resp == nil || len(bytes.TrimSpace(b)) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(b, resp); err != nil {
+		return fmt.Errorf("%s %s: decode response: %w", method, path, err)
+	}
+	out, err := json.MarshalIndent(resp, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+// do sends the request with the JSON encoded body if not nil by hc. It returns the error of the admin API
+// for a non-2xx response, otherwise the caller closes the body of the response.
+func (c *client) do(hc *http.Client, method, path string, body interface{}) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, c.addr+path, r)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res, nil
+	}
+	defer res.Body.Close()
+	var e struct {
+		Error string `json:"error"`
+	}
+	if b, _ := io.ReadAll(res.Body); json.Unmarshal(b, &e) == nil && e.Error != "" {
+		return nil, fmt.Errorf("%s %s: %s", method, path, e.Error)
+	}
+	return nil, fmt.Errorf("%s %s: %s", method, path, res.Status)
+}
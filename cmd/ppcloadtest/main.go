@@ -0,0 +1,114 @@
+// Command ppcloadtest spins up simulated clients against a ppcserver connector and reports
+// the round-trip latency percentiles and resource usage.
+//
+// Run against an in-process echo server:
+//
+//	go run ./cmd/ppcloadtest -serve -clients 1000 -rate 20 -duration 30s
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/loadtest"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"log"
+	"net/http"
+	"net/url"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func main() {
+	cfg := loadtest.DefaultConfig()
+	flag.StringVar(&cfg.URL, "url", cfg.URL, "server URL, ws://host:port/path or tcp://host:port")
+	flag.IntVar(&cfg.Clients, "clients", cfg.Clients, "number of concurrent clients")
+	flag.Float64Var(&cfg.Rate, "rate", cfg.Rate, "messages per second per client, 0 for closed-loop")
+	flag.IntVar(&cfg.PayloadSize, "payload", cfg.PayloadSize, "payload size in bytes")
+	flag.StringVar(&cfg.Route, "route", cfg.Route, "route of the messages, which should respond")
+	flag.DurationVar(&cfg.Duration, "duration", cfg.Duration, "duration of the load")
+	flag.DurationVar(&cfg.RampUp, "rampup", cfg.RampUp, "duration to spread the initial connects")
+	flag.DurationVar(&cfg.Churn, "churn", cfg.Churn, "average connection lifetime before reconnecting, 0 disables")
+	flag.DurationVar(&cfg.Timeout, "timeout", cfg.Timeout, "connect and response timeout")
+	serve := flag.Bool("serve", false, "start an in-process echo server at -url")
+	eventLoop := flag.Int("eventloop", 0, "number of event loop pollers of the in-process tcp server")
+	flushers := flag.Int("flushers", 0, "number of shared write flushers of the in-process server")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if *serve {
+		if err := startEchoServer(ctx, cfg.URL, *eventLoop, *flushers); err != nil {
+			log.Fatalln("ppcloadtest: start echo server error:", err)
+		}
+	}
+
+	report, err := loadtest.Run(ctx, cfg)
+	if err != nil {
+		log.Fatalln("ppcloadtest:", err)
+	}
+	fmt.Print(report)
+	if *serve {
+		s := connector.CollectStats()
+		fmt.Printf("server:      clients %d, received %d, sent %d, dropped %d\n",
+			s.NumClients, s.MessagesReceived, s.MessagesSent, s.DroppedMessages)
+	}
+}
+
+// startEchoServer starts a connector at rawURL with an "echo" route responding with the data received.
+func startEchoServer(ctx context.Context, rawURL string, eventLoopPollers, writeFlushers int) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	r := connector.NewRouter()
+	r.Handle(
+		"echo", func(_ context.Context, _ *connector.Client, m *connector.Message) (any, error) {
+			// m.Data must not be retained after the handler returns, so copy it to the response.
+			return json.RawMessage(append([]byte(nil), m.Data...)), nil
+		},
+	)
+	opts := []connector.Option{
+		connector.WithAddr(u.Host),
+		connector.WithRouter(r),
+		connector.WithWriteFlushers(writeFlushers),
+		connector.WithLogger(logging.Nop()),
+	}
+
+	var c interface {
+		Start(ctx context.Context) error
+		Ready() error
+	}
+	if u.Scheme == "tcp" {
+		c = connector.NewTCPConnector(append(opts, connector.WithEventLoop(eventLoopPollers))...)
+	} else {
+		path := u.Path
+		if path == "" || !strings.HasPrefix(path, "/") {
+			path = "/"
+		}
+		c = connector.NewWebsocketConnector(
+			append(opts, connector.WithHTTPServeMux(http.NewServeMux()), connector.WithWebsocketPath(path))...,
+		)
+	}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- c.Start(ctx) }()
+	deadline := time.Now().Add(3 * time.Second)
+	for c.Ready() != nil {
+		select {
+		case err := <-errCh:
+			return err
+		case <-time.After(10 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			return c.Ready()
+		}
+	}
+	return nil
+}
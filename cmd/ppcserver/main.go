@@ -0,0 +1,29 @@
+// Command ppcserver runs a ppcserver deployment configured by a JSON file, forwarding the routes to the backend
+// gRPC services, until SIGINT/SIGTERM is received:
+//
+//	go run ./cmd/ppcserver -config cmd/ppcserver/ppcserver.example.json
+//
+// See the config package for the format. The redisstore extensions are linked in, so they are configured by name.
+package main
+
+import (
+	"flag"
+	"github.com/pom-pom-crafts/ppcserver/config"
+	_ "github.com/pom-pom-crafts/ppcserver/redisstore"
+	"log"
+)
+
+func main() {
+	path := flag.String("config", "ppcserver.json", "path of the JSON config file")
+	flag.Parse()
+
+	cfg, err := config.Load(*path)
+	if err != nil {
+		log.Fatalln("ppcserver:", err)
+	}
+	s, err := cfg.NewServer(nil)
+	if err != nil {
+		log.Fatalln("ppcserver:", err)
+	}
+	s.Start()
+}
@@ -0,0 +1,113 @@
+// Command protoc-gen-ppcserver generates the connector.ServiceDesc of the protobuf services, so that the routes are
+// handled by a typed interface instead of the stringly-typed route names:
+//
+//	protoc --go_out=. --ppcserver_out=. battle.proto
+//
+// For a service Battle in the package battle, it generates the interface BattleServer with a method per rpc, and
+// RegisterBattleServer registering an implementation to a connector.Router as the routes "battle.Battle.<Method>".
+// The messages are encoded by the Codec of the Client, so the proto messages should be used with a protobuf Codec.
+// The streaming rpcs are not supported and skipped.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"google.golang.org/protobuf/compiler/protogen"
+)
+
+const (
+	contextPackage   = protogen.GoImportPath("context")
+	connectorPackage = protogen.GoImportPath("github.com/pom-pom-crafts/ppcserver/connector")
+)
+
+func main() {
+	var flags flag.FlagSet
+	protogen.Options{ParamFunc: flags.Set}.Run(
+		func(gen *protogen.Plugin) error {
+			for _, f := range gen.Files {
+				if f.Generate && len(f.Services) > 0 {
+					generateFile(gen, f)
+				}
+			}
+			return nil
+		},
+	)
+}
+
+// generateFile generates the file "<name>_ppcserver.pb.go" next to the file generated by protoc-gen-go.
+func generateFile(gen *protogen.Plugin, file *protogen.File) {
+	g := gen.NewGeneratedFile(file.GeneratedFilenamePrefix+"_ppcserver.pb.go", file.GoImportPath)
+	g.P("// Code generated by protoc-gen-ppcserver. DO NOT EDIT.")
+	g.P("// source: ", file.Desc.Path())
+	g.P()
+	g.P("package ", file.GoPackageName)
+	g.P()
+	for _, s := range file.Services {
+		generateService(g, file, s)
+	}
+}
+
+func generateService(g *protogen.GeneratedFile, file *protogen.File, s *protogen.Service) {
+	serverName := s.GoName + "Server"
+	descName := s.GoName + "_ServiceDesc"
+	var methods []*protogen.Method
+	for _, m := range s.Methods {
+		if m.Desc.IsStreamingClient() || m.Desc.IsStreamingServer() {
+			continue
+		}
+		methods = append(methods, m)
+	}
+
+	g.P("// ", serverName, " is the server API of the ", s.Desc.FullName(), " service.")
+	g.P("type ", serverName, " interface {")
+	for _, m := range methods {
+		g.P(m.Comments.Leading, m.GoName, "(ctx ", g.QualifiedGoIdent(contextPackage.Ident("Context")),
+			", c *", g.QualifiedGoIdent(connectorPackage.Ident("Client")),
+			", req *", g.QualifiedGoIdent(m.Input.GoIdent), ") (*", g.QualifiedGoIdent(m.Output.GoIdent), ", error)")
+	}
+	g.P("}")
+	g.P()
+
+	g.P("// Register", serverName, " registers the ", s.Desc.FullName(), " service implemented by srv to the Router.")
+	g.P("func Register", serverName, "(r *", g.QualifiedGoIdent(connectorPackage.Ident("Router")), ", srv ",
+		serverName, ") {")
+	g.P("r.RegisterService(&", descName, ", srv)")
+	g.P("}")
+	g.P()
+
+	for _, m := range methods {
+		g.P("func _", s.GoName, "_", m.GoName, "_Handler(srv interface{}, ctx ",
+			g.QualifiedGoIdent(contextPackage.Ident("Context")), ", c *",
+			g.QualifiedGoIdent(connectorPackage.Ident("Client")), ", dec func(interface{}) error) (interface{}, error) {")
+		g.P("in := new(", g.QualifiedGoIdent(m.Input.GoIdent), ")")
+		g.P("if err := dec(in); err != nil {")
+		g.P("return nil, err")
+		g.P("}")
+		g.P("out, err := srv.(", serverName, ").", m.GoName, "(ctx, c, in)")
+		g.P("if err != nil {")
+		g.P("return nil, err")
+		g.P("}")
+		g.P("return out, nil")
+		g.P("}")
+		g.P()
+	}
+
+	g.P("// ", descName, " is the ", g.QualifiedGoIdent(connectorPackage.Ident("ServiceDesc")), " of the ",
+		s.Desc.FullName(), " service.")
+	g.P("var ", descName, " = ", g.QualifiedGoIdent(connectorPackage.Ident("ServiceDesc")), "{")
+	g.P("ServiceName: ", fmt.Sprintf("%q", s.Desc.FullName()), ",")
+	g.P("HandlerType: (*", serverName, ")(nil),")
+	g.P("Methods: []", g.QualifiedGoIdent(connectorPackage.Ident("MethodDesc")), "{")
+	for _, m := range methods {
+		g.P("{")
+		g.P("MethodName: ", fmt.Sprintf("%q", m.Desc.Name()), ",")
+		g.P("Handler: _", s.GoName, "_", m.GoName, "_Handler,")
+		g.P("Request: (*", g.QualifiedGoIdent(m.Input.GoIdent), ")(nil),")
+		g.P("Response: (*", g.QualifiedGoIdent(m.Output.GoIdent), ")(nil),")
+		g.P("},")
+	}
+	g.P("},")
+	g.P("Metadata: ", fmt.Sprintf("%q", file.Desc.Path()), ",")
+	g.P("}")
+	g.P()
+}
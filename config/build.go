@@ -0,0 +1,189 @@
+package config
+
+import (
+	"context"
+	"github.com/pom-pom-crafts/ppcserver"
+	"github.com/pom-pom-crafts/ppcserver/admin"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/debug"
+	"github.com/pom-pom-crafts/ppcserver/extension"
+	"github.com/pom-pom-crafts/ppcserver/forward"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"github.com/pom-pom-crafts/ppcserver/metrics/statsd"
+	"github.com/pom-pom-crafts/ppcserver/pushapi"
+	"net/http"
+	"time"
+)
+
+// closer is a Component closing a resource once the Server shuts down, such as the forward.Pool.
+type closer func() error
+
+func (closer) Start(_ context.Context) error {
+	return nil
+}
+
+func (c closer) Shutdown(_ context.Context) error {
+	return c()
+}
+
+// NewServer wires a ppcserver.Server from the Config, with the routes of the Config forwarded to the backends
+// in addition to the routes of router, which may be nil. The health endpoints are served at /livez, /readyz,
+// and /healthz of the WebSocket listener if any.
+func (c *Config) NewServer(router *connector.Router) (*ppcserver.Server, error) {
+	logger, err := c.logger()
+	if err != nil {
+		return nil, err
+	}
+	if router == nil {
+		router = connector.NewRouter()
+	}
+	pool := forward.NewPool(forward.WithLogger(logger))
+	if err := pool.Apply(router, c.Routes); err != nil {
+		return nil, err
+	}
+	connectorOpts, err := c.connectorOptions(router, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []ppcserver.ServerOption{ppcserver.WithLogger(logger), ppcserver.WithComponent(closer(pool.Close))}
+	if c.ShutdownTimeout > 0 {
+		opts = append(opts, ppcserver.WithShutdownTimeout(time.Duration(c.ShutdownTimeout)))
+	}
+	var mux *http.ServeMux
+	if l := c.Websocket; l != nil {
+		mux = http.NewServeMux()
+		wsOpts := append(connectorOpts, connector.WithAddr(l.Addr), connector.WithHTTPServeMux(mux))
+		if l.Path != "" {
+			wsOpts = append(wsOpts, connector.WithWebsocketPath(l.Path))
+		}
+		opts = append(opts, ppcserver.WithComponent(connector.NewWebsocketConnector(wsOpts...)))
+	}
+	if l := c.TCP; l != nil {
+		tcpOpts := append(connectorOpts[:len(connectorOpts):len(connectorOpts)], connector.WithAddr(l.Addr))
+		if l.EventLoop > 0 {
+			tcpOpts = append(tcpOpts, connector.WithEventLoop(l.EventLoop))
+		}
+		opts = append(opts, ppcserver.WithComponent(connector.NewTCPConnector(tcpOpts...)))
+	}
+	if e := c.Debug; e != nil {
+		opts = append(opts, ppcserver.WithComponent(debug.NewServer(debug.WithAddr(e.Addr))))
+	}
+	if e := c.Admin; e != nil {
+		opts = append(
+			opts, ppcserver.WithComponent(
+				admin.NewServer(
+					admin.WithAddr(e.Addr), admin.WithTokens(e.Tokens...), admin.WithLogger(logger),
+					admin.WithRouter(router, pool.Handler),
+				),
+			),
+		)
+	}
+	if e := c.PushAPI; e != nil {
+		opts = append(
+			opts, ppcserver.WithComponent(pushapi.NewServer(pushapi.WithAddr(e.Addr), pushapi.WithTokens(e.Tokens...))),
+		)
+	}
+	if s := c.StatsD; s != nil {
+		statsdOpts := []statsd.Option{statsd.WithInterval(time.Duration(s.Interval)), statsd.WithLogger(logger)}
+		if s.Addr != "" {
+			statsdOpts = append(statsdOpts, statsd.WithAddr(s.Addr))
+		}
+		if s.Prefix != "" {
+			statsdOpts = append(statsdOpts, statsd.WithPrefix(s.Prefix))
+		}
+		if s.DogStatsD {
+			statsdOpts = append(statsdOpts, statsd.WithDogStatsD(s.Tags...))
+		}
+		opts = append(opts, ppcserver.WithComponent(statsd.NewExporter(statsdOpts...)))
+	}
+
+	s := ppcserver.NewServer(opts...)
+	if mux != nil {
+		health := s.HealthHandler()
+		for _, path := range []string{"/livez", "/readyz", "/healthz"} {
+			mux.Handle(path, health)
+		}
+	}
+	return s, nil
+}
+
+// logger returns logging.Default() at the Log.Level, sampled if Log.Sampling is set.
+func (c *Config) logger() (logging.Logger, error) {
+	l := logging.Default()
+	if c.Log.Level != "" {
+		level, err := logging.ParseLevel(c.Log.Level)
+		if err != nil {
+			return nil, err
+		}
+		l.SetLevel(level)
+	}
+	if s := c.Log.Sampling; s != nil {
+		return logging.NewSampledLogger(l, time.Duration(s.Tick), s.First, s.Thereafter), nil
+	}
+	return l, nil
+}
+
+// connectorOptions returns the connector Options shared by the listeners, with the extensions instantiated.
+func (c *Config) connectorOptions(router *connector.Router, logger logging.Logger) ([]connector.Option, error) {
+	cc := c.Connector
+	opts := []connector.Option{
+		connector.WithRouter(router),
+		connector.WithLogger(logger),
+		connector.WithLogPayload(c.Log.PayloadLimit, c.Log.RedactRoutes...),
+		connector.WithWriteFlushers(cc.WriteFlushers),
+	}
+	if cc.MaxClients > 0 {
+		connector.SetMaxClients(cc.MaxClients)
+	}
+	if cc.MaxMessageSize > 0 {
+		opts = append(opts, connector.WithMaxMessageSize(cc.MaxMessageSize))
+	}
+	if cc.WriteTimeout > 0 {
+		opts = append(opts, connector.WithWriteTimeout(time.Duration(cc.WriteTimeout)))
+	}
+	if cc.HeartbeatInterval > 0 {
+		opts = append(opts, connector.WithHeartbeat(time.Duration(cc.HeartbeatInterval), cc.HeartbeatMissed))
+	}
+	if len(cc.ReplicatedMetadata) > 0 {
+		opts = append(opts, connector.WithReplicatedMetadata(cc.ReplicatedMetadata...))
+	}
+
+	ext := c.Extensions
+	if e := ext.Authenticator; e != nil {
+		a, err := extension.Authenticators.New(e.Name, e.Config)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, connector.WithAuthenticator(a))
+	}
+	if e := ext.SessionStore; e != nil {
+		s, err := extension.SessionStores.New(e.Name, e.Config)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, connector.WithSessionStore(s, time.Duration(cc.SessionTTL)))
+	}
+	if e := ext.OfflineStore; e != nil {
+		s, err := extension.OfflineStores.New(e.Name, e.Config)
+		if err != nil {
+			return nil, err
+		}
+		connector.SetOfflineStore(s)
+	}
+	if e := ext.MessageSink; e != nil {
+		s, err := extension.MessageSinks.New(e.Name, e.Config)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, connector.WithMessageSink(s, cc.MessageSinkRoutes...))
+	}
+	if e := ext.AuditSink; e != nil {
+		s, err := extension.AuditSinks.New(e.Name, e.Config)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, connector.WithAuditSink(s))
+	}
+	return opts, nil
+}
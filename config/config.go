@@ -0,0 +1,147 @@
+// Package config loads the JSON configuration of a ppcserver deployment and wires the Server from it,
+// with the listeners, the routes forwarded to the backends, the extensions by name, and the metrics,
+// as run by the cmd/ppcserver command. The ${VAR} references in the file are expanded from the environment,
+// such as for the tokens.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/pom-pom-crafts/ppcserver/extension"
+	"os"
+	"time"
+)
+
+var ErrNoListener = errors.New("ppcserver: config requires a websocket or tcp listener")
+
+type (
+	// Config is the configuration of a ppcserver deployment, the omitted sections are disabled.
+	Config struct {
+		Log             Log       `json:"log"`
+		ShutdownTimeout Duration  `json:"shutdown_timeout,omitempty"`
+		Websocket       *Listener `json:"websocket,omitempty"`
+		TCP             *Listener `json:"tcp,omitempty"`
+		Connector       Connector `json:"connector"`
+		// Routes map the routes to the backend gRPC services they are forwarded to, such as
+		// {"battle.*": "dns:///battle-service:9000"}.
+		Routes map[string]string `json:"routes,omitempty"`
+		// Extensions instantiate the connector extensions by the names registered to the extension package.
+		Extensions Extensions `json:"extensions"`
+		Debug      *Endpoint  `json:"debug,omitempty"`
+		Admin      *Endpoint  `json:"admin,omitempty"`
+		PushAPI    *Endpoint  `json:"push_api,omitempty"`
+		StatsD     *StatsD    `json:"statsd,omitempty"`
+	}
+
+	// Log configures the logging.
+	Log struct {
+		// Level is the minimum level, such as "debug", default is "info".
+		Level string `json:"level,omitempty"`
+		// Sampling bounds the entries with the same message per tick, see logging.NewSampledLogger.
+		Sampling *Sampling `json:"sampling,omitempty"`
+		// PayloadLimit and RedactRoutes configure the logged message data, see connector.WithLogPayload.
+		PayloadLimit int      `json:"payload_limit,omitempty"`
+		RedactRoutes []string `json:"redact_routes,omitempty"`
+	}
+
+	Sampling struct {
+		Tick       Duration `json:"tick"`
+		First      int      `json:"first"`
+		Thereafter int      `json:"thereafter"`
+	}
+
+	// Listener is a connector listening on the Addr, the Path is for the WebSocket only.
+	Listener struct {
+		Addr string `json:"addr"`
+		Path string `json:"path,omitempty"`
+		// EventLoop is the number of the event loop pollers of the TCP connector, zero disables it.
+		EventLoop int `json:"event_loop,omitempty"`
+	}
+
+	// Connector configures the connector Options shared by the listeners.
+	Connector struct {
+		MaxClients        int32    `json:"max_clients,omitempty"`
+		MaxMessageSize    int64    `json:"max_message_size,omitempty"`
+		WriteTimeout      Duration `json:"write_timeout,omitempty"`
+		WriteFlushers     int      `json:"write_flushers,omitempty"`
+		HeartbeatInterval Duration `json:"heartbeat_interval,omitempty"`
+		HeartbeatMissed   int      `json:"heartbeat_missed,omitempty"`
+		SessionTTL        Duration `json:"session_ttl,omitempty"`
+		// MessageSinkRoutes are the routes persisted to Extensions.MessageSink, all the routes if empty.
+		MessageSinkRoutes []string `json:"message_sink_routes,omitempty"`
+		// ReplicatedMetadata are the Client metadata keys saved in the Session and forwarded to the backends.
+		ReplicatedMetadata []string `json:"replicated_metadata,omitempty"`
+	}
+
+	// Extensions are the connector extensions instantiated by name.
+	Extensions struct {
+		Authenticator *Extension `json:"authenticator,omitempty"`
+		SessionStore  *Extension `json:"session_store,omitempty"`
+		OfflineStore  *Extension `json:"offline_store,omitempty"`
+		MessageSink   *Extension `json:"message_sink,omitempty"`
+		AuditSink     *Extension `json:"audit_sink,omitempty"`
+	}
+
+	// Extension is an extension registered as the Name, created with the Config.
+	Extension struct {
+		Name   string           `json:"name"`
+		Config extension.Config `json:"config,omitempty"`
+	}
+
+	// Endpoint is an HTTP server listening on the Addr, with the bearer Tokens if it requires any.
+	Endpoint struct {
+		Addr   string   `json:"addr,omitempty"`
+		Tokens []string `json:"tokens,omitempty"`
+	}
+
+	// StatsD configures the statsd.Exporter.
+	StatsD struct {
+		Addr      string   `json:"addr,omitempty"`
+		Prefix    string   `json:"prefix,omitempty"`
+		Interval  Duration `json:"interval,omitempty"`
+		DogStatsD bool     `json:"dogstatsd,omitempty"`
+		Tags      []string `json:"tags,omitempty"`
+	}
+
+	// Duration is a time.Duration in the format of time.ParseDuration in JSON, such as "30s".
+	Duration time.Duration
+)
+
+// Load reads the Config from the JSON file at the path, with the ${VAR} references expanded from the environment.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse decodes the Config from the JSON data, with the ${VAR} references expanded from the environment.
+func Parse(data []byte) (*Config, error) {
+	cfg := &Config{}
+	if err := json.Unmarshal([]byte(os.ExpandEnv(string(data))), cfg); err != nil {
+		return nil, fmt.Errorf("ppcserver: parse config error: %w", err)
+	}
+	if cfg.Websocket == nil && cfg.TCP == nil {
+		return nil, ErrNoListener
+	}
+	return cfg, nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
@@ -0,0 +1,207 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"net"
+)
+
+const (
+	// RouteAck is the route of the Message sent by the peer to acknowledge a push sent by Client.PushWithAck,
+	// with the Message.Seq of the push. It is handled before the Router.
+	RouteAck = "ack"
+
+	// RouteResume is the route of the Message sent by the authorized peer to resume its previous Session,
+	// with a ResumeRequest as the data. It is handled before the Router. On success, the pushes of the Session
+	// still pending for ACK are sent again after the response.
+	RouteResume = "resume"
+)
+
+// AckStatus is the delivery status of a push sent by Client.PushWithAck.
+type AckStatus int
+
+const (
+	// AckStatusUnknown means the push was never sent in the Session.
+	AckStatusUnknown AckStatus = iota
+	// AckStatusPending means the push is sent but not acknowledged by the peer yet.
+	AckStatusPending
+	// AckStatusAcked means the push is acknowledged by the peer.
+	AckStatusAcked
+)
+
+// ResumeRequest is the data of the RouteResume Message sent by the peer.
+type ResumeRequest struct {
+	// SessionID is the resume token, the Client.SessionID of the previous connection.
+	SessionID string `json:"session_id"`
+}
+
+// String returns the name of the AckStatus.
+func (s AckStatus) String() string {
+	switch s {
+	case AckStatusPending:
+		return "pending"
+	case AckStatusAcked:
+		return "acked"
+	default:
+		return "unknown"
+	}
+}
+
+// AckStatus returns the delivery status of the push with the seq sent by Client.PushWithAck in the Session.
+func (s *Session) AckStatus(seq uint64) AckStatus {
+	if seq == 0 || seq > s.AckSeq {
+		return AckStatusUnknown
+	}
+	for _, p := range s.PendingAcks {
+		if p.Seq == seq {
+			return AckStatusPending
+		}
+	}
+	return AckStatusAcked
+}
+
+// AckStatus returns the delivery status of the push with the seq sent by PushWithAck in the Session of the Client.
+func (c *Client) AckStatus(seq uint64) AckStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.session == nil {
+		return AckStatusUnknown
+	}
+	return c.session.AckStatus(seq)
+}
+
+// PushWithAck pushes a one-way Message with the route and the encoded v, flagged with Message.Ack for the peer
+// to acknowledge by a RouteAck Message with the returned Message.Seq, for the critical pushes such as payments
+// and rewards. The push is saved to the Session before it is written, and sent again whenever the Session is
+// resumed until acknowledged, so the peer should deduplicate by Seq.
+// It returns ErrUnauthorized if the Client is not authorized. A write error still returns the Seq,
+// since the push is pending and sent again on resume.
+func (c *Client) PushWithAck(ctx context.Context, route string, v interface{}) (uint64, error) {
+	var payload []byte
+	if v != nil {
+		var err error
+		if payload, err = c.codec().Marshal(v); err != nil {
+			return 0, err
+		}
+	}
+
+	var p PendingAck
+	err := c.updateSession(
+		ctx, func(s *Session) {
+			s.AckSeq++
+			p = PendingAck{Seq: s.AckSeq, Route: route, Data: payload, SentAt: now()}
+			s.PendingAcks = append(s.PendingAcks, p)
+		},
+	)
+	if err != nil {
+		if p.Seq == 0 {
+			return 0, err
+		}
+		// The push is still pending in the Session of the Client, but it is lost if the process restarts.
+		c.Logger().Error("SessionStore.Save() error", logging.Err(err))
+	}
+	return p.Seq, c.writePendingAck(p)
+}
+
+// writePendingAck writes the push pending for ACK to the peer.
+func (c *Client) writePendingAck(p PendingAck) error {
+	data, err := c.codec().Marshal(&Message{Seq: p.Seq, Route: p.Route, Data: p.Data, Ack: true})
+	if err != nil {
+		return err
+	}
+	if err := c.writeBuffers(net.Buffers{data}); err != nil {
+		return err
+	}
+	c.persistPush(p.Route, json.RawMessage(p.Data))
+	return nil
+}
+
+// handleAck removes the push acknowledged by the RouteAck Message from the Session,
+// it returns false for the other messages.
+func (c *Client) handleAck(ctx context.Context, m *Message) bool {
+	if m.Route != RouteAck {
+		return false
+	}
+
+	err := c.updateSession(
+		ctx, func(s *Session) {
+			for i, p := range s.PendingAcks {
+				if p.Seq == m.Seq {
+					s.PendingAcks = append(s.PendingAcks[:i], s.PendingAcks[i+1:]...)
+					return
+				}
+			}
+		},
+	)
+	if err != nil && !errors.Is(err, ErrUnauthorized) {
+		c.Logger().Error("SessionStore.Save() error", logging.Err(err))
+	}
+	if m.ID != 0 {
+		_ = c.respond(m, nil, err)
+	}
+	return true
+}
+
+// handleResume replaces the Session of the Client by the previous Session of the same uid in the ResumeRequest,
+// and sends again its pushes pending for ACK, it returns false for the other messages.
+func (c *Client) handleResume(ctx context.Context, m *Message) bool {
+	if m.Route != RouteResume {
+		return false
+	}
+
+	sess, err := c.resumeSession(ctx, m)
+	if m.ID != 0 {
+		_ = c.respond(m, nil, err)
+	}
+	if err != nil {
+		c.Logger().Info("Client resume session failed", logging.Err(err))
+		return true
+	}
+
+	for _, p := range sess.PendingAcks {
+		if err := c.writePendingAck(p); err != nil {
+			break
+		}
+	}
+	return true
+}
+
+// resumeSession loads the Session in the RouteResume Message m and makes it the Session of the Client,
+// it returns a copy of the resumed Session.
+func (c *Client) resumeSession(ctx context.Context, m *Message) (*Session, error) {
+	var req ResumeRequest
+	if err := c.codec().Unmarshal(m.Data, &req); err != nil {
+		return nil, err
+	}
+	uid := c.UID()
+	if uid == "" {
+		return nil, ErrUnauthorized
+	}
+
+	sess, err := c.opts.SessionStore.Load(ctx, req.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	// A Session of another user is treated as not found, so that the resume token can't be probed.
+	if sess.UID != uid {
+		return nil, ErrSessionNotFound
+	}
+
+	c.mu.Lock()
+	prev := c.session
+	c.session = sess
+	c.restoreDeliveredKeys(sess.DeliveredKeys)
+	c.restoreMetadata(sess.Metadata)
+	c.mu.Unlock()
+	if prev != nil && prev.ID != sess.ID {
+		if err := c.opts.SessionStore.Delete(ctx, prev.ID); err != nil {
+			c.Logger().Error("SessionStore.Delete() error", logging.Err(err))
+		}
+	}
+
+	resumed := *sess
+	resumed.PendingAcks = append([]PendingAck(nil), sess.PendingAcks...)
+	return &resumed, nil
+}
@@ -0,0 +1,204 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CloseCodeOverloaded closes a new Client rejected by the AdmissionController, see SetAdmissionController.
+const CloseCodeOverloaded CloseCode = 4005
+
+var ErrOverloaded = errors.New("ppcserver: server is overloaded")
+
+// admission holds the admissionHolder of the AdmissionController set by SetAdmissionController.
+var admission atomic.Value
+
+type (
+	// AdmissionLimits are the thresholds of the load above which the AdmissionController refuses new clients,
+	// a zero threshold is not checked.
+	AdmissionLimits struct {
+		// MaxCPU is the CPU usage of the process, as a fraction of the GOMAXPROCS cores, such as 0.8.
+		// It's only measured on Linux and macOS.
+		MaxCPU float64
+		// MaxHeapBytes is the bytes of the allocated heap objects.
+		MaxHeapBytes uint64
+		// MaxSchedulerLag is the delay of the sampling ticks, which grows as the runtime is starved,
+		// so it reflects the latency of the existing clients.
+		MaxSchedulerLag time.Duration
+		// SampleInterval is the interval of sampling the load. Default is 1 second if zero.
+		SampleInterval time.Duration
+		// MaxDefer is the maximum time a new Client waits for the load to drop before being rejected,
+		// zero rejects it at once. The TCPConnector with Options.EventLoopPollers stops accepting while waiting.
+		MaxDefer time.Duration
+	}
+
+	// LoadSample is a sample of the load of the process.
+	LoadSample struct {
+		At           time.Time
+		CPU          float64
+		HeapBytes    uint64
+		SchedulerLag time.Duration
+	}
+
+	// AdmissionController samples the load of the process, and refuses or defers the new clients while the load
+	// exceeds its AdmissionLimits, so that the latency of the existing clients is protected instead of
+	// degrading all the clients equally. It's a Component that reports not ready while overloaded,
+	// and is applied to the connectors by SetAdmissionController.
+	AdmissionController struct {
+		limits     AdmissionLimits
+		logger     logging.Logger
+		sample     atomic.Value // sample holds the latest LoadSample.
+		mu         sync.Mutex   // mu guards overloaded and recovered.
+		overloaded error        // overloaded is the threshold exceeded by the latest LoadSample, nil if none.
+		recovered  chan struct{}
+	}
+
+	admissionHolder struct {
+		a *AdmissionController
+	}
+)
+
+// NewAdmissionController creates a new AdmissionController with the limits, which should be registered to the Server
+// by ppcserver.WithComponent to sample the load, and to the connectors by SetAdmissionController.
+func NewAdmissionController(limits AdmissionLimits, logger logging.Logger) *AdmissionController {
+	if limits.SampleInterval <= 0 {
+		limits.SampleInterval = 1 * time.Second
+	}
+	if logger == nil {
+		logger = logging.Default()
+	}
+	a := &AdmissionController{
+		limits: limits,
+		logger: logger,
+	}
+	a.sample.Store(LoadSample{})
+	return a
+}
+
+// SetAdmissionController sets the AdmissionController checked by the connectors for each new Client,
+// nil disables the admission control.
+func SetAdmissionController(a *AdmissionController) {
+	admission.Store(admissionHolder{a: a})
+}
+
+func loadAdmissionController() *AdmissionController {
+	h, _ := admission.Load().(admissionHolder)
+	return h.a
+}
+
+// Start samples the load every AdmissionLimits.SampleInterval, and blocks until ctx is done.
+func (a *AdmissionController) Start(ctx context.Context) error {
+	cpu := newCPUSampler()
+	interval := a.limits.SampleInterval
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	expected := time.Now().Add(interval)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case at := <-timer.C:
+			var ms runtime.MemStats
+			runtime.ReadMemStats(&ms)
+			s := LoadSample{At: at, CPU: cpu.sample(at), HeapBytes: ms.HeapAlloc}
+			if lag := at.Sub(expected); lag > 0 {
+				s.SchedulerLag = lag
+			}
+			a.update(s)
+
+			expected = time.Now().Add(interval)
+			timer.Reset(interval)
+		}
+	}
+}
+
+// Shutdown does nothing, as Start returns once its ctx is done.
+func (a *AdmissionController) Shutdown(_ context.Context) error {
+	return nil
+}
+
+// Ready returns the exceeded threshold as an error while overloaded, so that the load balancers
+// steer the new connections to the other servers.
+func (a *AdmissionController) Ready() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.overloaded
+}
+
+// Sample returns the latest LoadSample.
+func (a *AdmissionController) Sample() LoadSample {
+	return a.sample.Load().(LoadSample)
+}
+
+// Overloaded reports whether the latest LoadSample exceeds any of the AdmissionLimits.
+func (a *AdmissionController) Overloaded() bool {
+	return a.Ready() != nil
+}
+
+// update records the LoadSample, and wakes the deferred clients once the load drops.
+func (a *AdmissionController) update(s LoadSample) {
+	a.sample.Store(s)
+
+	var err error
+	switch l := a.limits; {
+	case l.MaxCPU > 0 && s.CPU > l.MaxCPU:
+		err = errors.New("ppcserver: cpu usage exceeds the admission limit")
+	case l.MaxHeapBytes > 0 && s.HeapBytes > l.MaxHeapBytes:
+		err = errors.New("ppcserver: heap bytes exceed the admission limit")
+	case l.MaxSchedulerLag > 0 && s.SchedulerLag > l.MaxSchedulerLag:
+		err = errors.New("ppcserver: scheduler lag exceeds the admission limit")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch {
+	case err != nil && a.overloaded == nil:
+		a.logger.Warn("AdmissionController overloaded", logging.Err(err))
+		a.recovered = make(chan struct{})
+	case err == nil && a.overloaded != nil:
+		a.logger.Info("AdmissionController recovered")
+		close(a.recovered)
+	}
+	a.overloaded = err
+}
+
+// wait blocks until the load drops, ctx is done, or d passes, and reports whether the load drops.
+func (a *AdmissionController) wait(ctx context.Context, d time.Duration) bool {
+	a.mu.Lock()
+	overloaded, recovered := a.overloaded != nil, a.recovered
+	a.mu.Unlock()
+	if !overloaded {
+		return true
+	}
+	if d <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-recovered:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return false
+}
+
+// admit checks the new Client against the AdmissionController, it closes the Client with CloseCodeOverloaded
+// and returns false if the load does not drop within AdmissionLimits.MaxDefer.
+func (c *Client) admit() bool {
+	a := loadAdmissionController()
+	if a == nil || a.wait(c.parentCtx, a.limits.MaxDefer) {
+		return true
+	}
+	atomic.AddUint64(&counters.AdmissionRejected, 1)
+	c.Logger().Info("Client rejected", logging.Err(ErrOverloaded))
+	c.CloseWithNotice(CloseCodeOverloaded, ErrOverloaded.Error())
+	return false
+}
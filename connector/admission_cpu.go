@@ -0,0 +1,40 @@
+//go:build linux || darwin
+
+package connector
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// cpuSampler measures the CPU usage of the process between the samples by getrusage.
+type cpuSampler struct {
+	at   time.Time
+	used time.Duration
+}
+
+func newCPUSampler() *cpuSampler {
+	return &cpuSampler{at: time.Now(), used: cpuTime()}
+}
+
+// sample returns the CPU usage since the previous sample, as a fraction of the GOMAXPROCS cores.
+func (s *cpuSampler) sample(at time.Time) float64 {
+	used := cpuTime()
+	elapsed := at.Sub(s.at)
+	usage := 0.0
+	if elapsed > 0 {
+		usage = float64(used-s.used) / float64(elapsed) / float64(runtime.GOMAXPROCS(0))
+	}
+	s.at, s.used = at, used
+	return usage
+}
+
+// cpuTime returns the user and system CPU time of the process.
+func cpuTime() time.Duration {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+}
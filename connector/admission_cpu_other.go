@@ -0,0 +1,16 @@
+//go:build !linux && !darwin
+
+package connector
+
+import "time"
+
+// cpuSampler does not measure the CPU usage on the platforms without getrusage.
+type cpuSampler struct{}
+
+func newCPUSampler() *cpuSampler {
+	return &cpuSampler{}
+}
+
+func (s *cpuSampler) sample(_ time.Time) float64 {
+	return 0
+}
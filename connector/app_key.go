@@ -0,0 +1,149 @@
+package connector
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// AppKey is a credential presented by the peer in the HandshakeRequest to select its Tenant.
+	// A Tenant may have several active keys at once, so that the clients move to a new key without downtime.
+	AppKey struct {
+		Key    string `json:"key"`
+		Tenant Tenant `json:"tenant"`
+		// ExpiresAt is the time the AppKey is no longer accepted, zero for never, set by RotateAppKeys.
+		ExpiresAt time.Time `json:"expires_at,omitempty"`
+	}
+
+	// AppKeyStore holds the AppKey of the tenants, such as NewMemoryAppKeyStore or redisstore.AppKeyStore,
+	// and resolves the tenants of the clients by AppKeyResolver.
+	AppKeyStore interface {
+		// Lookup returns the AppKey of the key, ErrUnknownAppKey if there is none or it is expired.
+		Lookup(ctx context.Context, key string) (AppKey, error)
+		// Put adds the AppKey, or replaces the one with the same Key.
+		Put(ctx context.Context, k AppKey) error
+		// Revoke removes the AppKey of the key immediately, it's OK if there is none.
+		Revoke(ctx context.Context, key string) error
+		// Keys returns the unexpired AppKey of the Tenant.
+		Keys(ctx context.Context, t Tenant) ([]AppKey, error)
+	}
+
+	// memoryAppKeyStore is an AppKeyStore in memory.
+	memoryAppKeyStore struct {
+		mu   sync.RWMutex // mu guards keys.
+		keys map[string]AppKey
+	}
+)
+
+// NewAppKey returns an AppKey of the Tenant with an unguessable random Key of 64 hex characters.
+func NewAppKey(t Tenant) (AppKey, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return AppKey{}, err
+	}
+	return AppKey{Key: hex.EncodeToString(b), Tenant: t}, nil
+}
+
+// AppKeyResolver returns a TenantResolver by the AppKey in the store.
+func AppKeyResolver(store AppKeyStore) TenantResolver {
+	return func(ctx context.Context, appKey string) (Tenant, error) {
+		if appKey == "" {
+			return DefaultTenant, ErrAppKeyRequired
+		}
+		k, err := store.Lookup(ctx, appKey)
+		if err != nil {
+			return DefaultTenant, err
+		}
+		return k.Tenant, nil
+	}
+}
+
+// RotateAppKeys adds a new AppKey of the Tenant to the store, and expires the other keys of the Tenant after grace,
+// during which both the old and the new keys are accepted, so that the clients are updated to the new key
+// without downtime. The keys already expiring earlier are kept as is.
+func RotateAppKeys(ctx context.Context, store AppKeyStore, t Tenant, grace time.Duration) (AppKey, error) {
+	k, err := NewAppKey(t)
+	if err != nil {
+		return AppKey{}, err
+	}
+	old, err := store.Keys(ctx, t)
+	if err != nil {
+		return AppKey{}, err
+	}
+	if err := store.Put(ctx, k); err != nil {
+		return AppKey{}, err
+	}
+
+	expiresAt := now().Add(grace)
+	for _, o := range old {
+		if !o.ExpiresAt.IsZero() && o.ExpiresAt.Before(expiresAt) {
+			continue
+		}
+		o.ExpiresAt = expiresAt
+		if err := store.Put(ctx, o); err != nil {
+			return k, err
+		}
+	}
+	return k, nil
+}
+
+// NewMemoryAppKeyStore creates an AppKeyStore in memory with the static keys, such as from the configuration.
+func NewMemoryAppKeyStore(keys ...AppKey) AppKeyStore {
+	s := &memoryAppKeyStore{keys: make(map[string]AppKey, len(keys))}
+	for _, k := range keys {
+		s.keys[k.Key] = k
+	}
+	return s
+}
+
+func (s *memoryAppKeyStore) Lookup(_ context.Context, key string) (AppKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	k, ok := s.keys[key]
+	if !ok || k.expired(now()) {
+		return AppKey{}, ErrUnknownAppKey
+	}
+	return k, nil
+}
+
+func (s *memoryAppKeyStore) Put(_ context.Context, k AppKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[k.Key] = k
+	return nil
+}
+
+func (s *memoryAppKeyStore) Revoke(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, key)
+	return nil
+}
+
+func (s *memoryAppKeyStore) Keys(_ context.Context, t Tenant) ([]AppKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	at := now()
+	var keys []AppKey
+	for key, k := range s.keys {
+		if k.expired(at) {
+			// Drop the expired keys lazily, as they are never accepted again.
+			delete(s.keys, key)
+			continue
+		}
+		if k.Tenant == t {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Key < keys[j].Key })
+	return keys, nil
+}
+
+// expired reports whether the AppKey is no longer accepted at the time.
+func (k AppKey) expired(at time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !at.Before(k.ExpiresAt)
+}
@@ -0,0 +1,129 @@
+package connector
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	AuditEventConnect     AuditEventType = "connect"
+	AuditEventAuthSuccess AuditEventType = "auth_success"
+	AuditEventAuthFailure AuditEventType = "auth_failure"
+	AuditEventAuthRefresh AuditEventType = "auth_refresh"
+	AuditEventKick        AuditEventType = "kick"
+	AuditEventBan         AuditEventType = "ban"
+	AuditEventDisconnect  AuditEventType = "disconnect"
+
+	// AuditEventCapacityRejected is recorded for a connection rejected by MaxClients, before any Client is created,
+	// so its ClientID is zero.
+	AuditEventCapacityRejected AuditEventType = "capacity_rejected"
+)
+
+type (
+	// AuditEventType is the type of AuditEvent.
+	AuditEventType string
+
+	// AuditEvent is a structured record of a security-relevant event of a Client,
+	// for security review and player-support investigations.
+	AuditEvent struct {
+		Type       AuditEventType `json:"type"`
+		Time       time.Time      `json:"time"`
+		ClientID   uint64         `json:"client_id"`
+		UID        string         `json:"uid,omitempty"`
+		RemoteAddr string         `json:"remote_addr,omitempty"`
+		Protocol   string         `json:"protocol,omitempty"`
+		// Reason describes why the event happens, such as the kick reason or the read error of a disconnect.
+		Reason string `json:"reason,omitempty"`
+		// Cause is the DisconnectCause of an AuditEventDisconnect.
+		Cause DisconnectCause `json:"cause,omitempty"`
+		// Metadata is the metadata of the Client, such as the region and the ASN attached by Options.Enricher.
+		Metadata map[string]string `json:"metadata,omitempty"`
+	}
+
+	// AuditSink receives AuditEvent, such as writing to a file or publishing to a broker topic.
+	// Record is invoked synchronously from the Client goroutines, so it should not block for long.
+	AuditSink interface {
+		Record(e AuditEvent)
+	}
+
+	// AuditSinkFunc is an adapter to allow the use of an ordinary function as AuditSink.
+	AuditSinkFunc func(e AuditEvent)
+
+	// jsonAuditSink writes AuditEvent as JSON lines into an io.Writer.
+	jsonAuditSink struct {
+		mu  sync.Mutex // mu guards enc since Record is invoked concurrently.
+		enc *json.Encoder
+	}
+)
+
+// Record calls f(e).
+func (f AuditSinkFunc) Record(e AuditEvent) {
+	f(e)
+}
+
+// NewJSONAuditSink creates an AuditSink that writes each AuditEvent as a JSON line into w, such as an *os.File.
+func NewJSONAuditSink(w io.Writer) AuditSink {
+	return &jsonAuditSink{
+		enc: json.NewEncoder(w),
+	}
+}
+
+func (s *jsonAuditSink) Record(e AuditEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = s.enc.Encode(e)
+}
+
+// audit records an AuditEvent of the Client to Options.AuditSink, does nothing if no AuditSink is set.
+func (c *Client) audit(typ AuditEventType, reason string) {
+	c.auditCause(typ, reason, "")
+}
+
+// auditDisconnect records an AuditEventDisconnect of the Client with the Disconnect.
+func (c *Client) auditDisconnect(d Disconnect) {
+	c.auditCause(AuditEventDisconnect, d.Reason, d.Cause)
+}
+
+func (c *Client) auditCause(typ AuditEventType, reason string, cause DisconnectCause) {
+	if c.opts.AuditSink == nil {
+		return
+	}
+
+	e := AuditEvent{
+		Type:     typ,
+		Time:     now(),
+		ClientID: c.id,
+		UID:      c.UID(),
+		Protocol: string(c.transport.ProtocolType()),
+		Reason:   reason,
+		Cause:    cause,
+	}
+	if conn := c.transport.NetConn(); conn != nil {
+		e.RemoteAddr = conn.RemoteAddr().String()
+	}
+	if md := c.MetadataMap(); len(md) > 0 {
+		e.Metadata = md
+	}
+	c.opts.AuditSink.Record(e)
+}
+
+// auditCapacityRejected records an AuditEventCapacityRejected of the transport to Options.AuditSink,
+// does nothing if no AuditSink is set.
+func auditCapacityRejected(transport Transport, opts *Options) {
+	if opts.AuditSink == nil {
+		return
+	}
+
+	e := AuditEvent{
+		Type:     AuditEventCapacityRejected,
+		Time:     now(),
+		Protocol: string(transport.ProtocolType()),
+		Reason:   ErrExceedMaxClients.Error(),
+	}
+	if conn := transport.NetConn(); conn != nil {
+		e.RemoteAddr = conn.RemoteAddr().String()
+	}
+	opts.AuditSink.Record(e)
+}
@@ -0,0 +1,102 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+)
+
+// RouteAuth is the route of the auth message, which must be the first message sent by the peer
+// when Options.Authenticator is set.
+const RouteAuth = "auth"
+
+var (
+	ErrUnauthorized = errors.New("ppcserver: client is not authorized")
+)
+
+// Authenticator verifies the auth message of a Client and returns the uid of the authorized user.
+// Return a non-nil error to reject the Client, and the Client will be closed.
+// It also verifies the RouteAuthRefresh request of an authorized Client, where the Client is kept on error,
+// and it may call Client.SetAuthExpiry and Client.SetSessionAttribute to keep the claims of the token,
+// which are applied on a refresh only once the token is verified to be of Client.UID.
+// The web session of a WebSocket Client, such as a cookie, can be verified by its Client.UpgradeRequest.
+type Authenticator func(ctx context.Context, c *Client, m *Message) (uid string, err error)
+
+// authenticate handles the Message received while the Client is in the ClientStateConnected state.
+// Only the RouteAuth message is accepted, on success the Client transitions to the ClientStateAuthorized state.
+// Without an Authenticator, the Client is only waiting for the handshake to resolve its Tenant, see resolveTenant.
+func (c *Client) authenticate(ctx context.Context, m *Message) error {
+	if c.opts.Authenticator == nil {
+		return ErrAppKeyRequired
+	}
+	if m.Route != RouteAuth {
+		return ErrUnauthorized
+	}
+	if err := c.checkTenant(); err != nil {
+		c.audit(AuditEventAuthFailure, err.Error())
+		c.closeWithCause(DisconnectCauseAuthFailed, err.Error())
+		return err
+	}
+
+	// A challenged auth attempt is rejected without closing the Client, so that the peer can answer and retry.
+	if err := c.checkChallenge(ctx); err != nil {
+		return err
+	}
+
+	uid, err := c.verifyAuth(ctx, m)
+	if err != nil {
+		// An error of the Authenticator without a specific ErrorCode tells the peer the auth fails.
+		if ErrorCodeOf(err) == ErrorCodeInternal {
+			err = WithErrorCode(err, ErrorCodeAuthFailed)
+		}
+		c.audit(AuditEventAuthFailure, err.Error())
+		c.Logger().Info("Client authenticate failed", logging.Err(err))
+		c.closeWithCause(DisconnectCauseAuthFailed, err.Error())
+		return err
+	}
+	return c.authorize(ctx, uid)
+}
+
+// authorize transitions the Client to the ClientStateAuthorized state as the user of the uid, it closes the Client
+// with CloseCodeUserQuotaExceeded and returns ErrUserQuotaExceeded if the user exceeds MaxConnectionsPerUser.
+func (c *Client) authorize(ctx context.Context, uid string) error {
+	c.mu.Lock()
+	// Index while holding mu, so that a Client closed concurrently is never left in the index.
+	if c.state != ClientStateClosed && !registry.indexUID(c, tenantKey(c.Tenant(), uid), c.opts.MaxConnectionsPerUser) {
+		c.mu.Unlock()
+		c.audit(AuditEventAuthFailure, ErrUserQuotaExceeded.Error())
+		c.Logger().Info("Client authenticate failed", logging.F("uid", uid), logging.Err(ErrUserQuotaExceeded))
+		c.CloseWithNotice(CloseCodeUserQuotaExceeded, ErrUserQuotaExceeded.Error())
+		return ErrUserQuotaExceeded
+	}
+	if c.state == ClientStateConnected {
+		c.state = ClientStateAuthorized
+	}
+	c.uid = uid
+	c.logger = uidLogger{Logger: c.logger.With(logging.F("uid", uid)), uid: uid}
+	c.mu.Unlock()
+
+	c.startSession(ctx, uid)
+
+	c.audit(AuditEventAuthSuccess, "")
+	TopicClientAuthorized.Publish(ClientAuthorized{Client: c, UID: uid})
+	return nil
+}
+
+// verifyAuth checks the auth message against replays if Options.AuthReplayWindow is set,
+// and then verifies it by the Authenticator.
+func (c *Client) verifyAuth(ctx context.Context, m *Message) (string, error) {
+	if c.opts.AuthReplayWindow > 0 {
+		if err := c.checkAuthReplay(ctx, m); err != nil {
+			return "", err
+		}
+	}
+	return c.opts.Authenticator(ctx, c, m)
+}
+
+// UID returns the uid of the authorized user, an empty string if the Client is not authorized.
+func (c *Client) UID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.uid
+}
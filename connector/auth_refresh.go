@@ -0,0 +1,157 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// RouteAuthRefresh is the route of the request sent by an authorized peer with a refreshed auth token,
+	// which is verified by the Authenticator the same as the auth message, before the current one expires.
+	RouteAuthRefresh = "auth_refresh"
+
+	// closeReasonAuthExpired is the close reason of a Client whose auth expires, see Client.SetAuthExpiry.
+	closeReasonAuthExpired = "auth expired"
+)
+
+var (
+	// ErrAuthUIDMismatch is logged and audited for a refreshed auth of another uid, the peer is responded
+	// ErrAuthRefreshFailed the same as for an invalid auth, so the refresh can't tell whose the token is.
+	ErrAuthUIDMismatch   = errors.New("ppcserver: refreshed auth is of another uid")
+	ErrAuthRefreshFailed = errors.New("ppcserver: auth refresh failed")
+)
+
+// refreshClaims are the claims set by the Authenticator while verifying a RouteAuthRefresh request, which are
+// applied only once the refreshed auth is verified to be of the uid of the Client.
+type refreshClaims struct {
+	expiry     *time.Time
+	attributes [][2]string // attributes are the session attributes as key-value pairs in the order set.
+}
+
+// SetAuthExpiry closes the Client at t unless the auth is refreshed before, replacing the previous expiry,
+// such as called by the Authenticator with the expiry of the token verified. Zero t removes the expiry.
+func (c *Client) SetAuthExpiry(t time.Time) {
+	if c.stageClaim(func(rc *refreshClaims) { rc.expiry = &t }) {
+		return
+	}
+
+	var ct *ClientTimer
+	if !t.IsZero() {
+		ct = c.AfterFunc(
+			t.Sub(now()), func() {
+				c.Logger().Info("Client auth expired")
+				c.closeWithCause(DisconnectCauseAuthExpired, closeReasonAuthExpired)
+			},
+		)
+	}
+
+	c.mu.Lock()
+	prev := c.authExpiry
+	c.authExpiry, c.authExpiresAt = ct, t
+	c.mu.Unlock()
+	if prev != nil {
+		prev.Stop()
+	}
+}
+
+// AuthExpiry returns the time the Client is closed unless the auth is refreshed, zero if there is no expiry.
+func (c *Client) AuthExpiry() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.authExpiresAt
+}
+
+// handleAuthRefresh verifies the RouteAuthRefresh request by the Authenticator, whose updates of the session
+// attributes and the expiry of the Client take effect on success only, it returns false for the other messages.
+// The requests are rate limited the same as the routed messages. A failed refresh is responded with
+// ErrAuthRefreshFailed, and leaves the current auth until it expires, but Options.MaxAuthRefreshFailures failed
+// refreshes close the Client.
+func (c *Client) handleAuthRefresh(ctx context.Context, m *Message) bool {
+	if m.Route != RouteAuthRefresh {
+		return false
+	}
+	if !c.limitRate(m) {
+		return true
+	}
+
+	err := c.refreshAuth(ctx, m)
+	if err != nil && !errors.Is(err, ErrUnauthorized) {
+		err = ErrAuthRefreshFailed
+	}
+	if err == ErrAuthRefreshFailed && c.failAuthRefresh() {
+		// Close once the response is written, so the peer knows why.
+		atomic.StoreInt32(&c.closing, 1)
+		cause := Disconnect{Cause: DisconnectCauseAuthFailed, Reason: err.Error()}
+		resp, merr := c.codec().Marshal(&Message{ID: m.ID, Route: m.Route, Error: err.Error(), Code: ErrorCodeOf(err)})
+		if m.ID == 0 || merr != nil || c.enqueueWrite(queuedWrite{bufs: net.Buffers{resp}, closing: cause}) != nil {
+			c.cancelCtx(cause)
+		}
+		return true
+	}
+	if m.ID != 0 {
+		_ = c.respond(m, nil, err)
+	}
+	return true
+}
+
+// failAuthRefresh counts a failed refresh, it returns true once Options.MaxAuthRefreshFailures is reached.
+func (c *Client) failAuthRefresh() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.authRefreshFailures++
+	return c.opts.MaxAuthRefreshFailures > 0 && c.authRefreshFailures >= c.opts.MaxAuthRefreshFailures
+}
+
+// refreshAuth verifies the refreshed auth, which must be of the uid of the Client.
+func (c *Client) refreshAuth(ctx context.Context, m *Message) error {
+	uid := c.UID()
+	if c.State() != ClientStateAuthorized || uid == "" {
+		return ErrUnauthorized
+	}
+
+	// Stage the claims set by the Authenticator, since a valid token of another uid must not extend the auth.
+	c.mu.Lock()
+	c.refreshing = &refreshClaims{}
+	c.mu.Unlock()
+	refreshed, err := c.verifyAuth(ctx, m)
+	c.mu.Lock()
+	claims := c.refreshing
+	c.refreshing = nil
+	c.mu.Unlock()
+
+	if err == nil && refreshed != uid {
+		err = ErrAuthUIDMismatch
+	}
+	if err != nil {
+		c.audit(AuditEventAuthFailure, err.Error())
+		c.Logger().Info("Client auth refresh failed", logging.Err(err))
+		return err
+	}
+
+	if claims.expiry != nil {
+		c.SetAuthExpiry(*claims.expiry)
+	}
+	for _, kv := range claims.attributes {
+		if err := c.SetSessionAttribute(ctx, kv[0], kv[1]); err != nil {
+			c.Logger().Error("Client.SetSessionAttribute() error", logging.Err(err))
+		}
+	}
+	c.audit(AuditEventAuthRefresh, "")
+	return nil
+}
+
+// stageClaim records a claim by f while a RouteAuthRefresh request is verified, it returns false otherwise,
+// where the claim is applied at once.
+func (c *Client) stageClaim(f func(rc *refreshClaims)) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.refreshing == nil {
+		return false
+	}
+	f(c.refreshing)
+	return true
+}
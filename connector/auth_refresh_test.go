@@ -0,0 +1,184 @@
+package connector_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/transporttest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tokenAuthenticator authorizes the token in the data of the auth message as the uid of the tokens.
+func tokenAuthenticator(tokens map[string]string) connector.Authenticator {
+	return func(_ context.Context, _ *connector.Client, m *connector.Message) (string, error) {
+		var token string
+		_ = json.Unmarshal(m.Data, &token)
+		if uid, ok := tokens[token]; ok {
+			return uid, nil
+		}
+		return "", errors.New("invalid token")
+	}
+}
+
+func request(t *testing.T, peer *transporttest.Peer, id uint64, route, token string) *connector.Message {
+	t.Helper()
+	data, _ := json.Marshal(token)
+	return call(t, peer, &connector.Message{ID: id, Route: route, Data: data})
+}
+
+// call sends the request m and returns its response, skipping the one-way messages pushed meanwhile.
+func call(t *testing.T, peer *transporttest.Peer, m *connector.Message) *connector.Message {
+	t.Helper()
+	if err := peer.SendMessage(m); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for {
+		resp, err := peer.ReceiveMessage(ctx)
+		if err != nil {
+			t.Fatalf("%s response: %v", m.Route, err)
+		}
+		if resp.ID == m.ID {
+			return resp
+		}
+	}
+}
+
+// waitClosed waits for the Client served with done to be closed, and returns the cause.
+func waitClosed(t *testing.T, done <-chan error) connector.Disconnect {
+	t.Helper()
+	select {
+	case err := <-done:
+		var d connector.Disconnect
+		if !errors.As(err, &d) {
+			t.Fatalf("StartClient() = %v, want a Disconnect", err)
+		}
+		return d
+	case <-time.After(time.Second):
+		t.Fatal("Client is not closed")
+	}
+	return connector.Disconnect{}
+}
+
+func TestAuthRefreshHidesUIDMismatch(t *testing.T) {
+	opts := connector.NewOptions(
+		connector.WithAuthenticator(tokenAuthenticator(map[string]string{"alice": "alice", "bob": "bob"})),
+	)
+	peer, done := transporttest.Serve(context.Background(), opts)
+	defer peer.Close()
+
+	if resp := request(t, peer, 1, connector.RouteAuth, "alice"); resp.Error != "" {
+		t.Fatalf("auth error = %q", resp.Error)
+	}
+	mismatch := request(t, peer, 2, connector.RouteAuthRefresh, "bob")
+	invalid := request(t, peer, 3, connector.RouteAuthRefresh, "mallory")
+	if mismatch.Error != invalid.Error || mismatch.Code != invalid.Code {
+		t.Fatalf("mismatch response (%q, %d) differs from invalid (%q, %d)",
+			mismatch.Error, mismatch.Code, invalid.Error, invalid.Code)
+	}
+	if resp := request(t, peer, 4, connector.RouteAuthRefresh, "alice"); resp.Error != "" {
+		t.Fatalf("valid refresh error = %q", resp.Error)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("closed before MaxAuthRefreshFailures: %v", err)
+	default:
+	}
+}
+
+func TestAuthRefreshClosesAfterMaxFailures(t *testing.T) {
+	opts := connector.NewOptions(
+		connector.WithAuthenticator(tokenAuthenticator(map[string]string{"alice": "alice"})),
+		connector.WithMaxAuthRefreshFailures(2),
+	)
+	peer, done := transporttest.Serve(context.Background(), opts)
+	defer peer.Close()
+
+	request(t, peer, 1, connector.RouteAuth, "alice")
+	for id := uint64(2); id <= 3; id++ {
+		if resp := request(t, peer, id, connector.RouteAuthRefresh, "guess"); resp.Code != connector.ErrorCodeAuthFailed {
+			t.Fatalf("refresh code = %d, want %d", resp.Code, connector.ErrorCodeAuthFailed)
+		}
+	}
+	select {
+	case err := <-done:
+		var d connector.Disconnect
+		if !errors.As(err, &d) || d.Cause != connector.DisconnectCauseAuthFailed {
+			t.Fatalf("StartClient() = %v, want DisconnectCauseAuthFailed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Client is not closed after MaxAuthRefreshFailures")
+	}
+}
+
+func TestAuthRefreshRateLimited(t *testing.T) {
+	opts := connector.NewOptions(
+		connector.WithAuthenticator(tokenAuthenticator(map[string]string{"alice": "alice"})),
+		connector.WithRouteRateLimit(connector.RouteAuthRefresh, connector.RouteRateLimit{Rate: 0.001, Burst: 1}),
+	)
+	peer, _ := transporttest.Serve(context.Background(), opts)
+	defer peer.Close()
+
+	request(t, peer, 1, connector.RouteAuth, "alice")
+	request(t, peer, 2, connector.RouteAuthRefresh, "alice")
+	if resp := request(t, peer, 3, connector.RouteAuthRefresh, "alice"); resp.Code != connector.ErrorCodeRateLimited {
+		t.Fatalf("refresh code = %d, want %d", resp.Code, connector.ErrorCodeRateLimited)
+	}
+}
+
+func TestAuthRefreshOfAnotherUIDKeepsClaims(t *testing.T) {
+	// The token "<uid>:<hours>" authorizes uid, and expires in hours with the tier of the hours.
+	authenticator := func(ctx context.Context, c *connector.Client, m *connector.Message) (string, error) {
+		var token string
+		_ = json.Unmarshal(m.Data, &token)
+		uid, hours, _ := strings.Cut(token, ":")
+		n, err := strconv.Atoi(hours)
+		if err != nil {
+			return "", err
+		}
+		c.SetAuthExpiry(time.Now().Add(time.Duration(n) * time.Hour))
+		_ = c.SetSessionAttribute(ctx, "tier", hours)
+		return uid, nil
+	}
+	type claims struct {
+		Expiry time.Time `json:"expiry"`
+		Tier   string    `json:"tier"`
+	}
+	router := connector.NewRouter()
+	router.Handle(
+		"claims", func(_ context.Context, c *connector.Client, _ *connector.Message) (interface{}, error) {
+			tier, _ := c.SessionAttribute("tier")
+			return claims{Expiry: c.AuthExpiry(), Tier: tier}, nil
+		},
+	)
+	peer, _ := transporttest.Serve(
+		context.Background(), connector.NewOptions(connector.WithAuthenticator(authenticator), connector.WithRouter(router)),
+	)
+	defer peer.Close()
+	current := func(id uint64) claims {
+		var v claims
+		if err := json.Unmarshal(call(t, peer, &connector.Message{ID: id, Route: "claims"}).Data, &v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	request(t, peer, 1, connector.RouteAuth, "alice:1")
+	before := current(2)
+	if resp := request(t, peer, 3, connector.RouteAuthRefresh, "bob:10"); resp.Code != connector.ErrorCodeAuthFailed {
+		t.Fatalf("refresh code = %d, want %d", resp.Code, connector.ErrorCodeAuthFailed)
+	}
+	if after := current(4); !after.Expiry.Equal(before.Expiry) || after.Tier != before.Tier {
+		t.Fatalf("claims after the refresh of another uid = %+v, want %+v", after, before)
+	}
+
+	request(t, peer, 5, connector.RouteAuthRefresh, "alice:10")
+	if after := current(6); !after.Expiry.After(before.Expiry) || after.Tier != "10" {
+		t.Fatalf("claims after a valid refresh = %+v, want extended", after)
+	}
+}
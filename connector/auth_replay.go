@@ -0,0 +1,99 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// memoryNonceSweepInterval is the number of nonces added between the sweeps of the expired nonces.
+const memoryNonceSweepInterval = 1024
+
+var (
+	ErrAuthReplayed = errors.New("ppcserver: auth message nonce is missing or already used")
+	ErrAuthStale    = errors.New("ppcserver: auth message timestamp is outside the skew window")
+)
+
+type (
+	// AuthNonce is the anti-replay fields of the auth message data, which is required when
+	// Options.AuthReplayWindow is set. Embed it in the auth data sent by the peer, such as
+	// struct{ Token string; connector.AuthNonce }, so that a captured auth frame can't be replayed.
+	AuthNonce struct {
+		// Nonce is a random string unique to the auth message.
+		Nonce string `json:"nonce"`
+		// Timestamp is the unix time in milliseconds of the peer sending the auth message.
+		Timestamp int64 `json:"timestamp"`
+	}
+
+	// NonceCache records the nonces of the auth messages seen, such as in the memory by default or
+	// in Redis by the redisstore package to reject the replays to any server node.
+	NonceCache interface {
+		// Add records the nonce for ttl, it returns false if the nonce is already recorded and not expired.
+		Add(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+	}
+
+	// memoryNonceCache is a NonceCache in the memory of the current process.
+	memoryNonceCache struct {
+		mu     sync.Mutex // mu guards nonces and adds.
+		nonces map[string]time.Time
+		adds   int
+	}
+)
+
+// NewAuthNonce creates the AuthNonce of an auth message sent now, for the peers written in Go.
+func NewAuthNonce() AuthNonce {
+	return AuthNonce{Nonce: newRandomID(), Timestamp: now().UnixMilli()}
+}
+
+// NewMemoryNonceCache creates a NonceCache in the memory of the current process, which is the default.
+func NewMemoryNonceCache() NonceCache {
+	return &memoryNonceCache{nonces: make(map[string]time.Time)}
+}
+
+func (n *memoryNonceCache) Add(_ context.Context, nonce string, ttl time.Duration) (bool, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	at := now()
+	if expiresAt, ok := n.nonces[nonce]; ok && at.Before(expiresAt) {
+		return false, nil
+	}
+	n.nonces[nonce] = at.Add(ttl)
+	if n.adds++; n.adds%memoryNonceSweepInterval == 0 {
+		for nonce, expiresAt := range n.nonces {
+			if !at.Before(expiresAt) {
+				delete(n.nonces, nonce)
+			}
+		}
+	}
+	return true, nil
+}
+
+// checkAuthReplay verifies the AuthNonce of the auth message, whose Timestamp must be within
+// Options.AuthReplayWindow of the server time and whose Nonce must not be seen before.
+func (c *Client) checkAuthReplay(ctx context.Context, m *Message) error {
+	var n AuthNonce
+	if len(m.Data) > 0 {
+		if err := c.codec().Unmarshal(m.Data, &n); err != nil {
+			return err
+		}
+	}
+	if n.Nonce == "" {
+		return ErrAuthReplayed
+	}
+
+	window := c.opts.AuthReplayWindow
+	if skew := now().Sub(time.UnixMilli(n.Timestamp)); skew > window || skew < -window {
+		return ErrAuthStale
+	}
+
+	// A nonce must be remembered as long as its Timestamp is within the window, which is at most 2 windows.
+	ok, err := c.opts.NonceCache.Add(ctx, n.Nonce, 2*window)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrAuthReplayed
+	}
+	return nil
+}
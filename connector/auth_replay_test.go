@@ -0,0 +1,82 @@
+package connector_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pom-pom-crafts/ppcserver/clock"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/transporttest"
+	"testing"
+	"time"
+)
+
+// nonceAuth is the data of an auth message with the anti-replay fields.
+type nonceAuth struct {
+	Token string `json:"token"`
+	connector.AuthNonce
+}
+
+func nonceAuthenticator(_ context.Context, _ *connector.Client, m *connector.Message) (string, error) {
+	var a nonceAuth
+	if err := json.Unmarshal(m.Data, &a); err != nil {
+		return "", err
+	}
+	return a.Token, nil
+}
+
+func TestMemoryNonceCache(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	connector.SetClock(clk)
+	defer connector.SetClock(nil)
+
+	cache := connector.NewMemoryNonceCache()
+	ctx := context.Background()
+	if ok, _ := cache.Add(ctx, "n", time.Minute); !ok {
+		t.Fatal("Add() of a new nonce = false")
+	}
+	if ok, _ := cache.Add(ctx, "n", time.Minute); ok {
+		t.Fatal("Add() of a recorded nonce = true")
+	}
+	clk.Advance(time.Minute)
+	if ok, _ := cache.Add(ctx, "n", time.Minute); !ok {
+		t.Fatal("Add() of an expired nonce = false")
+	}
+}
+
+func TestAuthReplayRejected(t *testing.T) {
+	opts := connector.NewOptions(
+		connector.WithAuthenticator(nonceAuthenticator),
+		connector.WithAuthReplayProtection(time.Minute, connector.NewMemoryNonceCache()),
+	)
+	connect := func() (*transporttest.Peer, <-chan error) {
+		return transporttest.Serve(context.Background(), opts)
+	}
+	send := func(peer *transporttest.Peer, a nonceAuth) {
+		data, _ := json.Marshal(a)
+		if err := peer.SendMessage(&connector.Message{ID: 1, Route: connector.RouteAuth, Data: data}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	captured := nonceAuth{Token: "alice", AuthNonce: connector.NewAuthNonce()}
+	peer, _ := connect()
+	defer peer.Close()
+	data, _ := json.Marshal(captured)
+	if resp := call(t, peer, &connector.Message{ID: 1, Route: connector.RouteAuth, Data: data}); resp.Error != "" {
+		t.Fatalf("auth error = %q", resp.Error)
+	}
+	stale := nonceAuth{Token: "alice", AuthNonce: connector.NewAuthNonce()}
+	stale.Timestamp -= 2 * time.Minute.Milliseconds()
+	for name, a := range map[string]nonceAuth{
+		"replayed": captured,
+		"stale":    stale,
+		"no nonce": {Token: "alice"},
+	} {
+		peer, done := connect()
+		send(peer, a)
+		if d := waitClosed(t, done); d.Cause != connector.DisconnectCauseAuthFailed {
+			t.Errorf("%s auth cause = %v, want DisconnectCauseAuthFailed", name, d.Cause)
+		}
+		peer.Close()
+	}
+}
@@ -0,0 +1,92 @@
+package connector_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/transporttest"
+	"sync/atomic"
+	"testing"
+)
+
+// countingRouter routes "secret" by counting the calls in n.
+func countingRouter(n *int32) *connector.Router {
+	router := connector.NewRouter()
+	router.Handle(
+		"secret", func(context.Context, *connector.Client, *connector.Message) (interface{}, error) {
+			atomic.AddInt32(n, 1)
+			return "ok", nil
+		},
+	)
+	return router
+}
+
+func TestAuthRequiredBeforeRouting(t *testing.T) {
+	var routed int32
+	opts := connector.NewOptions(
+		connector.WithRouter(countingRouter(&routed)),
+		connector.WithAuthenticator(tokenAuthenticator(map[string]string{"alice": "alice"})),
+	)
+	peer, _ := transporttest.Serve(context.Background(), opts)
+	defer peer.Close()
+
+	if resp := call(t, peer, &connector.Message{ID: 1, Route: "secret"}); resp.Code != connector.ErrorCodeUnauthorized {
+		t.Fatalf("code before auth = %d, want %d", resp.Code, connector.ErrorCodeUnauthorized)
+	}
+	if atomic.LoadInt32(&routed) != 0 {
+		t.Fatal("routed before auth")
+	}
+
+	if resp := request(t, peer, 2, connector.RouteAuth, "alice"); resp.Error != "" {
+		t.Fatalf("auth error = %q", resp.Error)
+	}
+	if resp := call(t, peer, &connector.Message{ID: 3, Route: "secret"}); resp.Error != "" {
+		t.Fatalf("error after auth = %q", resp.Error)
+	}
+	if n := atomic.LoadInt32(&routed); n != 1 {
+		t.Fatalf("routed %d messages after auth, want 1", n)
+	}
+}
+
+func TestFailedAuthClosesWithoutRouting(t *testing.T) {
+	var routed int32
+	opts := connector.NewOptions(
+		connector.WithRouter(countingRouter(&routed)),
+		connector.WithAuthenticator(tokenAuthenticator(nil)),
+	)
+	peer, done := transporttest.Serve(context.Background(), opts)
+	defer peer.Close()
+
+	token, _ := json.Marshal("mallory")
+	for _, m := range []*connector.Message{{ID: 1, Route: connector.RouteAuth, Data: token}, {ID: 2, Route: "secret"}} {
+		if err := peer.SendMessage(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := waitClosed(t, done); d.Cause != connector.DisconnectCauseAuthFailed {
+		t.Fatalf("cause = %v, want DisconnectCauseAuthFailed", d.Cause)
+	}
+	if n := atomic.LoadInt32(&routed); n != 0 {
+		t.Fatalf("routed %d messages after the failed auth, want 0", n)
+	}
+}
+
+func TestHandshakeBeforeAuth(t *testing.T) {
+	opts := connector.NewOptions(
+		connector.WithAuthenticator(tokenAuthenticator(map[string]string{"alice": "alice"})),
+	)
+	peer, _ := transporttest.Serve(context.Background(), opts)
+	defer peer.Close()
+
+	resp := call(t, peer, &connector.Message{ID: 1, Route: connector.RouteHandshake})
+	var hs connector.Handshake
+	if err := json.Unmarshal(resp.Data, &hs); err != nil || resp.Error != "" {
+		t.Fatalf("handshake response = %+v, %v", resp, err)
+	}
+	if hs.ClientID == 0 {
+		t.Fatal("Handshake.ClientID is not set")
+	}
+	if resp := request(t, peer, 2, connector.RouteAuth, "alice"); resp.Error != "" {
+		t.Fatalf("auth error after the handshake = %q", resp.Error)
+	}
+}
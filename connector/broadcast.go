@@ -0,0 +1,106 @@
+package connector
+
+import (
+	"net"
+	"sync"
+)
+
+// sharedPush encodes a one-way Message once per Codec instead of once per Client, and shares the encoded segments.
+// It's safe for concurrent use by the fanout pool.
+type sharedPush struct {
+	route   string
+	v       interface{}
+	seq     uint64     // seq is the Message.Seq of a push to a Room with history, zero for none.
+	key     string     // key is the idempotency key of Client.PushWithKey, empty for none.
+	mu      sync.Mutex // mu guards encoded and payloads.
+	encoded map[Codec]net.Buffers
+	// payloads are v encoded by each Codec, persisted by the MessageSink instead of encoding v again.
+	payloads map[Codec][]byte
+}
+
+// Broadcast pushes a one-way Message with the route and the encoded v to all the authorized clients
+// in the current process, of all the tenants, see Tenant.Broadcast for a single Tenant.
+func Broadcast(route string, v interface{}) error {
+	var clients []*Client
+	registry.forEach(
+		func(c *Client) bool {
+			if c.State() == ClientStateAuthorized {
+				clients = append(clients, c)
+			}
+			return true
+		},
+	)
+	return broadcastClients(clients, route, v)
+}
+
+// fanout pushes a one-way Message with the route and the encoded v to the clients, by the fanout pool if set.
+func fanout(clients []*Client, route string, v interface{}) error {
+	p := &sharedPush{route: route, v: v}
+	return fanoutClients(clients, p.writeTo)
+}
+
+// writeTo queues the Message encoded by the Codec of c, it only returns the encoding error.
+func (p *sharedPush) writeTo(c *Client) error {
+	if c.dropStale(p.route) || !c.markDelivered(p.key) {
+		return nil
+	}
+	codec := c.codec()
+	bufs, err := p.encode(codec)
+	if err != nil {
+		c.unmarkDelivered(p.key)
+		return err
+	}
+	// An error means the Client is closed or too slow, which is handled by the Client itself.
+	if c.writeBuffers(bufs) == nil {
+		c.persistPushData(p.route, p.payload(codec))
+	} else {
+		c.unmarkDelivered(p.key)
+	}
+	return nil
+}
+
+// encode returns the Message encoded by the codec, which is encoded on the first call.
+func (p *sharedPush) encode(codec Codec) (net.Buffers, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if bufs, ok := p.encoded[codec]; ok {
+		return bufs, nil
+	}
+	payload, err := marshalData(codec, p.v)
+	if err != nil {
+		return nil, err
+	}
+	var bufs net.Buffers
+	if p.seq != 0 {
+		bufs, err = frameSeqPush(codec, p.seq, p.route, payload)
+	} else {
+		bufs, err = framePush(codec, p.route, payload)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.encoded == nil {
+		p.encoded = make(map[Codec]net.Buffers, 1)
+		p.payloads = make(map[Codec][]byte, 1)
+	}
+	p.encoded[codec], p.payloads[codec] = bufs, payload
+	return bufs, nil
+}
+
+// payload returns v encoded by the codec, once encode is invoked with the codec.
+func (p *sharedPush) payload(codec Codec) []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.payloads[codec]
+}
+
+// encodeFor encodes the Message by the Codec of each Client ahead, for a push written after the broadcast returns,
+// since v may be reused by the caller afterwards, such as the Data of a pooled Message.
+func (p *sharedPush) encodeFor(clients []*Client) error {
+	for _, c := range clients {
+		if _, err := p.encode(c.codec()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package connector
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"math/bits"
+	"strconv"
+)
+
+// RouteChallenge is the route of the one-way Message pushed to the peer with the challenge data when its auth
+// is challenged by Options.Challenger, and of the request sent by the peer with the answer as the data.
+const RouteChallenge = "challenge"
+
+var (
+	ErrChallengeRequired = errors.New("ppcserver: challenge required before auth")
+	ErrChallengeFailed   = errors.New("ppcserver: challenge failed")
+)
+
+type (
+	// Challenger issues a challenge before accepting the auth attempts of the suspicious clients, such as
+	// a proof-of-work or an app-level captcha token check, to raise the cost of credential stuffing.
+	// The auth message of a challenged Client is responded with ErrChallengeRequired after the RouteChallenge
+	// Message is pushed, and the peer sends the answer by a RouteChallenge request before retrying the auth.
+	Challenger interface {
+		// Challenge returns the challenge data pushed to the Client, nil to accept the auth without a challenge,
+		// such as for the trusted IPs.
+		Challenge(ctx context.Context, c *Client) (interface{}, error)
+		// Verify verifies the answer in m.Data to the challenge returned by Challenge, the Client is closed
+		// if it returns an error.
+		Verify(ctx context.Context, c *Client, challenge interface{}, m *Message) error
+	}
+
+	// ProofOfWork is the challenge data of the Challenger created by NewProofOfWorkChallenger. The answer is
+	// a ProofOfWorkAnswer whose Counter makes SHA-256(Nonce || Counter) begin with Difficulty zero bits.
+	ProofOfWork struct {
+		Nonce      string `json:"nonce"`
+		Difficulty int    `json:"difficulty"`
+	}
+
+	// ProofOfWorkAnswer is the data of the RouteChallenge request answering a ProofOfWork.
+	ProofOfWorkAnswer struct {
+		Counter string `json:"counter"`
+	}
+
+	// proofOfWorkChallenger challenges the clients selected by suspicious with a ProofOfWork.
+	proofOfWorkChallenger struct {
+		difficulty int
+		suspicious func(c *Client) bool
+	}
+
+	// challengeState is the challenge of a Client, guarded by Client.mu.
+	challengeState struct {
+		// challenge is the data returned by Challenger.Challenge, nil until challenged.
+		challenge interface{}
+		// passed is true once the Client is not challenged or has answered the challenge.
+		passed bool
+	}
+)
+
+// NewProofOfWorkChallenger creates a Challenger that challenges the clients selected by suspicious with
+// a ProofOfWork of the difficulty in bits, such as 20 for about a million hashes, or all the clients if nil.
+func NewProofOfWorkChallenger(difficulty int, suspicious func(c *Client) bool) Challenger {
+	return &proofOfWorkChallenger{difficulty: difficulty, suspicious: suspicious}
+}
+
+func (p *proofOfWorkChallenger) Challenge(_ context.Context, c *Client) (interface{}, error) {
+	if p.suspicious != nil && !p.suspicious(c) {
+		return nil, nil
+	}
+	return ProofOfWork{Nonce: newRandomID(), Difficulty: p.difficulty}, nil
+}
+
+func (p *proofOfWorkChallenger) Verify(_ context.Context, c *Client, challenge interface{}, m *Message) error {
+	pow, ok := challenge.(ProofOfWork)
+	if !ok {
+		return ErrChallengeFailed
+	}
+	var answer ProofOfWorkAnswer
+	if len(m.Data) == 0 || c.codec().Unmarshal(m.Data, &answer) != nil || !pow.Check(answer.Counter) {
+		return ErrChallengeFailed
+	}
+	return nil
+}
+
+// Check reports whether SHA-256(Nonce || counter) begins with Difficulty zero bits.
+func (p ProofOfWork) Check(counter string) bool {
+	sum := sha256.Sum256([]byte(p.Nonce + counter))
+	zeros := 0
+	for i := 0; i < len(sum); i += 8 {
+		n := bits.LeadingZeros64(binary.BigEndian.Uint64(sum[i : i+8]))
+		zeros += n
+		if n < 64 {
+			break
+		}
+	}
+	return zeros >= p.Difficulty
+}
+
+// Solve returns the ProofOfWorkAnswer of the ProofOfWork, for the peers written in Go.
+func (p ProofOfWork) Solve() ProofOfWorkAnswer {
+	for i := uint64(0); ; i++ {
+		if counter := strconv.FormatUint(i, 10); p.Check(counter) {
+			return ProofOfWorkAnswer{Counter: counter}
+		}
+	}
+}
+
+// checkChallenge returns nil if the auth of the Client may proceed, it challenges the Client by Options.Challenger
+// on the first auth attempt, and returns ErrChallengeRequired until the challenge is answered.
+func (c *Client) checkChallenge(ctx context.Context) error {
+	if c.opts.Challenger == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	st := c.challenge
+	c.mu.Unlock()
+	if st.passed {
+		return nil
+	}
+	if st.challenge != nil {
+		return ErrChallengeRequired
+	}
+
+	challenge, err := c.opts.Challenger.Challenge(ctx, c)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.challenge = challengeState{challenge: challenge, passed: challenge == nil}
+	c.mu.Unlock()
+	if challenge == nil {
+		return nil
+	}
+
+	c.Logger().Info("Client auth challenged")
+	if err := c.Push(RouteChallenge, challenge); err != nil {
+		return err
+	}
+	return ErrChallengeRequired
+}
+
+// handleChallenge verifies the answer in the RouteChallenge request of the peer, it returns false for the other
+// messages. A wrong answer closes the Client, so that each attempt costs a new connection and a new challenge.
+func (c *Client) handleChallenge(ctx context.Context, m *Message) bool {
+	if m.Route != RouteChallenge || c.opts.Challenger == nil {
+		return false
+	}
+
+	c.mu.Lock()
+	st := c.challenge
+	c.mu.Unlock()
+	err := ErrChallengeFailed
+	if st.challenge != nil && !st.passed {
+		err = c.opts.Challenger.Verify(ctx, c, st.challenge, m)
+	}
+	if err == nil {
+		c.mu.Lock()
+		c.challenge.passed = true
+		c.mu.Unlock()
+	}
+
+	if m.ID != 0 {
+		_ = c.respond(m, nil, err)
+	}
+	if err != nil {
+		c.audit(AuditEventAuthFailure, err.Error())
+		c.Logger().Info("Client challenge failed", logging.Err(err))
+		c.closeWithCause(DisconnectCauseAuthFailed, err.Error())
+	}
+	return true
+}
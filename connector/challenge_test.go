@@ -0,0 +1,74 @@
+package connector_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/transporttest"
+	"testing"
+)
+
+func TestProofOfWork(t *testing.T) {
+	pow := connector.ProofOfWork{Nonce: "nonce", Difficulty: 12}
+	answer := pow.Solve()
+	if !pow.Check(answer.Counter) {
+		t.Fatalf("Check(%q) of the solved counter = false", answer.Counter)
+	}
+	if pow.Check(answer.Counter + "0") {
+		t.Fatalf("Check(%q) of another counter = true", answer.Counter+"0")
+	}
+	if !(connector.ProofOfWork{Nonce: "nonce"}).Check("any") {
+		t.Fatal("Check() of zero difficulty = false")
+	}
+}
+
+func TestProofOfWorkChallenge(t *testing.T) {
+	opts := connector.NewOptions(
+		connector.WithAuthenticator(tokenAuthenticator(map[string]string{"alice": "alice"})),
+		connector.WithChallenger(connector.NewProofOfWorkChallenger(8, nil)),
+	)
+	peer, _ := transporttest.Serve(context.Background(), opts)
+	defer peer.Close()
+
+	// The challenge is pushed before the response to the auth.
+	token, _ := json.Marshal("alice")
+	if err := peer.SendMessage(&connector.Message{ID: 1, Route: connector.RouteAuth, Data: token}); err != nil {
+		t.Fatal(err)
+	}
+	var pow connector.ProofOfWork
+	if err := json.Unmarshal(receiveRoute(t, peer, connector.RouteChallenge).Data, &pow); err != nil {
+		t.Fatal(err)
+	}
+	if resp := receiveRoute(t, peer, connector.RouteAuth); resp.Code != connector.ErrorCodeChallengeRequired {
+		t.Fatalf("auth code = %d, want %d", resp.Code, connector.ErrorCodeChallengeRequired)
+	}
+	if resp := request(t, peer, 2, connector.RouteAuth, "alice"); resp.Code != connector.ErrorCodeChallengeRequired {
+		t.Fatalf("auth code before the answer = %d, want %d", resp.Code, connector.ErrorCodeChallengeRequired)
+	}
+
+	data, _ := json.Marshal(pow.Solve())
+	if resp := call(t, peer, &connector.Message{ID: 3, Route: connector.RouteChallenge, Data: data}); resp.Error != "" {
+		t.Fatalf("challenge answer error = %q", resp.Error)
+	}
+	if resp := request(t, peer, 4, connector.RouteAuth, "alice"); resp.Error != "" {
+		t.Fatalf("auth error after the answer = %q", resp.Error)
+	}
+}
+
+func TestProofOfWorkChallengeWrongAnswer(t *testing.T) {
+	opts := connector.NewOptions(
+		connector.WithAuthenticator(tokenAuthenticator(map[string]string{"alice": "alice"})),
+		connector.WithChallenger(connector.NewProofOfWorkChallenger(32, nil)),
+	)
+	peer, done := transporttest.Serve(context.Background(), opts)
+	defer peer.Close()
+
+	request(t, peer, 1, connector.RouteAuth, "alice")
+	data, _ := json.Marshal(connector.ProofOfWorkAnswer{Counter: "guess"})
+	if err := peer.SendMessage(&connector.Message{ID: 2, Route: connector.RouteChallenge, Data: data}); err != nil {
+		t.Fatal(err)
+	}
+	if d := waitClosed(t, done); d.Cause != connector.DisconnectCauseAuthFailed {
+		t.Fatalf("cause = %v, want DisconnectCauseAuthFailed", d.Cause)
+	}
+}
@@ -4,9 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/pom-pom-crafts/ppcserver/clock"
+	"github.com/pom-pom-crafts/ppcserver/logging"
 	"golang.org/x/sync/errgroup"
-	"log"
+	"net"
+	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
@@ -21,44 +26,107 @@ const (
 
 var (
 	ErrExceedMaxClients = errors.New("ppcserver: exceed maximum number of clients")
+	ErrClientClosed     = errors.New("ppcserver: client is closed")
+	ErrWriteBufferFull  = errors.New("ppcserver: client write buffer is full")
+	ErrWriteTimeout     = errors.New("ppcserver: client write timeout")
 )
 
+// lastClientID is the ID assigned to the most recently created Client, accessed atomically.
+var lastClientID uint64
+
 type (
 	// ClientState represents the state of a Client instance, uint8 is used for save memory usage.
 	ClientState uint8
 
 	// Client represents a Client connection to a server.
 	Client struct {
-		transport Transport
-		mu        sync.Mutex         // mu guards state.
-		state     ClientState        // state is guarded by mu.
-		cancelCtx context.CancelFunc // cancelCtx cancels the Client-level context that creates inside StartClient and result in Client.Close() being called.
+		id          uint64
+		connectedAt time.Time
+		transport   Transport
+		opts        *Options
+		protocol    atomic.Value     // protocol is the *Protocol of the Client, replaced by the handshake of the peer.
+		mu          sync.Mutex       // mu guards state, uid, logger, and rooms.
+		state       ClientState      // state is guarded by mu.
+		uid         string           // uid is set after the Client is authorized.
+		logger      logging.Logger   // logger attaches the Client's fields to every log entry.
+		rooms       map[string]*Room // rooms the Client has joined, guarded by mu.
+		parentCtx   context.Context  // parentCtx is done when the connector is shutting down.
+		ctx         context.Context  // ctx is the Client-level context, whose cause is the Disconnect once done.
+		// cancelCtx cancels the Client-level context with a Disconnect as the cause, and results in Client.Close()
+		// being called. Only the first cause is kept.
+		cancelCtx context.CancelCauseFunc
 		readCh    chan []byte
-		writeCh   chan []byte // writeCh is the buffered channel of messages waiting to write to the transport.
+		writeCh   chan queuedWrite // writeCh is the buffered channel of messages waiting to write to the transport.
+		enqueued  uint64           // enqueued is the number of messages queued to writeCh, accessed atomically.
+		dropped   uint64           // dropped is the number of messages dropped since writeCh is full, accessed atomically.
+		// heartbeatTimer schedules the next heartbeat on the timing wheel, guarded by mu.
+		heartbeatTimer clock.Timer
+		alive          int32 // alive is 1 once a message is received in the current heartbeat interval, accessed atomically.
+		missedBeats    int   // missedBeats is the number of consecutive heartbeat intervals without any message received.
+		rtt            int64 // rtt is the smoothed round-trip time in nanoseconds, accessed atomically.
+		// session is the Session of the authorized Client, guarded by mu.
+		session *Session
+		// timers are the pending ClientTimer created by AfterFunc, guarded by mu.
+		timers map[*ClientTimer]struct{}
+		// authExpiry closes the Client at authExpiresAt set by SetAuthExpiry, guarded by mu.
+		authExpiry    *ClientTimer
+		authExpiresAt time.Time
+		// authRefreshFailures is the number of the failed RouteAuthRefresh requests, guarded by mu.
+		authRefreshFailures int
+		// refreshing holds the claims set while a RouteAuthRefresh request is verified, guarded by mu.
+		refreshing *refreshClaims
+		// challenge is the state of the challenge by Options.Challenger, guarded by mu.
+		challenge challengeState
+		// metadata is attached by Options.Enricher and SetMetadata, guarded by mu.
+		metadata map[string]string
+		// tags are added by AddTag and indexed by the registry, guarded by mu.
+		tags map[string]struct{}
+		// closing is 1 once CloseWithNotice is called or RouteLogout is received, accessed atomically.
+		closing int32
+		// quotaIP is the remote IP the Client is counted for Options.MaxConnectionsPerIP, set by open.
+		quotaIP string
+		// rateBuckets are the token buckets of Options.routeRateLimits by the route pattern, guarded by mu.
+		rateBuckets map[string]*tokenBucket
+		// handshaken is 1 once the peer sends the RouteHandshake Message, accessed atomically.
+		handshaken int32
+		// keys is the *sessionKeys derived by the handshake when Options.SigningSecret or Options.KeyExchange is set.
+		keys atomic.Value
+		// tenant is the *tenantState of the Tenant resolved by the handshake when Options.TenantResolver is set.
+		tenant atomic.Value
+		// flushScheduled is 1 while the Client is queued or being flushed by Options.flushers, accessed atomically.
+		flushScheduled int32
+		// pingScheduled is 1 while the Client is queued or being pinged by the pingers, accessed atomically.
+		pingScheduled int32
+		// waiting is 1 while the Client is in the waiting room, accessed atomically.
+		waiting int32
+		// waitPosition is the position last pushed to the waiting Client, guarded by the mu of the waiting room.
+		waitPosition int
+		// egress is the *egressLimiter of Options.EgressLimit or SetEgressLimit, nil if unlimited.
+		egress atomic.Value
+		// delivered are the times of the idempotency keys pushed by PushWithKey, guarded by mu.
+		delivered map[string]time.Time
+		// deliveredSwept is the number of the delivered keys after the last sweep plus one, guarded by mu.
+		deliveredSwept int
+		// taps are the []*clientTap tailing the messages by Tap, replaced while holding mu.
+		taps atomic.Value
 	}
 )
 
 // StartClient creates a new Client with ClientStateConnected as the initial state,
-//
-func StartClient(ctx context.Context, transport Transport) error {
-	if ExceedMaxClients() {
-		return ErrExceedMaxClients
-	}
-	incrNumClients()
-	defer decrNumClients()
-
-	// The ctx.Done channel returns from context.WithCancel() is closed when the cancelCtx() function is called
-	// or when the parent context's Done channel is closed, whichever happens first.
-	ctx, cancelCtx := context.WithCancel(ctx)
-	defer cancelCtx() // Call cancelCtx when StartClient exits to ensure the current Client's resources are fully released.
-
-	c := &Client{
-		transport: transport,
-		state:     ClientStateConnected,
-		cancelCtx: cancelCtx,
-		readCh:    make(chan []byte),      // TODO, what is the buffer size?
-		writeCh:   make(chan []byte, 256), // TODO, buffer size is configurable
+// and blocks until the Client is closed. It returns the Disconnect telling why the Client is closed,
+// such as a transport error, the server shutdown, or a kick.
+func StartClient(ctx context.Context, transport Transport, opts *Options) (err error) {
+	c, ctx, err := newClient(ctx, transport, opts)
+	if err != nil {
+		return err
 	}
+	c.open()
+	// Release the current Client's resources when StartClient exits.
+	defer func() {
+		d := c.disconnect(err)
+		c.release(d)
+		err = d
+	}()
 
 	// if !allowToConnect() {
 	// 	return
@@ -72,16 +140,18 @@ func StartClient(ctx context.Context, transport Transport) error {
 	// or g.Wait() returns, whichever occurs first.
 	g, ctx := errgroup.WithContext(ctx)
 	// Since per connection support only one concurrent reader and one concurrent writer,
-	// we execute all writes from the `writeLoop` goroutine and all reads from the `readLoop` goroutine.
+	// we execute all writes from the `writeLoop` goroutine (or a shared flusher) and all reads from the `readLoop` goroutine.
 	// Reference https://pkg.go.dev/github.com/gorilla/websocket#hdr-Concurrency for the concurrency usage details.
+	if opts.flushers == nil {
+		g.Go(
+			func() error {
+				return c.writeLoop(ctx)
+			},
+		)
+	}
 	g.Go(
 		func() error {
-			return c.writeLoop(ctx)
-		},
-	)
-	g.Go(
-		func() error {
-			return c.readLoop()
+			return c.readLoop(ctx)
 		},
 	)
 
@@ -94,16 +164,93 @@ func StartClient(ctx context.Context, transport Transport) error {
 	return g.Wait()
 }
 
+// newClient creates a new Client with ClientStateConnected as the initial state,
+// it returns the Client-level context which is done when the Client is closed.
+// The caller must call Client.open to register the Client, and Client.release once the Client is closed.
+func newClient(ctx context.Context, transport Transport, opts *Options) (*Client, context.Context, error) {
+	queued, err := waiting.reserve()
+	if err != nil {
+		atomic.AddUint64(&counters.CapacityRejected, 1)
+		auditCapacityRejected(transport, opts)
+		return nil, nil, err
+	}
+
+	// The ctx.Done channel returns from context.WithCancelCause() is closed when the cancelCtx() function is called
+	// or when the parent context's Done channel is closed, whichever happens first.
+	parentCtx := ctx
+	ctx, cancelCtx := context.WithCancelCause(ctx)
+
+	c := &Client{
+		id:          atomic.AddUint64(&lastClientID, 1),
+		connectedAt: time.Now(),
+		transport:   transport,
+		opts:        opts,
+		state:       ClientStateConnected,
+		rooms:       make(map[string]*Room),
+		parentCtx:   parentCtx,
+		ctx:         ctx,
+		cancelCtx:   cancelCtx,
+		readCh:      make(chan []byte),           // TODO, what is the buffer size?
+		writeCh:     make(chan queuedWrite, 256), // TODO, buffer size is configurable
+	}
+	c.protocol.Store(&Protocol{Codec: codecFor(transport.Encoding()), Router: opts.Router})
+	c.logger = opts.Logger.With(c.logFields()...)
+	c.selectSubprotocol()
+	c.SetEgressLimit(opts.EgressLimit)
+	// Without an Authenticator, the Client is authorized as soon as it is connected, or admitted from the waiting room,
+	// unless it waits for the handshake to resolve its Tenant.
+	if opts.Authenticator == nil && opts.TenantResolver == nil && !queued {
+		c.state = ClientStateAuthorized
+	}
+	if queued {
+		waiting.enter(c)
+	}
+
+	return c, ctx, nil
+}
+
+// open registers the Client so that it is visible to the registry, rooms, and audit.
+func (c *Client) open() {
+	registry.add(c)
+	c.enrich()
+	c.audit(AuditEventConnect, "")
+	TopicClientConnected.Publish(ClientConnected{Client: c})
+	if !c.checkMaintenance() || !c.admit() || !c.acquireIPQuota() {
+		return
+	}
+	c.authorizeSession()
+	c.startHeartbeat()
+}
+
+// release unregisters the closed Client and releases its resources, d tells why the Client is closed.
+func (c *Client) release(d Disconnect) {
+	c.stopHeartbeat()
+	c.stopTimers()
+	c.releaseIPQuota()
+	c.releaseTenant()
+	c.saveSession()
+	c.notifyDisconnect(d)
+	TopicClientDisconnected.Publish(ClientDisconnected{Client: c, Disconnect: d})
+	c.leaveAllRooms()
+	registry.remove(c)
+	c.cancelCtx(d)
+	c.closeTaps()
+	if !waiting.leave(c) {
+		decrNumClients()
+		waiting.admit()
+	}
+}
+
 // Close first mutates Client to the ClientStateClosed state,
 // then closes the underlying transport connection with the peer.
 // Close does nothing if the Client's state is already ClientStateClosed.
 func (c *Client) Close() (err error) {
 	defer func() {
 		if err != nil {
-			log.Println("ppcserver: Client.Close() error:", err)
+			c.Logger().Error("Client.Close() error", logging.Err(err))
 			return
 		}
-		log.Println("ppcserver: Client.Close() complete")
+		c.Logger().Debug("Client.Close() complete")
 	}()
 
 	// Change to the closed state should be guarded by mu. Skip if already in the closed state.
@@ -115,19 +262,42 @@ func (c *Client) Close() (err error) {
 	c.state = ClientStateClosed
 	c.mu.Unlock()
 
-	// TODO, should send close message
-
-	// c.cancelCtx()
+	// Cancel the Client-level context so that whatever drives the Client stops and releases it,
+	// the cause is kept if the Client is closed for another cause first.
+	if c.parentCtx.Err() != nil {
+		c.closeWithCause(DisconnectCauseShutdown, "server shutdown")
+	} else {
+		c.closeWithCause(DisconnectCauseServerClose, "closed")
+	}
 
 	// transport.Close() closes the underlying network connection.
 	// It can be called concurrently, and it's OK to call Close more than once.
+	if cc, ok := c.transport.(CodeCloser); ok {
+		if code, reason := c.closeCode(); code != 0 {
+			return cc.CloseWithCode(code, reason)
+		}
+	}
 	return c.transport.Close()
 }
 
+// Kick closes the Client actively for the reason, such as a duplicated login or a violation of the game rules,
+// with CloseCodeKicked in the close frame.
+func (c *Client) Kick(reason string) {
+	c.audit(AuditEventKick, reason)
+	c.cancelCtx(Disconnect{Cause: DisconnectCauseKick, Reason: "kicked: " + reason, Code: CloseCodeKicked})
+}
+
+// Ban records that the user of the Client is banned for the reason, then closes the Client with CloseCodeBanned.
+// Rejecting the banned user on subsequent connections is up to the Authenticator.
+func (c *Client) Ban(reason string) {
+	c.audit(AuditEventBan, reason)
+	c.cancelCtx(Disconnect{Cause: DisconnectCauseBan, Reason: "banned: " + reason, Code: CloseCodeBanned})
+}
+
 // readLoop keep reading from the transport until transport.Read() errored.
 // The only reason readLoop exits is an error returns from transport.Read().
 // readLoop must execute by a single goroutine to ensure that there is at most one concurrent reader on a connection.
-func (c *Client) readLoop() error {
+func (c *Client) readLoop(ctx context.Context) error {
 	// The readLoop method is the only sender on readCh,
 	// so we Close the readCh here to ensure not sending on the closed readCh channel.
 	defer close(c.readCh)
@@ -139,25 +309,328 @@ func (c *Client) readLoop() error {
 
 		// The connection must be closed once Read returns any error.
 		if err != nil {
+			c.closeWithError(readErrorCause(err), err)
 			return fmt.Errorf("ppcserver: Client.transport.Read() error: %w", err)
 		}
 
-		log.Printf("ppcserver: Client.transport.Read() receive: %s", message)
+		countReceived(len(message))
+		c.countTenantReceived()
 
 		// TODO, send to readCh, block when readCh is full
 		// case c.readCh <- message:
+		c.handleMessage(ctx, message)
+		putReadBuffer(message)
+	}
+}
+
+// handleMessage decodes the data into a Message, dispatches it to the Authenticator until authorized
+// and to the Router afterwards,
+// and writes the response back to the Client if the Message expects one.
+// Each step is covered by a span created from Options.Tracer.
+func (c *Client) handleMessage(ctx context.Context, data []byte) {
+	// The messages read after the Client is closed, such as in the same read as a failed auth, are discarded.
+	if atomic.LoadInt32(&c.closing) == 1 || c.State() == ClientStateClosed {
+		return
+	}
+	receivedAt := time.Now()
+	c.recordFrame(MessageDirectionInbound, net.Buffers{data}, receivedAt)
+
+	ctx, span := c.opts.Tracer.Start(ctx, SpanNameHandleMessage)
+	defer span.End()
+
+	_, decodeSpan := c.opts.Tracer.Start(ctx, SpanNameDecode)
+	m := getMessage()
+	defer putMessage(m)
+	if err := c.codec().Unmarshal(data, m); err != nil {
+		countDecodeError()
+		decodeSpan.RecordError(err)
+		decodeSpan.End()
+		span.RecordError(err)
+		c.Logger().Warn("Client.codec.Unmarshal() error", logging.Err(err))
+		return
+	}
+	decodeSpan.End()
+	span.SetAttribute("ppcserver.route", m.Route)
+	c.logInbound(m)
+	c.tapMessage(MessageDirectionInbound, m, receivedAt)
+
+	c.markAlive()
+	if !c.verifySignature(m) {
+		span.RecordError(ErrInvalidSignature)
+		c.Logger().Warn("Client message signature invalid", logging.F("route", m.Route))
+		if m.ID != 0 {
+			_ = c.respond(m, nil, ErrInvalidSignature)
+		}
+		c.closeWithCause(DisconnectCauseProtocolError, ErrInvalidSignature.Error())
+		return
+	}
+	if c.handleHeartbeat(m) || c.handleTimeSync(m) || c.rejectWaiting(m) || c.handleHandshake(ctx, m) ||
+		c.handleAck(ctx, m) || c.handleResume(ctx, m) || c.handleAuthRefresh(ctx, m) || c.handleChallenge(ctx, m) ||
+		c.handleLogout(ctx, m) {
+		return
+	}
+	c.persistInbound(m)
+
+	var (
+		v   interface{}
+		err error
+	)
+	switch c.State() {
+	case ClientStateConnected:
+		// Until authorized, the messages are handled by the Authenticator instead of the Router.
+		if err = c.authenticate(ctx, m); err == nil {
+			// Record the auth message once the uid is known, so that the recorded session can be replayed.
+			c.recordFrame(MessageDirectionInbound, net.Buffers{data}, receivedAt)
+			// Deliver the messages queued while the user is offline after the auth response.
+			defer c.deliverOffline(c.UID())
+		}
+	case ClientStateAuthorized:
+		if !c.limitRate(m) {
+			return
+		}
+		mwCtx, mwSpan := c.opts.Tracer.Start(ctx, SpanNameMiddleware)
+		v, err = c.Protocol().Router.dispatch(mwCtx, c, m)
+		if err != nil {
+			mwSpan.RecordError(err)
+		}
+		mwSpan.End()
+	default:
+		// A Client closed while handling the Message never reaches the Router.
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+
+	// A Message with zero ID is one-way and expects no response.
+	if m.ID == 0 {
+		return
+	}
+
+	_, respSpan := c.opts.Tracer.Start(ctx, SpanNameResponse)
+	defer respSpan.End()
+	if err := c.respond(m, v, err); err != nil {
+		respSpan.RecordError(err)
+		c.Logger().Warn("Client.respond() error", logging.F("route", m.Route), logging.Err(err))
+	}
+}
+
+// respond encodes the result of handling the request m and writes it to the Client.
+func (c *Client) respond(m *Message, v interface{}, handlerErr error) error {
+	resp := &Message{
+		ID:    m.ID,
+		Route: m.Route,
+	}
+	if handlerErr != nil {
+		resp.Error = handlerErr.Error()
+		resp.Code = ErrorCodeOf(handlerErr)
+	} else if v != nil {
+		data, err := c.codec().Marshal(v)
+		if err != nil {
+			return err
+		}
+		resp.Data = data
+	}
+
+	data, err := c.codec().Marshal(resp)
+	if err != nil {
+		return err
+	}
+	if err := c.Write(data); err != nil {
+		return err
+	}
+	if c.persistRoute(resp.Route) {
+		c.persistOutbound(resp.ID, resp.Route, resp.Data, resp.Error)
 	}
+	return nil
+}
+
+// Push sends a one-way Message with the route and the encoded v to the Client.
+// A push of EgressLimit.StaleRoutes is dropped without an error while the Client is behind its EgressLimit.
+func (c *Client) Push(route string, v interface{}) error {
+	if c.dropStale(route) {
+		return nil
+	}
+	bufs, err := encodePush(c.codec(), route, v)
+	if err != nil {
+		return err
+	}
+	if err := c.writeBuffers(bufs); err != nil {
+		return err
+	}
+	c.persistPush(route, v)
+	return nil
+}
+
+// encodePush encodes a one-way Message with the route and v as the Data by the Codec.
+// The returned segments are immutable, so they can be shared by all the recipients with the same Codec.
+func encodePush(codec Codec, route string, v interface{}) (net.Buffers, error) {
+	payload, err := marshalData(codec, v)
+	if err != nil {
+		return nil, err
+	}
+	return framePush(codec, route, payload)
+}
+
+// marshalData encodes v as the Data of a Message by the Codec, nil for nil v.
+func marshalData(codec Codec, v interface{}) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return codec.Marshal(v)
+}
+
+// framePush encodes a one-way Message with the route and the encoded payload as the Data by the Codec.
+func framePush(codec Codec, route string, payload []byte) (net.Buffers, error) {
+	if pe, ok := codec.(PushEncoder); ok {
+		return pe.EncodePush(route, payload)
+	}
+	data, err := codec.Marshal(&Message{Route: route, Data: payload})
+	if err != nil {
+		return nil, err
+	}
+	return net.Buffers{data}, nil
+}
 
-	// TODO, wait auth request from the peer.
+// encodeSeqPush encodes a one-way Message with the Seq, the route and v as the Data by the Codec.
+func encodeSeqPush(codec Codec, seq uint64, route string, v interface{}) (net.Buffers, error) {
+	payload, err := marshalData(codec, v)
+	if err != nil {
+		return nil, err
+	}
+	return frameSeqPush(codec, seq, route, payload)
+}
+
+// frameSeqPush encodes a one-way Message with the Seq, the route and the encoded payload as the Data by the Codec.
+func frameSeqPush(codec Codec, seq uint64, route string, payload []byte) (net.Buffers, error) {
+	data, err := codec.Marshal(&Message{Seq: seq, Route: route, Data: payload})
+	if err != nil {
+		return nil, err
+	}
+	return net.Buffers{data}, nil
 }
 
+// writeLoop keep writing the messages from writeCh to the transport until ctx is done or transport.Write() errored.
+// writeLoop must execute by a single goroutine to ensure that there is at most one concurrent writer on a connection.
 func (c *Client) writeLoop(ctx context.Context) error {
-	// ticker := time.NewTicker(pingPeriod)
-	// defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case w := <-c.writeCh:
+			observeWriteQueueWait(w)
+			c.waitEgress(ctx, w.bufs, true)
+			n, err := c.writeToTransport(w)
+			if err != nil {
+				c.closeWithError(writeErrorCause(err), err)
+				return fmt.Errorf("ppcserver: Client.transport.Write() error: %w", err)
+			}
+			countSent(n)
+			c.countTenantSent()
+			if w.closing != nil {
+				c.cancelCtx(w.closing)
+			}
+		}
+	}
+}
+
+// writeToTransport writes the segments of w as a single message, as a PreparedMessage if w is prepared and
+// the transport is a WebSocket, otherwise through BuffersWriter if the transport implements it, otherwise
+// the segments are joined into a contiguous buffer. It returns the number of bytes written.
+// A write exceeding Options.WriteTimeout fails with ErrWriteTimeout.
+func (c *Client) writeToTransport(w queuedWrite) (n int, err error) {
+	bufs := w.bufs
+	for _, b := range bufs {
+		n += len(b)
+	}
+
+	if c.opts.FrameRecorder != nil {
+		defer c.recordFrame(MessageDirectionOutbound, bufs, time.Now())
+	}
+	if c.tapped() {
+		defer c.tapOutbound(bufs, time.Now())
+	}
+	defer func() {
+		var ne net.Error
+		if errors.Is(err, os.ErrDeadlineExceeded) || errors.As(err, &ne) && ne.Timeout() {
+			atomic.AddUint64(&counters.WriteTimeouts, 1)
+			err = fmt.Errorf("%w: %v", ErrWriteTimeout, err)
+		}
+	}()
+	if t, ok := c.transport.(*websocketTransport); ok && w.prepared != nil {
+		return n, t.writePrepared(w.prepared)
+	}
+	if len(bufs) == 1 {
+		return n, c.transport.Write(bufs[0])
+	}
+	if bw, ok := c.transport.(BuffersWriter); ok {
+		return n, bw.WriteBuffers(bufs)
+	}
+	data := make([]byte, 0, n)
+	for _, b := range bufs {
+		data = append(data, b...)
+	}
+	return n, c.transport.Write(data)
+}
+
+// String returns the lower-case name of the ClientState.
+func (s ClientState) String() string {
+	switch s {
+	case ClientStateConnected:
+		return "connected"
+	case ClientStateAuthorized:
+		return "authorized"
+	case ClientStateClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+// ID returns the unique ID of the Client within the current process.
+func (c *Client) ID() uint64 {
+	return c.id
+}
+
+// ConnectedAt returns the time when the Client is started.
+func (c *Client) ConnectedAt() time.Time {
+	return c.connectedAt
+}
+
+// WriteQueueLen returns the number of messages waiting in the write buffer of the Client.
+func (c *Client) WriteQueueLen() int {
+	return len(c.writeCh)
+}
+
+// Transport returns the underlying Transport of the Client.
+func (c *Client) Transport() Transport {
+	return c.transport
+}
+
+// Logger returns the Logger that attaches the Client's fields (client ID, remote address, uid) to every log entry.
+func (c *Client) Logger() logging.Logger {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.logger
+}
 
+// RemoteAddr returns the remote network address of the Client, nil if the Transport has no network connection.
+func (c *Client) RemoteAddr() net.Addr {
+	if conn := c.transport.NetConn(); conn != nil {
+		return conn.RemoteAddr()
+	}
 	return nil
 }
 
+// logFields returns the fields identifying the Client in log entries.
+func (c *Client) logFields() []logging.Field {
+	fields := []logging.Field{logging.F("client_id", c.id)}
+	if conn := c.transport.NetConn(); conn != nil {
+		fields = append(fields, logging.F("remote_addr", conn.RemoteAddr().String()))
+	}
+	return fields
+}
+
 // State returns the current state of the Client.
 func (c *Client) State() ClientState {
 	c.mu.Lock()
@@ -165,16 +638,38 @@ func (c *Client) State() ClientState {
 	return c.state
 }
 
+// Write enqueues data to be written to the transport by writeLoop.
+// The Client is closed when its write buffer is full, since the peer is too slow to keep up.
 func (c *Client) Write(data []byte) error {
-	select {
-	case c.writeCh <- data:
-	default:
-		// TODO, do we need to close the writeCh when its buffer is full?
-		close(c.writeCh)
-	}
-	return nil
+	return c.writeBuffers(net.Buffers{data})
 }
 
-func (c *Client) heartbeat() {
+// writeBuffers enqueues the segments of a single message to be written to the transport by writeLoop.
+// The segments must not be modified afterwards, since they may be shared with other clients.
+func (c *Client) writeBuffers(bufs net.Buffers) error {
+	return c.enqueueWrite(queuedWrite{bufs: bufs})
+}
 
+// enqueueWrite enqueues the segments of a single message to be written to the transport by writeLoop,
+// the Client is closed with w.closing as the cause once the message is written if w.closing is not nil.
+func (c *Client) enqueueWrite(w queuedWrite) error {
+	if c.State() == ClientStateClosed {
+		return ErrClientClosed
+	}
+
+	w.queuedAt = time.Now().UnixNano()
+	select {
+	case c.writeCh <- w:
+		atomic.AddUint64(&c.enqueued, 1)
+		countEnqueuedMessage()
+		if c.opts.flushers != nil {
+			c.opts.flushers.schedule(c)
+		}
+		return nil
+	default:
+		atomic.AddUint64(&c.dropped, 1)
+		countDroppedMessage()
+		c.closeWithCause(DisconnectCauseSlowClient, ErrWriteBufferFull.Error())
+		return ErrWriteBufferFull
+	}
 }
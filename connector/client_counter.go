@@ -10,24 +10,38 @@ var (
 	numClients int32
 )
 
+// SetMaxClients changes the maximum number of clients allowed in the current process at runtime, such as
+// by the admin API. The new clients exceeding it wait in the waiting room if enabled by SetWaitingRoom,
+// or are rejected with ErrExceedMaxClients, counted in Counters.CapacityRejected and recorded as
+// AuditEventCapacityRejected. Lowering it closes no existing Client, and raising it admits the waiting clients.
 func SetMaxClients(v int32) {
 	atomic.StoreInt32(&maxClients, v)
+	waiting.admit()
 }
 
+// MaxClients returns the maximum number of clients allowed, see SetMaxClients.
 func MaxClients() int {
 	return int(atomic.LoadInt32(&maxClients))
 }
 
+// NumClients returns the number of started clients, including the ones not yet registered or being closed.
 func NumClients() int {
 	return int(atomic.LoadInt32(&numClients))
 }
 
+// ExceedMaxClients reports whether the number of clients has reached MaxClients.
 func ExceedMaxClients() bool {
 	return NumClients() >= MaxClients()
 }
 
-func incrNumClients() {
-	atomic.AddInt32(&numClients, 1)
+// acquireClient counts a new Client, it returns false without counting if MaxClients is reached.
+// The counting and the check are done at once, so that the concurrent clients never exceed MaxClients.
+func acquireClient() bool {
+	if atomic.AddInt32(&numClients, 1) > atomic.LoadInt32(&maxClients) {
+		decrNumClients()
+		return false
+	}
+	return true
 }
 
 func decrNumClients() {
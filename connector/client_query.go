@@ -0,0 +1,82 @@
+package connector
+
+// ClientQuery selects the clients of a Tenant by Tenant.FindClients, matching all the non-empty fields.
+// The clients are looked up by the index of the UID, the Room, or the Tag, whichever is set first in this order,
+// so a query with any of them doesn't iterate the whole registry.
+type ClientQuery struct {
+	// UID matches the clients authorized as the uid.
+	UID string
+	// Room matches the members of the Room with the name.
+	Room string
+	// Tag matches the clients with the tag added by Client.AddTag.
+	Tag string
+	// Match matches the clients for which it returns true, such as by the State or the metadata.
+	// It's called without holding any lock of the registry.
+	Match func(c *Client) bool
+}
+
+// Matches reports whether the Client matches all the non-empty fields of the ClientQuery, such as for FindClients
+// across all the tenants.
+func (q ClientQuery) Matches(c *Client) bool {
+	if q.UID != "" && c.UID() != q.UID {
+		return false
+	}
+	if q.Tag != "" && !c.HasTag(q.Tag) {
+		return false
+	}
+	if q.Room != "" && !c.inRoom(q.Room) {
+		return false
+	}
+	return q.Match == nil || q.Match(c)
+}
+
+// FindClients returns the clients started in the current process, of all the tenants, for which match returns
+// true. It iterates the whole registry, see Tenant.FindClients for the indexed lookups within a Tenant.
+func FindClients(match func(c *Client) bool) []*Client {
+	var clients []*Client
+	registry.forEach(
+		func(c *Client) bool {
+			if match(c) {
+				clients = append(clients, c)
+			}
+			return true
+		},
+	)
+	return clients
+}
+
+// FindClients returns the clients of the Tenant matching the ClientQuery, looked up by the index of the UID,
+// the Room, or the Tag if set, otherwise by iterating the whole registry.
+func (t Tenant) FindClients(q ClientQuery) []*Client {
+	var candidates []*Client
+	switch {
+	case q.UID != "":
+		candidates = t.ClientsByUID(q.UID)
+	case q.Room != "":
+		r, ok := t.GetRoom(q.Room)
+		if !ok {
+			return nil
+		}
+		candidates = r.Members()
+	case q.Tag != "":
+		candidates = t.ClientsByTag(q.Tag)
+	default:
+		return FindClients(func(c *Client) bool { return c.Tenant() == t && q.Matches(c) })
+	}
+
+	clients := candidates[:0]
+	for _, c := range candidates {
+		if c.Tenant() == t && q.Matches(c) {
+			clients = append(clients, c)
+		}
+	}
+	return clients
+}
+
+// inRoom reports whether the Client has joined the Room with the name.
+func (c *Client) inRoom(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.rooms[name]
+	return ok
+}
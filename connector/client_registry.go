@@ -0,0 +1,216 @@
+package connector
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// registryShards is the number of shards of the clientRegistry, a power of two.
+// Connect and disconnect storms, and the iterations of broadcasts, only contend on the same shard.
+const registryShards = 64
+
+var registry = newClientRegistry()
+
+type (
+	// clientRegistry holds all the clients that are started in the current process,
+	// sharded by Client.ID, with the secondary indexes sharded by the uid of the authorized clients,
+	// and by the tags added by Client.AddTag.
+	clientRegistry struct {
+		shards    [registryShards]clientShard
+		uidShards [registryShards]uidShard
+		tagShards [registryShards]uidShard
+	}
+
+	clientShard struct {
+		mu      sync.RWMutex // mu guards clients.
+		clients map[uint64]*Client
+	}
+
+	uidShard struct {
+		mu      sync.RWMutex // mu guards clients.
+		clients map[string]map[uint64]*Client
+	}
+)
+
+func newClientRegistry() *clientRegistry {
+	r := &clientRegistry{}
+	for i := range r.shards {
+		r.shards[i].clients = make(map[uint64]*Client)
+		r.uidShards[i].clients = make(map[string]map[uint64]*Client)
+		r.tagShards[i].clients = make(map[string]map[uint64]*Client)
+	}
+	return r
+}
+
+func (r *clientRegistry) shard(id uint64) *clientShard {
+	return &r.shards[id&(registryShards-1)]
+}
+
+func (r *clientRegistry) uidShard(uid string) *uidShard {
+	return &r.uidShards[shardOf(uid)]
+}
+
+func (r *clientRegistry) tagShard(tag string) *uidShard {
+	return &r.tagShards[shardOf(tag)]
+}
+
+func shardOf(key string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum32() & (registryShards - 1)
+}
+
+func (r *clientRegistry) add(c *Client) {
+	s := r.shard(c.id)
+	s.mu.Lock()
+	s.clients[c.id] = c
+	s.mu.Unlock()
+}
+
+func (r *clientRegistry) remove(c *Client) {
+	s := r.shard(c.id)
+	s.mu.Lock()
+	delete(s.clients, c.id)
+	s.mu.Unlock()
+
+	c.mu.Lock()
+	if c.uid != "" {
+		r.unindexUID(c, tenantKey(c.Tenant(), c.uid))
+	}
+	for tag := range c.tags {
+		r.unindexTag(c, tag)
+	}
+	c.mu.Unlock()
+}
+
+// indexUID adds c to the secondary index of the uid, invoked once c is authorized.
+// It returns false without adding if there are max clients of the uid already, zero max means unlimited.
+func (r *clientRegistry) indexUID(c *Client, uid string, max int) bool {
+	s := r.uidShard(uid)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clients, ok := s.clients[uid]
+	if max > 0 && len(clients) >= max {
+		return false
+	}
+	if !ok {
+		clients = make(map[uint64]*Client, 1)
+		s.clients[uid] = clients
+	}
+	clients[c.id] = c
+	return true
+}
+
+func (r *clientRegistry) unindexUID(c *Client, uid string) {
+	s := r.uidShard(uid)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if clients, ok := s.clients[uid]; ok {
+		delete(clients, c.id)
+		if len(clients) == 0 {
+			delete(s.clients, uid)
+		}
+	}
+}
+
+func (r *clientRegistry) indexTag(c *Client, tag string) {
+	s := r.tagShard(tag)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clients, ok := s.clients[tag]
+	if !ok {
+		clients = make(map[uint64]*Client, 1)
+		s.clients[tag] = clients
+	}
+	clients[c.id] = c
+}
+
+func (r *clientRegistry) unindexTag(c *Client, tag string) {
+	s := r.tagShard(tag)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if clients, ok := s.clients[tag]; ok {
+		delete(clients, c.id)
+		if len(clients) == 0 {
+			delete(s.clients, tag)
+		}
+	}
+}
+
+func (r *clientRegistry) get(id uint64) (*Client, bool) {
+	s := r.shard(id)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.clients[id]
+	return c, ok
+}
+
+func (r *clientRegistry) getByUID(uid string) []*Client {
+	s := r.uidShard(uid)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	clients := make([]*Client, 0, len(s.clients[uid]))
+	for _, c := range s.clients[uid] {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+func (r *clientRegistry) getByTag(tag string) []*Client {
+	s := r.tagShard(tag)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	clients := make([]*Client, 0, len(s.clients[tag]))
+	for _, c := range s.clients[tag] {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+// forEach calls f for each registered Client until f returns false,
+// a single shard is snapshotted at a time so that f is called without holding any lock.
+func (r *clientRegistry) forEach(f func(c *Client) bool) {
+	var clients []*Client
+	for i := range r.shards {
+		s := &r.shards[i]
+		s.mu.RLock()
+		clients = clients[:0]
+		for _, c := range s.clients {
+			clients = append(clients, c)
+		}
+		s.mu.RUnlock()
+
+		for _, c := range clients {
+			if !f(c) {
+				return
+			}
+		}
+	}
+}
+
+// snapshot returns the registered clients at the moment, so callers can iterate without holding any lock.
+func (r *clientRegistry) snapshot() []*Client {
+	var clients []*Client
+	r.forEach(
+		func(c *Client) bool {
+			clients = append(clients, c)
+			return true
+		},
+	)
+	return clients
+}
+
+// Clients returns a snapshot of all the clients that are started in the current process, of all the tenants.
+func Clients() []*Client {
+	return registry.snapshot()
+}
+
+// GetClient returns the Client with the id, or false if no such Client is started.
+func GetClient(id uint64) (*Client, bool) {
+	return registry.get(id)
+}
+
+// ClientsByUID returns the clients of DefaultTenant authorized as the uid, see Tenant.ClientsByUID for the others.
+func ClientsByUID(uid string) []*Client {
+	return registry.getByUID(uid)
+}
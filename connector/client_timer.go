@@ -0,0 +1,64 @@
+package connector
+
+import (
+	"github.com/pom-pom-crafts/ppcserver/clock"
+	"time"
+)
+
+// ClientTimer is a timer scoped to a Client, created by Client.AfterFunc.
+type ClientTimer struct {
+	c *Client
+	t clock.Timer // t is guarded by Client.mu.
+}
+
+// AfterFunc waits for the duration d to elapse and then calls f in its own goroutine,
+// unless the Client is closed before, so that session code never leaks a timer of a closed Client.
+// The timers are on the timing wheel shared by all the clients, so the precision is 100 milliseconds.
+func (c *Client) AfterFunc(d time.Duration, f func()) *ClientTimer {
+	ct := &ClientTimer{c: c}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state == ClientStateClosed {
+		return ct
+	}
+	ct.t = afterFunc(
+		d, func() {
+			c.mu.Lock()
+			_, ok := c.timers[ct]
+			delete(c.timers, ct)
+			closed := c.state == ClientStateClosed
+			c.mu.Unlock()
+			if ok && !closed {
+				go f()
+			}
+		},
+	)
+	if c.timers == nil {
+		c.timers = make(map[*ClientTimer]struct{})
+	}
+	c.timers[ct] = struct{}{}
+	return ct
+}
+
+// Stop prevents the ClientTimer from firing,
+// it returns false if the ClientTimer has already fired, been stopped, or the Client is closed.
+func (ct *ClientTimer) Stop() bool {
+	ct.c.mu.Lock()
+	defer ct.c.mu.Unlock()
+	if _, ok := ct.c.timers[ct]; !ok {
+		return false
+	}
+	delete(ct.c.timers, ct)
+	return ct.t.Stop()
+}
+
+// stopTimers stops all the ClientTimer of the closed Client.
+func (c *Client) stopTimers() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for ct := range c.timers {
+		ct.t.Stop()
+	}
+	c.timers = nil
+}
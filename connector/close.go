@@ -0,0 +1,79 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// RouteClose is the route of the one-way Message pushed to the peer right before the server closes the Client
+// for a reason the peer should know, carrying a CloseNotice, so that the client SDKs can branch on the CloseCode.
+const RouteClose = "close"
+
+const (
+	// CloseCodeNormal is sent in the close frame of a Client closed by the server without a CloseCode of its own.
+	CloseCodeNormal CloseCode = 1000
+	// CloseCodeGoingAway is sent in the close frames of the clients closed since the connector is shutting down.
+	CloseCodeGoingAway CloseCode = 1001
+	// CloseCodeIPQuotaExceeded closes a Client exceeding Options.MaxConnectionsPerIP.
+	CloseCodeIPQuotaExceeded CloseCode = 4001
+	// CloseCodeUserQuotaExceeded closes a Client exceeding Options.MaxConnectionsPerUser.
+	CloseCodeUserQuotaExceeded CloseCode = 4002
+	// CloseCodeTenantQuotaExceeded closes a Client exceeding TenantLimits.MaxClients of its Tenant.
+	CloseCodeTenantQuotaExceeded CloseCode = 4003
+	// CloseCodeMaintenance closes a new Client in the maintenance mode, see SetMaintenance.
+	CloseCodeMaintenance CloseCode = 4004
+	// CloseCodeKicked closes a Client by Client.Kick.
+	CloseCodeKicked CloseCode = 4006
+	// CloseCodeBanned closes a Client by Client.Ban.
+	CloseCodeBanned CloseCode = 4007
+)
+
+type (
+	// CloseCode tells the peer why the Client is closed, in the application range 4000-4999 of the WebSocket
+	// close codes, so that the same codes can be used in the close frames.
+	CloseCode int
+
+	// CloseNotice is the data of the RouteClose Message.
+	CloseNotice struct {
+		Code   CloseCode `json:"code"`
+		Reason string    `json:"reason,omitempty"`
+		// Error is the ErrorCode of the CloseCode, such as ErrorCodeServerBusy for the clients to retry later.
+		Error ErrorCode `json:"error,omitempty"`
+	}
+)
+
+// CloseWithNotice pushes a RouteClose Message with the CloseNotice to the peer, and closes the Client once
+// the Message is written, after the messages queued before it, with the code in the close frame if the Transport
+// is a CodeCloser. The messages received meanwhile are discarded.
+func (c *Client) CloseWithNotice(code CloseCode, reason string) {
+	atomic.StoreInt32(&c.closing, 1)
+	cause := Disconnect{Cause: DisconnectCauseNotice, Reason: reason, Code: code}
+
+	notice := CloseNotice{Code: code, Reason: reason, Error: closeErrorCodes[code]}
+	bufs, err := encodePush(c.codec(), RouteClose, notice)
+	if err != nil || c.enqueueWrite(queuedWrite{bufs: bufs, closing: cause}) != nil {
+		c.cancelCtx(cause)
+	}
+}
+
+// closeCode returns the CloseCode of the closed Client and its reason for the close frame, which is the Code of its
+// Disconnect if set. It's zero if the connection is already broken, such as closed by the peer or a write error.
+func (c *Client) closeCode() (CloseCode, string) {
+	var d Disconnect
+	if !errors.As(context.Cause(c.ctx), &d) {
+		return 0, ""
+	}
+	if d.Code != 0 {
+		return d.Code, d.Reason
+	}
+	switch d.Cause {
+	case DisconnectCauseShutdown:
+		return CloseCodeGoingAway, d.Reason
+	case DisconnectCausePeerClose, DisconnectCauseReadError, DisconnectCauseWriteError, DisconnectCauseWriteTimeout,
+		DisconnectCauseSlowClient:
+		return 0, ""
+	default:
+		return CloseCodeNormal, d.Reason
+	}
+}
@@ -0,0 +1,81 @@
+package connector_test
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/websocket"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dial connects to the WebsocketConnector served by srv, and sends the Message of the route unless empty.
+func dial(t *testing.T, srv *httptest.Server, route string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	if route != "" {
+		if err := conn.WriteJSON(connector.Message{ID: 1, Route: route}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return conn
+}
+
+// readCloseFrame returns the close frame received after the messages pushed before it.
+func readCloseFrame(t *testing.T, conn *websocket.Conn) *websocket.CloseError {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	var err error
+	for err == nil {
+		_, _, err = conn.ReadMessage()
+	}
+	var ce *websocket.CloseError
+	if !errors.As(err, &ce) {
+		t.Fatalf("read error = %v, want a close frame", err)
+	}
+	return ce
+}
+
+func TestCloseFrames(t *testing.T) {
+	router := connector.NewRouter()
+	router.Handle(
+		"leave", func(_ context.Context, c *connector.Client, _ *connector.Message) (interface{}, error) {
+			c.CloseWithNotice(connector.CloseCodeMaintenance, "down for maintenance")
+			return nil, nil
+		},
+	)
+	router.Handle(
+		"kick", func(_ context.Context, c *connector.Client, _ *connector.Message) (interface{}, error) {
+			c.Kick("cheating")
+			return nil, nil
+		},
+	)
+	router.Handle(
+		"ban", func(_ context.Context, c *connector.Client, _ *connector.Message) (interface{}, error) {
+			c.Ban("cheating")
+			return nil, nil
+		},
+	)
+	srv := httptest.NewServer(connector.NewWebsocketConnector(connector.WithRouter(router)).Handler())
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		route string
+		code  connector.CloseCode
+		text  string
+	}{
+		{"leave", connector.CloseCodeMaintenance, "down for maintenance"},
+		{"kick", connector.CloseCodeKicked, "kicked: cheating"},
+		{"ban", connector.CloseCodeBanned, "banned: cheating"},
+	} {
+		if ce := readCloseFrame(t, dial(t, srv, tt.route)); ce.Code != int(tt.code) || ce.Text != tt.text {
+			t.Errorf("close frame of %s = (%d, %q), want (%d, %q)", tt.route, ce.Code, ce.Text, tt.code, tt.text)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package connector
+
+import (
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+var debugUIDs = &uidSet{
+	uids: make(map[string]struct{}),
+}
+
+type (
+	// uidSet holds the uids selected for a feature, such as the debug logging.
+	uidSet struct {
+		mu   sync.RWMutex // mu guards uids.
+		uids map[string]struct{}
+		n    int32 // n is len(uids), accessed atomically to skip locking when empty.
+	}
+
+	// uidLogger is the Logger of an authorized Client, which logs the debug entries at LevelInfo
+	// with a "debug" field while debug logging is enabled for the uid via SetDebugUID.
+	uidLogger struct {
+		logging.Logger
+		uid string
+	}
+)
+
+// SetDebugUID enables or disables debug logging for the clients authorized as the uid at runtime,
+// so a single player can be investigated without turning on debug logging for everyone.
+func SetDebugUID(uid string, enabled bool) {
+	debugUIDs.set(uid, enabled)
+}
+
+// DebugUIDs returns the uids with debug logging enabled, in ascending order.
+func DebugUIDs() []string {
+	return debugUIDs.list()
+}
+
+func (s *uidSet) set(uid string, enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if enabled {
+		s.uids[uid] = struct{}{}
+	} else {
+		delete(s.uids, uid)
+	}
+	atomic.StoreInt32(&s.n, int32(len(s.uids)))
+}
+
+// list returns the uids in ascending order.
+func (s *uidSet) list() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	uids := make([]string, 0, len(s.uids))
+	for uid := range s.uids {
+		uids = append(uids, uid)
+	}
+	sort.Strings(uids)
+	return uids
+}
+
+func (s *uidSet) contains(uid string) bool {
+	if atomic.LoadInt32(&s.n) == 0 {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.uids[uid]
+	return ok
+}
+
+func (l uidLogger) Debug(msg string, fields ...logging.Field) {
+	if !debugUIDs.contains(l.uid) {
+		l.Logger.Debug(msg, fields...)
+		return
+	}
+	l.Logger.Info(msg, append(fields, logging.F("debug", true))...)
+}
+
+func (l uidLogger) With(fields ...logging.Field) logging.Logger {
+	return uidLogger{Logger: l.Logger.With(fields...), uid: l.uid}
+}
@@ -0,0 +1,105 @@
+package connector
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// PushWithKey is like Push, but tagged with the idempotency key, such as the ID of the event being pushed,
+// so that the push is delivered to the Client at most once within Options.DedupWindow. A duplicate push, such as
+// a retry after the Client resumes its Session or the same event relayed by several nodes, is dropped without
+// an error and counted in Counters.DuplicatesSuppressed. The keys delivered are kept in the Session, so they
+// survive the resume. An empty key or a zero DedupWindow pushes as Push.
+func (c *Client) PushWithKey(key, route string, v interface{}) error {
+	if !c.markDelivered(key) {
+		return nil
+	}
+	if err := c.Push(route, v); err != nil {
+		c.unmarkDelivered(key)
+		return err
+	}
+	return nil
+}
+
+// PushToUserWithKey is like PushToUser, but tagged with the idempotency key like Client.PushWithKey.
+// A message queued to the OfflineStore is not deduplicated.
+func PushToUserWithKey(uid, key, route string, v interface{}) error {
+	return pushToUser(DefaultTenant, uid, key, route, v)
+}
+
+// PushToUserWithKey is like the package-level PushToUserWithKey, but to the uid of the Tenant.
+func (t Tenant) PushToUserWithKey(uid, key, route string, v interface{}) error {
+	return pushToUser(t, uid, key, route, v)
+}
+
+// markDelivered records the key as delivered, it returns false if the key is already delivered within
+// Options.DedupWindow. It always returns true for an empty key or a zero DedupWindow.
+func (c *Client) markDelivered(key string) bool {
+	window := c.opts.DedupWindow
+	if key == "" || window <= 0 {
+		return true
+	}
+
+	at := now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if deliveredAt, ok := c.delivered[key]; ok && at.Sub(deliveredAt) < window {
+		atomic.AddUint64(&counters.DuplicatesSuppressed, 1)
+		return false
+	}
+	if c.delivered == nil {
+		c.delivered = make(map[string]time.Time)
+	}
+	// Sweep the expired keys once the keys double since the last sweep, so that the sweeps are amortized.
+	if len(c.delivered) >= c.deliveredSwept*2 {
+		for k, t := range c.delivered {
+			if at.Sub(t) >= window {
+				delete(c.delivered, k)
+			}
+		}
+		c.deliveredSwept = len(c.delivered) + 1
+	}
+	c.delivered[key] = at
+	return true
+}
+
+// unmarkDelivered forgets the key of a push failed to queue, so that the retry is delivered.
+func (c *Client) unmarkDelivered(key string) {
+	if key == "" || c.opts.DedupWindow <= 0 {
+		return
+	}
+	c.mu.Lock()
+	delete(c.delivered, key)
+	c.mu.Unlock()
+}
+
+// deliveredKeys returns a copy of the keys delivered within Options.DedupWindow to be saved in the Session,
+// must be called while holding mu.
+func (c *Client) deliveredKeys() map[string]time.Time {
+	if len(c.delivered) == 0 {
+		return nil
+	}
+	at := now()
+	keys := make(map[string]time.Time, len(c.delivered))
+	for k, t := range c.delivered {
+		if at.Sub(t) < c.opts.DedupWindow {
+			keys[k] = t
+		}
+	}
+	return keys
+}
+
+// restoreDeliveredKeys merges the keys delivered in the resumed Session, must be called while holding mu.
+func (c *Client) restoreDeliveredKeys(keys map[string]time.Time) {
+	if len(keys) == 0 {
+		return
+	}
+	if c.delivered == nil {
+		c.delivered = make(map[string]time.Time, len(keys))
+	}
+	for k, t := range keys {
+		if t.After(c.delivered[k]) {
+			c.delivered[k] = t
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/websocket"
+	"io"
+)
+
+const (
+	// DisconnectCausePeerClose is of a Client whose peer closes the connection.
+	DisconnectCausePeerClose DisconnectCause = "peer_close"
+	// DisconnectCauseLogout is of a Client closed intentionally by its peer with the RouteLogout Message,
+	// unlike DisconnectCausePeerClose which may be a network failure.
+	DisconnectCauseLogout DisconnectCause = "logout"
+	// DisconnectCauseReadError is of a Client failing to read, such as a connection reset or an oversized message.
+	DisconnectCauseReadError DisconnectCause = "read_error"
+	// DisconnectCauseWriteError is of a Client failing to write, such as a broken connection.
+	DisconnectCauseWriteError DisconnectCause = "write_error"
+	// DisconnectCauseWriteTimeout is of a Client failing to write within Options.WriteTimeout, such as a dead peer.
+	DisconnectCauseWriteTimeout DisconnectCause = "write_timeout"
+	// DisconnectCauseSlowClient is of a Client whose write buffer is full, since the peer is too slow to keep up.
+	DisconnectCauseSlowClient DisconnectCause = "slow_client"
+	// DisconnectCauseIdleTimeout is of a Client sending nothing for Options.HeartbeatMaxMissed heartbeat intervals.
+	DisconnectCauseIdleTimeout DisconnectCause = "idle_timeout"
+	// DisconnectCauseKick is of a Client closed by Client.Kick.
+	DisconnectCauseKick DisconnectCause = "kick"
+	// DisconnectCauseBan is of a Client closed by Client.Ban.
+	DisconnectCauseBan DisconnectCause = "ban"
+	// DisconnectCauseAuthFailed is of a Client failing the auth, the auth refresh, the challenge, or the tenant check.
+	DisconnectCauseAuthFailed DisconnectCause = "auth_failed"
+	// DisconnectCauseAuthExpired is of a Client whose auth expires, see Client.SetAuthExpiry.
+	DisconnectCauseAuthExpired DisconnectCause = "auth_expired"
+	// DisconnectCauseRateLimited is of a Client exceeding a RouteRateLimit with RateLimitPolicyKick.
+	DisconnectCauseRateLimited DisconnectCause = "rate_limited"
+	// DisconnectCauseProtocolError is of a Client violating the protocol, such as an invalid signature or handshake.
+	DisconnectCauseProtocolError DisconnectCause = "protocol_error"
+	// DisconnectCauseNotice is of a Client closed by Client.CloseWithNotice, such as exceeding a quota.
+	DisconnectCauseNotice DisconnectCause = "notice"
+	// DisconnectCauseShutdown is of a Client closed since the connector is shutting down.
+	DisconnectCauseShutdown DisconnectCause = "shutdown"
+	// DisconnectCauseServerClose is of a Client closed by Client.Close.
+	DisconnectCauseServerClose DisconnectCause = "server_close"
+)
+
+type (
+	// DisconnectCause is the kind of the cause of a disconnect, for the DisconnectHook and the AuditEvent
+	// to branch on.
+	DisconnectCause string
+
+	// Disconnect describes why a Client is disconnected. It's also the cause of the Client-level context,
+	// see context.Cause, and the error returned by StartClient.
+	Disconnect struct {
+		// Cause is the first cause of the Client to be closed.
+		Cause DisconnectCause
+		// Reason describes the cause, such as the kick reason or the read error.
+		Reason string
+		// Err is the error that ends the Client, such as the read error, nil if none.
+		Err error
+		// Code is the CloseCode told to the peer, such as by Client.CloseWithNotice, zero for the default of the Cause.
+		Code CloseCode
+	}
+
+	// DisconnectHook is called once a Client is closed with the Disconnect, before the Client leaves its rooms
+	// and is unregistered, such as for notifying the other players in its rooms. It's called in the goroutine
+	// releasing the Client, so it should not block for long.
+	DisconnectHook func(c *Client, d Disconnect)
+)
+
+func (d Disconnect) Error() string {
+	return "ppcserver: client disconnected (" + string(d.Cause) + "): " + d.Reason
+}
+
+func (d Disconnect) Unwrap() error {
+	return d.Err
+}
+
+// closeWithCause cancels the Client-level context with the cause, which results in StartClient closing the Client
+// and returning. Only the first cause is kept as the cause of the context.
+func (c *Client) closeWithCause(cause DisconnectCause, reason string) {
+	c.cancelCtx(Disconnect{Cause: cause, Reason: reason})
+}
+
+// closeWithError cancels the Client-level context with the cause and the error that ends the Client.
+func (c *Client) closeWithError(cause DisconnectCause, err error) {
+	c.cancelCtx(Disconnect{Cause: cause, Reason: err.Error(), Err: err})
+}
+
+// readErrorCause returns the DisconnectCause of a read error, which is DisconnectCausePeerClose if the peer closes
+// the connection gracefully.
+func readErrorCause(err error) DisconnectCause {
+	var ce *websocket.CloseError
+	if errors.Is(err, io.EOF) || errors.As(err, &ce) {
+		return DisconnectCausePeerClose
+	}
+	return DisconnectCauseReadError
+}
+
+// writeErrorCause returns the DisconnectCause of a write error, which is DisconnectCauseWriteTimeout if the write
+// fails with ErrWriteTimeout.
+func writeErrorCause(err error) DisconnectCause {
+	if errors.Is(err, ErrWriteTimeout) {
+		return DisconnectCauseWriteTimeout
+	}
+	return DisconnectCauseWriteError
+}
+
+// disconnect describes why the Client is disconnected by the cause of the Client-level context,
+// err is the error that ends the Client.
+func (c *Client) disconnect(err error) Disconnect {
+	var d Disconnect
+	switch {
+	case errors.As(context.Cause(c.ctx), &d):
+	case c.parentCtx.Err() != nil:
+		d = Disconnect{Cause: DisconnectCauseShutdown, Reason: "server shutdown"}
+	case err != nil:
+		d = Disconnect{Cause: readErrorCause(err), Reason: err.Error()}
+	default:
+		d = Disconnect{Cause: DisconnectCauseServerClose, Reason: "closed"}
+	}
+	if d.Err == nil {
+		d.Err = err
+	}
+	return d
+}
+
+// notifyDisconnect records the AuditEventDisconnect and calls the Options.OnDisconnect hooks.
+func (c *Client) notifyDisconnect(d Disconnect) {
+	c.auditDisconnect(d)
+	for _, h := range c.opts.OnDisconnect {
+		h(c, d)
+	}
+}
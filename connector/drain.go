@@ -0,0 +1,26 @@
+package connector
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+var ErrDraining = errors.New("ppcserver: connector is draining")
+
+// draining is 1 while the connectors reject new connections, accessed atomically.
+var draining int32
+
+// SetDraining toggles the drain mode, in which the connectors reject new connections and report not ready,
+// while the existing clients are left untouched.
+func SetDraining(v bool) {
+	var i int32
+	if v {
+		i = 1
+	}
+	atomic.StoreInt32(&draining, i)
+}
+
+// Draining reports whether the drain mode is on.
+func Draining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
@@ -0,0 +1,136 @@
+package connector
+
+import (
+	"context"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// EgressLimit caps the bytes written to each Client per second by a token bucket, such as for the spectator
+	// and replay streams, so that a Client can't saturate the NIC or the downlink of a mobile peer.
+	// The writeLoop of the Client waits for the rate, while with Options.WriteFlushers or the event loop
+	// the writes are not delayed and only the stale pushes are dropped.
+	EgressLimit struct {
+		// Rate is the bytes allowed per second, zero disables the EgressLimit.
+		Rate float64
+		// Burst is the bytes allowed at once, default is the Rate rounded up if not positive.
+		Burst int
+		// StaleRoutes are the routes of the pushes superseded by the next ones, such as the state updates, which
+		// are dropped while the Client is behind its Rate with messages queued, counted in Counters.EgressDropped.
+		// A route ending with "*" matches the prefix.
+		StaleRoutes []string
+	}
+
+	// egressLimiter is the token bucket of the EgressLimit of a Client, whose tokens go negative by the bytes
+	// written beyond the Rate.
+	egressLimiter struct {
+		limit  EgressLimit
+		mu     sync.Mutex // mu guards tokens and at.
+		tokens float64
+		at     time.Time
+	}
+)
+
+func newEgressLimiter(l EgressLimit) *egressLimiter {
+	if l.Burst <= 0 {
+		l.Burst = int(math.Ceil(l.Rate))
+	}
+	return &egressLimiter{limit: l, tokens: float64(l.Burst), at: time.Now()}
+}
+
+// refill adds the tokens accumulated since the last refill, must be called while holding mu.
+func (l *egressLimiter) refill() {
+	at := time.Now()
+	l.tokens += at.Sub(l.at).Seconds() * l.limit.Rate
+	if burst := float64(l.limit.Burst); l.tokens > burst {
+		l.tokens = burst
+	}
+	l.at = at
+}
+
+// reserve takes n tokens, it returns the time to wait until the bytes are within the Rate.
+func (l *egressLimiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.limit.Rate * float64(time.Second))
+}
+
+// behind reports whether the bytes written exceed the Rate.
+func (l *egressLimiter) behind() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+	return l.tokens < 0
+}
+
+// stale reports whether the route is one of EgressLimit.StaleRoutes.
+func (l *egressLimiter) stale(route string) bool {
+	for _, p := range l.limit.StaleRoutes {
+		if p == route || (strings.HasSuffix(p, "*") && strings.HasPrefix(route, p[:len(p)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetEgressLimit replaces the EgressLimit of the Client, such as a lower Rate for a spectator,
+// zero Rate removes the limit.
+func (c *Client) SetEgressLimit(l EgressLimit) {
+	if l.Rate <= 0 {
+		c.egress.Store((*egressLimiter)(nil))
+		return
+	}
+	c.egress.Store(newEgressLimiter(l))
+}
+
+func (c *Client) egressLimiter() *egressLimiter {
+	l, _ := c.egress.Load().(*egressLimiter)
+	return l
+}
+
+// waitEgress takes the tokens of the bytes of bufs to write, and blocks until they are within the EgressLimit
+// or ctx is done if wait is set.
+func (c *Client) waitEgress(ctx context.Context, bufs net.Buffers, wait bool) {
+	l := c.egressLimiter()
+	if l == nil {
+		return
+	}
+	n := 0
+	for _, b := range bufs {
+		n += len(b)
+	}
+	d := l.reserve(n)
+	if d <= 0 || !wait {
+		return
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// dropStale reports whether the push of the route is dropped, since it's stale while the Client is behind
+// its EgressLimit with messages queued.
+func (c *Client) dropStale(route string) bool {
+	l := c.egressLimiter()
+	if l == nil || !l.stale(route) {
+		return false
+	}
+	if len(c.writeCh) == 0 || !l.behind() {
+		return false
+	}
+	atomic.AddUint64(&counters.EgressDropped, 1)
+	return true
+}
@@ -1,5 +1,10 @@
 package connector
 
+import (
+	"encoding/json"
+	"net"
+)
+
 // EncodingType represents client connection transport encoding format.
 type EncodingType string
 
@@ -9,3 +14,57 @@ const (
 	// EncodingTypeProtobuf represents that data will transport in Protobuf format.
 	EncodingTypeProtobuf EncodingType = "protobuf"
 )
+
+// Codec marshals and unmarshals the Message envelope and its payload for a specific EncodingType.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// PushEncoder is optionally implemented by a Codec to encode the envelope of a one-way Message
+// around an already encoded payload as segments, so a payload shared by many recipients is neither
+// re-encoded nor copied into a contiguous buffer per recipient.
+type PushEncoder interface {
+	EncodePush(route string, payload []byte) (net.Buffers, error)
+}
+
+// jsonCodec is the Codec for EncodingTypeJSON.
+type jsonCodec struct{}
+
+// jsonPushTrailer closes the JSON object of a Message envelope encoded by jsonCodec.EncodePush.
+var jsonPushTrailer = []byte("}")
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// EncodePush encodes the Message envelope as the segments `{"route":"<route>","data":`, payload, and `}`.
+func (jsonCodec) EncodePush(route string, payload []byte) (net.Buffers, error) {
+	quoted, err := json.Marshal(route)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) == 0 {
+		header := make([]byte, 0, len(quoted)+10)
+		header = append(append(append(header, `{"route":`...), quoted...), '}')
+		return net.Buffers{header}, nil
+	}
+	header := make([]byte, 0, len(quoted)+18)
+	header = append(append(append(header, `{"route":`...), quoted...), `,"data":`...)
+	return net.Buffers{header, payload, jsonPushTrailer}, nil
+}
+
+// JSONCodec returns the Codec for EncodingTypeJSON.
+func JSONCodec() Codec {
+	return jsonCodec{}
+}
+
+// codecFor returns the Codec for the EncodingType, falls back to the JSON Codec for unsupported types.
+func codecFor(encoding EncodingType) Codec {
+	// TODO, add protobuf Codec.
+	return jsonCodec{}
+}
@@ -0,0 +1,146 @@
+package connector
+
+import (
+	"errors"
+	"strconv"
+)
+
+// ErrorCode tells the peer the kind of an error in Message.Code of an error response and CloseNotice.Error,
+// so that the client SDKs branch on the codes instead of parsing the error strings.
+type ErrorCode int
+
+const (
+	// ErrorCodeInternal is of the errors without a specific ErrorCode, such as an error returned by a handler.
+	ErrorCodeInternal ErrorCode = iota + 1
+	// ErrorCodeBadRequest is of the messages failed to decode.
+	ErrorCodeBadRequest
+	// ErrorCodeAuthFailed is of the auth messages rejected by the Authenticator or the auth checks.
+	ErrorCodeAuthFailed
+	// ErrorCodeUnauthorized is of the messages sent before authorized.
+	ErrorCodeUnauthorized
+	// ErrorCodeChallengeRequired is of the auth messages to retry after solving the challenge pushed by RouteChallenge.
+	ErrorCodeChallengeRequired
+	// ErrorCodeRateLimited is of the messages exceeding a rate limit.
+	ErrorCodeRateLimited
+	// ErrorCodeRouteNotFound is of the messages of a route without handler.
+	ErrorCodeRouteNotFound
+	// ErrorCodeServerBusy is of the clients rejected for the capacity or the load of the server, to retry later.
+	ErrorCodeServerBusy
+	// ErrorCodeQuotaExceeded is of the clients exceeding a connection quota.
+	ErrorCodeQuotaExceeded
+	// ErrorCodeInvalidSignature is of the messages with a missing or invalid signature.
+	ErrorCodeInvalidSignature
+)
+
+// errorCodes are the ErrorCode of the errors of the connector package.
+var errorCodes = map[error]ErrorCode{
+	ErrUnauthorized:         ErrorCodeUnauthorized,
+	ErrAuthUIDMismatch:      ErrorCodeAuthFailed,
+	ErrAuthRefreshFailed:    ErrorCodeAuthFailed,
+	ErrAuthReplayed:         ErrorCodeAuthFailed,
+	ErrAuthStale:            ErrorCodeAuthFailed,
+	ErrChallengeRequired:    ErrorCodeChallengeRequired,
+	ErrChallengeFailed:      ErrorCodeAuthFailed,
+	ErrAppKeyRequired:       ErrorCodeAuthFailed,
+	ErrUnknownAppKey:        ErrorCodeAuthFailed,
+	ErrKeyExchangeRequired:  ErrorCodeBadRequest,
+	ErrRateLimited:          ErrorCodeRateLimited,
+	ErrRouteNotFound:        ErrorCodeRouteNotFound,
+	ErrExceedMaxClients:     ErrorCodeServerBusy,
+	ErrOverloaded:           ErrorCodeServerBusy,
+	ErrMaintenance:          ErrorCodeServerBusy,
+	ErrDraining:             ErrorCodeServerBusy,
+	ErrWaiting:              ErrorCodeServerBusy,
+	ErrIPQuotaExceeded:      ErrorCodeQuotaExceeded,
+	ErrUserQuotaExceeded:    ErrorCodeQuotaExceeded,
+	ErrTenantQuotaExceeded:  ErrorCodeQuotaExceeded,
+	ErrTenantRoomsExceeded:  ErrorCodeQuotaExceeded,
+	ErrInvalidSignature:     ErrorCodeInvalidSignature,
+	ErrSigningNonceRequired: ErrorCodeBadRequest,
+
+	ErrUnsupportedProtocolVersion: ErrorCodeBadRequest,
+	ErrUnsupportedFrameType:       ErrorCodeBadRequest,
+}
+
+// closeErrorCodes are the ErrorCode of the CloseCode of the connector package.
+var closeErrorCodes = map[CloseCode]ErrorCode{
+	CloseCodeIPQuotaExceeded:     ErrorCodeQuotaExceeded,
+	CloseCodeUserQuotaExceeded:   ErrorCodeQuotaExceeded,
+	CloseCodeTenantQuotaExceeded: ErrorCodeQuotaExceeded,
+	CloseCodeMaintenance:         ErrorCodeServerBusy,
+	CloseCodeOverloaded:          ErrorCodeServerBusy,
+}
+
+// Error is an error with an ErrorCode, such as returned by a handler by NewError to tell the peer a specific
+// ErrorCode, which may be an application-defined ErrorCode from 1000 on.
+type Error struct {
+	Code ErrorCode
+	Err  error
+}
+
+// NewError returns an *Error of the code and the message.
+func NewError(code ErrorCode, message string) error {
+	return &Error{Code: code, Err: errors.New(message)}
+}
+
+// WithErrorCode returns an *Error wrapping err with the code, or nil if err is nil.
+func WithErrorCode(err error, code ErrorCode) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ErrorCodeOf returns the ErrorCode of err, which is the Code of the *Error in its chain, or of the error of
+// the connector package in its chain. It returns ErrorCodeInternal for any other error, and zero for nil.
+func ErrorCodeOf(err error) ErrorCode {
+	if err == nil {
+		return 0
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	for ; err != nil; err = errors.Unwrap(err) {
+		if code, ok := errorCodes[err]; ok {
+			return code
+		}
+	}
+	return ErrorCodeInternal
+}
+
+// String returns the snake-case name of the ErrorCode, or the number of an application-defined ErrorCode.
+func (c ErrorCode) String() string {
+	switch c {
+	case ErrorCodeInternal:
+		return "internal"
+	case ErrorCodeBadRequest:
+		return "bad_request"
+	case ErrorCodeAuthFailed:
+		return "auth_failed"
+	case ErrorCodeUnauthorized:
+		return "unauthorized"
+	case ErrorCodeChallengeRequired:
+		return "challenge_required"
+	case ErrorCodeRateLimited:
+		return "rate_limited"
+	case ErrorCodeRouteNotFound:
+		return "route_not_found"
+	case ErrorCodeServerBusy:
+		return "server_busy"
+	case ErrorCodeQuotaExceeded:
+		return "quota_exceeded"
+	case ErrorCodeInvalidSignature:
+		return "invalid_signature"
+	default:
+		return strconv.Itoa(int(c))
+	}
+}
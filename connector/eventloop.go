@@ -0,0 +1,53 @@
+package connector
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"syscall"
+)
+
+var ErrEventLoopUnsupported = errors.New("ppcserver: event loop mode is not supported on this platform")
+
+// eventLoopFlushersPerPoller is the number of flushers started per poller when WriteFlushers is not set,
+// so that a slow peer holding a flusher does not stall the writes of the other clients.
+const eventLoopFlushersPerPoller = 4
+
+// eventConn is a Client driven by an event loop poller, instead of its own read and write goroutines,
+// so an idle connection costs no goroutine.
+// Messages are handled in the poller goroutine, so handlers should not block in the event loop mode,
+// and are written by the shared flushers, so a slow peer never blocks the poller.
+type eventConn struct {
+	c       *Client
+	raw     syscall.RawConn
+	fd      int
+	pending []byte // pending holds the received bytes not forming a complete message yet, accessed by the poller only.
+	closed  int32  // closed is 1 once the eventConn is closed, accessed atomically.
+}
+
+// rawConnOf returns the syscall.RawConn and the file descriptor of conn.
+func rawConnOf(conn net.Conn) (syscall.RawConn, int, error) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil, 0, ErrEventLoopUnsupported
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return nil, 0, err
+	}
+	var fd int
+	if err := raw.Control(func(f uintptr) { fd = int(f) }); err != nil {
+		return nil, 0, err
+	}
+	return raw, fd, nil
+}
+
+// markClosed returns true only for the first call, so the eventConn is closed exactly once.
+func (ec *eventConn) markClosed() bool {
+	return atomic.CompareAndSwapInt32(&ec.closed, 0, 1)
+}
+
+// isClosed reports whether the eventConn is closed.
+func (ec *eventConn) isClosed() bool {
+	return atomic.LoadInt32(&ec.closed) == 1
+}
@@ -0,0 +1,226 @@
+//go:build linux
+
+package connector
+
+import (
+	"context"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+const (
+	// eventLoopReadBufferSize is the size of the read buffer shared by all the connections of a poller.
+	eventLoopReadBufferSize = 64 << 10
+	// eventLoopWaitMillis bounds the time a poller blocks in epoll_wait before checking for shutdown.
+	eventLoopWaitMillis = 100
+)
+
+type (
+	// eventLoop distributes the connections over the pollers in round-robin.
+	eventLoop struct {
+		opts    *Options
+		pollers []*poller
+		next    uint32
+		connsWg sync.WaitGroup // connsWg tracks the registered connections until they are released.
+	}
+
+	// poller waits for the readable connections with epoll and handles their messages in a single goroutine.
+	poller struct {
+		loop  *eventLoop
+		epfd  int
+		buf   []byte
+		mu    sync.Mutex // mu guards conns.
+		conns map[int]*eventConn
+	}
+)
+
+// newEventLoop creates the pollers which run until ctx is done, and close all their connections afterwards.
+func newEventLoop(ctx context.Context, numPollers int, opts *Options) (*eventLoop, error) {
+	l := &eventLoop{opts: opts}
+	for i := 0; i < numPollers; i++ {
+		epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+		if err != nil {
+			for _, p := range l.pollers {
+				_ = syscall.Close(p.epfd)
+			}
+			return nil, err
+		}
+		l.pollers = append(
+			l.pollers, &poller{
+				loop:  l,
+				epfd:  epfd,
+				buf:   make([]byte, eventLoopReadBufferSize),
+				conns: make(map[int]*eventConn),
+			},
+		)
+	}
+	for _, p := range l.pollers {
+		go p.run(ctx)
+	}
+	return l, nil
+}
+
+// register creates a Client for conn and adds it to a poller.
+func (l *eventLoop) register(ctx context.Context, conn net.Conn) error {
+	raw, fd, err := rawConnOf(conn)
+	if err != nil {
+		return err
+	}
+
+	c, ctx, err := newClient(ctx, newTCPTransport(conn, EncodingTypeJSON, l.opts), l.opts)
+	if err != nil {
+		return err
+	}
+	p := l.pollers[atomic.AddUint32(&l.next, 1)%uint32(len(l.pollers))]
+	ec := &eventConn{c: c, raw: raw, fd: fd}
+	// No goroutine waits on the Client-level context, so cancelling it closes the eventConn directly,
+	// and the Client is released with the cause of the context.
+	cancelCtx := c.cancelCtx
+	c.cancelCtx = func(cause error) {
+		cancelCtx(cause)
+		p.close(ec, nil)
+	}
+
+	l.connsWg.Add(1)
+	c.open()
+	// The Client may be closed by open, such as exceeding Options.MaxConnectionsPerIP.
+	if c.State() == ClientStateClosed {
+		return nil
+	}
+
+	p.mu.Lock()
+	p.conns[fd] = ec
+	p.mu.Unlock()
+	if err := syscall.EpollCtl(
+		p.epfd, syscall.EPOLL_CTL_ADD, fd, &syscall.EpollEvent{Events: syscall.EPOLLIN | syscall.EPOLLRDHUP, Fd: int32(fd)},
+	); err != nil {
+		p.close(ec, err)
+		return nil
+	}
+	return nil
+}
+
+// wait blocks until all the registered connections are released.
+func (l *eventLoop) wait() {
+	l.connsWg.Wait()
+}
+
+func (p *poller) run(ctx context.Context) {
+	defer syscall.Close(p.epfd)
+
+	events := make([]syscall.EpollEvent, 128)
+	for ctx.Err() == nil {
+		n, err := syscall.EpollWait(p.epfd, events, eventLoopWaitMillis)
+		if err != nil {
+			if err != syscall.EINTR {
+				p.loop.opts.Logger.Error("poller.EpollWait() error", logging.Err(err))
+			}
+			continue
+		}
+		for i := 0; i < n; i++ {
+			p.mu.Lock()
+			ec := p.conns[int(events[i].Fd)]
+			p.mu.Unlock()
+			if ec != nil {
+				p.handleReadable(ctx, ec)
+			}
+		}
+	}
+
+	// Close all the connections when the server is shutting down.
+	p.mu.Lock()
+	conns := make([]*eventConn, 0, len(p.conns))
+	for _, ec := range p.conns {
+		conns = append(conns, ec)
+	}
+	p.mu.Unlock()
+	for _, ec := range conns {
+		p.close(ec, ctx.Err())
+	}
+}
+
+// handleReadable reads once from the readable connection and handles all the complete messages.
+// The epoll is level-triggered, so the remaining bytes are read on the next readiness event.
+func (p *poller) handleReadable(ctx context.Context, ec *eventConn) {
+	var (
+		n    int
+		rerr error
+	)
+	if err := ec.raw.Read(
+		func(fd uintptr) bool {
+			n, rerr = syscall.Read(int(fd), p.buf)
+			return true // Never wait in the Go netpoller, the readiness is reported by epoll.
+		},
+	); err != nil {
+		p.closeRead(ec, err)
+		return
+	}
+	if rerr == syscall.EAGAIN || rerr == syscall.EINTR {
+		return
+	}
+	if rerr != nil {
+		p.closeRead(ec, rerr)
+		return
+	}
+	if n == 0 {
+		p.closeRead(ec, io.EOF)
+		return
+	}
+
+	b := p.buf[:n]
+	if len(ec.pending) > 0 {
+		b = append(ec.pending, b...)
+	}
+	for {
+		message, rest, ok, err := splitTCPFrame(b, p.loop.opts.MaxMessageSize)
+		if err != nil {
+			p.closeRead(ec, err)
+			return
+		}
+		if !ok {
+			break
+		}
+		countReceived(len(message))
+		ec.c.countTenantReceived()
+		ec.c.handleMessage(ctx, message)
+		// The rest of the read is discarded once the message closes the connection, such as a failed auth.
+		if ec.isClosed() {
+			return
+		}
+		b = rest
+	}
+	// Keep the incomplete message in a separate buffer, since p.buf is reused by the next connection.
+	ec.pending = append(ec.pending[:0:0], b...)
+	if len(ec.pending) == 0 {
+		ec.pending = nil
+	}
+}
+
+// closeRead closes the connection failing to read, with the read error as the cause.
+func (p *poller) closeRead(ec *eventConn, err error) {
+	ec.c.closeWithError(readErrorCause(err), err)
+	p.close(ec, err)
+}
+
+// close removes the connection from the poller, closes and releases its Client, err is the cause.
+func (p *poller) close(ec *eventConn, err error) {
+	if !ec.markClosed() {
+		return
+	}
+
+	p.mu.Lock()
+	if p.conns[ec.fd] == ec {
+		delete(p.conns, ec.fd)
+	}
+	p.mu.Unlock()
+	// Remove from epoll before the file descriptor is closed and possibly reused by a new connection.
+	_ = syscall.EpollCtl(p.epfd, syscall.EPOLL_CTL_DEL, ec.fd, nil)
+
+	_ = ec.c.Close()
+	ec.c.release(ec.c.disconnect(err))
+	p.loop.connsWg.Done()
+}
@@ -0,0 +1,153 @@
+//go:build linux
+
+package connector
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tcpFrame encodes the Message as a length-prefixed frame of the TCP transport.
+func tcpFrame(t *testing.T, m *Message) []byte {
+	t.Helper()
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	return append(frame, data...)
+}
+
+// freeAddr returns a local TCP address not in use.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+	return addr
+}
+
+func TestEventLoopFailedAuthDiscardsRestOfRead(t *testing.T) {
+	var routed int32
+	router := NewRouter()
+	router.Handle(
+		"secret", func(context.Context, *Client, *Message) (interface{}, error) {
+			atomic.AddInt32(&routed, 1)
+			return nil, nil
+		},
+	)
+	addr := freeAddr(t)
+	tc := NewTCPConnector(
+		WithAddr(addr),
+		WithEventLoop(1),
+		WithRouter(router),
+		WithAuthenticator(
+			func(context.Context, *Client, *Message) (string, error) {
+				return "", errors.New("bad token")
+			},
+		),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = tc.Start(ctx) }()
+	deadline := time.Now().Add(time.Second)
+	for tc.Ready() != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("TCPConnector is not ready")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	defer func() { _ = tc.Shutdown(context.Background()) }()
+
+	for i := 0; i < 20; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The auth and the routed message arrive in the same read.
+		b := append(tcpFrame(t, &Message{ID: 1, Route: RouteAuth}), tcpFrame(t, &Message{ID: 2, Route: "secret"})...)
+		if _, err := conn.Write(b); err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := io.Copy(io.Discard, conn); err != nil {
+			t.Fatalf("the connection is not closed after the failed auth: %v", err)
+		}
+		_ = conn.Close()
+	}
+	if n := atomic.LoadInt32(&routed); n != 0 {
+		t.Fatalf("routed %d messages of unauthorized clients, want 0", n)
+	}
+}
+
+func TestEventLoopSlowPeerDoesNotBlockPoller(t *testing.T) {
+	router := NewRouter()
+	router.Handle(
+		"flood", func(_ context.Context, c *Client, _ *Message) (interface{}, error) {
+			// Far more than the socket buffers hold, the peer never reads it.
+			for i := 0; i < 32; i++ {
+				_ = c.Write(make([]byte, 256<<10))
+			}
+			return nil, nil
+		},
+	)
+	router.Handle(
+		"echo", func(context.Context, *Client, *Message) (interface{}, error) {
+			return "ok", nil
+		},
+	)
+	addr := freeAddr(t)
+	tc := NewTCPConnector(
+		WithAddr(addr),
+		WithEventLoop(1),
+		WithRouter(router),
+		WithWriteTimeout(5*time.Second),
+		WithMaxMessageSize(1<<20),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = tc.Start(ctx) }()
+	deadline := time.Now().Add(time.Second)
+	for tc.Ready() != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("TCPConnector is not ready")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	defer func() { _ = tc.Shutdown(context.Background()) }()
+
+	slow, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slow.Close()
+	if _, err := slow.Write(tcpFrame(t, &Message{Route: "flood"})); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(tcpFrame(t, &Message{ID: 1, Route: "echo"})); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	var size [4]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		t.Fatalf("no response while the poller writes to a slow peer: %v", err)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package connector
+
+import (
+	"context"
+	"net"
+)
+
+// eventLoop is not supported on this platform, newEventLoop always returns ErrEventLoopUnsupported.
+type eventLoop struct{}
+
+func newEventLoop(context.Context, int, *Options) (*eventLoop, error) {
+	return nil, ErrEventLoopUnsupported
+}
+
+func (l *eventLoop) register(context.Context, net.Conn) error {
+	return ErrEventLoopUnsupported
+}
+
+func (l *eventLoop) wait() {}
@@ -0,0 +1,41 @@
+package connector
+
+import "github.com/pom-pom-crafts/ppcserver/eventbus"
+
+type (
+	// ClientConnected is published to TopicClientConnected once a Client is registered.
+	ClientConnected struct {
+		Client *Client
+	}
+
+	// ClientAuthorized is published to TopicClientAuthorized once a Client is authorized as the UID.
+	ClientAuthorized struct {
+		Client *Client
+		UID    string
+	}
+
+	// ClientDisconnected is published to TopicClientDisconnected once a Client is closed, before it leaves its rooms.
+	ClientDisconnected struct {
+		Client     *Client
+		Disconnect Disconnect
+	}
+
+	// RoomCreated is published to TopicRoomCreated once a Room is created.
+	RoomCreated struct {
+		Room *Room
+	}
+
+	// RoomClosed is published to TopicRoomClosed once a Room is closed.
+	RoomClosed struct {
+		Room *Room
+	}
+)
+
+// The topics of the connector events on the in-process event bus, published in the goroutine of the change.
+var (
+	TopicClientConnected    = eventbus.NewTopic[ClientConnected]("connector.client_connected")
+	TopicClientAuthorized   = eventbus.NewTopic[ClientAuthorized]("connector.client_authorized")
+	TopicClientDisconnected = eventbus.NewTopic[ClientDisconnected]("connector.client_disconnected")
+	TopicRoomCreated        = eventbus.NewTopic[RoomCreated]("connector.room_created")
+	TopicRoomClosed         = eventbus.NewTopic[RoomClosed]("connector.room_closed")
+)
@@ -0,0 +1,82 @@
+package connector
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// fanoutWorkers holds the *fanoutPool set by SetFanoutPool, nil if disabled.
+var fanoutWorkers atomic.Value
+
+// fanoutPool bounds the goroutines fanning out the shards of the large broadcasts.
+type fanoutPool struct {
+	shardSize int
+	sem       chan struct{} // sem holds a token per running worker.
+}
+
+// SetFanoutPool fans out the broadcasts to more than shardSize clients across at most workers goroutines
+// in shards of shardSize clients, such as a broadcast to a room of 50k members, so that it completes in bounded time.
+// As the workers are shared by all the broadcasts, the other traffic is not starved by a broadcast storm.
+// A shard without a free worker is written by the broadcasting goroutine itself, and the InterestFilter of a Room
+// is called concurrently by the workers. A broadcast still returns once all the clients are queued,
+// so the order of the broadcasts from the same goroutine is kept.
+// Zero workers disables the fanout pool, which is the default.
+func SetFanoutPool(workers, shardSize int) {
+	if workers <= 0 || shardSize <= 0 {
+		fanoutWorkers.Store((*fanoutPool)(nil))
+		return
+	}
+	fanoutWorkers.Store(&fanoutPool{shardSize: shardSize, sem: make(chan struct{}, workers)})
+}
+
+// fanoutClients calls write for each of the clients, in parallel shards by the fanout pool if set and the clients
+// exceed its shard size, write must be safe for concurrent use then. It returns the first error of write.
+func fanoutClients(clients []*Client, write func(c *Client) error) error {
+	p, _ := fanoutWorkers.Load().(*fanoutPool)
+	if p == nil || len(clients) <= p.shardSize {
+		for _, c := range clients {
+			if err := write(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	writeShard := func(shard []*Client) {
+		for _, c := range shard {
+			if err := write(c); err != nil {
+				errOnce.Do(func() { firstErr = err })
+				return
+			}
+		}
+	}
+	for len(clients) > 0 {
+		n := p.shardSize
+		if n > len(clients) {
+			n = len(clients)
+		}
+		shard := clients[:n]
+		clients = clients[n:]
+
+		select {
+		case p.sem <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-p.sem
+					wg.Done()
+				}()
+				writeShard(shard)
+			}()
+		default:
+			writeShard(shard)
+		}
+	}
+	wg.Wait()
+	return firstErr
+}
@@ -0,0 +1,109 @@
+package connector
+
+import (
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"sync"
+	"sync/atomic"
+)
+
+// flushBatch is the maximum number of messages written for a Client per turn,
+// so that a Client with a long write queue does not starve the others sharing the same flusher.
+const flushBatch = 16
+
+// flusherPool is a small number of flusher goroutines writing the queued messages of many clients,
+// instead of a writeLoop goroutine per Client.
+// The clients with queued messages wait in a FIFO run queue, each Client appears in the queue at most once.
+type flusherPool struct {
+	mu      sync.Mutex // mu guards queue and stopped.
+	cond    *sync.Cond
+	queue   []*Client
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+// startFlusherPool starts n flusher goroutines which run until stop is invoked.
+func startFlusherPool(n int) *flusherPool {
+	p := &flusherPool{}
+	p.cond = sync.NewCond(&p.mu)
+	p.wg.Add(n)
+	for i := 0; i < n; i++ {
+		go p.run()
+	}
+	return p
+}
+
+// schedule queues c to be flushed unless c is already queued or being flushed.
+func (p *flusherPool) schedule(c *Client) {
+	if !atomic.CompareAndSwapInt32(&c.flushScheduled, 0, 1) {
+		return
+	}
+	p.mu.Lock()
+	p.queue = append(p.queue, c)
+	p.mu.Unlock()
+	p.cond.Signal()
+}
+
+// stop stops the flusher goroutines and waits for them to exit, the queued messages are discarded.
+func (p *flusherPool) stop() {
+	p.mu.Lock()
+	p.stopped = true
+	p.mu.Unlock()
+	p.cond.Broadcast()
+	p.wg.Wait()
+}
+
+func (p *flusherPool) run() {
+	defer p.wg.Done()
+	for {
+		p.mu.Lock()
+		for len(p.queue) == 0 && !p.stopped {
+			p.cond.Wait()
+		}
+		if p.stopped {
+			p.mu.Unlock()
+			return
+		}
+		c := p.queue[0]
+		p.queue[0] = nil
+		p.queue = p.queue[1:]
+		p.mu.Unlock()
+
+		p.flush(c)
+	}
+}
+
+// flush writes up to flushBatch queued messages of c, and requeues c at the tail if more messages are queued.
+func (p *flusherPool) flush(c *Client) {
+	for i := 0; i < flushBatch; i++ {
+		var w queuedWrite
+		select {
+		case w = <-c.writeCh:
+		default:
+		}
+		if w.bufs == nil {
+			break
+		}
+		if c.State() == ClientStateClosed {
+			continue // Discard the messages of a closed Client.
+		}
+		observeWriteQueueWait(w)
+		c.waitEgress(c.ctx, w.bufs, false)
+		n, err := c.writeToTransport(w)
+		if err != nil {
+			c.Logger().Debug("flusherPool Client.transport.Write() error", logging.Err(err))
+			c.closeWithError(writeErrorCause(err), err)
+			continue
+		}
+		countSent(n)
+		c.countTenantSent()
+		if w.closing != nil {
+			c.cancelCtx(w.closing)
+		}
+	}
+
+	// Reset the flag before checking the queue, so that a message queued concurrently is never left behind.
+	atomic.StoreInt32(&c.flushScheduled, 0)
+	if len(c.writeCh) > 0 {
+		p.schedule(c)
+	}
+}
@@ -0,0 +1,79 @@
+package connector
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+var recordUIDs = &uidSet{
+	uids: make(map[string]struct{}),
+}
+
+type (
+	// Frame is a raw message read from or written to the transport of a Client, recorded for replaying it later.
+	Frame struct {
+		Direction MessageDirection `json:"direction"`
+		Time      time.Time        `json:"time"`
+		ClientID  uint64           `json:"client_id"`
+		UID       string           `json:"uid,omitempty"`
+		Data      []byte           `json:"data"`
+	}
+
+	// FrameRecorder records the Frame of the clients authorized as the uids selected by SetRecordUID.
+	// Record is invoked synchronously from the Client goroutines, so it should not block for long.
+	FrameRecorder interface {
+		Record(f Frame)
+	}
+
+	// jsonFrameRecorder writes Frame as JSON lines into an io.Writer.
+	jsonFrameRecorder struct {
+		mu  sync.Mutex // mu guards enc since Record is invoked concurrently.
+		enc *json.Encoder
+	}
+)
+
+// NewJSONFrameRecorder creates a FrameRecorder that writes each Frame as a JSON line into w, such as an *os.File,
+// which can be replayed by the replay package.
+func NewJSONFrameRecorder(w io.Writer) FrameRecorder {
+	return &jsonFrameRecorder{
+		enc: json.NewEncoder(w),
+	}
+}
+
+func (r *jsonFrameRecorder) Record(f Frame) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_ = r.enc.Encode(f)
+}
+
+// SetRecordUID enables or disables recording the frames of the clients authorized as the uid
+// to Options.FrameRecorder at runtime, such as for reproducing a bug reported by a player.
+func SetRecordUID(uid string, enabled bool) {
+	recordUIDs.set(uid, enabled)
+}
+
+// RecordUIDs returns the uids whose frames are recorded, in ascending order.
+func RecordUIDs() []string {
+	return recordUIDs.list()
+}
+
+// recordFrame records the message read or written at the time if the uid of the Client is selected,
+// the message is given as segments as written by writeToTransport.
+func (c *Client) recordFrame(dir MessageDirection, bufs net.Buffers, at time.Time) {
+	if c.opts.FrameRecorder == nil {
+		return
+	}
+	uid := c.UID()
+	if uid == "" || !recordUIDs.contains(uid) {
+		return
+	}
+	// Copy, since the data is reused once handled or written.
+	var data []byte
+	for _, b := range bufs {
+		data = append(data, b...)
+	}
+	c.opts.FrameRecorder.Record(Frame{Direction: dir, Time: at, ClientID: c.id, UID: uid, Data: data})
+}
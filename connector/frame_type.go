@@ -0,0 +1,53 @@
+package connector
+
+import "errors"
+
+const (
+	// FrameTypeText writes the messages in text frames, such as for the JSON debug clients.
+	FrameTypeText FrameType = "text"
+	// FrameTypeBinary writes the messages in binary frames, such as for the protobuf clients.
+	FrameTypeBinary FrameType = "binary"
+)
+
+var ErrUnsupportedFrameType = errors.New("ppcserver: unsupported frame type")
+
+type (
+	// FrameType is the type of the frames written to a Client whose Transport distinguishes text from binary frames,
+	// which the peer may choose by HandshakeRequest.FrameType.
+	FrameType string
+
+	// FrameTypeSetter is optionally implemented by a Transport distinguishing text from binary frames,
+	// such as the WebSocket transport, to switch the FrameType of the frames written as chosen by the handshake.
+	FrameTypeSetter interface {
+		// FrameType should return the FrameType of the frames written.
+		FrameType() FrameType
+		// SetFrameType should set the FrameType of the frames written afterwards, it may be called concurrently
+		// with the writes.
+		SetFrameType(t FrameType)
+	}
+)
+
+// FrameType returns the FrameType of the frames written to the Client, empty if its Transport does not distinguish
+// text from binary frames.
+func (c *Client) FrameType() FrameType {
+	if s, ok := c.transport.(FrameTypeSetter); ok {
+		return s.FrameType()
+	}
+	return ""
+}
+
+// selectFrameType switches the Transport of the Client to the FrameType chosen by the peer, empty keeps the default
+// FrameType of the transport encoding. It's ignored by a Transport not implementing FrameTypeSetter.
+func (c *Client) selectFrameType(t FrameType) error {
+	switch t {
+	case "":
+		return nil
+	case FrameTypeText, FrameTypeBinary:
+	default:
+		return ErrUnsupportedFrameType
+	}
+	if s, ok := c.transport.(FrameTypeSetter); ok {
+		s.SetFrameType(t)
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+package connector
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// RouteHandshake is the route of the one-way Message pushed to the peer as soon as connected,
+	// carrying the Handshake negotiated by the server. It is only pushed when the heartbeat is enabled.
+	// The peer may also send it with a HandshakeRequest to declare its Protocol version, see Client.handleHandshake.
+	RouteHandshake = "handshake"
+
+	// RoutePing is the route of the one-way Message sent every Options.HeartbeatInterval,
+	// by the server in HeartbeatModeServerPing, or by the peer in HeartbeatModeClientPing.
+	RoutePing = "ping"
+
+	// RoutePong is the route of the one-way Message replied to a RoutePing Message, echoing the data of the RoutePing.
+	// The application data of Options.HeartbeatData is added as the "app" field if the echoed data is an object,
+	// otherwise the data is a Ping with the Timestamp of the RoutePing Message and the application data.
+	RoutePong = "pong"
+
+	// HeartbeatModeServerPing is the HeartbeatMode that the server pushes RoutePing and the peer replies RoutePong,
+	// suitable for web clients.
+	HeartbeatModeServerPing HeartbeatMode = "server_ping"
+
+	// HeartbeatModeClientPing is the HeartbeatMode that the peer sends RoutePing as keepalive and the server
+	// replies RoutePong, suitable for mobile clients that manage their own radio wakeups.
+	HeartbeatModeClientPing HeartbeatMode = "client_ping"
+
+	// closeReasonHeartbeatTimeout is the close reason of a Client missing Options.HeartbeatMaxMissed heartbeats.
+	closeReasonHeartbeatTimeout = "heartbeat timeout"
+
+	// numPingers is the number of the pingers shared by the clients with Options.HeartbeatData.
+	numPingers = 4
+)
+
+var (
+	pingersOnce sync.Once
+	pingers     *pingQueue
+)
+
+// HeartbeatMode is the direction of the heartbeat pings.
+// In either mode, any message received from the peer counts as a beat.
+type HeartbeatMode string
+
+// Ping is the data of the RoutePing Message pushed by the server, which the peer echoes in the RoutePong Message
+// for measuring the RTT of the Client.
+type Ping struct {
+	// Timestamp is the Unix time in microseconds when the RoutePing Message is pushed,
+	// which is precise enough and safe as a JavaScript number.
+	Timestamp int64 `json:"ts"`
+	// App is the application data returned by Options.HeartbeatData, omitted if nil.
+	App interface{} `json:"app,omitempty"`
+}
+
+// Handshake is the data of the RouteHandshake Message.
+type Handshake struct {
+	// Version is the Protocol.Version selected by the HandshakeRequest of the peer.
+	Version string `json:"version,omitempty"`
+	// HeartbeatMode is the direction of the heartbeat pings.
+	HeartbeatMode HeartbeatMode `json:"heartbeat_mode"`
+	// ClientID is the ID of the Client in the server process.
+	ClientID uint64 `json:"client_id"`
+	// HeartbeatInterval is the interval in milliseconds of the heartbeat,
+	// the peer is disconnected when it sends nothing for HeartbeatMaxMissed intervals.
+	HeartbeatInterval int64 `json:"heartbeat_interval"`
+	// HeartbeatMaxMissed is the number of consecutive heartbeat intervals without any message from the peer,
+	// after which the peer is disconnected.
+	HeartbeatMaxMissed int `json:"heartbeat_max_missed"`
+	// Nonce is the server nonce to derive the signing key, set on the reply to the first HandshakeRequest
+	// when Options.SigningSecret or Options.KeyExchange is set, see DeriveSigningKey.
+	Nonce []byte `json:"nonce,omitempty"`
+	// PublicKey is the ephemeral X25519 public key of the server, set on the reply to the first HandshakeRequest
+	// when Options.KeyExchange is set, see DeriveSessionSecret.
+	PublicKey []byte `json:"public_key,omitempty"`
+	// FrameType is the type of the frames written to the peer, empty if the transport does not distinguish
+	// text from binary frames.
+	FrameType FrameType `json:"frame_type,omitempty"`
+}
+
+// handshake returns the Handshake negotiated with the Client.
+func (c *Client) handshake() Handshake {
+	hs := Handshake{
+		Version:   c.Protocol().Version,
+		ClientID:  c.id,
+		FrameType: c.FrameType(),
+	}
+	if c.opts.HeartbeatInterval > 0 {
+		hs.HeartbeatMode = c.opts.HeartbeatMode
+		hs.HeartbeatInterval = c.opts.HeartbeatInterval.Milliseconds()
+		hs.HeartbeatMaxMissed = c.opts.HeartbeatMaxMissed
+	}
+	return hs
+}
+
+// startHeartbeat pushes the Handshake and schedules the first heartbeat, if the heartbeat is enabled.
+func (c *Client) startHeartbeat() {
+	if c.opts.HeartbeatInterval <= 0 {
+		return
+	}
+
+	if err := c.Push(RouteHandshake, c.handshake()); err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.heartbeatTimer = afterFunc(c.opts.HeartbeatInterval, c.heartbeat)
+	c.mu.Unlock()
+}
+
+// stopHeartbeat stops the heartbeat of the closed Client.
+func (c *Client) stopHeartbeat() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.heartbeatTimer != nil {
+		c.heartbeatTimer.Stop()
+	}
+}
+
+// markAlive records that a message is received from the peer during the current heartbeat interval.
+func (c *Client) markAlive() {
+	if atomic.LoadInt32(&c.alive) == 0 {
+		atomic.StoreInt32(&c.alive, 1)
+	}
+}
+
+// heartbeat is called by the timing wheel every Options.HeartbeatInterval.
+// Any message received from the peer counts as a beat, so a busy Client does not depend on the pong.
+func (c *Client) heartbeat() {
+	if c.State() == ClientStateClosed {
+		return
+	}
+
+	if atomic.CompareAndSwapInt32(&c.alive, 1, 0) {
+		c.missedBeats = 0
+	} else {
+		c.missedBeats++
+		if c.missedBeats >= c.opts.HeartbeatMaxMissed {
+			c.Logger().Info("Client heartbeat timeout")
+			c.closeWithCause(DisconnectCauseIdleTimeout, closeReasonHeartbeatTimeout)
+			return
+		}
+	}
+
+	if c.opts.HeartbeatMode != HeartbeatModeClientPing {
+		if c.opts.HeartbeatData != nil {
+			// HeartbeatData is evaluated off the timing wheel, which is shared by the timers of all the clients.
+			schedulePing(c)
+		} else {
+			_ = c.Ping()
+		}
+	}
+
+	c.mu.Lock()
+	if c.state != ClientStateClosed {
+		c.heartbeatTimer.Reset(c.opts.HeartbeatInterval)
+	}
+	c.mu.Unlock()
+}
+
+// pingQueue is a FIFO queue of the clients waiting for the pingers, each Client appears in the queue at most once,
+// so that a slow HeartbeatData delays the pings instead of piling up a goroutine per Client every heartbeat.
+type pingQueue struct {
+	mu    sync.Mutex // mu guards queue.
+	cond  *sync.Cond
+	queue []*Client
+}
+
+// schedulePing queues c to be pinged by the pingers, which are started on the first call,
+// unless c is already queued or being pinged, in which case the heartbeat skips the ping.
+func schedulePing(c *Client) {
+	if !atomic.CompareAndSwapInt32(&c.pingScheduled, 0, 1) {
+		return
+	}
+	pingersOnce.Do(
+		func() {
+			pingers = &pingQueue{}
+			pingers.cond = sync.NewCond(&pingers.mu)
+			for i := 0; i < numPingers; i++ {
+				go pingers.run()
+			}
+		},
+	)
+	pingers.mu.Lock()
+	pingers.queue = append(pingers.queue, c)
+	pingers.mu.Unlock()
+	pingers.cond.Signal()
+}
+
+func (q *pingQueue) run() {
+	for {
+		q.mu.Lock()
+		for len(q.queue) == 0 {
+			q.cond.Wait()
+		}
+		c := q.queue[0]
+		q.queue[0] = nil
+		q.queue = q.queue[1:]
+		q.mu.Unlock()
+
+		if c.State() != ClientStateClosed {
+			_ = c.Ping()
+		}
+		atomic.StoreInt32(&c.pingScheduled, 0)
+	}
+}
+
+// handleHeartbeat handles the RoutePing and RoutePong messages of the peer, it returns false for the other messages.
+// The peer may send RoutePing in either HeartbeatMode, such as to probe the connection after waking up.
+func (c *Client) handleHeartbeat(m *Message) bool {
+	switch m.Route {
+	case RoutePong:
+		var p Ping
+		if len(m.Data) > 0 && c.codec().Unmarshal(m.Data, &p) == nil && p.Timestamp > 0 {
+			c.observeRTT(now().Sub(time.UnixMicro(p.Timestamp)))
+		}
+		return true
+	case RoutePing:
+		// Echo the data, so that the peer can measure the RTT by its own clock.
+		var v interface{}
+		if len(m.Data) > 0 {
+			v = json.RawMessage(m.Data)
+		}
+		if app := c.heartbeatData(); app != nil {
+			var pong map[string]interface{}
+			if len(m.Data) == 0 || c.codec().Unmarshal(m.Data, &pong) == nil {
+				if pong == nil {
+					pong = make(map[string]interface{}, 1)
+				}
+				pong["app"] = app
+				v = pong
+			} else {
+				// The data is not an object decodable by the Codec, reply a Ping with its Timestamp if any instead,
+				// so that the application data is never dropped.
+				var p Ping
+				_ = c.codec().Unmarshal(m.Data, &p)
+				v = Ping{Timestamp: p.Timestamp, App: app}
+			}
+		}
+		_ = c.Push(RoutePong, v)
+		return true
+	default:
+		return false
+	}
+}
+
+// Ping pushes a RoutePing Message with the current timestamp, the RTT of the Client is updated
+// once the peer echoes it in the RoutePong Message. It is called every heartbeat in HeartbeatModeServerPing,
+// and can be called explicitly in any mode, such as before matchmaking.
+func (c *Client) Ping() error {
+	return c.Push(RoutePing, Ping{Timestamp: now().UnixMicro(), App: c.heartbeatData()})
+}
+
+// heartbeatData returns the application data of Options.HeartbeatData for the Client, nil if not set.
+func (c *Client) heartbeatData() interface{} {
+	if c.opts.HeartbeatData == nil {
+		return nil
+	}
+	return c.opts.HeartbeatData(c)
+}
+
+// RTT returns the smoothed round-trip time between the server and the peer,
+// zero if not measured yet. See Ping for how the RTT is measured.
+func (c *Client) RTT() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.rtt))
+}
+
+// observeRTT updates the smoothed RTT with a sample, weighting the sample by 1/8 as the TCP SRTT.
+func (c *Client) observeRTT(sample time.Duration) {
+	if sample < 0 {
+		return
+	}
+	rttDurations.Observe(sample.Seconds())
+	for {
+		old := atomic.LoadInt64(&c.rtt)
+		srtt := int64(sample)
+		if old != 0 {
+			srtt = old + (int64(sample)-old)/8
+		}
+		if atomic.CompareAndSwapInt64(&c.rtt, old, srtt) {
+			return
+		}
+	}
+}
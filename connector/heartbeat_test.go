@@ -0,0 +1,124 @@
+package connector_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pom-pom-crafts/ppcserver/clock"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/transporttest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// receiveRoute returns the first Message of the route received by the peer, skipping the others.
+func receiveRoute(t *testing.T, peer *transporttest.Peer, route string) *connector.Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for {
+		m, err := peer.ReceiveMessage(ctx)
+		if err != nil {
+			t.Fatalf("receive %s: %v", route, err)
+		}
+		if m.Route == route {
+			return m
+		}
+	}
+}
+
+func TestHeartbeatDataOffTimingWheel(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	connector.SetClock(clk)
+	defer connector.SetClock(nil)
+
+	release := make(chan struct{})
+	opts := connector.NewOptions(
+		connector.WithHeartbeat(time.Second, 3),
+		connector.WithHeartbeatData(
+			func(*connector.Client) interface{} {
+				<-release
+				return "notice"
+			},
+		),
+	)
+	peer, _ := transporttest.Serve(context.Background(), opts)
+	defer peer.Close()
+	receiveRoute(t, peer, connector.RouteHandshake)
+
+	advanced := make(chan struct{})
+	go func() {
+		clk.Advance(time.Second)
+		close(advanced)
+	}()
+	select {
+	case <-advanced:
+	case <-time.After(time.Second):
+		t.Fatal("a blocking HeartbeatData blocks the timing wheel")
+	}
+
+	close(release)
+	var p connector.Ping
+	if err := json.Unmarshal(receiveRoute(t, peer, connector.RoutePing).Data, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.App != "notice" {
+		t.Fatalf("ping App = %v, want %q", p.App, "notice")
+	}
+}
+
+func TestSlowHeartbeatDataSkipsPings(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	connector.SetClock(clk)
+	defer connector.SetClock(nil)
+
+	var calls int32
+	release := make(chan struct{})
+	opts := connector.NewOptions(
+		connector.WithHeartbeat(time.Second, 10),
+		connector.WithHeartbeatData(
+			func(*connector.Client) interface{} {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return "notice"
+			},
+		),
+	)
+	peer, _ := transporttest.Serve(context.Background(), opts)
+	defer peer.Close()
+	receiveRoute(t, peer, connector.RouteHandshake)
+
+	for i := 0; i < 5; i++ {
+		clk.Advance(time.Second)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("HeartbeatData is called %d times while blocked, want 1", n)
+	}
+
+	close(release)
+	receiveRoute(t, peer, connector.RoutePing)
+	clk.Advance(time.Second)
+	receiveRoute(t, peer, connector.RoutePing)
+}
+
+func TestPongKeepsHeartbeatDataForNonObjectPing(t *testing.T) {
+	opts := connector.NewOptions(
+		connector.WithHeartbeatData(func(*connector.Client) interface{} { return "notice" }),
+	)
+	peer, _ := transporttest.Serve(context.Background(), opts)
+	defer peer.Close()
+
+	for _, data := range []string{`{"ts":42,"seq":7}`, `42`} {
+		if err := peer.SendMessage(&connector.Message{Route: connector.RoutePing, Data: json.RawMessage(data)}); err != nil {
+			t.Fatal(err)
+		}
+		var pong map[string]interface{}
+		if err := json.Unmarshal(receiveRoute(t, peer, connector.RoutePong).Data, &pong); err != nil {
+			t.Fatal(err)
+		}
+		if pong["app"] != "notice" {
+			t.Fatalf("pong of %s = %v, want the app data", data, pong)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package connector
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"golang.org/x/crypto/curve25519"
+)
+
+var ErrKeyExchangeRequired = errors.New("ppcserver: handshake public key is required for the key exchange")
+
+// sessionKeys are the keys of a Client derived by the handshake.
+type sessionKeys struct {
+	// secret is the session secret agreed by the key exchange, nil without Options.KeyExchange.
+	secret []byte
+	// signing is the key of the message signing.
+	signing []byte
+}
+
+// NewKeyExchangeKey generates an ephemeral X25519 key pair for the key exchange of a handshake,
+// pub is sent as the HandshakeRequest.PublicKey by the peers written in Go.
+func NewKeyExchangeKey() (priv, pub []byte, err error) {
+	priv = make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(priv); err != nil {
+		return nil, nil, err
+	}
+	pub, err = curve25519.X25519(priv, curve25519.Basepoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	return priv, pub, nil
+}
+
+// DeriveSessionSecret derives the session secret agreed by the X25519 key exchange of a handshake, from the private
+// key of a side, the public key of the other side, and the public keys of the HandshakeRequest and the Handshake.
+// The shared point is mixed with secret, which is the secret shared with the peer or nil,
+// as HMAC-SHA256(secret || shared point, label || clientPub || serverPub).
+func DeriveSessionSecret(secret, priv, peerPub, clientPub, serverPub []byte) ([]byte, error) {
+	shared, err := curve25519.X25519(priv, peerPub)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, append(append([]byte(nil), secret...), shared...))
+	mac.Write([]byte("ppcserver key exchange"))
+	mac.Write(clientPub)
+	mac.Write(serverPub)
+	return mac.Sum(nil), nil
+}
+
+// DeriveSessionKey derives the key for the label from the session secret, as HMAC-SHA256(secret, label).
+func DeriveSessionKey(secret []byte, label string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(label))
+	return mac.Sum(nil)
+}
+
+// SessionKey derives a key of the Client for the label from the session secret agreed by the key exchange,
+// such as a key of the application payload encryption, or nil if Options.KeyExchange is not set or
+// the handshake is not done yet. The peer derives the same key by DeriveSessionKey.
+func (c *Client) SessionKey(label string) []byte {
+	keys, _ := c.keys.Load().(*sessionKeys)
+	if keys == nil || keys.secret == nil {
+		return nil
+	}
+	return DeriveSessionKey(keys.secret, label)
+}
+
+// exchangeKeys completes the key exchange with the public key of the HandshakeRequest,
+// it returns the session secret and the server public key for the Handshake replied.
+func (c *Client) exchangeKeys(clientPub []byte) (secret, serverPub []byte, err error) {
+	if len(clientPub) != curve25519.PointSize {
+		return nil, nil, ErrKeyExchangeRequired
+	}
+	priv, serverPub, err := NewKeyExchangeKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	secret, err = DeriveSessionSecret(c.opts.SigningSecret, priv, clientPub, clientPub, serverPub)
+	if err != nil {
+		return nil, nil, err
+	}
+	return secret, serverPub, nil
+}
@@ -0,0 +1,59 @@
+package connector_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/transporttest"
+	"testing"
+)
+
+func TestKeyExchange(t *testing.T) {
+	const label = "payload encryption"
+	router := connector.NewRouter()
+	router.Handle(
+		"session_key", func(_ context.Context, c *connector.Client, _ *connector.Message) (interface{}, error) {
+			return c.SessionKey(label), nil
+		},
+	)
+	opts := connector.NewOptions(connector.WithRouter(router), connector.WithKeyExchange())
+	peer, _ := transporttest.Serve(context.Background(), opts)
+	defer peer.Close()
+
+	priv, pub, err := connector.NewKeyExchangeKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := newNonce(t)
+	hs := handshake(t, peer, connector.HandshakeRequest{Nonce: nonce, PublicKey: pub})
+	secret, err := connector.DeriveSessionSecret(nil, priv, hs.PublicKey, pub, hs.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The key agreed by the peer signs the messages, and derives the same session keys as the server.
+	m := &connector.Message{ID: 2, Route: "session_key"}
+	connector.SignMessage(connector.DeriveSigningKey(secret, nonce, hs.Nonce), m)
+	resp := call(t, peer, m)
+	var serverKey []byte
+	if err := json.Unmarshal(resp.Data, &serverKey); err != nil || resp.Error != "" {
+		t.Fatalf("session_key response = %+v, %v", resp, err)
+	}
+	if !bytes.Equal(serverKey, connector.DeriveSessionKey(secret, label)) {
+		t.Fatal("the session keys of the server and the peer differ")
+	}
+}
+
+func TestKeyExchangeRequiresPublicKey(t *testing.T) {
+	peer, done := transporttest.Serve(context.Background(), connector.NewOptions(connector.WithKeyExchange()))
+	defer peer.Close()
+
+	data, _ := json.Marshal(connector.HandshakeRequest{Nonce: newNonce(t)})
+	if err := peer.SendMessage(&connector.Message{Route: connector.RouteHandshake, Data: data}); err != nil {
+		t.Fatal(err)
+	}
+	if d := waitClosed(t, done); d.Cause != connector.DisconnectCauseProtocolError {
+		t.Fatalf("cause = %v, want DisconnectCauseProtocolError", d.Cause)
+	}
+}
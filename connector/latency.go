@@ -0,0 +1,41 @@
+package connector
+
+import "github.com/pom-pom-crafts/ppcserver/metrics"
+
+// Latency histograms of all the clients and rooms in the current process, in seconds.
+var (
+	handlerDurations = metrics.NewHistogramVec(metrics.DefBuckets)
+	fanoutDurations  = metrics.NewHistogram(metrics.DefBuckets)
+	writeQueueWaits  = metrics.NewHistogram(metrics.DefBuckets)
+	rttDurations     = metrics.NewHistogram(metrics.DefBuckets)
+)
+
+// SetLatencyBuckets sets the upper bounds in seconds of the latency histogram buckets,
+// so the exported metrics match the existing dashboards and SLO thresholds. It also resets the histograms.
+// Default is metrics.DefBuckets.
+func SetLatencyBuckets(upperBounds []float64) {
+	handlerDurations.SetBuckets(upperBounds)
+	fanoutDurations.SetBuckets(upperBounds)
+	writeQueueWaits.SetBuckets(upperBounds)
+	rttDurations.SetBuckets(upperBounds)
+}
+
+// HandlerDurations returns the snapshots of the handler execution time histograms keyed by route.
+func HandlerDurations() map[string]metrics.HistogramSnapshot {
+	return handlerDurations.Snapshot()
+}
+
+// FanoutDurations returns the snapshot of the room broadcast fanout time histogram.
+func FanoutDurations() metrics.HistogramSnapshot {
+	return fanoutDurations.Snapshot()
+}
+
+// WriteQueueWaits returns the snapshot of the histogram of the time messages wait in the write queues.
+func WriteQueueWaits() metrics.HistogramSnapshot {
+	return writeQueueWaits.Snapshot()
+}
+
+// RTTDurations returns the snapshot of the histogram of the RTT samples of all the clients.
+func RTTDurations() metrics.HistogramSnapshot {
+	return rttDurations.Snapshot()
+}
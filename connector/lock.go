@@ -0,0 +1,251 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/clock"
+	"sync"
+	"time"
+)
+
+var (
+	ErrLockHeld = errors.New("ppcserver: lock is held by another owner")
+	ErrLockLost = errors.New("ppcserver: lock is lost")
+)
+
+type (
+	// Locker keeps the locks shared by the server nodes, each held by one owner until released or expired,
+	// such as in the memory by default or in Redis by the redisstore package.
+	Locker interface {
+		// Lock acquires the lock of the key for the owner, which expires after ttl, or extends the lock already
+		// held by the owner. It returns ErrLockHeld if the lock is held by another owner.
+		Lock(ctx context.Context, key, owner string, ttl time.Duration) error
+		// Unlock releases the lock of the key if it's held by the owner.
+		Unlock(ctx context.Context, key, owner string) error
+	}
+
+	// Lease is a lock of a Locker held by the current process, which is extended every third of its TTL
+	// until released. The Lease is lost once the lock is taken by another owner, or it's not extended
+	// before the lock may have expired in the Locker, counting the TTL from the time each Lock request is sent,
+	// less a safety margin of a tenth of the TTL.
+	Lease struct {
+		locker   Locker
+		key      string
+		owner    string
+		ttl      time.Duration
+		stop     chan struct{} // stop is closed by Release to stop extending the lock.
+		stopOnce sync.Once
+		done     chan struct{} // done is closed once the Lease is released or lost.
+		doneOnce sync.Once
+		mu       sync.Mutex // mu guards err.
+		err      error
+	}
+
+	// roomLock is the lock of a Room created with WithRoomLock.
+	roomLock struct {
+		locker Locker
+		ttl    time.Duration
+		lease  *Lease // lease is set once acquired by createRoom.
+	}
+
+	// memoryLocker is a Locker in the memory of the current process.
+	memoryLocker struct {
+		mu    sync.Mutex // mu guards locks.
+		locks map[string]memoryLock
+	}
+
+	memoryLock struct {
+		owner     string
+		expiresAt time.Time
+	}
+)
+
+// NewMemoryLocker creates a Locker keeping the locks in the memory of the current process,
+// which only excludes the owners in the same process.
+func NewMemoryLocker() Locker {
+	return &memoryLocker{locks: make(map[string]memoryLock)}
+}
+
+func (l *memoryLocker) Lock(_ context.Context, key, owner string, ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	at := now()
+	if lock, ok := l.locks[key]; ok && lock.owner != owner && at.Before(lock.expiresAt) {
+		return ErrLockHeld
+	}
+	l.locks[key] = memoryLock{owner: owner, expiresAt: at.Add(ttl)}
+	return nil
+}
+
+func (l *memoryLocker) Unlock(_ context.Context, key, owner string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if lock, ok := l.locks[key]; ok && lock.owner == owner {
+		delete(l.locks, key)
+	}
+	return nil
+}
+
+// AcquireLease acquires the lock of the key by the Locker for ttl with a random owner, and keeps extending it
+// until Lease.Release is called. It returns ErrLockHeld if the lock is held by another owner.
+func AcquireLease(ctx context.Context, l Locker, key string, ttl time.Duration) (*Lease, error) {
+	owner := newRandomID()
+	// The TTL in the Locker starts at some point during the request, so count it from before the request.
+	lockedAt := now()
+	if err := l.Lock(ctx, key, owner, ttl); err != nil {
+		return nil, err
+	}
+	lease := &Lease{
+		locker: l,
+		key:    key,
+		owner:  owner,
+		ttl:    ttl,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	lease.extend(lockedAt)
+	return lease, nil
+}
+
+// Key returns the key of the lock.
+func (l *Lease) Key() string {
+	return l.key
+}
+
+// Done returns a channel closed once the Lease is released or lost.
+func (l *Lease) Done() <-chan struct{} {
+	return l.done
+}
+
+// Err returns ErrLockLost if the Lease is lost, nil if it's held or released.
+func (l *Lease) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Release stops extending the lock and releases it.
+func (l *Lease) Release(ctx context.Context) error {
+	l.stopOnce.Do(func() { close(l.stop) })
+	<-l.done
+	if l.Err() != nil {
+		return nil
+	}
+	return l.locker.Unlock(ctx, l.key, l.owner)
+}
+
+// extend starts extending the lock every third of the TTL until released. The Lease is lost once the lock is held
+// by another owner, or by a timer once the lock locked at lockedAt, or extended since, may have expired.
+// The timers are scheduled before it returns, so that they count from the current time of the clock.
+func (l *Lease) extend(lockedAt time.Time) {
+	clk := leaseClock()
+	expiry := clk.AfterFunc(l.heldUntil(lockedAt).Sub(clk.Now()), func() { l.finish(ErrLockLost) })
+	// The timer signals instead of a channel timer, so that it works the same on any clock.Clock.
+	tick := make(chan struct{}, 1)
+	ticker := clk.AfterFunc(
+		l.ttl/3, func() {
+			select {
+			case tick <- struct{}{}:
+			default:
+			}
+		},
+	)
+
+	go func() {
+		defer expiry.Stop()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-l.stop:
+				l.finish(nil)
+				return
+			case <-l.done:
+				return
+			case <-tick:
+			}
+
+			sentAt := clk.Now()
+			ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+			err := l.locker.Lock(ctx, l.key, l.owner, l.ttl)
+			cancel()
+			switch {
+			case err == nil:
+				expiry.Reset(l.heldUntil(sentAt).Sub(clk.Now()))
+			case errors.Is(err, ErrLockHeld):
+				l.finish(ErrLockLost)
+				return
+			}
+			ticker.Reset(l.ttl / 3)
+		}
+	}()
+}
+
+// heldUntil returns the time the lock locked by a request sent at sentAt is surely held until.
+func (l *Lease) heldUntil(sentAt time.Time) time.Time {
+	return sentAt.Add(l.ttl - l.ttl/10)
+}
+
+// finish closes done with err, only the first call takes effect.
+func (l *Lease) finish(err error) {
+	l.doneOnce.Do(
+		func() {
+			l.mu.Lock()
+			l.err = err
+			l.mu.Unlock()
+			close(l.done)
+		},
+	)
+}
+
+// leaseClock returns the clock.Clock set by SetClock, or the real clock.
+func leaseClock() clock.Clock {
+	if c := currentClock(); c != nil {
+		return c
+	}
+	return clock.Real()
+}
+
+// WithRoomLock is a RoomOption to hold the lock of the Room by the Locker shared by the server nodes while the Room
+// is open, so that the authoritative logic of the Room runs on exactly one node at a time. CreateRoom returns
+// ErrLockHeld if the Room is open on another node, and the Room is closed once its Lease is lost.
+func WithRoomLock(l Locker, ttl time.Duration) RoomOption {
+	return func(r *Room) {
+		r.lock = &roomLock{locker: l, ttl: ttl}
+	}
+}
+
+// acquireLock acquires the Lease of the Room created with WithRoomLock, and closes the Room once it's lost.
+func (r *Room) acquireLock() error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.lock.ttl)
+	defer cancel()
+	lease, err := AcquireLease(ctx, r.lock.locker, "room:"+r.key(), r.lock.ttl)
+	if err != nil {
+		return err
+	}
+	r.lock.lease = lease
+	go func() {
+		<-lease.Done()
+		if lease.Err() != nil {
+			r.Close()
+		}
+	}()
+	return nil
+}
+
+// releaseLock releases the Lease of the closed Room.
+func (r *Room) releaseLock() {
+	if r.lock == nil || r.lock.lease == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.lock.ttl)
+	defer cancel()
+	_ = r.lock.lease.Release(ctx)
+}
+
+// Lease returns the Lease of the Room created with WithRoomLock, nil otherwise.
+func (r *Room) Lease() *Lease {
+	if r.lock == nil {
+		return nil
+	}
+	return r.lock.lease
+}
@@ -0,0 +1,129 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/clock"
+	"sync"
+	"testing"
+	"time"
+)
+
+// scriptedLocker takes latency on the fake clock to lock, and fails the extensions with err.
+type scriptedLocker struct {
+	clk     *clock.Fake
+	latency time.Duration
+	err     error
+	mu      sync.Mutex // mu guards calls.
+	calls   int
+}
+
+func (l *scriptedLocker) Lock(context.Context, string, string, time.Duration) error {
+	l.mu.Lock()
+	l.calls++
+	first := l.calls == 1
+	l.mu.Unlock()
+	if first {
+		l.clk.Advance(l.latency)
+		return nil
+	}
+	return l.err
+}
+
+func (l *scriptedLocker) Unlock(context.Context, string, string) error {
+	return nil
+}
+
+func useFakeClock(t *testing.T) *clock.Fake {
+	t.Helper()
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	SetClock(clk)
+	t.Cleanup(func() { SetClock(nil) })
+	return clk
+}
+
+func waitDone(t *testing.T, l *Lease) {
+	t.Helper()
+	select {
+	case <-l.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Lease is not done")
+	}
+}
+
+func TestLeaseLostBeforeLockExpires(t *testing.T) {
+	clk := useFakeClock(t)
+	start := clk.Now()
+	locker := &scriptedLocker{clk: clk, latency: 2 * time.Second, err: errors.New("unavailable")}
+	lease, err := AcquireLease(context.Background(), locker, "k", 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The lock may expire 10s after the request is sent, the Lease must be lost before, not 10s after the response.
+	clk.Set(start.Add(8900 * time.Millisecond))
+	if lease.Err() != nil {
+		t.Fatalf("Lease lost early: %v", lease.Err())
+	}
+	clk.Set(start.Add(9100 * time.Millisecond))
+	waitDone(t, lease)
+	if !errors.Is(lease.Err(), ErrLockLost) {
+		t.Fatalf("Err() = %v, want ErrLockLost", lease.Err())
+	}
+}
+
+func TestLeaseLostOnLockHeld(t *testing.T) {
+	clk := useFakeClock(t)
+	locker := &scriptedLocker{clk: clk, err: ErrLockHeld}
+	lease, err := AcquireLease(context.Background(), locker, "k", 9*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clk.Advance(3 * time.Second)
+	waitDone(t, lease)
+	if !errors.Is(lease.Err(), ErrLockLost) {
+		t.Fatalf("Err() = %v, want ErrLockLost", lease.Err())
+	}
+}
+
+func TestLeaseExtendedAndReleased(t *testing.T) {
+	clk := useFakeClock(t)
+	locker := NewMemoryLocker()
+	lease, err := AcquireLease(context.Background(), locker, "k", 9*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AcquireLease(context.Background(), locker, "k", 9*time.Second); !errors.Is(err, ErrLockHeld) {
+		t.Fatalf("AcquireLease() of a held lock = %v, want ErrLockHeld", err)
+	}
+
+	// Each extension runs asynchronously after its tick, so wait for it before moving on.
+	for i := 0; i < 6; i++ {
+		clk.Advance(3 * time.Second)
+		deadline := time.Now().Add(time.Second)
+		for locker.(*memoryLocker).expiresAt("k") != clk.Now().Add(9*time.Second) {
+			if time.Now().After(deadline) {
+				t.Fatalf("lock is not extended at tick %d", i)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if lease.Err() != nil {
+		t.Fatalf("Lease lost while extended: %v", lease.Err())
+	}
+
+	if err := lease.Release(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	other, err := AcquireLease(context.Background(), locker, "k", 9*time.Second)
+	if err != nil {
+		t.Fatalf("AcquireLease() after Release = %v", err)
+	}
+	_ = other.Release(context.Background())
+}
+
+func (l *memoryLocker) expiresAt(key string) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.locks[key].expiresAt
+}
@@ -0,0 +1,37 @@
+package connector
+
+import (
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"strconv"
+	"strings"
+)
+
+// logInbound logs the Message received at LevelDebug, with the Data truncated to Options.LogPayloadLimit or
+// redacted for Options.LogRedactRoutes. Nothing is formatted if the debug entries are not written.
+func (c *Client) logInbound(m *Message) {
+	l := c.Logger()
+	if !logging.Enabled(l, logging.LevelDebug) {
+		return
+	}
+	l.Debug(
+		"Client message received",
+		logging.F("id", m.ID), logging.F("route", m.Route), logging.F("data", c.logPayload(m.Route, m.Data)),
+	)
+}
+
+// logPayload returns the data of the route as logged.
+func (c *Client) logPayload(route string, data []byte) string {
+	for _, p := range c.opts.LogRedactRoutes {
+		if p == route || (strings.HasSuffix(p, "*") && strings.HasPrefix(route, p[:len(p)-1])) {
+			return "[REDACTED]"
+		}
+	}
+	if limit := c.opts.LogPayloadLimit; limit > 0 && len(data) > limit {
+		return string(data[:limit]) + "...(" + strconv.Itoa(len(data)) + " bytes)"
+	}
+	return string(data)
+}
+
+func (l uidLogger) Enabled(level logging.Level) bool {
+	return debugUIDs.contains(l.uid) || logging.Enabled(l.Logger, level)
+}
@@ -0,0 +1,49 @@
+package connector
+
+import (
+	"context"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"net"
+	"sync/atomic"
+)
+
+// RouteLogout is the route of the Message the peer sends to close the Client intentionally, such as on a logout,
+// instead of dropping the connection. The server writes the messages queued before it, responds to it, or pushes
+// it back if it's one-way, as the acknowledgement, and then closes the Client with DisconnectCauseLogout.
+// The Session of the Client is deleted, so it can't be resumed.
+const RouteLogout = "logout"
+
+// closeReasonLogout is the reason of the Disconnect of a Client closed by RouteLogout.
+const closeReasonLogout = "logged out by the peer"
+
+// handleLogout closes the Client gracefully on the RouteLogout Message, it returns false for the other messages.
+// The messages received afterwards are discarded.
+func (c *Client) handleLogout(ctx context.Context, m *Message) bool {
+	if m.Route != RouteLogout {
+		return false
+	}
+
+	atomic.StoreInt32(&c.closing, 1)
+	c.deleteSession(ctx)
+	cause := Disconnect{Cause: DisconnectCauseLogout, Reason: closeReasonLogout}
+	ack, err := c.codec().Marshal(&Message{ID: m.ID, Route: RouteLogout})
+	if err != nil || c.enqueueWrite(queuedWrite{bufs: net.Buffers{ack}, closing: cause}) != nil {
+		c.cancelCtx(cause)
+	}
+	return true
+}
+
+// deleteSession deletes the Session of the Client from Options.SessionStore, so that it's neither resumed nor
+// saved again once the Client is closed.
+func (c *Client) deleteSession(ctx context.Context) {
+	c.mu.Lock()
+	sess := c.session
+	c.session = nil
+	c.mu.Unlock()
+	if sess == nil {
+		return
+	}
+	if err := c.opts.SessionStore.Delete(ctx, sess.ID); err != nil {
+		c.Logger().Error("SessionStore.Delete() error", logging.Err(err))
+	}
+}
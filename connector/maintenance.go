@@ -0,0 +1,46 @@
+package connector
+
+import (
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"sync/atomic"
+)
+
+var ErrMaintenance = errors.New("ppcserver: server is under maintenance")
+
+// maintenance holds the maintenanceMode, which the connectors check for each new Client.
+var maintenance atomic.Value
+
+// maintenanceMode is the state of the maintenance mode set by SetMaintenance.
+type maintenanceMode struct {
+	enabled bool
+	reason  string
+}
+
+// SetMaintenance toggles the maintenance mode, in which the new clients are accepted only to be closed
+// with CloseCodeMaintenance and the reason, such as "back at 10:00 UTC", while the existing clients are
+// left untouched. Unlike the drain mode, the connectors stay ready, and the peer is told why it's rejected.
+// The reason defaults to ErrMaintenance if empty.
+func SetMaintenance(enabled bool, reason string) {
+	if reason == "" {
+		reason = ErrMaintenance.Error()
+	}
+	maintenance.Store(maintenanceMode{enabled: enabled, reason: reason})
+}
+
+// Maintenance reports whether the maintenance mode is on, and the reason told to the rejected clients.
+func Maintenance() (enabled bool, reason string) {
+	m, _ := maintenance.Load().(maintenanceMode)
+	return m.enabled, m.reason
+}
+
+// checkMaintenance closes the new Client with CloseCodeMaintenance and returns false in the maintenance mode.
+func (c *Client) checkMaintenance() bool {
+	enabled, reason := Maintenance()
+	if !enabled {
+		return true
+	}
+	c.Logger().Info("Client rejected", logging.Err(ErrMaintenance))
+	c.CloseWithNotice(CloseCodeMaintenance, reason)
+	return false
+}
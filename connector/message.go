@@ -0,0 +1,25 @@
+package connector
+
+import "encoding/json"
+
+// Message is the envelope of every message exchanged between server and client.
+type Message struct {
+	// ID correlates a request with its response, the response echoes the ID of its request.
+	// Zero means a one-way message that expects no response.
+	ID uint64 `json:"id,omitempty"`
+	// Seq is the sequence number of a push to a Room with history or a push sent by Client.PushWithAck,
+	// for replay and deduplication by the peer.
+	Seq uint64 `json:"seq,omitempty"`
+	// Ack is set on a push sent by Client.PushWithAck, which the peer acknowledges by a RouteAck Message with the Seq.
+	Ack bool `json:"ack,omitempty"`
+	// Route is the name of the handler registered to the Router that processes the message.
+	Route string `json:"route"`
+	// Data is the encoded payload of the message.
+	Data json.RawMessage `json:"data,omitempty"`
+	// Error is set on a response when the handler returns an error.
+	Error string `json:"error,omitempty"`
+	// Code is the ErrorCode of Error, so that the peer branches on it instead of parsing Error.
+	Code ErrorCode `json:"code,omitempty"`
+	// Sig is the HMAC of the Message sent by the peer when the message signing is enabled, see SignMessage.
+	Sig []byte `json:"sig,omitempty"`
+}
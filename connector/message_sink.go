@@ -0,0 +1,142 @@
+package connector
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MessageDirectionInbound  MessageDirection = "inbound"
+	MessageDirectionOutbound MessageDirection = "outbound"
+)
+
+type (
+	// MessageDirection is whether a MessageRecord is received from or sent to the peer.
+	MessageDirection string
+
+	// MessageRecord is a persisted Message of a Client, for chat history, moderation, and debugging.
+	MessageRecord struct {
+		Direction MessageDirection `json:"direction"`
+		Time      time.Time        `json:"time"`
+		ClientID  uint64           `json:"client_id"`
+		UID       string           `json:"uid,omitempty"`
+		ID        uint64           `json:"id,omitempty"`
+		Route     string           `json:"route"`
+		Data      json.RawMessage  `json:"data,omitempty"`
+		Error     string           `json:"error,omitempty"`
+	}
+
+	// MessageSink persists the MessageRecord of the routes selected by Options.MessageSinkRoutes,
+	// such as writing to a database or publishing to a broker topic.
+	// Persist is invoked synchronously from the Client goroutines, so it should not block for long.
+	MessageSink interface {
+		Persist(r MessageRecord)
+	}
+
+	// MessageSinkFunc is an adapter to allow the use of an ordinary function as MessageSink.
+	MessageSinkFunc func(r MessageRecord)
+
+	// jsonMessageSink writes MessageRecord as JSON lines into an io.Writer.
+	jsonMessageSink struct {
+		mu  sync.Mutex // mu guards enc since Persist is invoked concurrently.
+		enc *json.Encoder
+	}
+)
+
+// Persist calls f(r).
+func (f MessageSinkFunc) Persist(r MessageRecord) {
+	f(r)
+}
+
+// NewJSONMessageSink creates a MessageSink that writes each MessageRecord as a JSON line into w, such as an *os.File.
+func NewJSONMessageSink(w io.Writer) MessageSink {
+	return &jsonMessageSink{
+		enc: json.NewEncoder(w),
+	}
+}
+
+func (s *jsonMessageSink) Persist(r MessageRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = s.enc.Encode(r)
+}
+
+// persistRoute reports whether the messages of the route are persisted to Options.MessageSink.
+// The RouteAuth and RouteAuthRefresh messages are never persisted.
+// A pattern ending with "*" matches the routes with the prefix, such as "chat.*".
+func (c *Client) persistRoute(route string) bool {
+	// The auth messages carry the credentials, which are never persisted even if selected.
+	if c.opts.MessageSink == nil || route == RouteAuth || route == RouteAuthRefresh {
+		return false
+	}
+	if len(c.opts.MessageSinkRoutes) == 0 {
+		switch route {
+		case RouteHandshake, RoutePing, RoutePong, RouteTimeSync, RouteAck, RouteResume, RouteChallenge, RouteLogout:
+			return false
+		default:
+			return true
+		}
+	}
+	for _, p := range c.opts.MessageSinkRoutes {
+		if p == route || (strings.HasSuffix(p, "*") && strings.HasPrefix(route, p[:len(p)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// persistInbound persists the Message received, m.Data is copied since it is released after handled.
+func (c *Client) persistInbound(m *Message) {
+	if !c.persistRoute(m.Route) {
+		return
+	}
+	c.opts.MessageSink.Persist(
+		MessageRecord{
+			Direction: MessageDirectionInbound,
+			Time:      now(),
+			ClientID:  c.id,
+			UID:       c.UID(),
+			ID:        m.ID,
+			Route:     m.Route,
+			Data:      append(json.RawMessage(nil), m.Data...),
+		},
+	)
+}
+
+// persistOutbound persists the Message sent, data is the encoded payload which must not be modified afterwards.
+func (c *Client) persistOutbound(id uint64, route string, data []byte, errMsg string) {
+	c.opts.MessageSink.Persist(
+		MessageRecord{
+			Direction: MessageDirectionOutbound,
+			Time:      now(),
+			ClientID:  c.id,
+			UID:       c.UID(),
+			ID:        id,
+			Route:     route,
+			Data:      data,
+			Error:     errMsg,
+		},
+	)
+}
+
+// persistPush persists a one-way Message with the route and v sent, v is encoded only if the route is selected.
+func (c *Client) persistPush(route string, v interface{}) {
+	if !c.persistRoute(route) {
+		return
+	}
+	data, err := marshalData(c.codec(), v)
+	if err != nil {
+		return
+	}
+	c.persistOutbound(0, route, data, "")
+}
+
+// persistPushData is like persistPush, but with v already encoded by the Codec of the Client.
+func (c *Client) persistPushData(route string, data []byte) {
+	if c.persistRoute(route) {
+		c.persistOutbound(0, route, data, "")
+	}
+}
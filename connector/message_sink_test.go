@@ -0,0 +1,27 @@
+package connector
+
+import "testing"
+
+func TestPersistRouteExcludesCredentials(t *testing.T) {
+	tests := []struct {
+		routes []string
+		route  string
+		want   bool
+	}{
+		{nil, "chat.say", true},
+		{nil, RouteAuth, false},
+		{nil, RouteAuthRefresh, false},
+		{nil, RouteLogout, false},
+		{nil, RoutePing, false},
+		{[]string{"*"}, RouteAuth, false},
+		{[]string{RouteAuthRefresh}, RouteAuthRefresh, false},
+		{[]string{"chat.*"}, "chat.say", true},
+		{[]string{"chat.*"}, "move", false},
+	}
+	for _, tt := range tests {
+		c := &Client{opts: NewOptions(WithMessageSink(NewJSONMessageSink(nil), tt.routes...))}
+		if got := c.persistRoute(tt.route); got != tt.want {
+			t.Errorf("persistRoute(%q) with routes %v = %v, want %v", tt.route, tt.routes, got, tt.want)
+		}
+	}
+}
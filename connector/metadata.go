@@ -0,0 +1,120 @@
+package connector
+
+import "context"
+
+// The well-known metadata keys attached by an Enricher.
+const (
+	MetadataCountry = "country"
+	MetadataRegion  = "region"
+	MetadataASN     = "asn"
+)
+
+// Enricher returns the metadata attached to a Client at accept time, such as the country, the region and the ASN
+// looked up by Client.RemoteAddr in a GeoIP database, for the auth policies, the matchmaking hints, and the audit log.
+// It is called before the Client handles any message, so it should be fast, such as a lookup in memory.
+// The ctx of a WebSocket Client carries its UpgradeRequest, see UpgradeRequestFromContext.
+type Enricher func(ctx context.Context, c *Client) map[string]string
+
+// Metadata returns the metadata of the Client with the key.
+func (c *Client) Metadata(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.metadata[key]
+	return v, ok
+}
+
+// MetadataMap returns a copy of all the metadata of the Client.
+func (c *Client) MetadataMap() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := make(map[string]string, len(c.metadata))
+	for k, v := range c.metadata {
+		m[k] = v
+	}
+	return m
+}
+
+// SetMetadata sets the metadata of the Client with the key, which lives as long as the Client.
+// A key of Options.ReplicatedMetadata is written through to the Session of an authorized Client.
+func (c *Client) SetMetadata(key, value string) {
+	c.mu.Lock()
+	if c.metadata == nil {
+		c.metadata = make(map[string]string)
+	}
+	c.metadata[key] = value
+	save := c.session != nil && c.replicated(key)
+	c.mu.Unlock()
+	if save {
+		c.saveSession()
+	}
+}
+
+// ReplicatedMetadata returns a copy of the metadata of the Client with the keys of Options.ReplicatedMetadata,
+// nil if none.
+func (c *Client) ReplicatedMetadata() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.replicatedMetadata()
+}
+
+// replicatedMetadata is like ReplicatedMetadata, must be called while holding mu.
+func (c *Client) replicatedMetadata() map[string]string {
+	var md map[string]string
+	for _, k := range c.opts.ReplicatedMetadata {
+		if v, ok := c.metadata[k]; ok {
+			if md == nil {
+				md = make(map[string]string, len(c.opts.ReplicatedMetadata))
+			}
+			md[k] = v
+		}
+	}
+	return md
+}
+
+// restoreMetadata attaches the metadata saved in the resumed Session, the keys already attached to the Client,
+// such as by Options.Enricher for the new connection, are kept. It must be called while holding mu.
+func (c *Client) restoreMetadata(md map[string]string) {
+	for k, v := range md {
+		if !c.replicated(k) {
+			continue
+		}
+		if _, ok := c.metadata[k]; ok {
+			continue
+		}
+		if c.metadata == nil {
+			c.metadata = make(map[string]string, len(md))
+		}
+		c.metadata[k] = v
+	}
+}
+
+func (c *Client) replicated(key string) bool {
+	for _, k := range c.opts.ReplicatedMetadata {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// enrich attaches the metadata of the UpgradeRequest and then the metadata returned by Options.Enricher to the Client.
+func (c *Client) enrich() {
+	c.attachMetadata(c.upgradeMetadata())
+	if c.opts.Enricher != nil {
+		c.attachMetadata(c.opts.Enricher(c.parentCtx, c))
+	}
+}
+
+func (c *Client) attachMetadata(md map[string]string) {
+	if len(md) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.metadata == nil {
+		c.metadata = make(map[string]string, len(md))
+	}
+	for k, v := range md {
+		c.metadata[k] = v
+	}
+}
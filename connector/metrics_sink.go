@@ -0,0 +1,143 @@
+package connector
+
+import (
+	"github.com/pom-pom-crafts/ppcserver/metrics"
+	"sort"
+)
+
+// CollectMetrics reports the metrics of the clients, rooms, tenants, and latencies in the current process to s,
+// which are exported by the prom and statsd packages.
+func CollectMetrics(s metrics.Sink) {
+	stats := CollectStats()
+	s.Gauge("clients", "Number of started clients.", nil, float64(stats.NumClients))
+	s.Gauge("max_clients", "Maximum number of clients allowed.", nil, float64(stats.MaxClients))
+	s.Gauge("waiting_clients", "Clients in the waiting room for a slot.", nil, float64(stats.NumWaiting))
+	for state, n := range stats.NumClientsByState {
+		s.Gauge(
+			"clients_by_state", "Number of registered clients per state.", metricLabel("state", state.String()), float64(n),
+		)
+	}
+	for proto, n := range stats.NumClientsByProtocol {
+		s.Gauge(
+			"clients_by_protocol", "Number of registered clients per transport protocol.",
+			metricLabel("protocol", string(proto)), float64(n),
+		)
+	}
+
+	counters := []struct {
+		name, help string
+		v          uint64
+	}{
+		{"messages_received_total", "Messages read from the transports.", stats.MessagesReceived},
+		{"messages_sent_total", "Messages written to the transports.", stats.MessagesSent},
+		{"received_bytes_total", "Bytes read from the transports.", stats.BytesReceived},
+		{"sent_bytes_total", "Bytes written to the transports.", stats.BytesSent},
+		{"decode_errors_total", "Received messages failed to decode.", stats.DecodeErrors},
+		{"handler_errors_total", "Handler executions returning an error.", stats.HandlerErrors},
+		{"slow_handlers_total", "Handler executions exceeding the slow threshold.", stats.SlowHandlers},
+		{"dropped_messages_total", "Messages dropped since the write buffer is full.", stats.DroppedMessages},
+		{"rate_limited_messages_total", "Received messages exceeding their route rate limit.", stats.RateLimitedMessages},
+		{"capacity_rejected_total", "Connections rejected since the max clients is reached.", stats.CapacityRejected},
+		{"admission_rejected_total", "Connections rejected since the server is overloaded.", stats.AdmissionRejected},
+		{"write_timeouts_total", "Writes failed since the write timeout is exceeded.", stats.WriteTimeouts},
+		{"egress_dropped_total", "Stale pushes dropped since the client is behind its egress limit.", stats.EgressDropped},
+		{
+			"duplicates_suppressed_total", "Pushes dropped since their idempotency key is already delivered.",
+			stats.DuplicatesSuppressed,
+		},
+		{"enqueued_messages_total", "Messages queued to the write buffers.", stats.EnqueuedMessages},
+	}
+	for _, c := range counters {
+		s.Counter(c.name, c.help, nil, c.v)
+	}
+	s.Gauge(
+		"write_queue_depth", "Messages waiting in the write buffers of all the clients.", nil, float64(stats.WriteQueueDepth),
+	)
+	s.Gauge(
+		"write_queue_depth_max", "Messages waiting in the write buffer of the most backlogged client.", nil,
+		float64(stats.MaxWriteQueueDepth),
+	)
+	s.Gauge(
+		"write_queue_capacity", "Total capacity of the write buffers of all the clients.", nil,
+		float64(stats.WriteQueueCapacity),
+	)
+	s.Gauge("saturated_clients", "Clients whose write buffer is at least 80% full.", nil, float64(stats.SaturatedClients))
+
+	s.Gauge("rooms", "Number of rooms.", nil, float64(NumRooms()))
+	roomStats := CollectRoomStats()
+	for _, rs := range roomStats {
+		s.Gauge(
+			"room_members", "Number of clients per room, limited to the hottest rooms.",
+			roomMetricLabels(rs), float64(rs.Members),
+		)
+	}
+	for _, rs := range roomStats {
+		s.Counter(
+			"room_messages_sent_total", "Messages broadcast per room, limited to the hottest rooms.",
+			roomMetricLabels(rs), rs.MessagesSent,
+		)
+	}
+
+	tenantStats := CollectTenantStats()
+	for _, ts := range tenantStats {
+		s.Gauge(
+			"tenant_clients", "Number of registered clients per tenant.",
+			metricLabel("tenant", string(ts.Tenant)), float64(ts.Clients),
+		)
+	}
+	for _, ts := range tenantStats {
+		s.Gauge("tenant_rooms", "Number of rooms per tenant.", metricLabel("tenant", string(ts.Tenant)), float64(ts.Rooms))
+	}
+	for _, ts := range tenantStats {
+		s.Counter(
+			"tenant_messages_received_total", "Messages read from the clients per tenant.",
+			metricLabel("tenant", string(ts.Tenant)), ts.MessagesReceived,
+		)
+	}
+	for _, ts := range tenantStats {
+		s.Counter(
+			"tenant_messages_sent_total", "Messages written to the clients per tenant.",
+			metricLabel("tenant", string(ts.Tenant)), ts.MessagesSent,
+		)
+	}
+	for _, ts := range tenantStats {
+		s.Counter(
+			"tenant_rate_limited_messages_total", "Received messages exceeding the tenant rate limit.",
+			metricLabel("tenant", string(ts.Tenant)), ts.RateLimitedMessages,
+		)
+	}
+
+	durations := HandlerDurations()
+	routes := make([]string, 0, len(durations))
+	for route := range durations {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	for _, route := range routes {
+		s.Histogram(
+			"handler_duration_seconds", "Handler execution time per route.", metricLabel("route", route), durations[route],
+		)
+	}
+	s.Histogram(
+		"room_fanout_duration_seconds", "Time spent in fanning out a room broadcast to the members.", nil,
+		FanoutDurations(),
+	)
+	s.Histogram(
+		"write_queue_wait_seconds", "Time messages wait in the write buffers before written.", nil, WriteQueueWaits(),
+	)
+	s.Histogram("client_rtt_seconds", "Round-trip time samples of the clients measured by the pings.", nil, RTTDurations())
+}
+
+// metricLabel returns the labels of a single pair.
+func metricLabel(key, value string) []metrics.Label {
+	return []metrics.Label{{Key: key, Value: value}}
+}
+
+// roomMetricLabels returns the labels of a Room, with its tenant if it is not of DefaultTenant.
+func roomMetricLabels(rs RoomStats) []metrics.Label {
+	labels := metricLabel("room", rs.Name)
+	if rs.Tenant != DefaultTenant {
+		labels = append(labels, metrics.Label{Key: "tenant", Value: string(rs.Tenant)})
+	}
+	return labels
+}
@@ -0,0 +1,148 @@
+package connector
+
+import (
+	"encoding/json"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"sync"
+	"time"
+)
+
+var offline = &offlineQueue{}
+
+type (
+	// OfflineMessage is a one-way Message pushed by PushToUser while the user is offline,
+	// which is delivered once the user is authorized again.
+	OfflineMessage struct {
+		Route    string          `json:"route"`
+		Data     json.RawMessage `json:"data,omitempty"`
+		QueuedAt time.Time       `json:"queued_at"`
+	}
+
+	// OfflineStore holds the OfflineMessage of the offline users, such as in memory or Redis.
+	OfflineStore interface {
+		// Enqueue appends the OfflineMessage to the queue of the uid.
+		Enqueue(uid string, m OfflineMessage) error
+		// Drain removes and returns the unexpired messages of the uid in the queued order.
+		Drain(uid string) ([]OfflineMessage, error)
+	}
+
+	offlineQueue struct {
+		mu    sync.RWMutex // mu guards store.
+		store OfflineStore
+	}
+
+	// memoryOfflineStore is an OfflineStore in memory bounded per user and by TTL.
+	memoryOfflineStore struct {
+		maxPerUser int
+		ttl        time.Duration
+		mu         sync.Mutex // mu guards queues.
+		queues     map[string][]OfflineMessage
+	}
+)
+
+// SetOfflineStore enables queueing the messages pushed by PushToUser to the offline users into the store,
+// which are delivered once the user is authorized again. A nil store disables the offline queue, which is the default.
+func SetOfflineStore(store OfflineStore) {
+	offline.mu.Lock()
+	defer offline.mu.Unlock()
+	offline.store = store
+}
+
+// PushToUser pushes a one-way Message with the route and the encoded v to all the clients of DefaultTenant
+// authorized as the uid.
+// If the user has no client and an OfflineStore is set, the Message is queued for the next time the user is authorized.
+func PushToUser(uid, route string, v interface{}) error {
+	return pushToUser(DefaultTenant, uid, "", route, v)
+}
+
+// pushToUser pushes to the clients of the uid of the Tenant, deduplicated by the key if not empty.
+func pushToUser(t Tenant, uid, key, route string, v interface{}) error {
+	if clients := t.ClientsByUID(uid); len(clients) > 0 {
+		p := &sharedPush{route: route, v: v, key: key}
+		return fanoutClients(clients, p.writeTo)
+	}
+
+	offline.mu.RLock()
+	store := offline.store
+	offline.mu.RUnlock()
+	if store == nil {
+		return nil
+	}
+	m := OfflineMessage{Route: route, QueuedAt: now()}
+	if v != nil {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		m.Data = data
+	}
+	return store.Enqueue(tenantKey(t, uid), m)
+}
+
+// deliverOffline pushes the messages queued while the user of the Client is offline, once the Client is authorized.
+func (c *Client) deliverOffline(uid string) {
+	offline.mu.RLock()
+	store := offline.store
+	offline.mu.RUnlock()
+	if store == nil {
+		return
+	}
+
+	messages, err := store.Drain(tenantKey(c.Tenant(), uid))
+	if err != nil {
+		c.Logger().Error("OfflineStore.Drain() error", logging.Err(err))
+		return
+	}
+	for _, m := range messages {
+		var v interface{}
+		if len(m.Data) > 0 {
+			v = m.Data
+		}
+		if err := c.Push(m.Route, v); err != nil {
+			c.Logger().Warn("Client.Push() offline message error", logging.F("route", m.Route), logging.Err(err))
+			return
+		}
+	}
+}
+
+// NewMemoryOfflineStore creates an OfflineStore in memory, which keeps at most maxPerUser messages per user
+// by dropping the oldest, and drops the messages queued longer than ttl. Zero maxPerUser or ttl means unlimited.
+func NewMemoryOfflineStore(maxPerUser int, ttl time.Duration) OfflineStore {
+	return &memoryOfflineStore{
+		maxPerUser: maxPerUser,
+		ttl:        ttl,
+		queues:     make(map[string][]OfflineMessage),
+	}
+}
+
+func (s *memoryOfflineStore) Enqueue(uid string, m OfflineMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.expire(append(s.queues[uid], m))
+	if s.maxPerUser > 0 && len(q) > s.maxPerUser {
+		q = append(q[:0:0], q[len(q)-s.maxPerUser:]...)
+	}
+	s.queues[uid] = q
+	return nil
+}
+
+func (s *memoryOfflineStore) Drain(uid string) ([]OfflineMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.expire(s.queues[uid])
+	delete(s.queues, uid)
+	return q, nil
+}
+
+// expire drops the messages queued longer than ttl from the head of q.
+func (s *memoryOfflineStore) expire(q []OfflineMessage) []OfflineMessage {
+	if s.ttl <= 0 {
+		return q
+	}
+	deadline := now().Add(-s.ttl)
+	i := 0
+	for i < len(q) && q[i].QueuedAt.Before(deadline) {
+		i++
+	}
+	return q[i:]
+}
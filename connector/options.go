@@ -1,7 +1,9 @@
 package connector
 
 import (
+	"crypto/tls"
 	"github.com/gorilla/websocket"
+	"github.com/pom-pom-crafts/ppcserver/logging"
 	"net/http"
 	"time"
 )
@@ -12,9 +14,9 @@ type (
 
 	// Options hold the configurable parts of a connector Component.
 	Options struct {
-		// WriteTimeout is the maximum time of write message operation.
-		// Slow client will be disconnected.
-		// Default is 1 second if not set via WithWriteTimeout.
+		// WriteTimeout is the maximum time of write message operation, set as the write deadline of each message.
+		// A write exceeding it fails with ErrWriteTimeout, and the slow client will be disconnected.
+		// Default is 1 second if not set via WithWriteTimeout, zero disables the deadline.
 		WriteTimeout time.Duration
 
 		// MaxMessageSize is the maximum allowed message size in bytes received from the client.
@@ -39,11 +41,201 @@ type (
 		// This option only applies to WebsocketConnector.
 		TLSKeyFile string
 
+		// TLSReloadInterval is the interval to check TLSCertFile and TLSKeyFile for a renewed certificate,
+		// which is picked up by the new connections without restarting. This option only applies to WebsocketConnector.
+		// Default is 1 minute, and reloading is disabled if negative.
+		TLSReloadInterval time.Duration
+
+		// GetCertificate returns the TLS certificate for the new connections, in place of TLSCertFile and TLSKeyFile,
+		// such as from a certificate manager. This option only applies to WebsocketConnector.
+		// Default is nil if not set via WithGetCertificate.
+		GetCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+
 		ServeMux *http.ServeMux
 
 		Server *http.Server
 
 		Upgrader *websocket.Upgrader
+
+		// Compression negotiates the WebSocket per-message compression with the clients, with which
+		// the PreparedMessage created with compress is compressed once for all of them. The other messages
+		// are not compressed. Default is false if not set via WithCompression.
+		Compression bool
+
+		// Router dispatches the messages received from clients to the registered handlers.
+		// Default is an empty Router if not set via WithRouter.
+		Router *Router
+
+		// Protocols are the versions of the client protocol served besides the default one, keyed by
+		// Protocol.Version, which the peer declares by a HandshakeRequest. Set via WithProtocol.
+		Protocols map[string]Protocol
+
+		// Subprotocols are the WebSocket subprotocols negotiated by the Sec-WebSocket-Protocol header on upgrade,
+		// in the order of preference, each selecting a Protocol and a FrameType. Set via WithSubprotocol.
+		Subprotocols []Subprotocol
+
+		// Tracer creates spans covering the message handling.
+		// Default is a Tracer that does nothing if not set via WithTracer.
+		Tracer Tracer
+
+		// SlowHandlerThreshold is the execution time of a handler above which the execution is logged
+		// and counted in Stats.SlowHandlers. Zero disables the detection.
+		// Default is 1 second if not set via WithSlowHandlerThreshold.
+		SlowHandlerThreshold time.Duration
+
+		// MaxConnectionsPerIP is the maximum number of simultaneous clients from a remote IP, the excess is closed
+		// with CloseCodeIPQuotaExceeded once connected. Default is 0 (unlimited) if not set via WithConnectionQuotas.
+		MaxConnectionsPerIP int
+
+		// MaxConnectionsPerUser is the maximum number of simultaneous clients authorized as a uid, the excess is
+		// closed with CloseCodeUserQuotaExceeded once authorized. Default is 0 (unlimited) if not set via
+		// WithConnectionQuotas.
+		MaxConnectionsPerUser int
+
+		// routeRateLimits cap the rate of the messages per route sent by each Client, with the exact routes first
+		// and then the prefixes by the length descending. No route is limited if not set via WithRouteRateLimit.
+		routeRateLimits []routeRateLimit
+
+		// Authenticator verifies the auth message sent by the peer before any other message is accepted.
+		// Clients are authorized as soon as connected if not set via WithAuthenticator.
+		Authenticator Authenticator
+
+		// SessionAuthenticator verifies the web session of the WebSocket upgrade requests, such as a session cookie,
+		// authorizing the clients without the auth message. No session is verified if not set via
+		// WithSessionAuthenticator.
+		SessionAuthenticator SessionAuthenticator
+
+		// Enricher attaches the metadata to the clients at accept time, such as the region and the ASN by GeoIP.
+		// No metadata is attached if not set via WithEnricher.
+		Enricher Enricher
+
+		// TenantResolver resolves the Tenant of the clients by the app key in the HandshakeRequest, which the peer
+		// must send before the auth message, or before any routed Message without Authenticator.
+		// All the clients are of DefaultTenant if not set via WithTenantResolver.
+		TenantResolver TenantResolver
+
+		// Challenger challenges the suspicious clients before accepting their auth attempts, such as
+		// by NewProofOfWorkChallenger. No Client is challenged if not set via WithChallenger.
+		Challenger Challenger
+
+		// AuthReplayWindow is the maximum clock skew between the AuthNonce.Timestamp of the auth message and
+		// the server time, the auth message must carry an AuthNonce if set, whose Nonce is recorded in NonceCache
+		// to reject the replays. Default is 0 (disabled) if not set via WithAuthReplayProtection.
+		AuthReplayWindow time.Duration
+
+		// NonceCache records the nonces of the auth messages when AuthReplayWindow is set.
+		// Default is a NonceCache in memory if not set via WithAuthReplayProtection.
+		NonceCache NonceCache
+
+		// MaxAuthRefreshFailures is the number of the failed RouteAuthRefresh requests of a Client, after which
+		// the Client is closed, so that an authorized connection can't probe the Authenticator with unlimited tokens.
+		// Default is 3 if not set via WithMaxAuthRefreshFailures.
+		MaxAuthRefreshFailures int
+
+		// SigningSecret is the secret shared with the peer to derive the per-session key at the handshake,
+		// which signs every Message sent by the peer after the handshake, see SignMessage. The Message with
+		// a missing or invalid Sig closes the Client, so that the tampering by the middleboxes is detected
+		// even without end-to-end TLS. Default is nil (disabled) if not set via WithMessageSigning.
+		SigningSecret []byte
+
+		// KeyExchange requires an X25519 key exchange in the handshake, which agrees a session secret with the peer
+		// to derive the signing key instead of SigningSecret alone, and the keys of Client.SessionKey, such as for
+		// the payload encryption. SigningSecret, if also set, is mixed into the session secret to authenticate
+		// the exchange against an active middlebox. Default is false if not set via WithKeyExchange.
+		KeyExchange bool
+
+		// AuditSink receives the AuditEvent of clients, such as connect, auth, kick, ban, and disconnect.
+		// No AuditEvent is recorded if not set via WithAuditSink.
+		AuditSink AuditSink
+
+		// OnDisconnect are the DisconnectHook called in order once a Client is closed, set via WithOnDisconnect.
+		OnDisconnect []DisconnectHook
+		// onDisconnectPriorities are the Priority of OnDisconnect, in ascending order.
+		onDisconnectPriorities []Priority
+
+		// MessageSink persists the messages of the routes selected by MessageSinkRoutes, inbound and outbound.
+		// No Message is persisted if not set via WithMessageSink.
+		MessageSink MessageSink
+
+		// MessageSinkRoutes are the routes persisted to MessageSink, a route ending with "*" selects the routes
+		// with the prefix. Empty selects all the routes except the built-in ones, such as the heartbeat and logout.
+		// The auth messages are never persisted, since they carry the credentials.
+		MessageSinkRoutes []string
+
+		// FrameRecorder records the raw frames of the clients authorized as the uids selected by SetRecordUID.
+		// No Frame is recorded if not set via WithFrameRecorder.
+		FrameRecorder FrameRecorder
+
+		// HeartbeatInterval is the interval of pushing RoutePing to the peer, which is negotiated with the peer
+		// by the Handshake pushed as soon as connected. A Client sending nothing for HeartbeatMaxMissed intervals
+		// is closed as dead. Default is 0 (disabled) if not set via WithHeartbeat.
+		HeartbeatInterval time.Duration
+
+		// HeartbeatMode is the direction of the heartbeat pings.
+		// Default is HeartbeatModeServerPing if not set via WithHeartbeatMode.
+		HeartbeatMode HeartbeatMode
+
+		// HeartbeatMaxMissed is the number of consecutive heartbeat intervals without any message from the peer
+		// before the Client is closed. Default is 3 if not set via WithHeartbeat.
+		HeartbeatMaxMissed int
+
+		// HeartbeatData returns the application data attached to the heartbeat pings and pongs pushed to the Client,
+		// such as the server time, the queue position, or a soft notice, which should be small since it's pushed
+		// every heartbeat. Nothing is attached when it returns nil. It's called for the pings by a few goroutines
+		// shared by all the clients, where a Client still waiting for its last ping skips the ping, and for the pongs
+		// in the goroutine reading the Client, which is a shared poller in the event loop mode, so it should be cheap
+		// and must not block. Default is nil if not set via WithHeartbeatData.
+		HeartbeatData func(c *Client) interface{}
+
+		// SessionStore persists the Session of the authorized clients.
+		// Default is a SessionStore in memory if not set via WithSessionStore.
+		SessionStore SessionStore
+
+		// SessionTTL is the time a Session is kept after the last update or the disconnect of its Client.
+		// Default is 10 minutes if not set via WithSessionStore.
+		SessionTTL time.Duration
+
+		// EventLoopPollers is the number of event loop pollers driving the clients, instead of
+		// a read and a write goroutine per Client, which saves memory with many mostly-idle connections.
+		// Messages are handled in the poller goroutines, so handlers should not block in this mode.
+		// The messages are written by the shared flushers of WriteFlushers, 4 per poller by default in this mode,
+		// since a write to a slow peer holds a flusher up to WriteTimeout.
+		// This option only applies to TCPConnector, and is only supported on Linux.
+		// Default is 0 (disabled) if not set via WithEventLoop.
+		EventLoopPollers int
+
+		// WriteFlushers is the number of flusher goroutines shared by the clients of a connector to write their
+		// queued messages, instead of a writeLoop goroutine per Client, for very high connection counts.
+		// Default is 0 (a writeLoop goroutine per Client) if not set via WithWriteFlushers.
+		WriteFlushers int
+
+		// flushers is started by the connector when WriteFlushers is positive.
+		flushers *flusherPool
+
+		// EgressLimit caps the bytes written to each Client per second, which may be replaced per Client
+		// by Client.SetEgressLimit. Default is unlimited if not set via WithEgressLimit.
+		EgressLimit EgressLimit
+
+		// DedupWindow is the time an idempotency key of Client.PushWithKey is remembered per Client,
+		// to drop the duplicate pushes. Default is 0 (disabled) if not set via WithDedupWindow.
+		DedupWindow time.Duration
+
+		// ReplicatedMetadata are the keys of the Client metadata saved in the Session, such as the region and
+		// the game context, which are restored when the Session is resumed on another node and forwarded to
+		// the backends. Default is none if not set via WithReplicatedMetadata.
+		ReplicatedMetadata []string
+
+		// Logger is the Logger for the connector Component and its clients, such as a logging.NewSampledLogger
+		// to bound the debug entries per message. Default is logging.Default() if not set via WithLogger.
+		Logger logging.Logger
+
+		// LogPayloadLimit is the maximum bytes of the Message data logged, the rest is truncated.
+		// Default is 0 (unlimited) if not set via WithLogPayload.
+		LogPayloadLimit int
+
+		// LogRedactRoutes are the routes whose Message data is never logged, such as the auth messages.
+		// A route ending with "*" matches the prefix. Default is none if not set via WithLogPayload.
+		LogRedactRoutes []string
 	}
 )
 
@@ -55,9 +247,31 @@ func defaultOptions() *Options {
 		ServeMux:       http.DefaultServeMux,
 		Server:         &http.Server{},
 		Upgrader:       &websocket.Upgrader{},
+		Router:         NewRouter(),
+		Tracer:         noopTracer{},
+		Logger:         logging.Default(),
+
+		SlowHandlerThreshold:   1 * time.Second,
+		HeartbeatMode:          HeartbeatModeServerPing,
+		HeartbeatMaxMissed:     3,
+		SessionStore:           NewMemorySessionStore(),
+		SessionTTL:             10 * time.Minute,
+		NonceCache:             NewMemoryNonceCache(),
+		MaxAuthRefreshFailures: 3,
+		TLSReloadInterval:      1 * time.Minute,
 	}
 }
 
+// NewOptions creates the Options with the defaults customized by opts,
+// for starting a Client by StartClient over a custom Transport, such as in tests.
+func NewOptions(opts ...Option) *Options {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
 // WithAddr is an Option to set the TCP address for the server to listen on.
 func WithAddr(a string) Option {
 	return func(o *Options) {
@@ -91,7 +305,7 @@ func WithMaxMessageSize(s int64) Option {
 
 // WithTLSCertAndKey is an Option to set the path to TLS certificate file with its matching private key.
 // WebsocketConnector will start the http.Server with ListenAndServeTLS that expects HTTPS connections,
-// when either certFile or keyFile is not an empty string.
+// when either certFile or keyFile is not an empty string, and reload the renewed certificate per TLSReloadInterval.
 func WithTLSCertAndKey(certFile, keyFile string) Option {
 	return func(o *Options) {
 		o.TLSCertFile = certFile
@@ -99,6 +313,22 @@ func WithTLSCertAndKey(certFile, keyFile string) Option {
 	}
 }
 
+// WithTLSReloadInterval is an Option to set the interval to check the TLS certificate files for a renewed certificate,
+// reloading is disabled if d is negative.
+func WithTLSReloadInterval(d time.Duration) Option {
+	return func(o *Options) {
+		o.TLSReloadInterval = d
+	}
+}
+
+// WithGetCertificate is an Option to set the callback returning the TLS certificate for the new connections,
+// WebsocketConnector will expect HTTPS connections when f is not nil.
+func WithGetCertificate(f func(*tls.ClientHelloInfo) (*tls.Certificate, error)) Option {
+	return func(o *Options) {
+		o.GetCertificate = f
+	}
+}
+
 // WithHTTPServeMux is an Option to set a custom http.ServeMux,
 // will also update Server.Handler to mux if Options.Server is not nil.
 func WithHTTPServeMux(mux *http.ServeMux) Option {
@@ -131,3 +361,273 @@ func WithWebsocketUpgrader(upgrader *websocket.Upgrader) Option {
 		o.Upgrader = upgrader
 	}
 }
+
+// WithCompression is an Option to negotiate the WebSocket per-message compression for the PreparedMessage.
+func WithCompression() Option {
+	return func(o *Options) {
+		o.Compression = true
+	}
+}
+
+// WithRouter is an Option to set the Router that dispatches the messages received from clients.
+func WithRouter(r *Router) Option {
+	return func(o *Options) {
+		o.Router = r
+	}
+}
+
+// WithProtocol is an Option to serve the clients declaring the version by the codec and the router,
+// a nil codec or router falls back to the default one.
+func WithProtocol(version string, codec Codec, router *Router) Option {
+	return func(o *Options) {
+		if o.Protocols == nil {
+			o.Protocols = make(map[string]Protocol)
+		}
+		o.Protocols[version] = Protocol{Version: version, Codec: codec, Router: router}
+	}
+}
+
+// WithSubprotocol is an Option to serve the WebSocket clients requesting the subprotocol name on upgrade,
+// such as a browser choosing the serialization, by the Protocol of the version registered via WithProtocol
+// and the frames of the FrameType. An empty version or FrameType falls back to the default one.
+func WithSubprotocol(name, version string, frameType FrameType) Option {
+	return func(o *Options) {
+		o.Subprotocols = append(o.Subprotocols, Subprotocol{Name: name, Version: version, FrameType: frameType})
+	}
+}
+
+// WithTracer is an Option to set the Tracer for tracing the message handling, such as an OpenTelemetry adapter.
+func WithTracer(t Tracer) Option {
+	return func(o *Options) {
+		o.Tracer = t
+	}
+}
+
+// WithLogger is an Option to set the Logger, such as an adapter over zap or slog.
+func WithLogger(l logging.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
+
+// WithSlowHandlerThreshold is an Option to set the execution time of a handler above which it is logged as slow.
+func WithSlowHandlerThreshold(d time.Duration) Option {
+	return func(o *Options) {
+		o.SlowHandlerThreshold = d
+	}
+}
+
+// WithConnectionQuotas is an Option to set the maximum numbers of simultaneous clients from a remote IP and
+// of an authorized uid, to contain the socket exhaustion abuse, zero means unlimited.
+func WithConnectionQuotas(perIP, perUser int) Option {
+	return func(o *Options) {
+		o.MaxConnectionsPerIP = perIP
+		o.MaxConnectionsPerUser = perUser
+	}
+}
+
+// WithRouteRateLimit is an Option to cap the rate of the messages of the route sent by each Client,
+// such as WithRouteRateLimit("chat.*", RouteRateLimit{Rate: 2, Policy: RateLimitPolicyDrop}).
+// A route ending with "*" limits the routes with the prefix by a single bucket, the most specific route matches.
+func WithRouteRateLimit(route string, l RouteRateLimit) Option {
+	return func(o *Options) {
+		o.setRouteRateLimit(route, l)
+	}
+}
+
+// WithAuthenticator is an Option to set the Authenticator that verifies the auth message of clients.
+func WithAuthenticator(a Authenticator) Option {
+	return func(o *Options) {
+		o.Authenticator = a
+	}
+}
+
+// WithSessionAuthenticator is an Option to set the SessionAuthenticator that verifies the web session
+// of the WebSocket upgrade requests.
+func WithSessionAuthenticator(a SessionAuthenticator) Option {
+	return func(o *Options) {
+		o.SessionAuthenticator = a
+	}
+}
+
+// WithEnricher is an Option to attach the metadata returned by e to the clients at accept time.
+func WithEnricher(e Enricher) Option {
+	return func(o *Options) {
+		o.Enricher = e
+	}
+}
+
+// WithTenantResolver is an Option to isolate the clients into the tenants resolved by r from their app keys.
+func WithTenantResolver(r TenantResolver) Option {
+	return func(o *Options) {
+		o.TenantResolver = r
+	}
+}
+
+// WithChallenger is an Option to set the Challenger of the auth attempts, such as a proof-of-work for suspicious IPs.
+func WithChallenger(ch Challenger) Option {
+	return func(o *Options) {
+		o.Challenger = ch
+	}
+}
+
+// WithAuthReplayProtection is an Option to require an AuthNonce in the auth message, whose timestamp is within
+// window of the server time and whose nonce is recorded in the NonceCache, the default NonceCache is kept if nil.
+func WithAuthReplayProtection(window time.Duration, cache NonceCache) Option {
+	return func(o *Options) {
+		o.AuthReplayWindow = window
+		if cache != nil {
+			o.NonceCache = cache
+		}
+	}
+}
+
+// WithMaxAuthRefreshFailures is an Option to close a Client once n of its RouteAuthRefresh requests failed.
+func WithMaxAuthRefreshFailures(n int) Option {
+	return func(o *Options) {
+		o.MaxAuthRefreshFailures = n
+	}
+}
+
+// WithMessageSigning is an Option to require the messages sent by the peer signed by the key derived from secret.
+func WithMessageSigning(secret []byte) Option {
+	return func(o *Options) {
+		o.SigningSecret = secret
+	}
+}
+
+// WithKeyExchange is an Option to agree the per-session keys with the peer by an X25519 key exchange in the handshake,
+// which also requires the messages sent by the peer signed, see Options.KeyExchange.
+func WithKeyExchange() Option {
+	return func(o *Options) {
+		o.KeyExchange = true
+	}
+}
+
+// WithAuditSink is an Option to set the AuditSink that receives the AuditEvent of clients.
+func WithAuditSink(s AuditSink) Option {
+	return func(o *Options) {
+		o.AuditSink = s
+	}
+}
+
+// WithOnDisconnect is an Option to add a DisconnectHook called once a Client is closed with the Disconnect,
+// which tells the DisconnectCause, such as for notifying the other players in its rooms.
+func WithOnDisconnect(h DisconnectHook) Option {
+	return WithOnDisconnectPriority(PriorityDefault, h)
+}
+
+// WithOnDisconnectPriority is an Option to add a DisconnectHook ordered by the Priority, the hook of the lower
+// Priority is called first.
+func WithOnDisconnectPriority(p Priority, h DisconnectHook) Option {
+	return func(o *Options) {
+		// The hooks set to OnDisconnect directly are of PriorityDefault.
+		for len(o.onDisconnectPriorities) < len(o.OnDisconnect) {
+			o.onDisconnectPriorities = append(o.onDisconnectPriorities, PriorityDefault)
+		}
+		i := insertByPriority(o.onDisconnectPriorities, p)
+		o.OnDisconnect = append(o.OnDisconnect[:i:i], append([]DisconnectHook{h}, o.OnDisconnect[i:]...)...)
+		o.onDisconnectPriorities = append(
+			o.onDisconnectPriorities[:i:i], append([]Priority{p}, o.onDisconnectPriorities[i:]...)...,
+		)
+	}
+}
+
+// WithMessageSink is an Option to persist the inbound and outbound messages of the routes to the MessageSink,
+// such as WithMessageSink(sink, "chat.*") for chat history.
+func WithMessageSink(s MessageSink, routes ...string) Option {
+	return func(o *Options) {
+		o.MessageSink = s
+		o.MessageSinkRoutes = routes
+	}
+}
+
+// WithFrameRecorder is an Option to record the frames of the clients selected by SetRecordUID to the FrameRecorder.
+func WithFrameRecorder(r FrameRecorder) Option {
+	return func(o *Options) {
+		o.FrameRecorder = r
+	}
+}
+
+// WithHeartbeat is an Option to push RoutePing every interval, and close the Client
+// sending nothing for maxMissed consecutive intervals.
+func WithHeartbeat(interval time.Duration, maxMissed int) Option {
+	return func(o *Options) {
+		o.HeartbeatInterval = interval
+		if maxMissed > 0 {
+			o.HeartbeatMaxMissed = maxMissed
+		}
+	}
+}
+
+// WithHeartbeatMode is an Option to set the direction of the heartbeat pings, such as HeartbeatModeClientPing.
+func WithHeartbeatMode(m HeartbeatMode) Option {
+	return func(o *Options) {
+		o.HeartbeatMode = m
+	}
+}
+
+// WithHeartbeatData is an Option to attach the application data returned by f to the heartbeat pings and pongs,
+// instead of pushing the trivial periodic data as separate messages.
+func WithHeartbeatData(f func(c *Client) interface{}) Option {
+	return func(o *Options) {
+		o.HeartbeatData = f
+	}
+}
+
+// WithSessionStore is an Option to set the SessionStore, such as a Redis adapter, and the TTL of the sessions.
+func WithSessionStore(s SessionStore, ttl time.Duration) Option {
+	return func(o *Options) {
+		o.SessionStore = s
+		if ttl > 0 {
+			o.SessionTTL = ttl
+		}
+	}
+}
+
+// WithEventLoop is an Option to drive the clients by n event loop pollers instead of goroutines per Client.
+func WithEventLoop(n int) Option {
+	return func(o *Options) {
+		o.EventLoopPollers = n
+	}
+}
+
+// WithWriteFlushers is an Option to write the queued messages of all the clients by n shared flusher goroutines.
+func WithWriteFlushers(n int) Option {
+	return func(o *Options) {
+		o.WriteFlushers = n
+	}
+}
+
+// WithEgressLimit is an Option to cap the bytes written to each Client per second,
+// such as WithEgressLimit(EgressLimit{Rate: 64 << 10, StaleRoutes: []string{"game.state"}}) for the spectators.
+func WithEgressLimit(l EgressLimit) Option {
+	return func(o *Options) {
+		o.EgressLimit = l
+	}
+}
+
+// WithLogPayload is an Option to truncate the logged Message data to limit bytes, and to redact the data of
+// the routes, such as WithLogPayload(256, "auth", "payment.*").
+func WithLogPayload(limit int, redactRoutes ...string) Option {
+	return func(o *Options) {
+		o.LogPayloadLimit = limit
+		o.LogRedactRoutes = redactRoutes
+	}
+}
+
+// WithDedupWindow is an Option to drop the pushes by Client.PushWithKey whose idempotency key is already
+// delivered to the Client within the window.
+func WithDedupWindow(window time.Duration) Option {
+	return func(o *Options) {
+		o.DedupWindow = window
+	}
+}
+
+// WithReplicatedMetadata is an Option to save the Client metadata of the keys in the Session, so that they
+// survive a resume on another node.
+func WithReplicatedMetadata(keys ...string) Option {
+	return func(o *Options) {
+		o.ReplicatedMetadata = keys
+	}
+}
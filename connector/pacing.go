@@ -0,0 +1,111 @@
+package connector
+
+import (
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pacingSlot is the interval between the batches of a paced broadcast.
+const pacingSlot = 10 * time.Millisecond
+
+var (
+	// broadcastPacing is the duration in nanoseconds the global broadcasts are spread over, accessed atomically.
+	broadcastPacing int64
+	// globalPacer orders the paced global broadcasts.
+	globalPacer pacer
+)
+
+// pacer spreads the paced broadcasts of a target over time in batches, one broadcast after another.
+type pacer struct {
+	mu   sync.Mutex    // mu guards tail.
+	tail chan struct{} // tail is closed once the latest paced broadcast completes.
+}
+
+// SetBroadcastPacing spreads each global broadcast, by Broadcast and Tenant.Broadcast, over the duration in batches
+// instead of queuing to all the clients at once, so that a broadcast to many clients causes no bandwidth and CPU
+// spikes delaying the realtime traffic. See WithRoomPacing for a Room. A paced broadcast returns once v is encoded,
+// so v may be reused afterwards, and the paced broadcasts are delivered in order.
+// Zero disables the pacing, which is the default.
+func SetBroadcastPacing(over time.Duration) {
+	atomic.StoreInt64(&broadcastPacing, int64(over))
+}
+
+// WithRoomPacing is a RoomOption to spread each broadcast to the Room over the duration, like SetBroadcastPacing.
+// The push is encoded before the broadcast returns, but the InterestFilter of the Room is evaluated as each batch
+// is written, so a filter inspecting v requires v not to be reused until the paced broadcast completes.
+func WithRoomPacing(over time.Duration) RoomOption {
+	return func(r *Room) {
+		r.pacing = over
+	}
+}
+
+// pace writes to the clients in batches spread evenly over the duration, once the previous paced broadcast
+// of the pacer completes, and then calls done with the number of the clients written. It returns at once.
+func (p *pacer) pace(clients []*Client, over time.Duration, write func(c *Client) (bool, error), done func(n int)) {
+	p.mu.Lock()
+	prev := p.tail
+	tail := make(chan struct{})
+	p.tail = tail
+	p.mu.Unlock()
+
+	go func() {
+		defer close(tail)
+		if prev != nil {
+			<-prev
+		}
+
+		slots := int(over / pacingSlot)
+		if slots < 1 {
+			slots = 1
+		}
+		batch := (len(clients) + slots - 1) / slots
+		start := time.Now()
+		var n int64
+		for i := 0; len(clients) > 0; i++ {
+			if d := time.Until(start.Add(time.Duration(i) * over / time.Duration(slots))); d > 0 {
+				time.Sleep(d)
+			}
+			k := batch
+			if k > len(clients) {
+				k = len(clients)
+			}
+			err := fanoutClients(
+				clients[:k], func(c *Client) error {
+					written, err := write(c)
+					if written {
+						atomic.AddInt64(&n, 1)
+					}
+					return err
+				},
+			)
+			if err != nil {
+				logging.Default().Warn("Broadcast paced error", logging.Err(err))
+			}
+			clients = clients[k:]
+		}
+		if done != nil {
+			done(int(n))
+		}
+	}()
+}
+
+// broadcastClients pushes a one-way Message with the route and the encoded v to the clients of a global broadcast,
+// paced if SetBroadcastPacing is set.
+func broadcastClients(clients []*Client, route string, v interface{}) error {
+	over := time.Duration(atomic.LoadInt64(&broadcastPacing))
+	if over <= 0 {
+		return fanout(clients, route, v)
+	}
+	p := &sharedPush{route: route, v: v}
+	if err := p.encodeFor(clients); err != nil {
+		return err
+	}
+	globalPacer.pace(
+		clients, over, func(c *Client) (bool, error) {
+			return true, p.writeTo(c)
+		}, nil,
+	)
+	return nil
+}
@@ -0,0 +1,45 @@
+package connector_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/transporttest"
+	"testing"
+	"time"
+)
+
+func TestPacedBroadcastEncodesBeforeReturning(t *testing.T) {
+	room, err := connector.CreateRoom("paced", connector.WithRoomPacing(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer room.Close()
+
+	router := connector.NewRouter()
+	router.Handle(
+		"join", func(_ context.Context, c *connector.Client, _ *connector.Message) (interface{}, error) {
+			return nil, room.Join(c)
+		},
+	)
+	peer, _ := transporttest.Serve(context.Background(), connector.NewOptions(connector.WithRouter(router)))
+	defer peer.Close()
+	request(t, peer, 1, "join", "")
+
+	data := json.RawMessage(`"before"`)
+	if err := room.Broadcast("news", data); err != nil {
+		t.Fatal(err)
+	}
+	// Reuse the data right after the broadcast returns, such as the Data of a pooled Message.
+	copy(data, `"after!"`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	m, err := peer.ReceiveMessage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(m.Data) != `"before"` {
+		t.Fatalf("paced push Data = %s, want %q", m.Data, `"before"`)
+	}
+}
@@ -0,0 +1,54 @@
+package connector
+
+import "sync"
+
+// maxPooledBufferSize is the capacity above which a read buffer is not returned to the pool,
+// so a few oversized messages do not pin large buffers in memory.
+const maxPooledBufferSize = 64 << 10
+
+var (
+	// readBufferPool holds *[]byte for reading messages from the transports.
+	readBufferPool = sync.Pool{
+		New: func() interface{} {
+			b := make([]byte, 0, 512)
+			return &b
+		},
+	}
+
+	// messagePool holds *Message for decoding the received messages,
+	// Message.Data keeps its capacity across uses so that decoding the payload does not allocate.
+	messagePool = sync.Pool{
+		New: func() interface{} {
+			return &Message{}
+		},
+	}
+)
+
+// getReadBuffer returns an empty buffer from the pool for reading a message.
+func getReadBuffer() []byte {
+	return (*readBufferPool.Get().(*[]byte))[:0]
+}
+
+// putReadBuffer returns the buffer to the pool, the buffer must not be used afterwards.
+func putReadBuffer(b []byte) {
+	if cap(b) > maxPooledBufferSize {
+		return
+	}
+	b = b[:0]
+	readBufferPool.Put(&b)
+}
+
+// getMessage returns a zero Message from the pool for decoding a received message.
+func getMessage() *Message {
+	return messagePool.Get().(*Message)
+}
+
+// putMessage resets the Message and returns it to the pool, the Message must not be used afterwards.
+func putMessage(m *Message) {
+	data := m.Data
+	if cap(data) > maxPooledBufferSize {
+		data = nil
+	}
+	*m = Message{Data: data[:0]}
+	messagePool.Put(m)
+}
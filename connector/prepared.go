@@ -0,0 +1,155 @@
+package connector
+
+import (
+	"github.com/gorilla/websocket"
+	"net"
+	"sync"
+	"time"
+)
+
+type (
+	// PreparedMessage is a one-way Message encoded once per Codec, whose immutable buffers are shared by all
+	// the recipients instead of being encoded per Client, such as a payload pushed to thousands of clients.
+	// If created with compress, it's also compressed once for all the WebSocket clients negotiating the compression,
+	// see WithCompression. It may be reused by several broadcasts, and is safe for concurrent use.
+	PreparedMessage struct {
+		route    string
+		v        interface{}
+		compress bool
+		mu       sync.Mutex // mu guards frames.
+		frames   map[Codec]*preparedFrame
+	}
+
+	// preparedFrame is a PreparedMessage encoded by a Codec.
+	preparedFrame struct {
+		bufs     net.Buffers
+		compress bool
+		mu       sync.Mutex                         // mu guards ws.
+		ws       map[int]*websocket.PreparedMessage // ws are the WebSocket frames by the message type.
+	}
+)
+
+// NewPreparedMessage creates a PreparedMessage with the route and v as the Data, which is compressed for
+// the WebSocket clients negotiating the compression if compress is set.
+func NewPreparedMessage(route string, v interface{}, compress bool) *PreparedMessage {
+	return &PreparedMessage{
+		route:    route,
+		v:        v,
+		compress: compress,
+		frames:   make(map[Codec]*preparedFrame, 1),
+	}
+}
+
+// Route returns the route of the PreparedMessage.
+func (pm *PreparedMessage) Route() string {
+	return pm.route
+}
+
+// frame returns the PreparedMessage encoded by the codec, which is encoded on the first call.
+func (pm *PreparedMessage) frame(codec Codec) (*preparedFrame, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if f, ok := pm.frames[codec]; ok {
+		return f, nil
+	}
+	bufs, err := encodePush(codec, pm.route, pm.v)
+	if err != nil {
+		return nil, err
+	}
+	f := &preparedFrame{bufs: bufs, compress: pm.compress}
+	pm.frames[codec] = f
+	return f, nil
+}
+
+// websocketMessage returns the websocket.PreparedMessage of the message type, which caches the frame
+// per compression of the connections, so it's compressed once.
+func (f *preparedFrame) websocketMessage(messageType int) (*websocket.PreparedMessage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if m, ok := f.ws[messageType]; ok {
+		return m, nil
+	}
+	data := f.bufs[0]
+	if len(f.bufs) > 1 {
+		data = nil
+		for _, b := range f.bufs {
+			data = append(data, b...)
+		}
+	}
+	m, err := websocket.NewPreparedMessage(messageType, data)
+	if err != nil {
+		return nil, err
+	}
+	if f.ws == nil {
+		f.ws = make(map[int]*websocket.PreparedMessage, 1)
+	}
+	f.ws[messageType] = m
+	return m, nil
+}
+
+// WritePrepared queues the PreparedMessage to be written to the Client, like Push.
+func (c *Client) WritePrepared(pm *PreparedMessage) error {
+	if c.dropStale(pm.route) {
+		return nil
+	}
+	f, err := pm.frame(c.codec())
+	if err != nil {
+		return err
+	}
+	if err := c.enqueueWrite(queuedWrite{bufs: f.bufs, prepared: f}); err != nil {
+		return err
+	}
+	c.persistPush(pm.route, pm.v)
+	return nil
+}
+
+// writeTo queues the PreparedMessage encoded by the Codec of c, it only returns the encoding error.
+func (pm *PreparedMessage) writeTo(c *Client) error {
+	if c.dropStale(pm.route) {
+		return nil
+	}
+	f, err := pm.frame(c.codec())
+	if err != nil {
+		return err
+	}
+	// An error means the Client is closed or too slow, which is handled by the Client itself.
+	if c.enqueueWrite(queuedWrite{bufs: f.bufs, prepared: f}) == nil {
+		c.persistPush(pm.route, pm.v)
+	}
+	return nil
+}
+
+// BroadcastPrepared is like Broadcast, but pushes the PreparedMessage. For a Room with history, each push carries
+// the Seq assigned, so the PreparedMessage is encoded once per broadcast instead.
+func (r *Room) BroadcastPrepared(pm *PreparedMessage) error {
+	if r.history != nil {
+		return r.broadcast(pm.route, pm.v, r.interest)
+	}
+	if r.isClosed() {
+		return ErrRoomClosed
+	}
+
+	return r.deliver(
+		time.Now(), func(c *Client) (bool, error) {
+			if r.interest != nil && !r.interest(c, pm.route, pm.v) {
+				return false, nil
+			}
+			return true, pm.writeTo(c)
+		},
+	)
+}
+
+// writePrepared writes the WebSocket frame of f, compressed if the compression is negotiated and f is compressed.
+func (t *websocketTransport) writePrepared(f *preparedFrame) error {
+	m, err := f.websocketMessage(t.messageType())
+	if err != nil {
+		return err
+	}
+
+	t.setWriteDeadline()
+	if f.compress {
+		t.conn.EnableWriteCompression(true)
+		defer t.conn.EnableWriteCompression(false)
+	}
+	return t.conn.WritePreparedMessage(m)
+}
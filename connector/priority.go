@@ -0,0 +1,25 @@
+package connector
+
+import "sort"
+
+// The well-known Priority of the Middleware and the hooks, the gaps leave room for the others in between.
+const (
+	// PriorityAuth is for the Middleware and the hooks checking the permissions of a Client.
+	PriorityAuth Priority = 100
+	// PriorityRateLimit is for the Middleware limiting the rate of the messages, after PriorityAuth.
+	PriorityRateLimit Priority = 200
+	// PriorityDefault is the Priority of the Middleware registered by Router.Use and the hooks registered
+	// without a Priority.
+	PriorityDefault Priority = 500
+)
+
+// Priority orders the Middleware and the hooks registered by several components, so that the order is declared
+// explicitly instead of depending on the order of the registrations, such as the auth Middleware always running
+// before the rate limiting one. The lower Priority runs first, and the same Priority runs in the order registered.
+type Priority int
+
+// insertByPriority returns the index to insert an element of the Priority p into the elements of the priorities,
+// after the elements of the same Priority.
+func insertByPriority(priorities []Priority, p Priority) int {
+	return sort.Search(len(priorities), func(i int) bool { return priorities[i] > p })
+}
@@ -0,0 +1,125 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"sync/atomic"
+)
+
+var ErrUnsupportedProtocolVersion = errors.New("ppcserver: unsupported protocol version")
+
+type (
+	// Protocol is a version of the client protocol served by the connector, with its own Codec and Router,
+	// so that the clients on different versions are served simultaneously during a staged client rollout.
+	Protocol struct {
+		// Version is declared by the peer in the HandshakeRequest, empty for the default Protocol.
+		Version string
+		// Codec encodes the messages of the Protocol, nil for the Codec of the transport encoding.
+		Codec Codec
+		// Router dispatches the messages of the Protocol, nil for Options.Router.
+		Router *Router
+	}
+
+	// HandshakeRequest is the data of the RouteHandshake Message sent by the peer, which should be its first Message,
+	// it is decoded by the Codec of the default Protocol.
+	HandshakeRequest struct {
+		// Version is the Protocol.Version of the peer, registered via WithProtocol.
+		Version string `json:"version"`
+		// Nonce is a random value of at least 16 bytes to derive the signing key, when the message signing is enabled.
+		Nonce []byte `json:"nonce,omitempty"`
+		// PublicKey is the ephemeral X25519 public key of the peer, when Options.KeyExchange is set.
+		PublicKey []byte `json:"public_key,omitempty"`
+		// AppKey selects the Tenant of the peer, when Options.TenantResolver is set.
+		AppKey string `json:"app_key,omitempty"`
+		// FrameType chooses the type of the frames written to the peer, such as FrameTypeText for a JSON debug client,
+		// when the transport distinguishes text from binary frames. Empty keeps the default of the transport encoding.
+		FrameType FrameType `json:"frame_type,omitempty"`
+	}
+)
+
+// Protocol returns the Protocol of the Client, the default Protocol until the peer declares the version.
+func (c *Client) Protocol() *Protocol {
+	return c.protocol.Load().(*Protocol)
+}
+
+// codec returns the Codec of the Protocol of the Client.
+func (c *Client) codec() Codec {
+	return c.Protocol().Codec
+}
+
+// handleHandshake selects the Protocol of the version in the RouteHandshake Message sent by the peer,
+// and replies the Handshake encoded by the Codec of the selected Protocol, it returns false for the other messages.
+// The reply is a response if the Message has an ID, otherwise a one-way Message. The Client is closed
+// if the version is not registered or the app key is rejected, and the Protocol and the Tenant are selected
+// by the first handshake only, as is the FrameType.
+func (c *Client) handleHandshake(ctx context.Context, m *Message) bool {
+	if m.Route != RouteHandshake {
+		return false
+	}
+
+	var (
+		req        HandshakeRequest
+		nonce, pub []byte
+		err        error
+	)
+	if len(m.Data) > 0 {
+		err = c.codec().Unmarshal(m.Data, &req)
+	}
+	// A repeated handshake replies the Handshake without changing the Protocol and the signing key.
+	if err == nil && atomic.CompareAndSwapInt32(&c.handshaken, 0, 1) {
+		// Without a version, the Protocol of the default or the WebSocket subprotocol is kept.
+		if req.Version != "" {
+			err = c.selectProtocol(req.Version)
+		}
+		if err == nil {
+			err = c.selectFrameType(req.FrameType)
+		}
+		if err == nil {
+			err = c.resolveTenant(ctx, req.AppKey)
+		}
+		if err == nil && c.signing() {
+			nonce, pub, err = c.startSigning(req)
+		}
+	}
+	if err != nil {
+		if m.ID != 0 {
+			_ = c.respond(m, nil, err)
+		}
+		if errors.Is(err, ErrTenantQuotaExceeded) {
+			c.Logger().Info("Client rejected", logging.Err(err))
+			c.CloseWithNotice(CloseCodeTenantQuotaExceeded, err.Error())
+		} else {
+			c.closeWithCause(DisconnectCauseProtocolError, err.Error())
+		}
+		return true
+	}
+
+	hs := c.handshake()
+	hs.Nonce, hs.PublicKey = nonce, pub
+	if m.ID != 0 {
+		_ = c.respond(m, hs, nil)
+	} else {
+		_ = c.Push(RouteHandshake, hs)
+	}
+	return true
+}
+
+// selectProtocol makes the Protocol of the version the Protocol of the Client.
+func (c *Client) selectProtocol(version string) error {
+	p, ok := c.opts.Protocols[version]
+	if !ok {
+		if version != "" {
+			return ErrUnsupportedProtocolVersion
+		}
+		p = Protocol{}
+	}
+	if p.Codec == nil {
+		p.Codec = codecFor(c.transport.Encoding())
+	}
+	if p.Router == nil {
+		p.Router = c.opts.Router
+	}
+	c.protocol.Store(&p)
+	return nil
+}
@@ -0,0 +1,55 @@
+package connector
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// saturationRatio is the occupancy of a write queue above which the Client is counted in Stats.SaturatedClients.
+const saturationRatio = 0.8
+
+type (
+	// queuedWrite is a message waiting in the write queue of a Client.
+	queuedWrite struct {
+		bufs     net.Buffers
+		queuedAt int64 // queuedAt is the UnixNano when the message is queued, for the write queue wait time.
+		// closing closes the Client with the cause once the message is written, such as a CloseNotice.
+		closing error
+		// prepared is the PreparedMessage of bufs, written as such to a WebSocket.
+		prepared *preparedFrame
+	}
+
+	// ClientQueueStats is a snapshot of the write queue of a single Client.
+	// There is no read queue, the received messages are handled as soon as read.
+	ClientQueueStats struct {
+		// WriteQueueLen is the number of messages waiting in the write queue.
+		WriteQueueLen int
+		// WriteQueueCap is the capacity of the write queue, the Client is disconnected when it is full.
+		WriteQueueCap int
+		// Enqueued is the number of messages queued for writing since the Client is started.
+		Enqueued uint64
+		// Dropped is the number of messages dropped since the write queue is full.
+		Dropped uint64
+	}
+)
+
+// QueueStats returns a snapshot of the write queue of the Client.
+func (c *Client) QueueStats() ClientQueueStats {
+	return ClientQueueStats{
+		WriteQueueLen: len(c.writeCh),
+		WriteQueueCap: cap(c.writeCh),
+		Enqueued:      atomic.LoadUint64(&c.enqueued),
+		Dropped:       atomic.LoadUint64(&c.dropped),
+	}
+}
+
+// saturated reports whether the write queue occupancy of the Client is above saturationRatio.
+func (s ClientQueueStats) saturated() bool {
+	return s.WriteQueueCap > 0 && float64(s.WriteQueueLen) >= saturationRatio*float64(s.WriteQueueCap)
+}
+
+// observeWriteQueueWait records the time the message waited in the write queue before being written.
+func observeWriteQueueWait(w queuedWrite) {
+	writeQueueWaits.Observe(time.Duration(time.Now().UnixNano() - w.queuedAt).Seconds())
+}
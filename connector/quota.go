@@ -0,0 +1,77 @@
+package connector
+
+import (
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"net"
+	"sync"
+)
+
+var (
+	ErrIPQuotaExceeded   = errors.New("ppcserver: too many connections from the IP")
+	ErrUserQuotaExceeded = errors.New("ppcserver: too many connections of the user")
+)
+
+// ipConns counts the open clients per remote IP for Options.MaxConnectionsPerIP.
+var ipConns = &ipConnCounter{counts: make(map[string]int)}
+
+// ipConnCounter counts the open clients per remote IP.
+type ipConnCounter struct {
+	mu     sync.Mutex // mu guards counts.
+	counts map[string]int
+}
+
+// acquire counts a Client from the ip, it returns false without counting if there are max clients already.
+// Zero max means unlimited.
+func (n *ipConnCounter) acquire(ip string, max int) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if max > 0 && n.counts[ip] >= max {
+		return false
+	}
+	n.counts[ip]++
+	return true
+}
+
+func (n *ipConnCounter) release(ip string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.counts[ip]--; n.counts[ip] <= 0 {
+		delete(n.counts, ip)
+	}
+}
+
+// NumClientsByIP returns the number of the open clients from the remote IP.
+func NumClientsByIP(ip string) int {
+	ipConns.mu.Lock()
+	defer ipConns.mu.Unlock()
+	return ipConns.counts[ip]
+}
+
+// acquireIPQuota counts the Client from its remote IP, it closes the Client with CloseCodeIPQuotaExceeded
+// and returns false if it exceeds Options.MaxConnectionsPerIP.
+func (c *Client) acquireIPQuota() bool {
+	addr := c.RemoteAddr()
+	if addr == nil {
+		return true
+	}
+	ip := addr.String()
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	if !ipConns.acquire(ip, c.opts.MaxConnectionsPerIP) {
+		c.Logger().Info("Client rejected", logging.Err(ErrIPQuotaExceeded))
+		c.CloseWithNotice(CloseCodeIPQuotaExceeded, ErrIPQuotaExceeded.Error())
+		return false
+	}
+	c.quotaIP = ip
+	return true
+}
+
+// releaseIPQuota uncounts the closed Client from its remote IP.
+func (c *Client) releaseIPQuota() {
+	if c.quotaIP != "" {
+		ipConns.release(c.quotaIP)
+	}
+}
@@ -0,0 +1,39 @@
+package connector_test
+
+import (
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConnectionQuotaCloseCodes(t *testing.T) {
+	srv := httptest.NewServer(
+		connector.NewWebsocketConnector(
+			connector.WithConnectionQuotas(2, 1),
+			connector.WithAuthenticator(tokenAuthenticator(map[string]string{"alice": "alice"})),
+		).Handler(),
+	)
+	defer srv.Close()
+
+	first := dial(t, srv, "")
+	if err := first.WriteJSON(connector.Message{ID: 1, Route: connector.RouteAuth, Data: []byte(`"alice"`)}); err != nil {
+		t.Fatal(err)
+	}
+	var resp connector.Message
+	if err := first.ReadJSON(&resp); err != nil || resp.Error != "" {
+		t.Fatalf("auth response = %+v, %v", resp, err)
+	}
+
+	second := dial(t, srv, "")
+	if err := second.WriteJSON(connector.Message{ID: 1, Route: connector.RouteAuth, Data: []byte(`"alice"`)}); err != nil {
+		t.Fatal(err)
+	}
+	if ce := readCloseFrame(t, second); ce.Code != int(connector.CloseCodeUserQuotaExceeded) {
+		t.Fatalf("close code over the user quota = %d, want %d", ce.Code, connector.CloseCodeUserQuotaExceeded)
+	}
+
+	dial(t, srv, "")
+	if ce := readCloseFrame(t, dial(t, srv, "")); ce.Code != int(connector.CloseCodeIPQuotaExceeded) {
+		t.Fatalf("close code over the IP quota = %d, want %d", ce.Code, connector.CloseCodeIPQuotaExceeded)
+	}
+}
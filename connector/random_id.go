@@ -0,0 +1,13 @@
+package connector
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// newRandomID returns an unguessable random ID of 32 hex characters.
+func newRandomID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,147 @@
+package connector
+
+import (
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// RateLimitPolicyReject responds ErrRateLimited to the request exceeding the rate, and drops a one-way Message.
+	RateLimitPolicyReject RateLimitPolicy = "reject"
+	// RateLimitPolicyDrop drops the Message exceeding the rate silently, without a response.
+	RateLimitPolicyDrop RateLimitPolicy = "drop"
+	// RateLimitPolicyKick closes the Client sending a Message exceeding the rate.
+	RateLimitPolicyKick RateLimitPolicy = "kick"
+
+	// closeReasonRateLimited is the close reason of a Client exceeding a RouteRateLimit with RateLimitPolicyKick.
+	closeReasonRateLimited = "rate limited"
+)
+
+var ErrRateLimited = errors.New("ppcserver: message rate limit exceeded")
+
+type (
+	// RateLimitPolicy is the action on a Message exceeding its RouteRateLimit.
+	RateLimitPolicy string
+
+	// RouteRateLimit caps the rate of the messages of a route sent by each Client, by a token bucket.
+	RouteRateLimit struct {
+		// Rate is the number of messages allowed per second, such as 2 for chat or 30 for movement.
+		Rate float64
+		// Burst is the number of messages allowed at once, default is the Rate rounded up if not positive.
+		Burst int
+		// Policy is the action on a Message exceeding the rate, default is RateLimitPolicyReject if empty.
+		Policy RateLimitPolicy
+	}
+
+	// routeRateLimit is a RouteRateLimit of a route pattern, where a pattern ending with "*" matches the prefix.
+	routeRateLimit struct {
+		pattern string
+		RouteRateLimit
+	}
+
+	// tokenBucket is the state of a RouteRateLimit of a Client.
+	tokenBucket struct {
+		tokens float64
+		at     time.Time
+	}
+)
+
+// setRouteRateLimit adds or replaces the RouteRateLimit of the pattern, keeping the exact routes first
+// and then the prefixes by the length descending, so that the most specific one matches.
+func (o *Options) setRouteRateLimit(pattern string, l RouteRateLimit) {
+	if l.Burst <= 0 {
+		l.Burst = int(math.Ceil(l.Rate))
+		if l.Burst < 1 {
+			l.Burst = 1
+		}
+	}
+	if l.Policy == "" {
+		l.Policy = RateLimitPolicyReject
+	}
+
+	for i := range o.routeRateLimits {
+		if o.routeRateLimits[i].pattern == pattern {
+			o.routeRateLimits[i].RouteRateLimit = l
+			return
+		}
+	}
+	o.routeRateLimits = append(o.routeRateLimits, routeRateLimit{pattern: pattern, RouteRateLimit: l})
+	sort.SliceStable(
+		o.routeRateLimits, func(i, j int) bool {
+			pi, pj := o.routeRateLimits[i].pattern, o.routeRateLimits[j].pattern
+			if wi, wj := strings.HasSuffix(pi, "*"), strings.HasSuffix(pj, "*"); wi != wj {
+				return !wi
+			}
+			return len(pi) > len(pj)
+		},
+	)
+}
+
+// routeRateLimit returns the most specific routeRateLimit matching the route.
+func (o *Options) routeRateLimit(route string) (*routeRateLimit, bool) {
+	for i := range o.routeRateLimits {
+		p := o.routeRateLimits[i].pattern
+		if p == route || (strings.HasSuffix(p, "*") && strings.HasPrefix(route, p[:len(p)-1])) {
+			return &o.routeRateLimits[i], true
+		}
+	}
+	return nil, false
+}
+
+// allowRate takes a token from the bucket of the RouteRateLimit matching the route of the Message,
+// it returns the RateLimitPolicy to apply if the rate is exceeded, and ok is true if the Message is allowed.
+func (c *Client) allowRate(m *Message) (policy RateLimitPolicy, ok bool) {
+	l, found := c.opts.routeRateLimit(m.Route)
+	if !found {
+		return "", true
+	}
+
+	at := now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rateBuckets == nil {
+		c.rateBuckets = make(map[string]*tokenBucket)
+	}
+	b, exists := c.rateBuckets[l.pattern]
+	if !exists {
+		b = &tokenBucket{tokens: float64(l.Burst), at: at}
+		c.rateBuckets[l.pattern] = b
+	}
+	b.tokens += at.Sub(b.at).Seconds() * l.Rate
+	if burst := float64(l.Burst); b.tokens > burst {
+		b.tokens = burst
+	}
+	b.at = at
+	if b.tokens < 1 {
+		return l.Policy, false
+	}
+	b.tokens--
+	return "", true
+}
+
+// limitRate applies the TenantLimits and the RouteRateLimit of the Message, it returns false if the Message is not to be dispatched.
+func (c *Client) limitRate(m *Message) bool {
+	if !c.limitTenantRate(m) {
+		return false
+	}
+	policy, ok := c.allowRate(m)
+	if ok {
+		return true
+	}
+
+	countRateLimited()
+	c.Logger().Debug("Client message rate limited", logging.F("route", m.Route), logging.F("policy", policy))
+	switch policy {
+	case RateLimitPolicyKick:
+		c.closeWithCause(DisconnectCauseRateLimited, closeReasonRateLimited)
+	case RateLimitPolicyReject:
+		if m.ID != 0 {
+			_ = c.respond(m, nil, ErrRateLimited)
+		}
+	}
+	return false
+}
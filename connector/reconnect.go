@@ -0,0 +1,47 @@
+package connector
+
+import (
+	"math/rand"
+	"time"
+)
+
+// RouteReconnect is the route of the one-way Message pushed to the peer with a ReconnectHint, before the server
+// goes away for a planned restart, so that the client SDKs move to another server proactively instead of
+// experiencing an abrupt drop.
+const RouteReconnect = "reconnect"
+
+// ReconnectHint is the data of the RouteReconnect Message.
+type ReconnectHint struct {
+	// Addr is the address to reconnect to, in the form "host:port". Empty means the same address,
+	// such as behind a load balancer.
+	Addr string `json:"addr,omitempty"`
+	// After is the delay in milliseconds before the peer reconnects, randomized per Client,
+	// so that the clients do not reconnect at once.
+	After int64 `json:"after"`
+}
+
+// SendReconnectHints pushes a RouteReconnect Message to all the authorized clients in the current process,
+// telling each to reconnect to addr after a delay, randomized in after±jitter. It returns the number of
+// the clients hinted. The clients are left connected until they leave or the server closes them.
+func SendReconnectHints(addr string, after, jitter time.Duration) int {
+	n := 0
+	registry.forEach(
+		func(c *Client) bool {
+			if c.State() != ClientStateAuthorized {
+				return true
+			}
+			d := after
+			if jitter > 0 {
+				d += time.Duration(rand.Int63n(int64(2*jitter+1))) - jitter
+			}
+			if d < 0 {
+				d = 0
+			}
+			if c.Push(RouteReconnect, ReconnectHint{Addr: addr, After: d.Milliseconds()}) == nil {
+				n++
+			}
+			return true
+		},
+	)
+	return n
+}
@@ -0,0 +1,319 @@
+package connector
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrRoomExists = errors.New("ppcserver: room already exists")
+	ErrRoomClosed = errors.New("ppcserver: room is closed")
+)
+
+var rooms = &roomRegistry{
+	rooms: make(map[string]*Room),
+}
+
+type (
+	// Room is a named group of clients that receive the messages broadcast to the Room.
+	Room struct {
+		name      string
+		tenant    Tenant
+		createdAt time.Time
+		mu        sync.RWMutex       // mu guards members and closed.
+		members   map[uint64]*Client // members is keyed by Client.ID.
+		closed    bool
+		metrics   roomMetrics
+		history   *roomHistory   // history is nil unless created with WithRoomHistory or WithRoomHistoryStore.
+		interest  InterestFilter // interest is nil unless created with WithRoomInterest.
+		pacing    time.Duration  // pacing is zero unless created with WithRoomPacing.
+		pacer     pacer
+		lock      *roomLock // lock is nil unless created with WithRoomLock.
+		// snapshots is nil unless created with WithRoomFailover.
+		snapshots RoomSnapshotStore
+	}
+
+	// roomRegistry holds all the rooms created in the current process, keyed by Room.key.
+	roomRegistry struct {
+		mu    sync.RWMutex // mu guards rooms.
+		rooms map[string]*Room
+	}
+)
+
+// CreateRoom creates a Room of DefaultTenant with the unique name, returns ErrRoomExists if the name is in use.
+func CreateRoom(name string, opts ...RoomOption) (*Room, error) {
+	return createRoom(DefaultTenant, name, opts...)
+}
+
+func createRoom(t Tenant, name string, opts ...RoomOption) (*Room, error) {
+	r := &Room{
+		name:      name,
+		tenant:    t,
+		createdAt: time.Now(),
+		members:   make(map[uint64]*Client),
+	}
+
+	// Apply opts to customize Room.
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.lock != nil {
+		// Hold the lock before reading the history, so that only the owner continues the sequence.
+		if err := r.acquireLock(); err != nil {
+			return nil, err
+		}
+	}
+	if r.history != nil {
+		// Continue the sequence of the history kept by the store, such as after a restart.
+		seq, err := r.history.store.LastSeq(r.key())
+		if err != nil {
+			r.releaseLock()
+			return nil, err
+		}
+		r.history.seq = seq
+	}
+
+	rooms.mu.Lock()
+	if _, ok := rooms.rooms[r.key()]; ok {
+		rooms.mu.Unlock()
+		r.releaseLock()
+		return nil, ErrRoomExists
+	}
+	if max := t.Limits().MaxRooms; max > 0 && rooms.countTenant(t) >= max {
+		rooms.mu.Unlock()
+		r.releaseLock()
+		return nil, ErrTenantRoomsExceeded
+	}
+	rooms.rooms[r.key()] = r
+	rooms.mu.Unlock()
+
+	TopicRoomCreated.Publish(RoomCreated{Room: r})
+	return r, nil
+}
+
+// countTenant returns the number of rooms of the Tenant, must be called while holding mu.
+func (rr *roomRegistry) countTenant(t Tenant) int {
+	n := 0
+	for _, r := range rr.rooms {
+		if r.tenant == t {
+			n++
+		}
+	}
+	return n
+}
+
+// GetRoom returns the Room of DefaultTenant with the name, or false if no such Room exists.
+func GetRoom(name string) (*Room, bool) {
+	return DefaultTenant.GetRoom(name)
+}
+
+// Rooms returns a snapshot of all the rooms created in the current process, of all the tenants.
+func Rooms() []*Room {
+	rooms.mu.RLock()
+	defer rooms.mu.RUnlock()
+	rs := make([]*Room, 0, len(rooms.rooms))
+	for _, r := range rooms.rooms {
+		rs = append(rs, r)
+	}
+	return rs
+}
+
+// NumRooms returns the number of rooms created in the current process, of all the tenants.
+func NumRooms() int {
+	rooms.mu.RLock()
+	defer rooms.mu.RUnlock()
+	return len(rooms.rooms)
+}
+
+// Name returns the name of the Room, unique in its Tenant.
+func (r *Room) Name() string {
+	return r.name
+}
+
+// Tenant returns the Tenant of the Room.
+func (r *Room) Tenant() Tenant {
+	return r.tenant
+}
+
+// key returns the name of the Room qualified by its Tenant, which keys the Room in the registry and the history.
+func (r *Room) key() string {
+	return tenantKey(r.tenant, r.name)
+}
+
+// Join adds the Client to the Room, it's OK to join a Room more than once.
+// It returns ErrTenantMismatch if the Client is not of the Tenant of the Room.
+func (r *Room) Join(c *Client) error {
+	if c.Tenant() != r.tenant {
+		return ErrTenantMismatch
+	}
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrRoomClosed
+	}
+	r.members[c.id] = c
+	r.mu.Unlock()
+
+	c.mu.Lock()
+	c.rooms[r.name] = r
+	c.mu.Unlock()
+
+	// The Client leaves all the rooms once closed, check again in case it is closed concurrently.
+	if c.State() == ClientStateClosed {
+		r.Leave(c)
+		return ErrClientClosed
+	}
+	return nil
+}
+
+// Leave removes the Client from the Room, does nothing if the Client is not a member.
+func (r *Room) Leave(c *Client) {
+	r.mu.Lock()
+	delete(r.members, c.id)
+	r.mu.Unlock()
+
+	c.mu.Lock()
+	delete(c.rooms, r.name)
+	c.mu.Unlock()
+}
+
+// Members returns a snapshot of the clients in the Room.
+func (r *Room) Members() []*Client {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	members := make([]*Client, 0, len(r.members))
+	for _, c := range r.members {
+		members = append(members, c)
+	}
+	return members
+}
+
+// Len returns the number of clients in the Room.
+func (r *Room) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.members)
+}
+
+// Broadcast pushes a one-way Message with the route and the encoded v to all the clients in the Room,
+// or the ones interested in it if created with WithRoomInterest.
+// For a Room with history, the Message carries the Seq assigned and is appended to the history.
+// For a Room created with WithRoomPacing, it returns at once and the Message is spread over the duration.
+func (r *Room) Broadcast(route string, v interface{}) error {
+	return r.broadcast(route, v, r.interest)
+}
+
+// BroadcastFiltered is like Broadcast, but pushes only to the members for which f returns true,
+// instead of the InterestFilter of WithRoomInterest.
+func (r *Room) BroadcastFiltered(route string, v interface{}, f InterestFilter) error {
+	return r.broadcast(route, v, f)
+}
+
+func (r *Room) broadcast(route string, v interface{}, f InterestFilter) error {
+	if r.isClosed() {
+		return ErrRoomClosed
+	}
+
+	start := time.Now()
+	p := &sharedPush{route: route, v: v}
+	if r.history != nil {
+		e, err := r.history.appendHistory(r.key(), route, v)
+		if err != nil {
+			return err
+		}
+		p.seq = e.Seq
+	}
+	if r.pacing > 0 {
+		if err := p.encodeFor(r.Members()); err != nil {
+			return err
+		}
+	}
+	return r.deliver(
+		start, func(c *Client) (bool, error) {
+			if f != nil && !f(c, route, v) {
+				return false, nil
+			}
+			return true, p.writeTo(c)
+		},
+	)
+}
+
+// deliver writes a broadcast started at start to the members of the Room, by the fanout pool if set, or paced if
+// created with WithRoomPacing. write reports whether the Client is a recipient, and returns the encoding error.
+func (r *Room) deliver(start time.Time, write func(c *Client) (bool, error)) error {
+	if r.pacing > 0 {
+		r.pacer.pace(
+			r.Members(), r.pacing, write, func(n int) {
+				r.metrics.observeBroadcast(n, time.Since(start))
+			},
+		)
+		return nil
+	}
+
+	var recipients int64
+	err := fanoutClients(
+		r.Members(), func(c *Client) error {
+			written, err := write(c)
+			if written {
+				atomic.AddInt64(&recipients, 1)
+			}
+			return err
+		},
+	)
+	r.metrics.observeBroadcast(int(recipients), time.Since(start))
+	return err
+}
+
+// Close removes the Room from the registry and all the clients from the Room.
+func (r *Room) Close() {
+	rooms.mu.Lock()
+	if rooms.rooms[r.key()] == r {
+		delete(rooms.rooms, r.key())
+	}
+	rooms.mu.Unlock()
+
+	r.mu.Lock()
+	closed := r.closed
+	r.closed = true
+	members := r.members
+	r.members = make(map[uint64]*Client)
+	r.mu.Unlock()
+
+	for _, c := range members {
+		c.mu.Lock()
+		delete(c.rooms, r.name)
+		c.mu.Unlock()
+	}
+	if !closed {
+		r.deleteSnapshot()
+		r.releaseLock()
+		TopicRoomClosed.Publish(RoomClosed{Room: r})
+	}
+}
+
+func (r *Room) isClosed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.closed
+}
+
+// Rooms returns a snapshot of the rooms the Client has joined.
+func (c *Client) Rooms() []*Room {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rs := make([]*Room, 0, len(c.rooms))
+	for _, r := range c.rooms {
+		rs = append(rs, r)
+	}
+	return rs
+}
+
+// leaveAllRooms removes the Client from all the rooms it has joined, called when the Client is closed.
+func (c *Client) leaveAllRooms() {
+	for _, r := range c.Rooms() {
+		r.Leave(c)
+	}
+}
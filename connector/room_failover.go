@@ -0,0 +1,241 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RouteRoomFailover is the route of the one-way Message pushed to the members of a Room recovered by StandbyRoom
+// on another node once its owner died, with a RoomFailover as the data, so that the peer joins the Room again.
+const RouteRoomFailover = "room.failover"
+
+var (
+	ErrRoomFailoverDisabled = errors.New("ppcserver: room failover requires WithRoomLock and WithRoomFailover")
+	ErrRoomSnapshotNotFound = errors.New("ppcserver: room snapshot not found")
+)
+
+type (
+	// RoomFailover is the data of the RouteRoomFailover Message.
+	RoomFailover struct {
+		Room string `json:"room"`
+		// Seq is the Seq of the latest message in the history of the Room, to replay the messages after it.
+		Seq uint64 `json:"seq,omitempty"`
+	}
+
+	// RoomSnapshot is the state of a Room saved by its owner node with Room.SaveSnapshot, from which another node
+	// recovers the Room once the owner died.
+	RoomSnapshot struct {
+		Room   string `json:"room"`
+		Tenant Tenant `json:"tenant,omitempty"`
+		// Members are the uids of the authorized members, who are told to join the recovered Room again.
+		Members []string `json:"members,omitempty"`
+		// Seq is the Seq of the latest message in the history of the Room.
+		Seq uint64 `json:"seq,omitempty"`
+		// State is the application-defined state of the Room encoded as JSON.
+		State   json.RawMessage `json:"state,omitempty"`
+		SavedAt time.Time       `json:"saved_at"`
+	}
+
+	// RoomSnapshotStore persists the RoomSnapshot of the rooms created with WithRoomFailover, shared by the server
+	// nodes, such as in Redis by the redisstore package. The memory store only recovers the rooms within a process.
+	RoomSnapshotStore interface {
+		// Save saves the RoomSnapshot of the room, replacing the previous one.
+		Save(ctx context.Context, room string, s RoomSnapshot) error
+		// Load returns the RoomSnapshot of the room, or ErrRoomSnapshotNotFound if there is none.
+		Load(ctx context.Context, room string) (RoomSnapshot, error)
+		// Delete removes the RoomSnapshot of the room.
+		Delete(ctx context.Context, room string) error
+	}
+
+	// RoomRecoverFunc restores the application state of the Room recovered by StandbyRoom from the RoomSnapshot,
+	// before its members are told to join again.
+	RoomRecoverFunc func(r *Room, s RoomSnapshot)
+
+	// memoryRoomSnapshotStore is a RoomSnapshotStore in the memory of the current process.
+	memoryRoomSnapshotStore struct {
+		mu        sync.Mutex // mu guards snapshots.
+		snapshots map[string]RoomSnapshot
+	}
+)
+
+// NewMemoryRoomSnapshotStore creates a RoomSnapshotStore in the memory of the current process.
+func NewMemoryRoomSnapshotStore() RoomSnapshotStore {
+	return &memoryRoomSnapshotStore{snapshots: make(map[string]RoomSnapshot)}
+}
+
+func (s *memoryRoomSnapshotStore) Save(_ context.Context, room string, snap RoomSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshots[room] = snap
+	return nil
+}
+
+func (s *memoryRoomSnapshotStore) Load(_ context.Context, room string) (RoomSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap, ok := s.snapshots[room]
+	if !ok {
+		return RoomSnapshot{}, ErrRoomSnapshotNotFound
+	}
+	return snap, nil
+}
+
+func (s *memoryRoomSnapshotStore) Delete(_ context.Context, room string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.snapshots, room)
+	return nil
+}
+
+// WithRoomFailover is a RoomOption to save the RoomSnapshot of the Room to the store by Room.SaveSnapshot, so that
+// StandbyRoom on another node recovers the Room once its owner died. It requires WithRoomLock, and the snapshot is
+// deleted once the Room is closed by its owner.
+func WithRoomFailover(store RoomSnapshotStore) RoomOption {
+	return func(r *Room) {
+		r.snapshots = store
+	}
+}
+
+// SaveSnapshot saves the RoomSnapshot of the Room created with WithRoomFailover with the state encoded as JSON,
+// such as on every change of the state or periodically. It returns ErrLockLost if the Room is owned by another
+// node now.
+func (r *Room) SaveSnapshot(ctx context.Context, state interface{}) error {
+	if r.snapshots == nil || r.lock == nil {
+		return ErrRoomFailoverDisabled
+	}
+	if err := r.lock.lease.Err(); err != nil {
+		return err
+	}
+	snap := RoomSnapshot{Room: r.name, Tenant: r.tenant, SavedAt: now()}
+	if state != nil {
+		data, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+		snap.State = data
+	}
+	for _, c := range r.Members() {
+		if uid := c.UID(); uid != "" && !containsUID(snap.Members, uid) {
+			snap.Members = append(snap.Members, uid)
+		}
+	}
+	sort.Strings(snap.Members)
+	if r.history != nil {
+		r.history.mu.Lock()
+		snap.Seq = r.history.seq
+		r.history.mu.Unlock()
+	}
+	return r.snapshots.Save(ctx, r.key(), snap)
+}
+
+// deleteSnapshot deletes the RoomSnapshot of the Room closed by its owner, so that it's not recovered.
+// The snapshot is kept if the Lease is lost, since the Room is owned by another node.
+func (r *Room) deleteSnapshot() {
+	if r.snapshots == nil || r.lock == nil || r.lock.lease == nil || r.lock.lease.Err() != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.lock.ttl)
+	defer cancel()
+	if err := r.snapshots.Delete(ctx, r.key()); err != nil {
+		logging.Default().Error("RoomSnapshotStore.Delete() error", logging.F("room", r.name), logging.Err(err))
+	}
+}
+
+// StandbyRoom keeps the current node as a standby owner of the Room of DefaultTenant with the name, see
+// Tenant.StandbyRoom.
+func StandbyRoom(ctx context.Context, name string, restore RoomRecoverFunc, opts ...RoomOption) error {
+	return standbyRoom(ctx, DefaultTenant, name, restore, opts...)
+}
+
+// StandbyRoom keeps the current node as a standby owner of the Room of the Tenant with the name, created by opts
+// with WithRoomLock and WithRoomFailover, and blocks until ctx is done. Once the owner died, and its RoomSnapshot
+// is left in the store, the first standby node acquiring the lock after its TTL recreates the Room, restores it
+// by restore, and pushes a RouteRoomFailover Message to the members in the snapshot. The standby keeps watching,
+// so the Room is recovered again once this node loses it.
+func (t Tenant) StandbyRoom(ctx context.Context, name string, restore RoomRecoverFunc, opts ...RoomOption) error {
+	return standbyRoom(ctx, t, name, restore, opts...)
+}
+
+func standbyRoom(ctx context.Context, t Tenant, name string, restore RoomRecoverFunc, opts ...RoomOption) error {
+	probe := &Room{name: name, tenant: t}
+	for _, opt := range opts {
+		opt(probe)
+	}
+	if probe.lock == nil || probe.snapshots == nil {
+		return ErrRoomFailoverDisabled
+	}
+
+	ticker := time.NewTicker(probe.lock.ttl)
+	defer ticker.Stop()
+	for {
+		if r, ok := t.GetRoom(name); ok && r.Lease() != nil {
+			// Owned by this node, watch until the Room is closed or the Lease is lost.
+			select {
+			case <-r.Lease().Done():
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		} else if err := recoverRoom(ctx, t, name, probe.snapshots, restore, opts...); err != nil {
+			logging.Default().Warn("StandbyRoom recover error", logging.F("room", name), logging.Err(err))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// recoverRoom recreates the Room left by its dead owner if its RoomSnapshot exists and the lock is free.
+func recoverRoom(
+	ctx context.Context, t Tenant, name string, store RoomSnapshotStore, restore RoomRecoverFunc, opts ...RoomOption,
+) error {
+	key := tenantKey(t, name)
+	if _, err := store.Load(ctx, key); err != nil {
+		if errors.Is(err, ErrRoomSnapshotNotFound) {
+			return nil
+		}
+		return err
+	}
+	r, err := createRoom(t, name, opts...)
+	if errors.Is(err, ErrLockHeld) || errors.Is(err, ErrRoomExists) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Load again once the lock is held, since the previous owner may have saved or deleted it meanwhile.
+	snap, err := store.Load(ctx, key)
+	if err != nil {
+		r.Close()
+		if errors.Is(err, ErrRoomSnapshotNotFound) {
+			return nil
+		}
+		return err
+	}
+	if restore != nil {
+		restore(r, snap)
+	}
+	for _, uid := range snap.Members {
+		if err := pushToUser(t, uid, "", RouteRoomFailover, RoomFailover{Room: name, Seq: snap.Seq}); err != nil {
+			logging.Default().Warn("RoomFailover push error", logging.F("room", name), logging.Err(err))
+		}
+	}
+	return nil
+}
+
+func containsUID(uids []string, uid string) bool {
+	for _, u := range uids {
+		if u == uid {
+			return true
+		}
+	}
+	return false
+}
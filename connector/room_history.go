@@ -0,0 +1,163 @@
+package connector
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+type (
+	// RoomOption is a function to apply various configurations to customize a Room.
+	RoomOption func(r *Room)
+
+	// RoomHistoryEntry is a Message broadcast to a Room with history, the data is encoded as JSON.
+	RoomHistoryEntry struct {
+		Seq   uint64          `json:"seq"`
+		Route string          `json:"route"`
+		Data  json.RawMessage `json:"data,omitempty"`
+		Time  time.Time       `json:"time"`
+	}
+
+	// RoomHistoryStore keeps the history of the rooms, such as in memory by default or in a database.
+	RoomHistoryStore interface {
+		// Append appends the entry to the history of the room.
+		Append(room string, e RoomHistoryEntry) error
+		// Since returns at most limit latest entries of the room with Seq greater than seq, in ascending Seq.
+		Since(room string, seq uint64, limit int) ([]RoomHistoryEntry, error)
+		// LastSeq returns the largest Seq of the room, so a Room recreated after a restart continues the sequence.
+		LastSeq(room string) (uint64, error)
+	}
+
+	// roomHistory is the history state of a Room.
+	roomHistory struct {
+		size  int
+		store RoomHistoryStore
+		mu    sync.Mutex // mu guards seq and serializes the appends, so the entries are stored in order.
+		seq   uint64
+	}
+
+	// memoryRoomHistoryStore is a RoomHistoryStore keeping the latest size entries per room in memory.
+	memoryRoomHistoryStore struct {
+		size    int
+		mu      sync.Mutex // mu guards entries.
+		entries map[string][]RoomHistoryEntry
+	}
+)
+
+// WithRoomHistory is a RoomOption to keep the latest size messages broadcast to the Room in memory,
+// which are replayed by Room.JoinAndReplay.
+func WithRoomHistory(size int) RoomOption {
+	return WithRoomHistoryStore(NewMemoryRoomHistoryStore(size), size)
+}
+
+// WithRoomHistoryStore is a RoomOption to keep the history of the Room in the store,
+// size is the maximum number of messages replayed by Room.JoinAndReplay.
+func WithRoomHistoryStore(store RoomHistoryStore, size int) RoomOption {
+	return func(r *Room) {
+		r.history = &roomHistory{size: size, store: store}
+	}
+}
+
+// NewMemoryRoomHistoryStore creates a RoomHistoryStore keeping the latest size entries per room in memory.
+func NewMemoryRoomHistoryStore(size int) RoomHistoryStore {
+	return &memoryRoomHistoryStore{size: size, entries: make(map[string][]RoomHistoryEntry)}
+}
+
+func (s *memoryRoomHistoryStore) Append(room string, e RoomHistoryEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := append(s.entries[room], e)
+	if len(entries) > s.size {
+		// Copy to release the underlying array of the dropped entries.
+		entries = append(entries[:0:0], entries[len(entries)-s.size:]...)
+	}
+	s.entries[room] = entries
+	return nil
+}
+
+func (s *memoryRoomHistoryStore) Since(room string, seq uint64, limit int) ([]RoomHistoryEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := s.entries[room]
+	i := len(entries)
+	for i > 0 && entries[i-1].Seq > seq && len(entries)-i < limit {
+		i--
+	}
+	return append([]RoomHistoryEntry(nil), entries[i:]...), nil
+}
+
+func (s *memoryRoomHistoryStore) LastSeq(room string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entries := s.entries[room]; len(entries) > 0 {
+		return entries[len(entries)-1].Seq, nil
+	}
+	return 0, nil
+}
+
+// LastSeq returns the Seq of the latest Message broadcast to the Room, zero if the Room has no history.
+func (r *Room) LastSeq() uint64 {
+	if r.history == nil {
+		return 0
+	}
+	r.history.mu.Lock()
+	defer r.history.mu.Unlock()
+	return r.history.seq
+}
+
+// History returns at most the history size latest messages broadcast to the Room with Seq greater than seq.
+func (r *Room) History(seq uint64) ([]RoomHistoryEntry, error) {
+	if r.history == nil {
+		return nil, nil
+	}
+	return r.history.store.Since(r.key(), seq, r.history.size)
+}
+
+// JoinAndReplay adds the Client to the Room and pushes the history messages with Seq greater than seq,
+// zero seq replays the whole kept history, such as the last N chat messages for a new member,
+// and a resuming member passes the last Seq it received to get the missed messages.
+// A Message broadcast during the replay may arrive twice or out of order, so the peer should deduplicate by Seq.
+func (r *Room) JoinAndReplay(c *Client, seq uint64) error {
+	if err := r.Join(c); err != nil {
+		return err
+	}
+	entries, err := r.History(seq)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		var v interface{}
+		if e.Data != nil {
+			v = e.Data
+		}
+		bufs, err := encodeSeqPush(c.codec(), e.Seq, e.Route, v)
+		if err != nil {
+			return err
+		}
+		if err := c.writeBuffers(bufs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendHistory assigns the next Seq to the broadcast Message and appends it to the history.
+func (h *roomHistory) appendHistory(room, route string, v interface{}) (RoomHistoryEntry, error) {
+	e := RoomHistoryEntry{Route: route, Time: now()}
+	if v != nil {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return e, err
+		}
+		e.Data = data
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e.Seq = h.seq + 1
+	if err := h.store.Append(room, e); err != nil {
+		return e, err
+	}
+	h.seq = e.Seq
+	return e, nil
+}
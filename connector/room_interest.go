@@ -0,0 +1,76 @@
+package connector
+
+import "sync"
+
+type (
+	// InterestFilter reports whether the member of a Room is interested in the Message broadcast with the route
+	// and v, such as an update of a nearby entity. It is evaluated per member before the Message is enqueued,
+	// so it must be fast and must not block. The filtered out members of a Room with history see gaps in Seq.
+	InterestFilter func(member *Client, route string, v interface{}) bool
+
+	// Point is a location in the 2D space of a Room.
+	Point struct {
+		X float64 `json:"x"`
+		Y float64 `json:"y"`
+	}
+
+	// Located is implemented by the broadcast data located in the space of a Room, for RadiusInterest.
+	Located interface {
+		Location() Point
+	}
+
+	// RadiusInterest is an area of interest of the members of a Room, where a member is interested in
+	// the Located data within a radius of its position, and in all the data not Located.
+	RadiusInterest struct {
+		radius    float64
+		mu        sync.RWMutex // mu guards positions.
+		positions map[uint64]Point
+	}
+)
+
+// WithRoomInterest is a RoomOption to push the messages broadcast to the Room only to the members
+// for which f returns true, such as RadiusInterest.Filter.
+func WithRoomInterest(f InterestFilter) RoomOption {
+	return func(r *Room) {
+		r.interest = f
+	}
+}
+
+// NewRadiusInterest creates a RadiusInterest of the radius.
+func NewRadiusInterest(radius float64) *RadiusInterest {
+	return &RadiusInterest{
+		radius:    radius,
+		positions: make(map[uint64]Point),
+	}
+}
+
+// Move sets the position of the member, such as on each movement received from it.
+func (ri *RadiusInterest) Move(c *Client, p Point) {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	ri.positions[c.ID()] = p
+}
+
+// Remove removes the position of the member, which should be called once it leaves the Room.
+func (ri *RadiusInterest) Remove(c *Client) {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	delete(ri.positions, c.ID())
+}
+
+// Filter is the InterestFilter of the RadiusInterest, a member without a position is interested in everything.
+func (ri *RadiusInterest) Filter(member *Client, _ string, v interface{}) bool {
+	l, ok := v.(Located)
+	if !ok {
+		return true
+	}
+	ri.mu.RLock()
+	p, ok := ri.positions[member.ID()]
+	ri.mu.RUnlock()
+	if !ok {
+		return true
+	}
+	at := l.Location()
+	dx, dy := at.X-p.X, at.Y-p.Y
+	return dx*dx+dy*dy <= ri.radius*ri.radius
+}
@@ -0,0 +1,96 @@
+package connector
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// maxRoomMetrics limits the number of rooms reported by CollectRoomStats, accessed atomically.
+var maxRoomMetrics int64 = 100
+
+type (
+	// roomMetrics holds the cumulative counters of a Room, accessed atomically.
+	roomMetrics struct {
+		broadcasts     uint64
+		messagesSent   uint64
+		fanoutNanos    uint64
+		maxFanoutNanos uint64
+	}
+
+	// RoomStats is a snapshot of the metrics of a Room.
+	RoomStats struct {
+		Name   string
+		Tenant Tenant
+		// Members is the number of clients in the Room.
+		Members int
+		// Broadcasts is the cumulative number of Room.Broadcast calls.
+		Broadcasts uint64
+		// MessagesSent is the cumulative number of messages enqueued to the members by Room.Broadcast.
+		MessagesSent uint64
+		// FanoutTotal is the cumulative time spent in fanning out the broadcasts to the members,
+		// divide by Broadcasts for the average fanout latency.
+		FanoutTotal time.Duration
+		// FanoutMax is the longest time spent in fanning out a single broadcast.
+		FanoutMax time.Duration
+	}
+)
+
+// SetMaxRoomMetrics sets the maximum number of rooms reported by CollectRoomStats,
+// which limits the cardinality of the per-room metrics exported to monitoring systems.
+func SetMaxRoomMetrics(v int) {
+	atomic.StoreInt64(&maxRoomMetrics, int64(v))
+}
+
+// MaxRoomMetrics returns the maximum number of rooms reported by CollectRoomStats.
+func MaxRoomMetrics() int {
+	return int(atomic.LoadInt64(&maxRoomMetrics))
+}
+
+func (m *roomMetrics) observeBroadcast(recipients int, d time.Duration) {
+	fanoutDurations.Observe(d.Seconds())
+	atomic.AddUint64(&m.broadcasts, 1)
+	atomic.AddUint64(&m.messagesSent, uint64(recipients))
+	atomic.AddUint64(&m.fanoutNanos, uint64(d))
+	for {
+		max := atomic.LoadUint64(&m.maxFanoutNanos)
+		if uint64(d) <= max || atomic.CompareAndSwapUint64(&m.maxFanoutNanos, max, uint64(d)) {
+			return
+		}
+	}
+}
+
+// Stats returns a snapshot of the metrics of the Room.
+func (r *Room) Stats() RoomStats {
+	return RoomStats{
+		Name:         r.name,
+		Tenant:       r.tenant,
+		Members:      r.Len(),
+		Broadcasts:   atomic.LoadUint64(&r.metrics.broadcasts),
+		MessagesSent: atomic.LoadUint64(&r.metrics.messagesSent),
+		FanoutTotal:  time.Duration(atomic.LoadUint64(&r.metrics.fanoutNanos)),
+		FanoutMax:    time.Duration(atomic.LoadUint64(&r.metrics.maxFanoutNanos)),
+	}
+}
+
+// CollectRoomStats returns the metrics of the hottest rooms, limited by MaxRoomMetrics,
+// ordered by MessagesSent and then Members in descending order, so hot rooms can be identified.
+func CollectRoomStats() []RoomStats {
+	rs := Rooms()
+	stats := make([]RoomStats, 0, len(rs))
+	for _, r := range rs {
+		stats = append(stats, r.Stats())
+	}
+	sort.Slice(
+		stats, func(i, j int) bool {
+			if stats[i].MessagesSent != stats[j].MessagesSent {
+				return stats[i].MessagesSent > stats[j].MessagesSent
+			}
+			return stats[i].Members > stats[j].Members
+		},
+	)
+	if limit := MaxRoomMetrics(); limit >= 0 && len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats
+}
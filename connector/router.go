@@ -0,0 +1,221 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRouteNotFound = errors.New("ppcserver: route not found")
+)
+
+type (
+	// HandlerFunc processes a Message received from a Client.
+	// The returned value, if not nil, is encoded as the Data of the response sent back to the Client.
+	// The Message and its Data are pooled and released after the HandlerFunc returns,
+	// so copy them if they are needed afterwards, such as by another goroutine.
+	HandlerFunc func(ctx context.Context, c *Client, m *Message) (interface{}, error)
+
+	// Middleware wraps a HandlerFunc to run logic before and after the next HandlerFunc.
+	Middleware func(next HandlerFunc) HandlerFunc
+
+	// Router dispatches Message to the HandlerFunc registered for Message.Route.
+	Router struct {
+		mu          sync.RWMutex // mu guards handlers, prefixes, middlewares, schemas and services.
+		handlers    map[string]HandlerFunc
+		prefixes    []prefixHandler // prefixes is ordered by the prefix length descending.
+		middlewares []Middleware
+		priorities  []Priority // priorities are the Priority of middlewares, in ascending order.
+		schemas     map[string]RouteSchema
+		services    map[string]*ServiceDesc // services are registered by RegisterService, keyed by the name.
+	}
+
+	// RouteSchema declares the message contract of a route, for exporting it to the client teams,
+	// such as by the schema package. Request and Response are zero values of the types of the data,
+	// such as MoveRequest{}, nil for no data.
+	RouteSchema struct {
+		Route       string
+		Description string
+		// Push is true for a one-way Message pushed by the server, where Response is the type of the data.
+		Push     bool
+		Request  interface{}
+		Response interface{}
+	}
+
+	// prefixHandler is a HandlerFunc registered for the routes with the prefix.
+	prefixHandler struct {
+		prefix string
+		h      HandlerFunc
+	}
+)
+
+// NewRouter creates a new Router with no routes.
+func NewRouter() *Router {
+	return &Router{
+		handlers: make(map[string]HandlerFunc),
+		schemas:  make(map[string]RouteSchema),
+	}
+}
+
+// Handle registers the HandlerFunc for the route, replaces the previous one if the route exists.
+// A route ending with "*" registers the HandlerFunc for all the routes with the prefix, such as "battle.*",
+// which handles the routes without an exact match, and the longest prefix wins.
+func (r *Router) Handle(route string, h HandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !strings.HasSuffix(route, "*") {
+		r.handlers[route] = h
+		return
+	}
+
+	prefix := strings.TrimSuffix(route, "*")
+	for i := range r.prefixes {
+		if r.prefixes[i].prefix == prefix {
+			r.prefixes[i].h = h
+			return
+		}
+	}
+	r.prefixes = append(r.prefixes, prefixHandler{prefix: prefix, h: h})
+	sort.SliceStable(r.prefixes, func(i, j int) bool { return len(r.prefixes[i].prefix) > len(r.prefixes[j].prefix) })
+}
+
+// Remove unregisters the HandlerFunc of the route, a route ending with "*" unregisters the prefix.
+// It's safe to update the routes while the Router is dispatching, such as re-pointing a prefix to a new backend.
+func (r *Router) Remove(route string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !strings.HasSuffix(route, "*") {
+		delete(r.handlers, route)
+		return
+	}
+
+	prefix := strings.TrimSuffix(route, "*")
+	for i := range r.prefixes {
+		if r.prefixes[i].prefix == prefix {
+			r.prefixes = append(r.prefixes[:i:i], r.prefixes[i+1:]...)
+			return
+		}
+	}
+}
+
+// Routes returns the sorted routes registered to the Router, the prefixes end with "*".
+func (r *Router) Routes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	routes := make([]string, 0, len(r.handlers)+len(r.prefixes))
+	for route := range r.handlers {
+		routes = append(routes, route)
+	}
+	for _, p := range r.prefixes {
+		routes = append(routes, p.prefix+"*")
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+// Describe declares the RouteSchema of a route handled by the Router, or of a route pushed by the server,
+// replaces the previous one of the same route.
+func (r *Router) Describe(s RouteSchema) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schemas[s.Route] = s
+}
+
+// Schemas returns the declared RouteSchema sorted by the route.
+func (r *Router) Schemas() []RouteSchema {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	schemas := make([]RouteSchema, 0, len(r.schemas))
+	for _, s := range r.schemas {
+		schemas = append(schemas, s)
+	}
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i].Route < schemas[j].Route })
+	return schemas
+}
+
+// lookup returns the HandlerFunc for the route, the exact match first and then the longest prefix.
+func (r *Router) lookup(route string) (HandlerFunc, bool) {
+	if h, ok := r.handlers[route]; ok {
+		return h, true
+	}
+	for _, p := range r.prefixes {
+		if strings.HasPrefix(route, p.prefix) {
+			return p.h, true
+		}
+	}
+	return nil, false
+}
+
+// Use appends Middleware to the Router with PriorityDefault, the Middleware registered first is the outermost one.
+func (r *Router) Use(mws ...Middleware) {
+	r.UseWithPriority(PriorityDefault, mws...)
+}
+
+// UseWithPriority adds Middleware to the Router ordered by the Priority, the Middleware of the lower Priority is
+// the outer one, such as UseWithPriority(PriorityAuth, auth) running before the Middleware of PriorityRateLimit
+// regardless of the order registered.
+func (r *Router) UseWithPriority(p Priority, mws ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, mw := range mws {
+		i := insertByPriority(r.priorities, p)
+		// Copy on insert, since the middlewares may be held by a dispatch in progress.
+		r.middlewares = append(r.middlewares[:i:i], append([]Middleware{mw}, r.middlewares[i:]...)...)
+		r.priorities = append(r.priorities[:i:i], append([]Priority{p}, r.priorities[i:]...)...)
+	}
+}
+
+// dispatch runs the HandlerFunc registered for m.Route wrapped by all the Middleware.
+func (r *Router) dispatch(ctx context.Context, c *Client, m *Message) (interface{}, error) {
+	r.mu.RLock()
+	h, ok := r.lookup(m.Route)
+	mws := r.middlewares
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrRouteNotFound
+	}
+
+	// The innermost span covers only the registered HandlerFunc, excluding the Middleware.
+	next := func(ctx context.Context, c *Client, m *Message) (interface{}, error) {
+		ctx, span := c.opts.Tracer.Start(ctx, SpanNameHandler)
+		defer span.End()
+
+		start := time.Now()
+		v, err := h(ctx, c, m)
+		if err != nil {
+			countHandlerError()
+			span.RecordError(err)
+		}
+		observeHandlerDuration(c, m.Route, time.Since(start))
+		return v, err
+	}
+	for i := len(mws) - 1; i >= 0; i-- {
+		next = mws[i](next)
+	}
+	return next(ctx, c, m)
+}
+
+// observeHandlerDuration records the handler execution time,
+// and counts and logs the execution that takes longer than Options.SlowHandlerThreshold.
+func observeHandlerDuration(c *Client, route string, d time.Duration) {
+	handlerDurations.Observe(route, d.Seconds())
+
+	threshold := c.opts.SlowHandlerThreshold
+	if threshold <= 0 || d < threshold {
+		return
+	}
+
+	countSlowHandler()
+	c.Logger().Warn(
+		"slow handler",
+		logging.F("route", route),
+		logging.F("duration", d),
+		logging.F("threshold", threshold),
+	)
+}
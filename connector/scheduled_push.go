@@ -0,0 +1,250 @@
+package connector
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/clock"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrInvalidScheduledPush = errors.New("ppcserver: scheduled push requires either a uid or a room")
+
+var scheduledPushes = &scheduledPushRegistry{
+	pushes: make(map[string]*scheduledPush),
+}
+
+type (
+	// ScheduledPush is a one-way Message pushed to the clients of a user or the members of a Room at a future time.
+	// The data is encoded as JSON when scheduled, so that a ScheduledPush can be persisted by a ScheduledPushStore.
+	ScheduledPush struct {
+		ID    string          `json:"id"`
+		At    time.Time       `json:"at"`
+		UID   string          `json:"uid,omitempty"`
+		Room  string          `json:"room,omitempty"`
+		Route string          `json:"route"`
+		Data  json.RawMessage `json:"data,omitempty"`
+	}
+
+	// ScheduledPushStore persists the scheduled pushes, so that a restart does not lose them.
+	ScheduledPushStore interface {
+		// Save persists the ScheduledPush, replacing the one with the same ID.
+		Save(p ScheduledPush) error
+		// Delete removes the ScheduledPush with the id, which is delivered or cancelled.
+		Delete(id string) error
+		// Load returns all the persisted pushes.
+		Load() ([]ScheduledPush, error)
+	}
+
+	scheduledPush struct {
+		ScheduledPush
+		timer clock.Timer
+	}
+
+	// scheduledPushRegistry holds the pending scheduled pushes in the current process, keyed by ScheduledPush.ID.
+	scheduledPushRegistry struct {
+		mu     sync.Mutex // mu guards pushes and store.
+		pushes map[string]*scheduledPush
+		store  ScheduledPushStore
+	}
+)
+
+// SchedulePushToUser schedules a one-way Message with the route and the encoded v to all the clients
+// authorized as the uid at the time at, it returns the ID for CancelScheduledPush.
+// The clients are resolved at the time at as PushToUser, which queues the Message if the user is offline then.
+func SchedulePushToUser(at time.Time, uid, route string, v interface{}) (string, error) {
+	return schedulePush(ScheduledPush{At: at, UID: uid, Route: route}, v)
+}
+
+// SchedulePushToRoom schedules a one-way Message with the route and the encoded v to the members of the Room
+// with the name at the time at, such as a "match starts in 60s" countdown, it returns the ID for CancelScheduledPush.
+func SchedulePushToRoom(at time.Time, room, route string, v interface{}) (string, error) {
+	return schedulePush(ScheduledPush{At: at, Room: room, Route: route}, v)
+}
+
+// CancelScheduledPush cancels the pending ScheduledPush with the id,
+// it returns false if there is no such ScheduledPush or it has been delivered.
+func CancelScheduledPush(id string) bool {
+	scheduledPushes.mu.Lock()
+	p, ok := scheduledPushes.pushes[id]
+	if ok {
+		delete(scheduledPushes.pushes, id)
+		p.timer.Stop()
+	}
+	store := scheduledPushes.store
+	scheduledPushes.mu.Unlock()
+
+	if ok && store != nil {
+		if err := store.Delete(id); err != nil {
+			logging.Default().Error("ScheduledPushStore.Delete() error", logging.F("id", id), logging.Err(err))
+		}
+	}
+	return ok
+}
+
+// ScheduledPushes returns the pending scheduled pushes ordered by the time to push.
+func ScheduledPushes() []ScheduledPush {
+	scheduledPushes.mu.Lock()
+	pushes := make([]ScheduledPush, 0, len(scheduledPushes.pushes))
+	for _, p := range scheduledPushes.pushes {
+		pushes = append(pushes, p.ScheduledPush)
+	}
+	scheduledPushes.mu.Unlock()
+	sort.Slice(pushes, func(i, j int) bool { return pushes[i].At.Before(pushes[j].At) })
+	return pushes
+}
+
+// SetScheduledPushStore sets the ScheduledPushStore persisting the scheduled pushes, and schedules the pushes
+// loaded from it, the overdue ones are pushed immediately. It should be called once before the connector starts.
+func SetScheduledPushStore(store ScheduledPushStore) error {
+	pushes, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	scheduledPushes.mu.Lock()
+	scheduledPushes.store = store
+	for _, p := range pushes {
+		scheduledPushes.addLocked(p)
+	}
+	scheduledPushes.mu.Unlock()
+	return nil
+}
+
+func schedulePush(p ScheduledPush, v interface{}) (string, error) {
+	if (p.UID == "") == (p.Room == "") {
+		return "", ErrInvalidScheduledPush
+	}
+	if v != nil {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		p.Data = data
+	}
+	p.ID = newRandomID()
+
+	scheduledPushes.mu.Lock()
+	store := scheduledPushes.store
+	scheduledPushes.mu.Unlock()
+	if store != nil {
+		if err := store.Save(p); err != nil {
+			return "", err
+		}
+	}
+
+	scheduledPushes.mu.Lock()
+	scheduledPushes.addLocked(p)
+	scheduledPushes.mu.Unlock()
+	return p.ID, nil
+}
+
+// addLocked schedules p on the timing wheel, mu must be held.
+func (r *scheduledPushRegistry) addLocked(p ScheduledPush) {
+	sp := &scheduledPush{ScheduledPush: p}
+	// The delivery may call the ScheduledPushStore, which must not block the timing wheel.
+	sp.timer = afterFunc(p.At.Sub(now()), func() { go r.deliver(p.ID) })
+	r.pushes[p.ID] = sp
+}
+
+// deliver pushes the ScheduledPush with the id unless it has been cancelled.
+func (r *scheduledPushRegistry) deliver(id string) {
+	r.mu.Lock()
+	sp, ok := r.pushes[id]
+	delete(r.pushes, id)
+	store := r.store
+	r.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	var v interface{}
+	if len(sp.Data) > 0 {
+		v = sp.Data
+	}
+	var err error
+	if sp.UID != "" {
+		err = PushToUser(sp.UID, sp.Route, v)
+	} else if room, ok := GetRoom(sp.Room); ok {
+		err = room.Broadcast(sp.Route, v)
+	}
+	if err != nil {
+		logging.Default().Warn("ScheduledPush deliver error", logging.F("id", id), logging.Err(err))
+	}
+
+	if store != nil {
+		if err := store.Delete(id); err != nil {
+			logging.Default().Error("ScheduledPushStore.Delete() error", logging.F("id", id), logging.Err(err))
+		}
+	}
+}
+
+// fileScheduledPushStore is a ScheduledPushStore that rewrites all the pending pushes to a JSON file on every change.
+type fileScheduledPushStore struct {
+	path   string
+	mu     sync.Mutex // mu guards pushes and the file.
+	pushes map[string]ScheduledPush
+}
+
+// NewFileScheduledPushStore creates a ScheduledPushStore persisting to the JSON file at the path,
+// which is suitable for a single server with a moderate number of scheduled pushes.
+func NewFileScheduledPushStore(path string) ScheduledPushStore {
+	return &fileScheduledPushStore{path: path, pushes: make(map[string]ScheduledPush)}
+}
+
+func (s *fileScheduledPushStore) Save(p ScheduledPush) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pushes[p.ID] = p
+	return s.flush()
+}
+
+func (s *fileScheduledPushStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pushes[id]; !ok {
+		return nil
+	}
+	delete(s.pushes, id)
+	return s.flush()
+}
+
+func (s *fileScheduledPushStore) Load() ([]ScheduledPush, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var pushes []ScheduledPush
+	if err := json.Unmarshal(b, &pushes); err != nil {
+		return nil, err
+	}
+	for _, p := range pushes {
+		s.pushes[p.ID] = p
+	}
+	return pushes, nil
+}
+
+// flush writes to a temporary file and renames it, so that a crash never leaves a truncated file, mu must be held.
+func (s *fileScheduledPushStore) flush() error {
+	pushes := make([]ScheduledPush, 0, len(s.pushes))
+	for _, p := range s.pushes {
+		pushes = append(pushes, p)
+	}
+	b, err := json.Marshal(pushes)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
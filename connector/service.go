@@ -0,0 +1,140 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// RouteReflection is the route of the Message answered with the []ServiceInfo of the services registered to
+// the Router once Router.EnableReflection is called, for the tooling to discover the routes.
+const RouteReflection = "ppcserver.reflection"
+
+type (
+	// ServiceDesc describes a service whose methods are handled as the routes "<ServiceName>.<MethodName>",
+	// such as generated from a protobuf service by protoc-gen-ppcserver, so that the handlers implement a typed
+	// interface instead of the stringly-typed routes:
+	//
+	//	battlepb.RegisterBattleServer(router, &battleServer{})
+	ServiceDesc struct {
+		// ServiceName is the full name of the service, such as "battle.Battle".
+		ServiceName string
+		// HandlerType is the nil pointer to the interface implemented by the service, such as (*BattleServer)(nil),
+		// to check the implementation by Router.RegisterService.
+		HandlerType interface{}
+		Methods     []MethodDesc
+		// Metadata is the source of the service, such as the name of the proto file.
+		Metadata interface{}
+	}
+
+	// MethodDesc describes a method of a ServiceDesc.
+	MethodDesc struct {
+		MethodName string
+		// Handler decodes the request by dec and calls the method of srv, which implements ServiceDesc.HandlerType.
+		Handler func(srv interface{}, ctx context.Context, c *Client, dec func(v interface{}) error) (interface{}, error)
+		// Request and Response are the nil pointers to the types of the data, such as (*MoveRequest)(nil),
+		// declared as the RouteSchema of the route.
+		Request  interface{}
+		Response interface{}
+	}
+
+	// ServiceInfo describes a service registered to the Router, see Router.Services.
+	ServiceInfo struct {
+		Name     string       `json:"name"`
+		Methods  []MethodInfo `json:"methods"`
+		Metadata interface{}  `json:"metadata,omitempty"`
+	}
+
+	// MethodInfo describes a method of a ServiceInfo, the types are the Go type names of the data.
+	MethodInfo struct {
+		Name     string `json:"name"`
+		Route    string `json:"route"`
+		Request  string `json:"request,omitempty"`
+		Response string `json:"response,omitempty"`
+	}
+)
+
+// RegisterService registers the methods of the service implemented by srv as the routes
+// "<ServiceName>.<MethodName>", and declares their RouteSchema. It panics if srv does not implement
+// ServiceDesc.HandlerType, or the service is already registered.
+func (r *Router) RegisterService(sd *ServiceDesc, srv interface{}) {
+	if sd.HandlerType != nil {
+		ht := reflect.TypeOf(sd.HandlerType).Elem()
+		if st := reflect.TypeOf(srv); !st.Implements(ht) {
+			panic(fmt.Sprintf("ppcserver: Router.RegisterService found the handler of type %v not satisfying %v", st, ht))
+		}
+	}
+
+	r.mu.Lock()
+	if r.services == nil {
+		r.services = make(map[string]*ServiceDesc)
+	}
+	if _, ok := r.services[sd.ServiceName]; ok {
+		r.mu.Unlock()
+		panic("ppcserver: Router.RegisterService found duplicate service registration for " + sd.ServiceName)
+	}
+	r.services[sd.ServiceName] = sd
+	r.mu.Unlock()
+
+	for _, md := range sd.Methods {
+		md := md
+		route := sd.ServiceName + "." + md.MethodName
+		r.Handle(
+			route, func(ctx context.Context, c *Client, m *Message) (interface{}, error) {
+				dec := func(v interface{}) error {
+					if len(m.Data) == 0 {
+						return nil
+					}
+					return c.codec().Unmarshal(m.Data, v)
+				}
+				return md.Handler(srv, ctx, c, dec)
+			},
+		)
+		r.Describe(RouteSchema{Route: route, Request: md.Request, Response: md.Response})
+	}
+}
+
+// Services returns the ServiceInfo of the services registered by RegisterService, sorted by the name.
+func (r *Router) Services() []ServiceInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	infos := make([]ServiceInfo, 0, len(r.services))
+	for _, sd := range r.services {
+		info := ServiceInfo{Name: sd.ServiceName, Methods: make([]MethodInfo, 0, len(sd.Methods)), Metadata: sd.Metadata}
+		for _, md := range sd.Methods {
+			info.Methods = append(
+				info.Methods, MethodInfo{
+					Name:     md.MethodName,
+					Route:    sd.ServiceName + "." + md.MethodName,
+					Request:  typeName(md.Request),
+					Response: typeName(md.Response),
+				},
+			)
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// EnableReflection registers the RouteReflection route answering the ServiceInfo of the registered services.
+func (r *Router) EnableReflection() {
+	r.Handle(
+		RouteReflection, func(context.Context, *Client, *Message) (interface{}, error) {
+			return r.Services(), nil
+		},
+	)
+}
+
+// typeName returns the name of the type of v without the pointers, empty for nil.
+func typeName(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.String()
+}
@@ -0,0 +1,200 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"sync"
+	"time"
+)
+
+var ErrSessionNotFound = errors.New("ppcserver: session not found")
+
+type (
+	// Session is the durable state of an authorized user session, which outlives the Client for Options.SessionTTL,
+	// such as the resume token, the session attributes, and the pushes pending for ACK.
+	Session struct {
+		// ID is the resume token of the Session, an unguessable random string.
+		ID  string `json:"id"`
+		UID string `json:"uid"`
+		// Attributes are the application-defined session attributes.
+		Attributes map[string]string `json:"attributes,omitempty"`
+		// Metadata is the Client metadata of the keys in Options.ReplicatedMetadata.
+		Metadata map[string]string `json:"metadata,omitempty"`
+		// PendingAcks are the pushes sent to the peer but not acknowledged yet.
+		PendingAcks []PendingAck `json:"pending_acks,omitempty"`
+		// AckSeq is the Seq of the latest push sent by Client.PushWithAck in the Session.
+		AckSeq uint64 `json:"ack_seq,omitempty"`
+		// DeliveredKeys are the idempotency keys pushed by Client.PushWithKey within Options.DedupWindow,
+		// by the time delivered.
+		DeliveredKeys map[string]time.Time `json:"delivered_keys,omitempty"`
+		UpdatedAt     time.Time            `json:"updated_at"`
+	}
+
+	// PendingAck is a push waiting for the ACK from the peer.
+	PendingAck struct {
+		Seq    uint64          `json:"seq"`
+		Route  string          `json:"route"`
+		Data   json.RawMessage `json:"data,omitempty"`
+		SentAt time.Time       `json:"sent_at"`
+	}
+
+	// SessionStore persists the Session, so that the durability features of the connector are not tied to
+	// a single backend, such as in memory by default or Redis by the redisstore package.
+	SessionStore interface {
+		// Load returns the Session with the id, or ErrSessionNotFound if there is none or it is expired.
+		Load(ctx context.Context, id string) (*Session, error)
+		// Save persists the Session, which expires after ttl.
+		Save(ctx context.Context, s *Session, ttl time.Duration) error
+		// Delete removes the Session with the id.
+		Delete(ctx context.Context, id string) error
+	}
+
+	// memorySessionStore is a SessionStore in the memory of the current process.
+	memorySessionStore struct {
+		mu       sync.Mutex // mu guards sessions and saves.
+		sessions map[string]memorySession
+		saves    int
+	}
+
+	memorySession struct {
+		data      []byte
+		expiresAt time.Time
+	}
+)
+
+// memorySessionSweepInterval is the number of saves between the sweeps of the expired sessions.
+const memorySessionSweepInterval = 1024
+
+// NewMemorySessionStore creates a SessionStore in the memory of the current process, which is the default.
+// The sessions are encoded on Save, so that the caller can keep modifying the saved Session.
+func NewMemorySessionStore() SessionStore {
+	return &memorySessionStore{sessions: make(map[string]memorySession)}
+}
+
+func (s *memorySessionStore) Load(_ context.Context, id string) (*Session, error) {
+	s.mu.Lock()
+	ms, ok := s.sessions[id]
+	if ok && now().After(ms.expiresAt) {
+		delete(s.sessions, id)
+		ok = false
+	}
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+
+	sess := &Session{}
+	if err := json.Unmarshal(ms.data, sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+func (s *memorySessionStore) Save(_ context.Context, sess *Session, ttl time.Duration) error {
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	at := now()
+	s.sessions[sess.ID] = memorySession{data: data, expiresAt: at.Add(ttl)}
+	if s.saves++; s.saves%memorySessionSweepInterval == 0 {
+		for id, ms := range s.sessions {
+			if at.After(ms.expiresAt) {
+				delete(s.sessions, id)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *memorySessionStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+	return nil
+}
+
+// startSession creates and saves the Session of the Client once authorized as the uid.
+func (c *Client) startSession(ctx context.Context, uid string) {
+	sess := &Session{ID: newRandomID(), UID: uid, Metadata: c.ReplicatedMetadata(), UpdatedAt: now()}
+	if err := c.opts.SessionStore.Save(ctx, sess, c.opts.SessionTTL); err != nil {
+		c.Logger().Error("SessionStore.Save() error", logging.Err(err))
+	}
+	c.mu.Lock()
+	c.session = sess
+	c.mu.Unlock()
+}
+
+// saveSession saves the Session of the closed Client, so that it expires Options.SessionTTL after the disconnect.
+func (c *Client) saveSession() {
+	err := c.updateSession(context.Background(), func(*Session) {})
+	if err != nil && !errors.Is(err, ErrUnauthorized) {
+		c.Logger().Error("SessionStore.Save() error", logging.Err(err))
+	}
+}
+
+// updateSession applies f to the Session of the Client and saves it, the Client must be authorized.
+func (c *Client) updateSession(ctx context.Context, f func(s *Session)) error {
+	c.mu.Lock()
+	sess := c.session
+	if sess == nil {
+		c.mu.Unlock()
+		return ErrUnauthorized
+	}
+	f(sess)
+	sess.UpdatedAt = now()
+	// Save a copy, since the Session keeps changing while being saved.
+	saved := *sess
+	saved.Attributes = make(map[string]string, len(sess.Attributes))
+	for k, v := range sess.Attributes {
+		saved.Attributes[k] = v
+	}
+	saved.PendingAcks = append([]PendingAck(nil), sess.PendingAcks...)
+	saved.DeliveredKeys = c.deliveredKeys()
+	saved.Metadata = c.replicatedMetadata()
+	c.mu.Unlock()
+
+	return c.opts.SessionStore.Save(ctx, &saved, c.opts.SessionTTL)
+}
+
+// SessionID returns the ID of the Session, which is the resume token, empty if the Client is not authorized.
+func (c *Client) SessionID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.session == nil {
+		return ""
+	}
+	return c.session.ID
+}
+
+// SessionAttribute returns the session attribute with the key.
+func (c *Client) SessionAttribute(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.session == nil {
+		return "", false
+	}
+	v, ok := c.session.Attributes[key]
+	return v, ok
+}
+
+// SetSessionAttribute sets the session attribute with the key, which is written through to Options.SessionStore.
+// It returns ErrUnauthorized if the Client is not authorized.
+func (c *Client) SetSessionAttribute(ctx context.Context, key, value string) error {
+	if c.stageClaim(func(rc *refreshClaims) { rc.attributes = append(rc.attributes, [2]string{key, value}) }) {
+		return nil
+	}
+	return c.updateSession(
+		ctx, func(s *Session) {
+			if s.Attributes == nil {
+				s.Attributes = make(map[string]string)
+			}
+			s.Attributes[key] = value
+		},
+	)
+}
@@ -0,0 +1,37 @@
+package connector
+
+import "context"
+
+// SessionAuthenticator verifies the web session of the UpgradeRequest of a WebSocket Client during the upgrade,
+// such as a session cookie of a browser game, and returns the uid of the authorized user, with which the Client
+// is authorized as soon as connected and sends no auth message. Return a non-nil error to reject the upgrade
+// with 401 Unauthorized, or an empty uid to leave the Client to the auth message verified by the Authenticator,
+// such as a request without the cookie. The Tenant of the Client is not checked, as it's resolved by the handshake.
+type SessionAuthenticator func(ctx context.Context, r *UpgradeRequest) (uid string, err error)
+
+// authenticateSession verifies r by Options.SessionAuthenticator, and records the uid to be authorized
+// in r once the Client is connected. It returns the error rejecting the upgrade.
+func (o *Options) authenticateSession(ctx context.Context, r *UpgradeRequest) error {
+	if o.SessionAuthenticator == nil {
+		return nil
+	}
+	uid, err := o.SessionAuthenticator(ctx, r)
+	if err != nil {
+		return err
+	}
+	r.sessionUID = uid
+	return nil
+}
+
+// authorizeSession authorizes the Client as the user of its web session verified by Options.SessionAuthenticator.
+func (c *Client) authorizeSession() {
+	r := c.UpgradeRequest()
+	if r == nil || r.sessionUID == "" {
+		return
+	}
+	if err := c.authorize(c.parentCtx, r.sessionUID); err != nil {
+		return
+	}
+	c.Logger().Debug("Client authorized by the web session")
+	c.deliverOffline(r.sessionUID)
+}
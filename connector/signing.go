@@ -0,0 +1,90 @@
+package connector
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+)
+
+// signingNonceSize is the minimum size of the nonces exchanged by the handshake to derive the signing key.
+const signingNonceSize = 16
+
+var (
+	ErrInvalidSignature     = errors.New("ppcserver: message signature is missing or invalid")
+	ErrSigningNonceRequired = errors.New("ppcserver: handshake nonce of at least 16 bytes is required for signing")
+)
+
+// DeriveSigningKey derives the per-session key of the message signing from the secret shared with the peer, or
+// the session secret of the key exchange, and the nonces of the HandshakeRequest and the Handshake,
+// as HMAC-SHA256(secret, label || clientNonce || serverNonce).
+func DeriveSigningKey(secret, clientNonce, serverNonce []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("ppcserver message signing"))
+	mac.Write(clientNonce)
+	mac.Write(serverNonce)
+	return mac.Sum(nil)
+}
+
+// SignMessage sets the Sig of the Message signed by the key from DeriveSigningKey, over its ID, Seq, Route and Data.
+func SignMessage(key []byte, m *Message) {
+	m.Sig = messageMAC(key, m)
+}
+
+// messageMAC returns HMAC-SHA256(key, ID || Seq || Route || 0x00 || Data), ID and Seq in 8-byte big-endian.
+func messageMAC(key []byte, m *Message) []byte {
+	mac := hmac.New(sha256.New, key)
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], m.ID)
+	binary.BigEndian.PutUint64(b[8:], m.Seq)
+	mac.Write(b[:])
+	mac.Write([]byte(m.Route))
+	mac.Write([]byte{0})
+	mac.Write(m.Data)
+	return mac.Sum(nil)
+}
+
+// signing reports whether the messages sent by the peer must be signed.
+func (c *Client) signing() bool {
+	return c.opts.SigningSecret != nil || c.opts.KeyExchange
+}
+
+// startSigning derives the keys of the Client from its HandshakeRequest, by the key exchange if
+// Options.KeyExchange is set, it returns the server nonce and public key for the Handshake replied.
+func (c *Client) startSigning(req HandshakeRequest) (nonce, pub []byte, err error) {
+	if len(req.Nonce) < signingNonceSize {
+		return nil, nil, ErrSigningNonceRequired
+	}
+	keys := &sessionKeys{}
+	secret := c.opts.SigningSecret
+	if c.opts.KeyExchange {
+		if keys.secret, pub, err = c.exchangeKeys(req.PublicKey); err != nil {
+			return nil, nil, err
+		}
+		secret = keys.secret
+	}
+
+	nonce = make([]byte, signingNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	keys.signing = DeriveSigningKey(secret, req.Nonce, nonce)
+	c.keys.Store(keys)
+	return nonce, pub, nil
+}
+
+// verifySignature reports whether the Message is signed by the signing key of the Client, which is always true
+// if neither Options.SigningSecret nor Options.KeyExchange is set. The handshake and the heartbeat messages carry
+// no application data and are accepted unsigned, the others are rejected until the handshake derives the signing key.
+func (c *Client) verifySignature(m *Message) bool {
+	if !c.signing() {
+		return true
+	}
+	switch m.Route {
+	case RouteHandshake, RoutePing, RoutePong:
+		return true
+	}
+	keys, _ := c.keys.Load().(*sessionKeys)
+	return keys != nil && hmac.Equal(m.Sig, messageMAC(keys.signing, m))
+}
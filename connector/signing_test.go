@@ -0,0 +1,77 @@
+package connector_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/transporttest"
+	"sync/atomic"
+	"testing"
+)
+
+// handshake sends the HandshakeRequest and returns the Handshake replied.
+func handshake(t *testing.T, peer *transporttest.Peer, req connector.HandshakeRequest) connector.Handshake {
+	t.Helper()
+	data, _ := json.Marshal(req)
+	resp := call(t, peer, &connector.Message{ID: 1, Route: connector.RouteHandshake, Data: data})
+	var hs connector.Handshake
+	if err := json.Unmarshal(resp.Data, &hs); err != nil || resp.Error != "" {
+		t.Fatalf("handshake response = %+v, %v", resp, err)
+	}
+	return hs
+}
+
+func newNonce(t *testing.T) []byte {
+	t.Helper()
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatal(err)
+	}
+	return nonce
+}
+
+func TestMessageSigning(t *testing.T) {
+	var routed int32
+	secret := []byte("shared secret")
+	opts := connector.NewOptions(connector.WithRouter(countingRouter(&routed)), connector.WithMessageSigning(secret))
+	peer, done := transporttest.Serve(context.Background(), opts)
+	defer peer.Close()
+
+	nonce := newNonce(t)
+	hs := handshake(t, peer, connector.HandshakeRequest{Nonce: nonce})
+	key := connector.DeriveSigningKey(secret, nonce, hs.Nonce)
+
+	signed := &connector.Message{ID: 2, Route: "secret", Data: json.RawMessage(`"a"`)}
+	connector.SignMessage(key, signed)
+	if resp := call(t, peer, signed); resp.Error != "" {
+		t.Fatalf("signed message error = %q", resp.Error)
+	}
+
+	tampered := &connector.Message{ID: 3, Route: "secret", Data: json.RawMessage(`"a"`)}
+	connector.SignMessage(key, tampered)
+	tampered.Data = json.RawMessage(`"b"`)
+	if err := peer.SendMessage(tampered); err != nil {
+		t.Fatal(err)
+	}
+	if d := waitClosed(t, done); d.Cause != connector.DisconnectCauseProtocolError {
+		t.Fatalf("cause = %v, want DisconnectCauseProtocolError", d.Cause)
+	}
+	if n := atomic.LoadInt32(&routed); n != 1 {
+		t.Fatalf("routed %d messages, want only the signed one", n)
+	}
+}
+
+func TestMessageSigningRequiresNonce(t *testing.T) {
+	opts := connector.NewOptions(connector.WithMessageSigning([]byte("shared secret")))
+	peer, done := transporttest.Serve(context.Background(), opts)
+	defer peer.Close()
+
+	data, _ := json.Marshal(connector.HandshakeRequest{Nonce: []byte("short")})
+	if err := peer.SendMessage(&connector.Message{Route: connector.RouteHandshake, Data: data}); err != nil {
+		t.Fatal(err)
+	}
+	if d := waitClosed(t, done); d.Cause != connector.DisconnectCauseProtocolError {
+		t.Fatalf("cause = %v, want DisconnectCauseProtocolError", d.Cause)
+	}
+}
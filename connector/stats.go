@@ -0,0 +1,158 @@
+package connector
+
+import "sync/atomic"
+
+// counters holds the cumulative counters of all the clients in the current process, accessed atomically.
+var counters Counters
+
+type (
+	// Counters is the cumulative counters of all the clients in the current process.
+	// The counters only increase, so callers calculate the rates by sampling periodically.
+	Counters struct {
+		// MessagesReceived is the number of messages read from all the transports.
+		MessagesReceived uint64
+		// MessagesSent is the number of messages written to all the transports.
+		MessagesSent uint64
+		// BytesReceived is the number of bytes read from all the transports.
+		BytesReceived uint64
+		// BytesSent is the number of bytes written to all the transports.
+		BytesSent uint64
+		// DecodeErrors is the number of received messages failed to decode.
+		DecodeErrors uint64
+		// HandlerErrors is the number of handler executions returning an error.
+		HandlerErrors uint64
+		// SlowHandlers is the number of handler executions exceeding Options.SlowHandlerThreshold.
+		SlowHandlers uint64
+		// EnqueuedMessages is the number of messages queued to the write buffers of all the clients.
+		EnqueuedMessages uint64
+		// DroppedMessages is the number of messages dropped since the write buffer of the Client is full.
+		DroppedMessages uint64
+		// RateLimitedMessages is the number of received messages exceeding their RouteRateLimit.
+		RateLimitedMessages uint64
+		// CapacityRejected is the number of connections rejected since MaxClients is reached.
+		CapacityRejected uint64
+		// AdmissionRejected is the number of connections rejected since the AdmissionController is overloaded.
+		AdmissionRejected uint64
+		// WriteTimeouts is the number of writes failed with ErrWriteTimeout, each closing its Client.
+		WriteTimeouts uint64
+		// EgressDropped is the number of stale pushes dropped since their Client is behind its EgressLimit.
+		EgressDropped uint64
+		// DuplicatesSuppressed is the number of pushes dropped since their idempotency key is already delivered.
+		DuplicatesSuppressed uint64
+	}
+
+	// Stats is a snapshot of the connection statistics of all the clients in the current process.
+	Stats struct {
+		Counters
+
+		// NumClients is the number of started clients, including the ones not yet registered or being closed.
+		NumClients int
+		// MaxClients is the maximum number of clients allowed, see SetMaxClients.
+		MaxClients int
+		// NumWaiting is the number of clients in the waiting room, see SetWaitingRoom.
+		NumWaiting int
+		// NumClientsByState is the number of registered clients per ClientState.
+		NumClientsByState map[ClientState]int
+		// NumClientsByProtocol is the number of registered clients per TransportProtocolType.
+		NumClientsByProtocol map[TransportProtocolType]int
+
+		// WriteQueueDepth is the total number of messages waiting in the write buffers of all the clients.
+		WriteQueueDepth int
+		// MaxWriteQueueDepth is the largest number of messages waiting in the write buffer of a single Client.
+		MaxWriteQueueDepth int
+		// WriteQueueCapacity is the total capacity of the write buffers of all the clients,
+		// divide WriteQueueDepth by it for the aggregate occupancy.
+		WriteQueueCapacity int
+		// SaturatedClients is the number of clients whose write buffer is at least 80% full,
+		// which are about to be disconnected as too slow.
+		SaturatedClients int
+	}
+)
+
+// ReadCounters returns the current values of the cumulative counters.
+// Unlike CollectStats, it does not iterate the clients, so it is cheap enough to call frequently.
+func ReadCounters() Counters {
+	return Counters{
+		MessagesReceived: atomic.LoadUint64(&counters.MessagesReceived),
+		MessagesSent:     atomic.LoadUint64(&counters.MessagesSent),
+		BytesReceived:    atomic.LoadUint64(&counters.BytesReceived),
+		BytesSent:        atomic.LoadUint64(&counters.BytesSent),
+		DecodeErrors:     atomic.LoadUint64(&counters.DecodeErrors),
+		HandlerErrors:    atomic.LoadUint64(&counters.HandlerErrors),
+		SlowHandlers:     atomic.LoadUint64(&counters.SlowHandlers),
+		EnqueuedMessages: atomic.LoadUint64(&counters.EnqueuedMessages),
+		DroppedMessages:  atomic.LoadUint64(&counters.DroppedMessages),
+
+		RateLimitedMessages: atomic.LoadUint64(&counters.RateLimitedMessages),
+		CapacityRejected:    atomic.LoadUint64(&counters.CapacityRejected),
+		AdmissionRejected:   atomic.LoadUint64(&counters.AdmissionRejected),
+		WriteTimeouts:       atomic.LoadUint64(&counters.WriteTimeouts),
+		EgressDropped:       atomic.LoadUint64(&counters.EgressDropped),
+
+		DuplicatesSuppressed: atomic.LoadUint64(&counters.DuplicatesSuppressed),
+	}
+}
+
+// CollectStats returns a snapshot of the connection statistics of all the clients in the current process.
+func CollectStats() Stats {
+	s := Stats{
+		Counters:             ReadCounters(),
+		NumClients:           NumClients(),
+		MaxClients:           MaxClients(),
+		NumWaiting:           NumWaiting(),
+		NumClientsByState:    make(map[ClientState]int),
+		NumClientsByProtocol: make(map[TransportProtocolType]int),
+	}
+	registry.forEach(
+		func(c *Client) bool {
+			s.NumClientsByState[c.State()]++
+			s.NumClientsByProtocol[c.transport.ProtocolType()]++
+
+			qs := c.QueueStats()
+			s.WriteQueueDepth += qs.WriteQueueLen
+			s.WriteQueueCapacity += qs.WriteQueueCap
+			if qs.WriteQueueLen > s.MaxWriteQueueDepth {
+				s.MaxWriteQueueDepth = qs.WriteQueueLen
+			}
+			if qs.saturated() {
+				s.SaturatedClients++
+			}
+			return true
+		},
+	)
+	return s
+}
+
+func countReceived(n int) {
+	atomic.AddUint64(&counters.MessagesReceived, 1)
+	atomic.AddUint64(&counters.BytesReceived, uint64(n))
+}
+
+func countSent(n int) {
+	atomic.AddUint64(&counters.MessagesSent, 1)
+	atomic.AddUint64(&counters.BytesSent, uint64(n))
+}
+
+func countDecodeError() {
+	atomic.AddUint64(&counters.DecodeErrors, 1)
+}
+
+func countHandlerError() {
+	atomic.AddUint64(&counters.HandlerErrors, 1)
+}
+
+func countSlowHandler() {
+	atomic.AddUint64(&counters.SlowHandlers, 1)
+}
+
+func countEnqueuedMessage() {
+	atomic.AddUint64(&counters.EnqueuedMessages, 1)
+}
+
+func countDroppedMessage() {
+	atomic.AddUint64(&counters.DroppedMessages, 1)
+}
+
+func countRateLimited() {
+	atomic.AddUint64(&counters.RateLimitedMessages, 1)
+}
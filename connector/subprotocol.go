@@ -0,0 +1,64 @@
+package connector
+
+import (
+	"github.com/gorilla/websocket"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"net/http"
+)
+
+// Subprotocol maps a WebSocket subprotocol to the Protocol and the FrameType serving the clients requesting it,
+// see WithSubprotocol.
+type Subprotocol struct {
+	// Name is the subprotocol in the Sec-WebSocket-Protocol header, such as "ppc.v2.json".
+	Name string
+	// Version is the Protocol.Version registered via WithProtocol, empty for the default Protocol.
+	Version string
+	// FrameType is the type of the frames written, empty for the default of the transport encoding.
+	FrameType FrameType
+}
+
+// negotiateSubprotocol returns the response header accepting the first of Options.Subprotocols requested by r,
+// nil if none is requested or Options.Subprotocols is empty. A Subprotocol of an unregistered version is skipped.
+func (o *Options) negotiateSubprotocol(r *http.Request) http.Header {
+	requested := websocket.Subprotocols(r)
+	for _, sp := range o.Subprotocols {
+		if _, ok := o.Protocols[sp.Version]; sp.Version != "" && !ok {
+			continue
+		}
+		for _, name := range requested {
+			if name == sp.Name {
+				return http.Header{"Sec-Websocket-Protocol": {name}}
+			}
+		}
+	}
+	return nil
+}
+
+// selectSubprotocol selects the Protocol and the FrameType of the WebSocket subprotocol negotiated on upgrade,
+// which the HandshakeRequest of the peer may still override.
+func (c *Client) selectSubprotocol() {
+	t, ok := c.transport.(*websocketTransport)
+	if !ok || t.conn.Subprotocol() == "" {
+		return
+	}
+	for _, sp := range c.opts.Subprotocols {
+		if sp.Name != t.conn.Subprotocol() {
+			continue
+		}
+		if err := c.selectProtocol(sp.Version); err != nil {
+			c.Logger().Warn("Client subprotocol version unsupported", logging.F("subprotocol", sp.Name))
+		}
+		if sp.FrameType != "" {
+			t.SetFrameType(sp.FrameType)
+		}
+		return
+	}
+}
+
+// Subprotocol returns the WebSocket subprotocol negotiated on upgrade, empty if none or not a WebSocket Client.
+func (c *Client) Subprotocol() string {
+	if t, ok := c.transport.(*websocketTransport); ok {
+		return t.conn.Subprotocol()
+	}
+	return ""
+}
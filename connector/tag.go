@@ -0,0 +1,94 @@
+package connector
+
+import "sort"
+
+// AddTag adds the tag to the Client, such as a feature-flag cohort "beta", a platform "ios", or an A/B group,
+// so that the Client is reached by PushToTag. Unlike a Room, a tag has no members list or lifecycle of its own,
+// it lives as long as the Client. Adding a tag to a closed Client does nothing.
+func (c *Client) AddTag(tag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state == ClientStateClosed {
+		return
+	}
+	if _, ok := c.tags[tag]; ok {
+		return
+	}
+	if c.tags == nil {
+		c.tags = make(map[string]struct{})
+	}
+	c.tags[tag] = struct{}{}
+	registry.indexTag(c, tag)
+}
+
+// RemoveTag removes the tag from the Client.
+func (c *Client) RemoveTag(tag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.tags[tag]; !ok {
+		return
+	}
+	delete(c.tags, tag)
+	registry.unindexTag(c, tag)
+}
+
+// HasTag reports whether the Client has the tag.
+func (c *Client) HasTag(tag string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.tags[tag]
+	return ok
+}
+
+// Tags returns the tags of the Client sorted, nil if none.
+func (c *Client) Tags() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.tags) == 0 {
+		return nil
+	}
+	tags := make([]string, 0, len(c.tags))
+	for tag := range c.tags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// ClientsByTag returns the clients of DefaultTenant with the tag, see Tenant.ClientsByTag for the others.
+func ClientsByTag(tag string) []*Client {
+	return DefaultTenant.ClientsByTag(tag)
+}
+
+// ClientsByTag returns the clients of the Tenant with the tag.
+func (t Tenant) ClientsByTag(tag string) []*Client {
+	clients := registry.getByTag(tag)
+	n := 0
+	for _, c := range clients {
+		if c.Tenant() == t {
+			clients[n] = c
+			n++
+		}
+	}
+	return clients[:n]
+}
+
+// PushToTag pushes a one-way Message with the route and the encoded v to the authorized clients of DefaultTenant
+// with the tag in the current process, see Tenant.PushToTag for the others.
+func PushToTag(tag, route string, v interface{}) error {
+	return DefaultTenant.PushToTag(tag, route, v)
+}
+
+// PushToTag pushes a one-way Message with the route and the encoded v to the authorized clients of the Tenant
+// with the tag in the current process.
+func (t Tenant) PushToTag(tag, route string, v interface{}) error {
+	clients := t.ClientsByTag(tag)
+	n := 0
+	for _, c := range clients {
+		if c.State() == ClientStateAuthorized {
+			clients[n] = c
+			n++
+		}
+	}
+	return broadcastClients(clients[:n], route, v)
+}
@@ -0,0 +1,132 @@
+package connector
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+type (
+	// TapRecord is a message read from or written to a Client tailed by Client.Tap, whose Data is truncated to
+	// Options.LogPayloadLimit or redacted for Options.LogRedactRoutes as logged.
+	TapRecord struct {
+		Direction MessageDirection `json:"direction"`
+		Time      time.Time        `json:"time"`
+		ClientID  uint64           `json:"client_id"`
+		UID       string           `json:"uid,omitempty"`
+		ID        uint64           `json:"id,omitempty"`
+		Route     string           `json:"route"`
+		Data      string           `json:"data,omitempty"`
+	}
+
+	// clientTap is a subscriber of Client.Tap.
+	clientTap struct {
+		mu     sync.Mutex // mu guards ch and closed, so that no record is sent once closed.
+		ch     chan TapRecord
+		closed bool
+	}
+)
+
+// Tap tails the messages read from and written to the Client in real time, such as for debugging the issue of
+// a player in production. The records are sent to the returned channel buffered by the buffer size, which is
+// closed once cancel is called or the Client is released. A record is dropped if the channel is full,
+// so that a slow reader never blocks the Client.
+func (c *Client) Tap(buffer int) (records <-chan TapRecord, cancel func()) {
+	t := &clientTap{ch: make(chan TapRecord, buffer)}
+	c.mu.Lock()
+	if c.state == ClientStateClosed {
+		c.mu.Unlock()
+		t.close()
+		return t.ch, func() {}
+	}
+	taps, _ := c.taps.Load().([]*clientTap)
+	c.taps.Store(append(append([]*clientTap(nil), taps...), t))
+	c.mu.Unlock()
+
+	return t.ch, func() {
+		c.mu.Lock()
+		taps, _ := c.taps.Load().([]*clientTap)
+		remaining := make([]*clientTap, 0, len(taps))
+		for _, other := range taps {
+			if other != t {
+				remaining = append(remaining, other)
+			}
+		}
+		c.taps.Store(remaining)
+		c.mu.Unlock()
+		t.close()
+	}
+}
+
+// tapped reports whether the Client is tailed by Tap.
+func (c *Client) tapped() bool {
+	taps, _ := c.taps.Load().([]*clientTap)
+	return len(taps) > 0
+}
+
+// tapMessage sends the TapRecord of the Message to the taps of the Client.
+func (c *Client) tapMessage(dir MessageDirection, m *Message, at time.Time) {
+	taps, _ := c.taps.Load().([]*clientTap)
+	if len(taps) == 0 {
+		return
+	}
+	r := TapRecord{
+		Direction: dir,
+		Time:      at,
+		ClientID:  c.id,
+		UID:       c.UID(),
+		ID:        m.ID,
+		Route:     m.Route,
+		Data:      c.logPayload(m.Route, m.Data),
+	}
+	for _, t := range taps {
+		t.send(r)
+	}
+}
+
+// tapOutbound decodes the segments written to the transport as a Message for the taps of the Client,
+// which is only called if tapped since the message is already encoded.
+func (c *Client) tapOutbound(bufs net.Buffers, at time.Time) {
+	var data []byte
+	for _, b := range bufs {
+		data = append(data, b...)
+	}
+	m := getMessage()
+	defer putMessage(m)
+	if err := c.codec().Unmarshal(data, m); err != nil {
+		m.Data = data
+	}
+	c.tapMessage(MessageDirectionOutbound, m, at)
+}
+
+// closeTaps closes the channels of all the taps of the released Client.
+func (c *Client) closeTaps() {
+	c.mu.Lock()
+	taps, _ := c.taps.Load().([]*clientTap)
+	c.taps.Store([]*clientTap(nil))
+	c.mu.Unlock()
+	for _, t := range taps {
+		t.close()
+	}
+}
+
+func (t *clientTap) send(r TapRecord) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	select {
+	case t.ch <- r:
+	default:
+	}
+}
+
+func (t *clientTap) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.closed {
+		t.closed = true
+		close(t.ch)
+	}
+}
@@ -0,0 +1,153 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// TCPConnector accepts TCP client connections, each message is framed with a 4-byte big-endian length prefix.
+// By default, each Client is driven by its own read and write goroutines;
+// set WithEventLoop to drive the clients by a few event loop pollers instead.
+type TCPConnector struct {
+	opts      *Options
+	clientsWg sync.WaitGroup
+	listening int32 // listening is 1 while the listener is bound, accessed atomically.
+	shutdown  int32 // shutdown is 1 once Shutdown is invoked, accessed atomically.
+
+	mu       sync.Mutex // mu guards listener and loop.
+	listener net.Listener
+	loop     *eventLoop
+}
+
+// NewTCPConnector creates a new TCPConnector.
+func NewTCPConnector(opts ...Option) *TCPConnector {
+	c := &TCPConnector{
+		opts: defaultOptions(),
+	}
+
+	// Apply opts to customize TCPConnector.
+	for _, opt := range opts {
+		opt(c.opts)
+	}
+
+	return c
+}
+
+// Start listens on Options.Addr and accepts TCP connections until Shutdown is invoked.
+// The clients are closed when ctx is done.
+func (c *TCPConnector) Start(ctx context.Context) error {
+	ln, err := net.Listen("tcp", c.opts.Addr)
+	if err != nil {
+		return err
+	}
+
+	flushers := c.opts.WriteFlushers
+	if flushers <= 0 && c.opts.EventLoopPollers > 0 {
+		// The pollers never write, so that a slow peer can't block the other connections of its poller.
+		flushers = eventLoopFlushersPerPoller * c.opts.EventLoopPollers
+	}
+	if flushers > 0 {
+		c.opts.flushers = startFlusherPool(flushers)
+	}
+	var loop *eventLoop
+	if c.opts.EventLoopPollers > 0 {
+		if loop, err = newEventLoop(ctx, c.opts.EventLoopPollers, c.opts); err != nil {
+			if c.opts.flushers != nil {
+				c.opts.flushers.stop()
+			}
+			_ = ln.Close()
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	c.listener, c.loop = ln, loop
+	c.mu.Unlock()
+	atomic.StoreInt32(&c.listening, 1)
+	defer atomic.StoreInt32(&c.listening, 0)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if atomic.LoadInt32(&c.shutdown) == 1 {
+				return nil
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+		if Draining() {
+			_ = conn.Close()
+			continue
+		}
+
+		if loop != nil {
+			if err := loop.register(ctx, conn); err != nil {
+				c.opts.Logger.Info("eventLoop.register() error", logging.Err(err))
+				_ = conn.Close()
+			}
+			continue
+		}
+
+		c.clientsWg.Add(1)
+		go func() {
+			defer c.clientsWg.Done()
+			defer conn.Close() // Ensure the connection is closed when the Client exits.
+
+			// Note: ctx passes in for closing the connection gracefully when the server is shutting down.
+			if err := StartClient(ctx, newTCPTransport(conn, EncodingTypeJSON, c.opts), c.opts); err != nil {
+				c.opts.Logger.Info("StartClient() error", logging.Err(err))
+			}
+		}()
+	}
+}
+
+// Ready returns a non-nil error before the listener is bound, once Shutdown is invoked, or while draining.
+func (c *TCPConnector) Ready() error {
+	if atomic.LoadInt32(&c.shutdown) == 1 {
+		return ErrConnectorShutdown
+	}
+	if atomic.LoadInt32(&c.listening) == 0 {
+		return ErrConnectorNotListening
+	}
+	if Draining() {
+		return ErrDraining
+	}
+	return nil
+}
+
+// Shutdown stops accepting new connections and waits for all the clients to be closed or ctx is done.
+func (c *TCPConnector) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&c.shutdown, 1)
+
+	c.mu.Lock()
+	ln, loop := c.listener, c.loop
+	c.mu.Unlock()
+	if ln != nil {
+		_ = ln.Close()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.clientsWg.Wait()
+		if loop != nil {
+			loop.wait()
+		}
+		if c.opts.flushers != nil {
+			c.opts.flushers.stop()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
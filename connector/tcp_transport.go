@@ -0,0 +1,124 @@
+package connector
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	TransportProtocolTypeTCP TransportProtocolType = "tcp"
+
+	// tcpFrameHeaderSize is the size of the big-endian uint32 length prefix of each message over TCP.
+	tcpFrameHeaderSize = 4
+)
+
+var ErrMessageTooLarge = errors.New("ppcserver: message exceeds the maximum size")
+
+// tcpTransport frames each message with a 4-byte big-endian length prefix over a TCP connection.
+type tcpTransport struct {
+	conn     net.Conn
+	br       *bufio.Reader
+	encoding EncodingType
+	opts     *Options
+}
+
+func newTCPTransport(conn net.Conn, encoding EncodingType, opts *Options) *tcpTransport {
+	return &tcpTransport{
+		conn:     conn,
+		br:       bufio.NewReader(conn),
+		encoding: encoding,
+		opts:     opts,
+	}
+}
+
+// ProtocolType returns the protocol type of the transport.
+func (t *tcpTransport) ProtocolType() TransportProtocolType {
+	return TransportProtocolTypeTCP
+}
+
+// NetConn returns the internal net.Conn of the connection.
+func (t *tcpTransport) NetConn() net.Conn {
+	return t.conn
+}
+
+// Encoding returns the EncodingType of the data transported.
+func (t *tcpTransport) Encoding() EncodingType {
+	return t.encoding
+}
+
+// Read reads a single length-prefixed message into a pooled buffer, which is released by the Client
+// after the message is handled.
+func (t *tcpTransport) Read() ([]byte, error) {
+	var header [tcpFrameHeaderSize]byte
+	if _, err := io.ReadFull(t.br, header[:]); err != nil {
+		return nil, err
+	}
+	size := int(binary.BigEndian.Uint32(header[:]))
+	if t.opts.MaxMessageSize > 0 && int64(size) > t.opts.MaxMessageSize {
+		return nil, ErrMessageTooLarge
+	}
+
+	b := getReadBuffer()
+	if cap(b) < size {
+		b = make([]byte, 0, size)
+	}
+	b = b[:size]
+	if _, err := io.ReadFull(t.br, b); err != nil {
+		putReadBuffer(b)
+		return nil, err
+	}
+	return b, nil
+}
+
+// Write writes the length prefix and data to the connection.
+func (t *tcpTransport) Write(data []byte) error {
+	return t.WriteBuffers(net.Buffers{data})
+}
+
+// WriteBuffers writes the length prefix and the segments as a single message,
+// using writev on the TCP connection without joining the segments.
+func (t *tcpTransport) WriteBuffers(bufs net.Buffers) error {
+	size := 0
+	for _, b := range bufs {
+		size += len(b)
+	}
+	header := make([]byte, tcpFrameHeaderSize)
+	binary.BigEndian.PutUint32(header, uint32(size))
+
+	// WriteTo consumes the net.Buffers, so write a copy to leave the shared segments untouched.
+	frame := make(net.Buffers, 0, len(bufs)+1)
+	frame = append(append(frame, header), bufs...)
+
+	// SetWriteDeadline should be set per message written.
+	if t.opts.WriteTimeout > 0 {
+		_ = t.conn.SetWriteDeadline(time.Now().Add(t.opts.WriteTimeout))
+	}
+	_, err := frame.WriteTo(t.conn)
+	return err
+}
+
+// Close closes the underlying network connection.
+func (t *tcpTransport) Close() error {
+	return t.conn.Close()
+}
+
+// splitTCPFrame splits the first complete length-prefixed message from b,
+// ok is false if b does not contain a complete message yet.
+func splitTCPFrame(b []byte, maxSize int64) (message, rest []byte, ok bool, err error) {
+	if len(b) < tcpFrameHeaderSize {
+		return nil, b, false, nil
+	}
+	size := int(binary.BigEndian.Uint32(b))
+	if maxSize > 0 && int64(size) > maxSize {
+		return nil, b, false, ErrMessageTooLarge
+	}
+	if len(b) < tcpFrameHeaderSize+size {
+		return nil, b, false, nil
+	}
+	end := tcpFrameHeaderSize + size
+	return b[tcpFrameHeaderSize:end], b[end:], true, nil
+}
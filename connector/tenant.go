@@ -0,0 +1,246 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultTenant is the Tenant of the clients when Options.TenantResolver is not set,
+// whose namespace is served by the package-level functions, such as ClientsByUID and CreateRoom.
+const DefaultTenant Tenant = ""
+
+var (
+	ErrAppKeyRequired = errors.New("ppcserver: app key is required")
+	ErrUnknownAppKey  = errors.New("ppcserver: unknown app key")
+	ErrTenantMismatch = errors.New("ppcserver: client belongs to another tenant")
+)
+
+// tenants holds the state of each Tenant resolved in the current process, keyed by Tenant.
+var tenants sync.Map
+
+type (
+	// Tenant is an isolated namespace of the clients presenting the app keys of a game or an environment,
+	// so that one connector deployment serves several of them. The uids, the rooms and the broadcasts of a Tenant
+	// never reach the clients of the other tenants.
+	Tenant string
+
+	// TenantResolver returns the Tenant of the app key presented by the peer in the HandshakeRequest,
+	// such as StaticTenants or AppKeyResolver.
+	// Return a non-nil error to reject the handshake, and the Client will be closed.
+	TenantResolver func(ctx context.Context, appKey string) (Tenant, error)
+
+	// tenantState is the state of a Tenant shared by its clients.
+	tenantState struct {
+		name             Tenant
+		messagesReceived uint64 // messagesReceived is accessed atomically.
+		messagesSent     uint64 // messagesSent is accessed atomically.
+		rateLimited      uint64 // rateLimited is accessed atomically.
+
+		mu      sync.Mutex // mu guards limits, bucket, and clients.
+		limits  TenantLimits
+		bucket  *tokenBucket // bucket is the state of TenantLimits.MessageRate, nil until a Message is limited.
+		clients int          // clients is the number of the clients counted for TenantLimits.MaxClients.
+	}
+
+	// TenantStats is a snapshot of the metrics of a Tenant.
+	TenantStats struct {
+		Tenant Tenant
+		// Clients is the number of registered clients of the Tenant.
+		Clients int
+		// Rooms is the number of rooms of the Tenant.
+		Rooms int
+		// MessagesReceived is the cumulative number of messages read from the clients of the Tenant.
+		MessagesReceived uint64
+		// MessagesSent is the cumulative number of messages written to the clients of the Tenant.
+		MessagesSent uint64
+		// RateLimitedMessages is the cumulative number of messages exceeding TenantLimits.MessageRate.
+		RateLimitedMessages uint64
+	}
+)
+
+// StaticTenants returns a TenantResolver of the fixed app keys, it rejects the other app keys with ErrUnknownAppKey.
+func StaticTenants(appKeys map[string]Tenant) TenantResolver {
+	return func(_ context.Context, appKey string) (Tenant, error) {
+		t, ok := appKeys[appKey]
+		if !ok {
+			return DefaultTenant, ErrUnknownAppKey
+		}
+		return t, nil
+	}
+}
+
+// tenantKey qualifies the name of a uid or a Room by the Tenant, the names of DefaultTenant are kept as is.
+func tenantKey(t Tenant, name string) string {
+	if t == DefaultTenant {
+		return name
+	}
+	return string(t) + "\x00" + name
+}
+
+func loadTenantState(t Tenant) *tenantState {
+	if s, ok := tenants.Load(t); ok {
+		return s.(*tenantState)
+	}
+	s, _ := tenants.LoadOrStore(t, &tenantState{name: t})
+	return s.(*tenantState)
+}
+
+// resolveTenant sets the Tenant of the Client by the app key presented in the HandshakeRequest,
+// it does nothing if Options.TenantResolver is not set. It returns ErrTenantQuotaExceeded if the Tenant
+// has TenantLimits.MaxClients already. Without Options.Authenticator, the Client is authorized once resolved.
+func (c *Client) resolveTenant(ctx context.Context, appKey string) error {
+	if c.opts.TenantResolver == nil {
+		return nil
+	}
+	t, err := c.opts.TenantResolver(ctx, appKey)
+	if err != nil {
+		return err
+	}
+	s := loadTenantState(t)
+	if !s.acquire() {
+		return ErrTenantQuotaExceeded
+	}
+	c.tenant.Store(s)
+	c.mu.Lock()
+	c.logger = c.logger.With(logging.F("tenant", string(t)))
+	if c.opts.Authenticator == nil && c.state == ClientStateConnected {
+		c.state = ClientStateAuthorized
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+// checkTenant returns ErrAppKeyRequired if Options.TenantResolver is set and the peer is authorizing
+// before presenting the app key by the handshake, so it never falls into DefaultTenant.
+func (c *Client) checkTenant() error {
+	if c.opts.TenantResolver != nil && atomic.LoadInt32(&c.handshaken) == 0 {
+		return ErrAppKeyRequired
+	}
+	return nil
+}
+
+// Tenant returns the Tenant of the Client, DefaultTenant until resolved by the handshake.
+func (c *Client) Tenant() Tenant {
+	if s, ok := c.tenant.Load().(*tenantState); ok {
+		return s.name
+	}
+	return DefaultTenant
+}
+
+// countTenantReceived counts a Message read from the Client in its Tenant.
+func (c *Client) countTenantReceived() {
+	if s, ok := c.tenant.Load().(*tenantState); ok {
+		atomic.AddUint64(&s.messagesReceived, 1)
+	}
+}
+
+// countTenantSent counts a Message written to the Client in its Tenant.
+func (c *Client) countTenantSent() {
+	if s, ok := c.tenant.Load().(*tenantState); ok {
+		atomic.AddUint64(&s.messagesSent, 1)
+	}
+}
+
+// Clients returns a snapshot of the clients of the Tenant.
+func (t Tenant) Clients() []*Client {
+	var clients []*Client
+	registry.forEach(
+		func(c *Client) bool {
+			if c.Tenant() == t {
+				clients = append(clients, c)
+			}
+			return true
+		},
+	)
+	return clients
+}
+
+// ClientsByUID returns the clients of the Tenant authorized as the uid.
+func (t Tenant) ClientsByUID(uid string) []*Client {
+	return registry.getByUID(tenantKey(t, uid))
+}
+
+// Broadcast pushes a one-way Message with the route and the encoded v to all the authorized clients of the Tenant
+// in the current process.
+func (t Tenant) Broadcast(route string, v interface{}) error {
+	var clients []*Client
+	registry.forEach(
+		func(c *Client) bool {
+			if c.State() == ClientStateAuthorized && c.Tenant() == t {
+				clients = append(clients, c)
+			}
+			return true
+		},
+	)
+	return broadcastClients(clients, route, v)
+}
+
+// PushToUser is like the package-level PushToUser, but to the uid of the Tenant.
+func (t Tenant) PushToUser(uid, route string, v interface{}) error {
+	return pushToUser(t, uid, "", route, v)
+}
+
+// CreateRoom creates a Room of the Tenant with the name unique in the Tenant,
+// returns ErrRoomExists if the name is in use, or ErrTenantRoomsExceeded beyond TenantLimits.MaxRooms.
+func (t Tenant) CreateRoom(name string, opts ...RoomOption) (*Room, error) {
+	return createRoom(t, name, opts...)
+}
+
+// GetRoom returns the Room of the Tenant with the name, or false if no such Room exists.
+func (t Tenant) GetRoom(name string) (*Room, bool) {
+	rooms.mu.RLock()
+	defer rooms.mu.RUnlock()
+	r, ok := rooms.rooms[tenantKey(t, name)]
+	return r, ok
+}
+
+// Rooms returns a snapshot of the rooms of the Tenant.
+func (t Tenant) Rooms() []*Room {
+	rooms.mu.RLock()
+	defer rooms.mu.RUnlock()
+	var rs []*Room
+	for _, r := range rooms.rooms {
+		if r.tenant == t {
+			rs = append(rs, r)
+		}
+	}
+	return rs
+}
+
+// Stats returns a snapshot of the metrics of the Tenant.
+func (t Tenant) Stats() TenantStats {
+	st := TenantStats{
+		Tenant:  t,
+		Clients: len(t.Clients()),
+		Rooms:   len(t.Rooms()),
+	}
+	if s, ok := tenants.Load(t); ok {
+		st.MessagesReceived = atomic.LoadUint64(&s.(*tenantState).messagesReceived)
+		st.MessagesSent = atomic.LoadUint64(&s.(*tenantState).messagesSent)
+		st.RateLimitedMessages = atomic.LoadUint64(&s.(*tenantState).rateLimited)
+	}
+	return st
+}
+
+// CollectTenantStats returns the metrics of all the tenants resolved in the current process, ordered by Tenant.
+// Since the clients and the rooms are counted by iterating the registries, it is not meant to be called frequently.
+func CollectTenantStats() []TenantStats {
+	var names []Tenant
+	tenants.Range(
+		func(k, _ interface{}) bool {
+			names = append(names, k.(Tenant))
+			return true
+		},
+	)
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+
+	stats := make([]TenantStats, 0, len(names))
+	for _, t := range names {
+		stats = append(stats, t.Stats())
+	}
+	return stats
+}
@@ -0,0 +1,119 @@
+package connector
+
+import (
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"math"
+	"sync/atomic"
+)
+
+var (
+	ErrTenantQuotaExceeded = errors.New("ppcserver: too many connections of the tenant")
+	ErrTenantRoomsExceeded = errors.New("ppcserver: too many rooms of the tenant")
+)
+
+// TenantLimits caps the resources of a Tenant, so that a busy or misbehaving game on a shared deployment
+// only affects its own clients. A zero field means unlimited.
+type TenantLimits struct {
+	// MaxClients is the maximum number of simultaneous clients of the Tenant, the excess is closed
+	// with CloseCodeTenantQuotaExceeded by the handshake.
+	MaxClients int
+	// MessageRate is the number of messages allowed per second from all the clients of the Tenant together,
+	// the excess is rejected like RateLimitPolicyReject.
+	MessageRate float64
+	// MessageBurst is the number of messages allowed at once, default is the MessageRate rounded up if not positive.
+	MessageBurst int
+	// MaxRooms is the maximum number of rooms of the Tenant, Tenant.CreateRoom returns ErrTenantRoomsExceeded beyond.
+	MaxRooms int
+}
+
+// SetTenantLimits sets the TenantLimits of the Tenant, which applies to the clients already connected as well.
+func SetTenantLimits(t Tenant, l TenantLimits) {
+	if l.MessageRate > 0 && l.MessageBurst <= 0 {
+		l.MessageBurst = int(math.Ceil(l.MessageRate))
+	}
+
+	s := loadTenantState(t)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limits = l
+	// Restart the bucket from the new burst, instead of keeping the tokens of the previous limits.
+	s.bucket = nil
+}
+
+// Limits returns the TenantLimits of the Tenant, set by SetTenantLimits.
+func (t Tenant) Limits() TenantLimits {
+	s, ok := tenants.Load(t)
+	if !ok {
+		return TenantLimits{}
+	}
+	s.(*tenantState).mu.Lock()
+	defer s.(*tenantState).mu.Unlock()
+	return s.(*tenantState).limits
+}
+
+// acquire counts a Client of the Tenant, it returns false without counting if there are MaxClients already.
+func (s *tenantState) acquire() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.limits.MaxClients > 0 && s.clients >= s.limits.MaxClients {
+		return false
+	}
+	s.clients++
+	return true
+}
+
+func (s *tenantState) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients--
+}
+
+// allowMessage takes a token from the bucket of TenantLimits.MessageRate, it returns true if the Message is allowed.
+func (s *tenantState) allowMessage() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.limits.MessageRate <= 0 {
+		return true
+	}
+
+	at := now()
+	if s.bucket == nil {
+		s.bucket = &tokenBucket{tokens: float64(s.limits.MessageBurst), at: at}
+	}
+	b := s.bucket
+	b.tokens += at.Sub(b.at).Seconds() * s.limits.MessageRate
+	if burst := float64(s.limits.MessageBurst); b.tokens > burst {
+		b.tokens = burst
+	}
+	b.at = at
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// limitTenantRate applies TenantLimits.MessageRate of the Tenant of the Client to the Message,
+// it returns false if the Message is not to be dispatched.
+func (c *Client) limitTenantRate(m *Message) bool {
+	s, ok := c.tenant.Load().(*tenantState)
+	if !ok || s.allowMessage() {
+		return true
+	}
+
+	countRateLimited()
+	atomic.AddUint64(&s.rateLimited, 1)
+	c.Logger().Debug("Client message rate limited by the tenant", logging.F("route", m.Route))
+	if m.ID != 0 {
+		_ = c.respond(m, nil, ErrRateLimited)
+	}
+	return false
+}
+
+// releaseTenant uncounts the closed Client from its Tenant.
+func (c *Client) releaseTenant() {
+	if s, ok := c.tenant.Load().(*tenantState); ok {
+		s.release()
+	}
+}
@@ -0,0 +1,38 @@
+package connector_test
+
+import (
+	"context"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/transporttest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTenantResolvedBeforeRoutingWithoutAuth(t *testing.T) {
+	var routed int32
+	opts := connector.NewOptions(
+		connector.WithRouter(countingRouter(&routed)),
+		connector.WithTenantResolver(connector.StaticTenants(map[string]connector.Tenant{"key": "game"})),
+	)
+	peer, _ := transporttest.Serve(context.Background(), opts)
+	defer peer.Close()
+
+	if resp := call(t, peer, &connector.Message{ID: 2, Route: "secret"}); resp.Code != connector.ErrorCodeAuthFailed {
+		t.Fatalf("code before handshake = %d, want %d", resp.Code, connector.ErrorCodeAuthFailed)
+	}
+	if atomic.LoadInt32(&routed) != 0 {
+		t.Fatal("routed before the Tenant is resolved")
+	}
+
+	handshake(t, peer, connector.HandshakeRequest{AppKey: "key"})
+	if resp := call(t, peer, &connector.Message{ID: 3, Route: "secret"}); resp.Error != "" {
+		t.Fatalf("error after handshake = %q", resp.Error)
+	}
+	if n := atomic.LoadInt32(&routed); n != 1 {
+		t.Fatalf("routed %d messages after handshake, want 1", n)
+	}
+	clients := connector.Tenant("game").Clients()
+	if len(clients) != 1 || clients[0].State() != connector.ClientStateAuthorized {
+		t.Fatalf("clients of the Tenant = %v, want 1 authorized", clients)
+	}
+}
@@ -0,0 +1,60 @@
+package connector
+
+import (
+	"github.com/pom-pom-crafts/ppcserver/clock"
+	"github.com/pom-pom-crafts/ppcserver/timingwheel"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// timerWheelTick is the precision of the per-client heartbeats and timeouts.
+	timerWheelTick = 100 * time.Millisecond
+	// timerWheelSlots makes a revolution of the timing wheel 1 minute.
+	timerWheelSlots = 600
+)
+
+var (
+	timerWheelOnce sync.Once
+	timerWheel     *timingwheel.TimingWheel
+
+	// clk holds the clockHolder set by SetClock, the timing wheel and time.Now are used if not set.
+	clk atomic.Value
+)
+
+// clockHolder wraps the clock.Clock, since atomic.Value requires the values stored of the same concrete type.
+type clockHolder struct {
+	c clock.Clock
+}
+
+// SetClock sets the clock.Clock of the heartbeats, the timers, the scheduled pushes, and the timestamps of
+// the sessions, such as a clock.Fake to test the idle timeout and the resume window deterministically.
+// It should be called before any Client is connected, nil restores the real clock.
+func SetClock(c clock.Clock) {
+	clk.Store(clockHolder{c: c})
+}
+
+// currentClock returns the clock.Clock set by SetClock, nil for the real clock.
+func currentClock() clock.Clock {
+	h, _ := clk.Load().(clockHolder)
+	return h.c
+}
+
+// now returns the current time of the clock.Clock set by SetClock.
+func now() time.Time {
+	if c := currentClock(); c != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+// afterFunc schedules f on the timing wheel shared by all the clients, instead of a runtime timer per Client.
+// f is called in the timing wheel goroutine and should not block.
+func afterFunc(d time.Duration, f func()) clock.Timer {
+	if c := currentClock(); c != nil {
+		return c.AfterFunc(d, f)
+	}
+	timerWheelOnce.Do(func() { timerWheel = timingwheel.New(timerWheelTick, timerWheelSlots) })
+	return timerWheel.AfterFunc(d, f)
+}
@@ -0,0 +1,59 @@
+package connector
+
+import "encoding/json"
+
+// RouteTimeSync is the route of the built-in clock synchronization exchange, which is handled before the Router,
+// even if the Client is not authorized yet. The peer sends its timestamp and the server replies a TimeSync.
+// With t0 the peer's send time and t3 its receive time, the peer estimates the server clock offset as
+// ((ServerReceiveTimestamp - t0) + (ServerSendTimestamp - t3)) / 2, the same as NTP.
+const RouteTimeSync = "time_sync"
+
+type (
+	// TimeSyncRequest is the data of the RouteTimeSync Message sent by the peer.
+	TimeSyncRequest struct {
+		// ClientTimestamp is the send time by the peer's clock in any unit, which is echoed as is.
+		ClientTimestamp json.RawMessage `json:"client_ts,omitempty"`
+	}
+
+	// TimeSync is the data of the RouteTimeSync Message replied by the server,
+	// the timestamps are the Unix time in microseconds as Ping.Timestamp.
+	TimeSync struct {
+		// ClientTimestamp is echoed from TimeSyncRequest.ClientTimestamp.
+		ClientTimestamp json.RawMessage `json:"client_ts,omitempty"`
+		// ServerReceiveTimestamp is when the server receives the RouteTimeSync Message.
+		ServerReceiveTimestamp int64 `json:"server_recv_ts"`
+		// ServerSendTimestamp is when the server replies the RouteTimeSync Message.
+		ServerSendTimestamp int64 `json:"server_send_ts"`
+	}
+)
+
+// handleTimeSync replies the RouteTimeSync Message with a TimeSync, it returns false for the other messages.
+// The reply is a response if the Message has an ID, otherwise a one-way Message.
+func (c *Client) handleTimeSync(m *Message) bool {
+	if m.Route != RouteTimeSync {
+		return false
+	}
+	recvAt := now().UnixMicro()
+
+	var req TimeSyncRequest
+	if len(m.Data) > 0 {
+		if err := c.codec().Unmarshal(m.Data, &req); err != nil {
+			if m.ID != 0 {
+				_ = c.respond(m, nil, err)
+			}
+			return true
+		}
+	}
+	ts := TimeSync{
+		// Copy the echoed timestamp, since m.Data is released after the Message is handled.
+		ClientTimestamp:        append(json.RawMessage(nil), req.ClientTimestamp...),
+		ServerReceiveTimestamp: recvAt,
+		ServerSendTimestamp:    now().UnixMicro(),
+	}
+	if m.ID != 0 {
+		_ = c.respond(m, ts, nil)
+	} else {
+		_ = c.Push(RouteTimeSync, ts)
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package connector
+
+import (
+	"crypto/tls"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertReloader serves the TLS certificate loaded from a pair of files, and reloads it once the files are modified,
+// so that a renewed certificate is picked up by the new connections without restarting the server.
+// The connected clients are kept, as the certificate is only presented on the TLS handshake.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+	logger   logging.Logger
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// NewCertReloader loads the certificate from certFile and keyFile, which are checked for modifications
+// at most once per interval on the TLS handshakes, every handshake if interval is not positive.
+func NewCertReloader(certFile, keyFile string, interval time.Duration, logger logging.Logger) (*CertReloader, error) {
+	r := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: interval,
+		logger:   logger,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the certificate from the files immediately, such as on receiving SIGHUP.
+// The previous certificate is kept on error.
+func (r *CertReloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.load(r.latestModTime())
+}
+
+// GetCertificate returns the current certificate, reloading it first if the files are modified,
+// for setting tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if t := now(); t.Sub(r.checkedAt) >= r.interval {
+		r.checkedAt = t
+		if modTime := r.latestModTime(); modTime.After(r.modTime) {
+			if err := r.load(modTime); err != nil && r.logger != nil {
+				// Keep serving the previous certificate, as the files may be in the middle of being replaced.
+				r.logger.Info("CertReloader reload failed", logging.Err(err))
+			}
+		}
+	}
+	return r.cert, nil
+}
+
+// load must be called while holding mu.
+func (r *CertReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+// latestModTime returns the latest modification time of the files, zero if neither can be stat.
+func (r *CertReloader) latestModTime() time.Time {
+	var t time.Time
+	for _, name := range [...]string{r.certFile, r.keyFile} {
+		if fi, err := os.Stat(name); err == nil && fi.ModTime().After(t) {
+			t = fi.ModTime()
+		}
+	}
+	return t
+}
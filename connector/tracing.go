@@ -0,0 +1,52 @@
+package connector
+
+import "context"
+
+type (
+	// Tracer creates spans covering the message handling of a Client,
+	// which are decode → middleware → handler → response.
+	// Implement it with an adapter over OpenTelemetry or any other tracing library, for example:
+	//
+	//	func (t otelTracer) Start(ctx context.Context, spanName string) (context.Context, connector.Span) {
+	//		ctx, span := t.tracer.Start(ctx, spanName)
+	//		return ctx, otelSpan{span}
+	//	}
+	//
+	// The ctx returned from Start is passed to the HandlerFunc, so the trace context propagates to the
+	// backend RPC calls made by the handler through the usual instrumentation of the RPC client.
+	Tracer interface {
+		// Start creates a span as a child of the span carried by ctx (if any),
+		// and returns a copy of ctx that carries the new span.
+		Start(ctx context.Context, spanName string) (context.Context, Span)
+	}
+
+	// Span is a single operation within a trace.
+	Span interface {
+		// SetAttribute sets a key-value attribute on the span.
+		SetAttribute(key string, value interface{})
+		// RecordError records err as a failure of the span.
+		RecordError(err error)
+		// End completes the span.
+		End()
+	}
+
+	// noopTracer is the default Tracer which creates spans that do nothing.
+	noopTracer struct{}
+	noopSpan   struct{}
+)
+
+const (
+	SpanNameHandleMessage = "ppcserver.HandleMessage"
+	SpanNameDecode        = "ppcserver.Decode"
+	SpanNameMiddleware    = "ppcserver.Middleware"
+	SpanNameHandler       = "ppcserver.Handler"
+	SpanNameResponse      = "ppcserver.Response"
+)
+
+func (noopTracer) Start(ctx context.Context, _ string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (noopSpan) SetAttribute(string, interface{}) {}
+func (noopSpan) RecordError(error)                {}
+func (noopSpan) End()                             {}
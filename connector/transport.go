@@ -13,11 +13,28 @@ type (
 		ProtocolType() TransportProtocolType
 		// NetConn should return the internal net.Conn of the connection.
 		NetConn() net.Conn
-		//
+		// Encoding should return the EncodingType of the data transported.
+		Encoding() EncodingType
+		// Read should read single data from a connection.
+		// The Client takes the ownership of the returned data and may reuse it after the data is handled,
+		// so the Transport must not retain it.
 		Read() ([]byte, error)
 		// Write should write single data into a connection.
 		Write([]byte) error
 		// Close should close the underlying network connection.
 		Close() error
 	}
+
+	// CodeCloser is optionally implemented by a Transport to tell the peer the CloseCode on closing, such as by
+	// the close frame of a WebSocket connection, instead of an abnormal closure.
+	CodeCloser interface {
+		CloseWithCode(code CloseCode, reason string) error
+	}
+
+	// BuffersWriter is optionally implemented by a Transport to write a single message from multiple segments
+	// without copying them into a contiguous buffer first, such as writev on a TCP connection.
+	// The segments may be shared with other clients, so the BuffersWriter must not modify them.
+	BuffersWriter interface {
+		WriteBuffers(bufs net.Buffers) error
+	}
 )
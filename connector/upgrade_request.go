@@ -0,0 +1,90 @@
+package connector
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/url"
+)
+
+// The well-known metadata keys attached from the UpgradeRequest of a WebSocket Client.
+const (
+	MetadataUserAgent = "user_agent"
+	MetadataOrigin    = "origin"
+)
+
+type (
+	// UpgradeRequest is a snapshot of the HTTP request upgraded to the WebSocket connection of a Client,
+	// such as for the Authenticator to verify a web session cookie, or the Enricher to attach a query parameter.
+	UpgradeRequest struct {
+		Header     http.Header
+		Query      url.Values
+		Cookies    []*http.Cookie
+		Host       string
+		Path       string
+		RemoteAddr string
+		// TLS is the state of the TLS connection, nil if the request is not over TLS.
+		TLS *tls.ConnectionState
+		// sessionUID is the uid verified by Options.SessionAuthenticator, authorized once the Client is connected.
+		sessionUID string
+	}
+
+	upgradeRequestKey struct{}
+)
+
+// newUpgradeRequest takes a snapshot of r, which should not be retained once upgraded.
+func newUpgradeRequest(r *http.Request) *UpgradeRequest {
+	return &UpgradeRequest{
+		Header:     r.Header.Clone(),
+		Query:      r.URL.Query(),
+		Cookies:    r.Cookies(),
+		Host:       r.Host,
+		Path:       r.URL.Path,
+		RemoteAddr: r.RemoteAddr,
+		TLS:        r.TLS,
+	}
+}
+
+// Cookie returns the cookie with the name, or http.ErrNoCookie if not found.
+func (r *UpgradeRequest) Cookie(name string) (*http.Cookie, error) {
+	for _, c := range r.Cookies {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return nil, http.ErrNoCookie
+}
+
+// ContextWithUpgradeRequest returns a copy of ctx carrying the UpgradeRequest, such as the ctx passed to StartClient
+// by a custom WebSocket handler.
+func ContextWithUpgradeRequest(ctx context.Context, r *UpgradeRequest) context.Context {
+	return context.WithValue(ctx, upgradeRequestKey{}, r)
+}
+
+// UpgradeRequestFromContext returns the UpgradeRequest carried by ctx, such as the ctx passed to the Authenticator
+// and the Enricher of a WebSocket Client, nil if none.
+func UpgradeRequestFromContext(ctx context.Context) *UpgradeRequest {
+	r, _ := ctx.Value(upgradeRequestKey{}).(*UpgradeRequest)
+	return r
+}
+
+// UpgradeRequest returns the UpgradeRequest of the WebSocket Client, nil if the Client is not upgraded from HTTP.
+func (c *Client) UpgradeRequest() *UpgradeRequest {
+	return UpgradeRequestFromContext(c.parentCtx)
+}
+
+// upgradeMetadata returns the metadata of the UpgradeRequest, attached before the metadata of Options.Enricher.
+func (c *Client) upgradeMetadata() map[string]string {
+	r := c.UpgradeRequest()
+	if r == nil {
+		return nil
+	}
+	md := make(map[string]string, 2)
+	if ua := r.Header.Get("User-Agent"); ua != "" {
+		md[MetadataUserAgent] = ua
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		md[MetadataOrigin] = origin
+	}
+	return md
+}
@@ -0,0 +1,199 @@
+package connector
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RouteQueue is the route of the one-way Message pushed to a Client in the waiting room with its QueueStatus,
+// on entering, as its position changes, and once admitted.
+const RouteQueue = "queue"
+
+var ErrWaiting = errors.New("ppcserver: client is waiting for a slot")
+
+// waiting is the waiting room of the clients exceeding MaxClients, see SetWaitingRoom.
+var waiting = &waitingRoom{updateInterval: 5 * time.Second}
+
+type (
+	// QueueStatus is the data of the RouteQueue Message.
+	QueueStatus struct {
+		// Position is the 1-based position of the Client in the waiting room, zero once admitted.
+		Position int `json:"position,omitempty"`
+		// Size is the number of the clients in the waiting room.
+		Size int `json:"size,omitempty"`
+		// Admitted is true once the Client takes a slot, from which on its messages are handled.
+		Admitted bool `json:"admitted,omitempty"`
+	}
+
+	// waitingRoom queues the clients exceeding MaxClients in the order they connect,
+	// and admits them as the slots free up.
+	waitingRoom struct {
+		mu             sync.Mutex // mu guards all the fields, and Client.waitPosition of the queued clients.
+		max            int
+		updateInterval time.Duration
+		queue          []*Client
+		updating       bool // updating is true while the goroutine pushing the positions runs.
+	}
+)
+
+// SetWaitingRoom enables the waiting room, in which the new clients exceeding MaxClients wait for a slot instead
+// of being rejected, such as during a login rush. Each waiting Client is pushed its QueueStatus on entering
+// and every updateInterval as its position changes, and is admitted in the order connected as the slots free up.
+// The messages of a waiting Client are rejected with ErrWaiting, except for the heartbeats and the time sync.
+// The clients exceeding max waiting are rejected. Zero max disables the waiting room, which is the default.
+func SetWaitingRoom(max int, updateInterval time.Duration) {
+	waiting.mu.Lock()
+	waiting.max = max
+	if updateInterval > 0 {
+		waiting.updateInterval = updateInterval
+	}
+	waiting.mu.Unlock()
+}
+
+// NumWaiting returns the number of the clients in the waiting room.
+func NumWaiting() int {
+	waiting.mu.Lock()
+	defer waiting.mu.Unlock()
+	return len(waiting.queue)
+}
+
+// reserve reports whether a new Client should enter the waiting room instead of taking a slot, which is the case
+// once MaxClients is reached, or while any Client is waiting so that none jumps the queue.
+// Otherwise the slot is taken by acquireClient. It returns an error if the Client is rejected.
+func (w *waitingRoom) reserve() (queued bool, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.max <= 0 {
+		if !acquireClient() {
+			return false, ErrExceedMaxClients
+		}
+		return false, nil
+	}
+	if len(w.queue) == 0 && acquireClient() {
+		return false, nil
+	}
+	if len(w.queue) >= w.max {
+		return false, ErrExceedMaxClients
+	}
+	return true, nil
+}
+
+// enter queues the Client reserved by reserve, which may be admitted at once if a slot is freed meanwhile.
+func (w *waitingRoom) enter(c *Client) {
+	w.mu.Lock()
+	atomic.StoreInt32(&c.waiting, 1)
+	w.queue = append(w.queue, c)
+	c.waitPosition = len(w.queue)
+	admitted := w.admitLocked()
+	if !w.updating {
+		w.updating = true
+		go w.update()
+	}
+	position, size := c.waitPosition, len(w.queue)
+	w.mu.Unlock()
+
+	if atomic.LoadInt32(&c.waiting) == 1 {
+		_ = c.Push(RouteQueue, QueueStatus{Position: position, Size: size})
+	}
+	notifyAdmitted(admitted)
+}
+
+// leave removes the closed Client from the waiting room, it reports false if the Client is not waiting,
+// which holds a slot to be released instead.
+func (w *waitingRoom) leave(c *Client) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if atomic.LoadInt32(&c.waiting) == 0 {
+		return false
+	}
+	for i, q := range w.queue {
+		if q == c {
+			w.queue = append(w.queue[:i], w.queue[i+1:]...)
+			break
+		}
+	}
+	atomic.StoreInt32(&c.waiting, 0)
+	return true
+}
+
+// admit admits the waiting clients to the free slots.
+func (w *waitingRoom) admit() {
+	w.mu.Lock()
+	admitted := w.admitLocked()
+	w.mu.Unlock()
+	notifyAdmitted(admitted)
+}
+
+func (w *waitingRoom) admitLocked() []*Client {
+	var admitted []*Client
+	for len(w.queue) > 0 && acquireClient() {
+		c := w.queue[0]
+		w.queue[0] = nil
+		w.queue = w.queue[1:]
+		atomic.StoreInt32(&c.waiting, 0)
+		admitted = append(admitted, c)
+	}
+	return admitted
+}
+
+func notifyAdmitted(clients []*Client) {
+	for _, c := range clients {
+		c.Logger().Info("Client admitted from the waiting room")
+		if c.opts.Authenticator == nil && c.opts.TenantResolver == nil {
+			c.mu.Lock()
+			if c.state == ClientStateConnected {
+				c.state = ClientStateAuthorized
+			}
+			c.mu.Unlock()
+		}
+		_ = c.Push(RouteQueue, QueueStatus{Admitted: true})
+	}
+}
+
+// update pushes the QueueStatus to the waiting clients whose positions change every updateInterval,
+// until the waiting room is empty.
+func (w *waitingRoom) update() {
+	for {
+		w.mu.Lock()
+		interval := w.updateInterval
+		w.mu.Unlock()
+		time.Sleep(interval)
+
+		type change struct {
+			c      *Client
+			status QueueStatus
+		}
+		var changes []change
+		w.mu.Lock()
+		if len(w.queue) == 0 {
+			w.updating = false
+			w.mu.Unlock()
+			return
+		}
+		for i, c := range w.queue {
+			if c.waitPosition != i+1 {
+				c.waitPosition = i + 1
+				changes = append(changes, change{c: c, status: QueueStatus{Position: i + 1, Size: len(w.queue)}})
+			}
+		}
+		w.mu.Unlock()
+
+		// Push without holding mu, as a slow Client being closed leaves the waiting room.
+		for _, ch := range changes {
+			_ = ch.c.Push(RouteQueue, ch.status)
+		}
+	}
+}
+
+// rejectWaiting responds ErrWaiting to the Message of a waiting Client, and reports whether it's rejected.
+func (c *Client) rejectWaiting(m *Message) bool {
+	if atomic.LoadInt32(&c.waiting) == 0 {
+		return false
+	}
+	if m.ID != 0 {
+		_ = c.respond(m, nil, ErrWaiting)
+	}
+	return true
+}
@@ -2,10 +2,18 @@ package connector
 
 import (
 	"context"
-	"log"
+	"crypto/tls"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/logging"
 	"net"
 	"net/http"
 	"sync"
+	"sync/atomic"
+)
+
+var (
+	ErrConnectorNotListening = errors.New("ppcserver: connector is not listening")
+	ErrConnectorShutdown     = errors.New("ppcserver: connector is shutting down")
 )
 
 // WebsocketConnector accepts WebSocket client connections,
@@ -13,6 +21,8 @@ import (
 type WebsocketConnector struct {
 	opts      *Options
 	clientsWg sync.WaitGroup
+	listening int32 // listening is 1 while the listener is bound, accessed atomically.
+	shutdown  int32 // shutdown is 1 once Shutdown is invoked, accessed atomically.
 }
 
 // NewWebsocketConnector creates a new WebsocketConnector.
@@ -25,6 +35,12 @@ func NewWebsocketConnector(opts ...Option) *WebsocketConnector {
 	for _, opt := range opts {
 		opt(c.opts)
 	}
+	if c.opts.Compression {
+		// Copy the Upgrader, which may be shared with the other connectors.
+		u := *c.opts.Upgrader
+		u.EnableCompression = true
+		c.opts.Upgrader = &u
+	}
 
 	return c
 }
@@ -40,64 +56,43 @@ func (c *WebsocketConnector) Start(ctx context.Context) error {
 		return ctx
 	}
 
-	// HandleFunc registers the handler for processing WebSocket connection requests at opts.WebsocketPath.
-	c.opts.ServeMux.HandleFunc(
-		c.opts.WebsocketPath, func(w http.ResponseWriter, r *http.Request) {
-			// Note: upgrader.Upgrade will reply to the client with an HTTP error when it returns an error.
-			conn, err := c.opts.Upgrader.Upgrade(w, r, nil)
-			if err != nil {
-				log.Println("ppcserver: WebsocketConnector.upgrader.Upgrade() error:", err)
-				return
-			}
-			defer conn.Close() // Ensure the connection is closed when the current function exits.
-
-			c.clientsWg.Add(1)
-			defer c.clientsWg.Done()
-
-			// go func() {
-			// 	time.Sleep(time.Second * 3)
-			//
-			// 	if err := conn.WriteControl(
-			// 		websocket.CloseMessage, websocket.FormatCloseMessage(3000, "hello"),
-			// 		time.Now().Add(3*time.Second),
-			// 	); err != nil {
-			// 		log.Println("ppcserver: WriteControl() error:", err)
-			// 	}
-			// }()
-
-			// SetReadLimit will close the connection when a client sends bytes larger than MaxMessageSize
-			// and returns ErrReadLimit from Client.transport.Read().
-			if c.opts.MaxMessageSize > 0 {
-				conn.SetReadLimit(c.opts.MaxMessageSize)
-			}
+	// Handle registers the handler for processing WebSocket connection requests at opts.WebsocketPath.
+	c.opts.ServeMux.Handle(c.opts.WebsocketPath, c.Handler())
 
-			// TODO, wait pong
-			// conn.SetReadDeadline(time.Now().Add(0))
-			// c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
-
-			if err := StartClient(
-				// Note: ctx passes in for closing the connection gracefully when the server is shutting down.
-				ctx, newWebsocketTransport(
-					conn,
-					EncodingTypeJSON, // TODO, encodingType depends
-					c.opts,
-				),
-			); err != nil {
-				log.Println("ppcserver: StartClient() error:", err)
-			}
-		},
-	)
-
-	// ListenAndServe will block until the server is closed for various reasons,
-	// such as when WebsocketConnector.Shutdown() is invoked,
-	// or when PORT is already in-used.
-	var err error
-	if c.opts.TLSCertFile != "" || c.opts.TLSKeyFile != "" {
-		err = c.opts.Server.ListenAndServeTLS(c.opts.TLSCertFile, c.opts.TLSKeyFile)
+	// Listen separately from Serve so that Ready reports whether the listener is bound,
+	// it fails when PORT is already in-used.
+	useTLS := c.opts.TLSCertFile != "" || c.opts.TLSKeyFile != "" || c.opts.GetCertificate != nil
+	if useTLS {
+		if err := c.setupTLS(); err != nil {
+			return err
+		}
+	}
+	addr := c.opts.Server.Addr
+	if addr == "" {
+		addr = ":http"
+		if useTLS {
+			addr = ":https"
+		}
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	if c.opts.WriteFlushers > 0 {
+		c.opts.flushers = startFlusherPool(c.opts.WriteFlushers)
+	}
+	atomic.StoreInt32(&c.listening, 1)
+	defer atomic.StoreInt32(&c.listening, 0)
+
+	// Serve will block until the server is closed for various reasons,
+	// such as when WebsocketConnector.Shutdown() is invoked.
+	if useTLS {
+		// The certificate is served by TLSConfig.GetCertificate set up by setupTLS.
+		err = c.opts.Server.ServeTLS(ln, "", "")
 	} else {
-		err = c.opts.Server.ListenAndServe()
+		err = c.opts.Server.Serve(ln)
 	}
-	// ErrServerClosed returns on calling http.Server.Shutdown() and does not mean ListenAndServe() fails,
+	// ErrServerClosed returns on calling http.Server.Shutdown() and does not mean Serve() fails,
 	// so we return a nil error; for the other errors we return as is.
 	if err == http.ErrServerClosed {
 		return nil
@@ -105,12 +100,126 @@ func (c *WebsocketConnector) Start(ctx context.Context) error {
 	return err
 }
 
+// Handler returns the http.Handler upgrading the requests to WebSocket connections and serving them as clients,
+// so that it can be mounted on an existing http.ServeMux or http.Server alongside the other endpoints,
+// instead of the HTTP server started by Start. Each Client is closed once its request context is done,
+// so the server should cancel its BaseContext when shutting down. It responds 503 once Shutdown is invoked
+// or while draining.
+func (c *WebsocketConnector) Handler() http.Handler {
+	return http.HandlerFunc(c.serveWebsocket)
+}
+
+// serveWebsocket upgrades the request to a WebSocket connection and blocks until the Client is closed.
+func (c *WebsocketConnector) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&c.shutdown) == 1 {
+		http.Error(w, ErrConnectorShutdown.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if Draining() {
+		http.Error(w, ErrDraining.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	ur := newUpgradeRequest(r)
+	if err := c.opts.authenticateSession(r.Context(), ur); err != nil {
+		c.opts.Logger.Info("WebsocketConnector session rejected", logging.F("remote_addr", r.RemoteAddr), logging.Err(err))
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	// Note: upgrader.Upgrade will reply to the client with an HTTP error when it returns an error.
+	conn, err := c.opts.Upgrader.Upgrade(w, r, c.opts.negotiateSubprotocol(r))
+	if err != nil {
+		c.opts.Logger.Warn("WebsocketConnector.upgrader.Upgrade() error", logging.Err(err))
+		return
+	}
+	defer conn.Close() // Ensure the connection is closed when the current function exits.
+	if c.opts.Compression {
+		// Only the PreparedMessage created with compress is compressed.
+		conn.EnableWriteCompression(false)
+	}
+
+	c.clientsWg.Add(1)
+	defer c.clientsWg.Done()
+
+	// SetReadLimit will close the connection when a client sends bytes larger than MaxMessageSize
+	// and returns ErrReadLimit from Client.transport.Read().
+	if c.opts.MaxMessageSize > 0 {
+		conn.SetReadLimit(c.opts.MaxMessageSize)
+	}
+
+	// TODO, wait pong
+	// conn.SetReadDeadline(time.Now().Add(0))
+	// c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
+
+	if err := StartClient(
+		// Note: the request ctx passes in for closing the connection gracefully when the server is shutting down,
+		// which derives from the ctx of Start by Server.BaseContext. It carries the UpgradeRequest for the auth.
+		ContextWithUpgradeRequest(r.Context(), ur), newWebsocketTransport(
+			conn,
+			EncodingTypeJSON, // TODO, encodingType depends
+			c.opts,
+		),
+		c.opts,
+	); err != nil {
+		c.opts.Logger.Info("StartClient() error", logging.Err(err))
+	}
+}
+
+// setupTLS sets Server.TLSConfig.GetCertificate to Options.GetCertificate, or to a CertReloader of the
+// certificate files if Options.TLSReloadInterval is not negative, otherwise the files are loaded once.
+func (c *WebsocketConnector) setupTLS() error {
+	getCertificate := c.opts.GetCertificate
+	if getCertificate == nil {
+		if c.opts.TLSReloadInterval < 0 {
+			cert, err := tls.LoadX509KeyPair(c.opts.TLSCertFile, c.opts.TLSKeyFile)
+			if err != nil {
+				return err
+			}
+			getCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return &cert, nil }
+		} else {
+			r, err := NewCertReloader(c.opts.TLSCertFile, c.opts.TLSKeyFile, c.opts.TLSReloadInterval, c.opts.Logger)
+			if err != nil {
+				return err
+			}
+			getCertificate = r.GetCertificate
+		}
+	}
+
+	if c.opts.Server.TLSConfig == nil {
+		c.opts.Server.TLSConfig = &tls.Config{}
+	} else {
+		c.opts.Server.TLSConfig = c.opts.Server.TLSConfig.Clone()
+	}
+	c.opts.Server.TLSConfig.GetCertificate = getCertificate
+	return nil
+}
+
+// Ready returns a non-nil error before the listener is bound, once Shutdown is invoked, or while draining.
+func (c *WebsocketConnector) Ready() error {
+	if atomic.LoadInt32(&c.shutdown) == 1 {
+		return ErrConnectorShutdown
+	}
+	if atomic.LoadInt32(&c.listening) == 0 {
+		return ErrConnectorNotListening
+	}
+	if Draining() {
+		return ErrDraining
+	}
+	return nil
+}
+
+// Shutdown gracefully shuts down the HTTP server and waits for all the clients to be closed.
 func (c *WebsocketConnector) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&c.shutdown, 1)
 	if err := c.opts.Server.Shutdown(ctx); err != nil {
 		return err
 	}
 
 	// Wait for all the clients' Close complete.
 	c.clientsWg.Wait()
+	if c.opts.flushers != nil {
+		c.opts.flushers.stop()
+	}
 	return nil
 }
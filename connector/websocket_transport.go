@@ -2,27 +2,40 @@ package connector
 
 import (
 	"github.com/gorilla/websocket"
+	"io"
 	"net"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 )
 
 const (
 	TransportProtocolTypeWebsocket TransportProtocolType = "websocket"
+
+	// closeFrameTimeout bounds the time writing a close frame, since the connection may be congested.
+	closeFrameTimeout = 1 * time.Second
+	// maxCloseReasonSize is the maximum size of the reason in a close frame, whose payload is at most 125 bytes.
+	maxCloseReasonSize = 123
 )
 
 // websocketTransport is a wrapper struct over websocket connection to fit Transport
 // interface so Client will accept it.
 type websocketTransport struct {
-	conn     *websocket.Conn
-	encoding EncodingType
-	opts     *Options
+	conn      *websocket.Conn
+	encoding  EncodingType
+	opts      *Options
+	frameType int32 // frameType is the websocket message type of the frames written, accessed atomically.
 }
 
 func newWebsocketTransport(conn *websocket.Conn, encoding EncodingType, opts *Options) *websocketTransport {
 	transport := &websocketTransport{
-		conn:     conn,
-		encoding: encoding,
-		opts:     opts,
+		conn:      conn,
+		encoding:  encoding,
+		opts:      opts,
+		frameType: websocket.TextMessage,
+	}
+	if encoding == EncodingTypeProtobuf {
+		transport.frameType = websocket.BinaryMessage
 	}
 
 	return transport
@@ -38,28 +51,93 @@ func (t *websocketTransport) NetConn() net.Conn {
 	return t.conn.UnderlyingConn()
 }
 
+// Encoding returns the EncodingType of the data transported.
+func (t *websocketTransport) Encoding() EncodingType {
+	return t.encoding
+}
+
+// Read reads a single message from websocket.Conn into a pooled buffer, which is released by the Client
+// after the message is handled.
 func (t *websocketTransport) Read() ([]byte, error) {
-	_, message, err := t.conn.ReadMessage()
-	return message, err
+	_, r, err := t.conn.NextReader()
+	if err != nil {
+		return nil, err
+	}
+
+	b := getReadBuffer()
+	for {
+		if len(b) == cap(b) {
+			// Grow the buffer, append handles the growth strategy.
+			b = append(b, 0)[:len(b)]
+		}
+		n, err := r.Read(b[len(b):cap(b)])
+		b = b[:len(b)+n]
+		if err == io.EOF {
+			return b, nil
+		}
+		if err != nil {
+			putReadBuffer(b)
+			return nil, err
+		}
+	}
 }
 
 // Write data to websocket.Conn.
 func (t *websocketTransport) Write(data []byte) error {
-	messageType := websocket.TextMessage
-	if t.encoding == EncodingTypeProtobuf {
-		messageType = websocket.BinaryMessage
-	}
+	t.setWriteDeadline()
 
-	// SetWriteDeadline should be set per WriteMessage call.
-	if t.opts.WriteTimeout > 0 {
-		_ = t.conn.SetWriteDeadline(time.Now().Add(t.opts.WriteTimeout))
+	if err := t.conn.WriteMessage(t.messageType(), data); err != nil {
+		return err
 	}
 
-	if err := t.conn.WriteMessage(messageType, data); err != nil {
+	return nil
+}
+
+// WriteBuffers writes the segments as a single message to websocket.Conn,
+// which frames the segments directly without joining them first.
+func (t *websocketTransport) WriteBuffers(bufs net.Buffers) error {
+	t.setWriteDeadline()
+
+	w, err := t.conn.NextWriter(t.messageType())
+	if err != nil {
 		return err
 	}
+	for _, b := range bufs {
+		if _, err := w.Write(b); err != nil {
+			_ = w.Close()
+			return err
+		}
+	}
+	return w.Close()
+}
 
-	return nil
+// FrameType returns the FrameType of the frames written, which is FrameTypeBinary for EncodingTypeProtobuf
+// and FrameTypeText otherwise, unless chosen by the handshake.
+func (t *websocketTransport) FrameType() FrameType {
+	if t.messageType() == websocket.BinaryMessage {
+		return FrameTypeBinary
+	}
+	return FrameTypeText
+}
+
+// SetFrameType sets the FrameType of the frames written afterwards.
+func (t *websocketTransport) SetFrameType(ft FrameType) {
+	mt := websocket.TextMessage
+	if ft == FrameTypeBinary {
+		mt = websocket.BinaryMessage
+	}
+	atomic.StoreInt32(&t.frameType, int32(mt))
+}
+
+func (t *websocketTransport) messageType() int {
+	return int(atomic.LoadInt32(&t.frameType))
+}
+
+// setWriteDeadline should be called per message written.
+func (t *websocketTransport) setWriteDeadline() {
+	if t.opts.WriteTimeout > 0 {
+		_ = t.conn.SetWriteDeadline(time.Now().Add(t.opts.WriteTimeout))
+	}
 }
 
 // Close closes the underlying network connection.
@@ -67,3 +145,26 @@ func (t *websocketTransport) Write(data []byte) error {
 func (t *websocketTransport) Close() error {
 	return t.conn.Close()
 }
+
+// CloseWithCode writes a close frame with the code and the reason, and then closes the underlying network
+// connection without waiting for the close frame of the peer. It can be called concurrently with the writes.
+func (t *websocketTransport) CloseWithCode(code CloseCode, reason string) error {
+	timeout := t.opts.WriteTimeout
+	if timeout <= 0 || timeout > closeFrameTimeout {
+		timeout = closeFrameTimeout
+	}
+	msg := websocket.FormatCloseMessage(int(code), truncateUTF8(reason, maxCloseReasonSize))
+	_ = t.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(timeout))
+	return t.conn.Close()
+}
+
+// truncateUTF8 truncates s to at most n bytes without splitting a UTF-8 encoded rune.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
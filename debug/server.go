@@ -0,0 +1,354 @@
+// Package debug provides an opt-in HTTP server exposing pprof profiles, goroutine dumps,
+// and connector-specific dumps for diagnosing a running ppcserver.
+//
+// The pprof handlers are served from runtime/pprof directly instead of importing net/http/pprof,
+// since the latter registers itself on http.DefaultServeMux, which the connector serves publicly by default.
+// For the same reason, /debug/vars is served by the debug mux itself in the expvar format instead of importing expvar.
+package debug
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/metrics/prom"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// Option is a function to apply various configurations to customize a debug Server.
+	Option func(o *Options)
+
+	// Options hold the configurable parts of a debug Server.
+	Options struct {
+		// Addr specifies the TCP address for the debug server to listen on, in the form "host:port".
+		// Default is "localhost:6060" if not set via WithAddr, so it is not reachable from other hosts.
+		Addr string
+	}
+
+	// Server is a Component that serves the debug endpoints:
+	//
+	//	/debug/pprof/              index of the available profiles
+	//	/debug/pprof/profile       CPU profile, ?seconds=N (default 30)
+	//	/debug/pprof/trace         execution trace, ?seconds=N (default 1)
+	//	/debug/pprof/cmdline       command line of the process
+	//	/debug/pprof/{name}        named profile such as heap and goroutine, ?debug=N
+	//	                           (goroutine?debug=2 dumps the stacks of all goroutines)
+	//	/debug/vars                JSON of the "ppcserver" counters, the "ppcserver_rooms" and the "memstats",
+	//	                           in the expvar format
+	//	/metrics                   Prometheus metrics with the default prom.Options
+	//	/debug/ppcserver/clients   JSON dump of the connector client registry
+	//	/debug/ppcserver/rooms     JSON dump of the metrics of the hottest rooms
+	Server struct {
+		opts   *Options
+		server *http.Server
+	}
+
+	// ClientsDump is the JSON response of /debug/ppcserver/clients.
+	ClientsDump struct {
+		NumClients  int            `json:"num_clients"`
+		NumRooms    int            `json:"num_rooms"`
+		MaxClients  int            `json:"max_clients"`
+		NumByState  map[string]int `json:"num_by_state"`
+		NumByProto  map[string]int `json:"num_by_protocol"`
+		Clients     []ClientDump   `json:"clients,omitempty"`
+		GeneratedAt time.Time      `json:"generated_at"`
+		Goroutines  int            `json:"goroutines"`
+	}
+
+	// RoomDump describes the metrics of a single Room in the /debug/ppcserver/rooms response.
+	RoomDump struct {
+		Name         string  `json:"name"`
+		Tenant       string  `json:"tenant,omitempty"`
+		Members      int     `json:"members"`
+		Broadcasts   uint64  `json:"broadcasts"`
+		MessagesSent uint64  `json:"messages_sent"`
+		FanoutAvgMs  float64 `json:"fanout_avg_ms"`
+		FanoutMaxMs  float64 `json:"fanout_max_ms"`
+	}
+
+	// ClientDump describes a single Client in ClientsDump.
+	ClientDump struct {
+		ID          uint64    `json:"id"`
+		Tenant      string    `json:"tenant,omitempty"`
+		State       string    `json:"state"`
+		Protocol    string    `json:"protocol"`
+		RemoteAddr  string    `json:"remote_addr,omitempty"`
+		ConnectedAt time.Time `json:"connected_at"`
+
+		RTTMs float64 `json:"rtt_ms"`
+
+		WriteQueueLen int    `json:"write_queue_len"`
+		WriteQueueCap int    `json:"write_queue_cap"`
+		Enqueued      uint64 `json:"enqueued"`
+		Dropped       uint64 `json:"dropped"`
+	}
+)
+
+// counters returns the connector counters served as the "ppcserver" variable of /debug/vars.
+func counters() map[string]interface{} {
+	c := connector.ReadCounters()
+	return map[string]interface{}{
+		"clients":               connector.NumClients(),
+		"rooms":                 connector.NumRooms(),
+		"max_clients":           connector.MaxClients(),
+		"messages_received":     c.MessagesReceived,
+		"messages_sent":         c.MessagesSent,
+		"bytes_received":        c.BytesReceived,
+		"bytes_sent":            c.BytesSent,
+		"decode_errors":         c.DecodeErrors,
+		"handler_errors":        c.HandlerErrors,
+		"slow_handlers":         c.SlowHandlers,
+		"enqueued_messages":     c.EnqueuedMessages,
+		"dropped_messages":      c.DroppedMessages,
+		"rate_limited":          c.RateLimitedMessages,
+		"capacity_rejected":     c.CapacityRejected,
+		"admission_rejected":    c.AdmissionRejected,
+		"write_timeouts":        c.WriteTimeouts,
+		"egress_dropped":        c.EgressDropped,
+		"duplicates_suppressed": c.DuplicatesSuppressed,
+	}
+}
+
+func defaultOptions() *Options {
+	return &Options{
+		Addr: "localhost:6060",
+	}
+}
+
+// NewServer creates a new debug Server.
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		opts: defaultOptions(),
+	}
+
+	// Apply opts to customize Server.
+	for _, opt := range opts {
+		opt(s.opts)
+	}
+
+	s.server = &http.Server{
+		Addr:    s.opts.Addr,
+		Handler: Handler(),
+	}
+	return s
+}
+
+// Handler returns an http.Handler serving all the debug endpoints,
+// for mounting on a custom server instead of starting a debug Server.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprofIndex)
+	mux.HandleFunc("/debug/pprof/profile", pprofCPUProfile)
+	mux.HandleFunc("/debug/pprof/trace", pprofTrace)
+	mux.HandleFunc("/debug/pprof/cmdline", pprofCmdline)
+	mux.HandleFunc("/debug/vars", dumpVars)
+	mux.Handle("/metrics", prom.NewHandler())
+	mux.HandleFunc("/debug/ppcserver/clients", dumpClients)
+	mux.HandleFunc("/debug/ppcserver/rooms", dumpRooms)
+	return mux
+}
+
+// Start starts the debug HTTP server and blocks until the server is closed.
+func (s *Server) Start(_ context.Context) error {
+	if err := s.server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Shutdown gracefully shuts down the debug HTTP server.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// WithAddr is an Option to set the TCP address for the debug server to listen on.
+func WithAddr(a string) Option {
+	return func(o *Options) {
+		o.Addr = a
+	}
+}
+
+// pprofIndex lists the available profiles, or writes the profile named by the path suffix.
+func pprofIndex(w http.ResponseWriter, r *http.Request) {
+	if name := strings.TrimPrefix(r.URL.Path, "/debug/pprof/"); name != "" {
+		pprofProfile(w, r, name)
+		return
+	}
+
+	profiles := pprof.Profiles()
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name() < profiles[j].Name() })
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, p := range profiles {
+		fmt.Fprintf(w, "%d\t/debug/pprof/%s\n", p.Count(), p.Name())
+	}
+	fmt.Fprintln(w, "-\t/debug/pprof/profile")
+	fmt.Fprintln(w, "-\t/debug/pprof/trace")
+	fmt.Fprintln(w, "-\t/debug/vars")
+	fmt.Fprintln(w, "-\t/metrics")
+	fmt.Fprintln(w, "-\t/debug/ppcserver/clients")
+	fmt.Fprintln(w, "-\t/debug/ppcserver/rooms")
+}
+
+func pprofProfile(w http.ResponseWriter, r *http.Request, name string) {
+	p := pprof.Lookup(name)
+	if p == nil {
+		http.Error(w, "unknown profile: "+name, http.StatusNotFound)
+		return
+	}
+	debug, _ := strconv.Atoi(r.FormValue("debug"))
+	if debug != 0 {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+	}
+	if name == "heap" && r.FormValue("gc") != "" {
+		runtime.GC()
+	}
+	_ = p.WriteTo(w, debug)
+}
+
+func pprofCPUProfile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="profile"`)
+	if err := pprof.StartCPUProfile(w); err != nil {
+		w.Header().Del("Content-Disposition")
+		http.Error(w, "could not enable CPU profiling: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sleep(r, parseSeconds(r, 30))
+	pprof.StopCPUProfile()
+}
+
+func pprofTrace(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="trace"`)
+	if err := trace.Start(w); err != nil {
+		w.Header().Del("Content-Disposition")
+		http.Error(w, "could not enable tracing: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sleep(r, parseSeconds(r, 1))
+	trace.Stop()
+}
+
+func pprofCmdline(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, strings.Join(os.Args, "\x00"))
+}
+
+// dumpClients writes the connector client registry as JSON, ?verbose=1 includes every Client.
+func dumpClients(w http.ResponseWriter, r *http.Request) {
+	stats := connector.CollectStats()
+	dump := ClientsDump{
+		NumClients:  stats.NumClients,
+		NumRooms:    connector.NumRooms(),
+		MaxClients:  stats.MaxClients,
+		NumByState:  make(map[string]int),
+		NumByProto:  make(map[string]int),
+		GeneratedAt: time.Now(),
+		Goroutines:  runtime.NumGoroutine(),
+	}
+	for state, n := range stats.NumClientsByState {
+		dump.NumByState[state.String()] = n
+	}
+	for proto, n := range stats.NumClientsByProtocol {
+		dump.NumByProto[string(proto)] = n
+	}
+
+	if r.FormValue("verbose") == "" {
+		writeJSON(w, dump)
+		return
+	}
+	for _, c := range connector.Clients() {
+		qs := c.QueueStats()
+		cd := ClientDump{
+			ID:            c.ID(),
+			Tenant:        string(c.Tenant()),
+			State:         c.State().String(),
+			Protocol:      string(c.Transport().ProtocolType()),
+			ConnectedAt:   c.ConnectedAt(),
+			RTTMs:         float64(c.RTT()) / float64(time.Millisecond),
+			WriteQueueLen: qs.WriteQueueLen,
+			WriteQueueCap: qs.WriteQueueCap,
+			Enqueued:      qs.Enqueued,
+			Dropped:       qs.Dropped,
+		}
+		if conn := c.Transport().NetConn(); conn != nil {
+			cd.RemoteAddr = conn.RemoteAddr().String()
+		}
+		dump.Clients = append(dump.Clients, cd)
+	}
+	sort.Slice(dump.Clients, func(i, j int) bool { return dump.Clients[i].ID < dump.Clients[j].ID })
+	writeJSON(w, dump)
+}
+
+// dumpVars writes the key counters for the deployments without Prometheus as JSON, in the format of expvar,
+// the number of rooms is limited by connector.MaxRoomMetrics to bound the cardinality.
+func dumpVars(w http.ResponseWriter, _ *http.Request) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	writeJSON(w, map[string]interface{}{
+		"cmdline":         os.Args,
+		"memstats":        ms,
+		"ppcserver":       counters(),
+		"ppcserver_rooms": roomDumps(),
+	})
+}
+
+// dumpRooms writes the metrics of the hottest rooms as JSON.
+func dumpRooms(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, roomDumps())
+}
+
+func roomDumps() []RoomDump {
+	stats := connector.CollectRoomStats()
+	dumps := make([]RoomDump, 0, len(stats))
+	for _, s := range stats {
+		d := RoomDump{
+			Name:         s.Name,
+			Tenant:       string(s.Tenant),
+			Members:      s.Members,
+			Broadcasts:   s.Broadcasts,
+			MessagesSent: s.MessagesSent,
+			FanoutMaxMs:  float64(s.FanoutMax) / float64(time.Millisecond),
+		}
+		if s.Broadcasts > 0 {
+			d.FanoutAvgMs = float64(s.FanoutTotal) / float64(s.Broadcasts) / float64(time.Millisecond)
+		}
+		dumps = append(dumps, d)
+	}
+	return dumps
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+func parseSeconds(r *http.Request, def int) int {
+	if sec, err := strconv.Atoi(r.FormValue("seconds")); err == nil && sec > 0 {
+		return sec
+	}
+	return def
+}
+
+// sleep blocks for the seconds or until the request is cancelled, whichever happens first.
+func sleep(r *http.Request, seconds int) {
+	select {
+	case <-time.After(time.Duration(seconds) * time.Second):
+	case <-r.Context().Done():
+	}
+}
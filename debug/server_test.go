@@ -0,0 +1,26 @@
+package debug
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVarsNotOnDefaultServeMux(t *testing.T) {
+	if _, pattern := http.DefaultServeMux.Handler(httptest.NewRequest(http.MethodGet, "/debug/vars", nil)); pattern != "" {
+		t.Fatalf("/debug/vars is registered on http.DefaultServeMux as %q", pattern)
+	}
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+	var vars map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"ppcserver", "ppcserver_rooms", "memstats"} {
+		if _, ok := vars[name]; !ok {
+			t.Errorf("/debug/vars misses %q", name)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Package eventbus provides the in-process event bus of ppcserver, whose typed topics are published by
+// the subsystems, such as connector.TopicClientConnected, and subscribed by the built-in and user components,
+// so that they integrate without direct references to each other.
+package eventbus
+
+import (
+	"fmt"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+type (
+	// Topic is a topic of the events of type T. The events are delivered synchronously to the subscribers
+	// in the goroutine publishing them, in the order of their priorities, so a subscriber must not block,
+	// and should hand the event over to its own goroutine for a slow work. Safe for concurrent use.
+	Topic[T any] struct {
+		name string
+		mu   sync.Mutex   // mu serializes the changes of subs.
+		subs atomic.Value // subs holds []*subscriber[T], replaced as a whole so that Publish takes no lock.
+	}
+
+	subscriber[T any] struct {
+		fn       func(e T)
+		priority int
+	}
+)
+
+// NewTopic creates a Topic with the name, such as "connector.client_connected", which identifies it in the logs.
+func NewTopic[T any](name string) *Topic[T] {
+	return &Topic[T]{name: name}
+}
+
+// Name returns the name of the Topic.
+func (t *Topic[T]) Name() string {
+	return t.name
+}
+
+// Subscribe calls fn with each event published to the Topic, until the returned unsubscribe function is called.
+// It's SubscribeWithPriority with the priority 0.
+func (t *Topic[T]) Subscribe(fn func(e T)) (unsubscribe func()) {
+	return t.SubscribeWithPriority(0, fn)
+}
+
+// SubscribeWithPriority is like Subscribe, but fn is called before the subscribers of a higher priority,
+// such as a negative priority to run before the subscribers of the default, regardless of the order subscribed.
+// The subscribers of the same priority are called in the order subscribed.
+func (t *Topic[T]) SubscribeWithPriority(priority int, fn func(e T)) (unsubscribe func()) {
+	s := &subscriber[T]{fn: fn, priority: priority}
+	t.mu.Lock()
+	subs := t.subscribers()
+	i := sort.Search(len(subs), func(i int) bool { return subs[i].priority > priority })
+	t.subs.Store(append(subs[:i:i], append([]*subscriber[T]{s}, subs[i:]...)...))
+	t.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(
+			func() {
+				t.mu.Lock()
+				defer t.mu.Unlock()
+				subs := t.subscribers()
+				kept := make([]*subscriber[T], 0, len(subs))
+				for _, sub := range subs {
+					if sub != s {
+						kept = append(kept, sub)
+					}
+				}
+				t.subs.Store(kept)
+			},
+		)
+	}
+}
+
+// HasSubscribers reports whether the Topic has any subscriber, so that a publisher can skip building the event.
+func (t *Topic[T]) HasSubscribers() bool {
+	return len(t.subscribers()) > 0
+}
+
+// Publish delivers e to all the subscribers of the Topic. A panic of a subscriber is logged by logging.Default()
+// without affecting the publisher and the other subscribers.
+func (t *Topic[T]) Publish(e T) {
+	for _, s := range t.subscribers() {
+		t.deliver(s, e)
+	}
+}
+
+func (t *Topic[T]) deliver(s *subscriber[T], e T) {
+	defer func() {
+		if r := recover(); r != nil {
+			logging.Default().Error(
+				"eventbus subscriber panic", logging.F("topic", t.name), logging.Err(fmt.Errorf("%v", r)),
+			)
+		}
+	}()
+	s.fn(e)
+}
+
+func (t *Topic[T]) subscribers() []*subscriber[T] {
+	subs, _ := t.subs.Load().([]*subscriber[T])
+	return subs
+}
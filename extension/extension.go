@@ -0,0 +1,95 @@
+// Package extension provides the registries of the extension points of ppcserver, such as the SessionStores,
+// so that a third-party package registers its implementations by name, either in its init function or
+// by an explicit call, and the configuration loader instantiates them by the names in the configuration:
+//
+//	func init() {
+//		extension.SessionStores.Register("redis", newStore)
+//	}
+//
+//	store, err := extension.SessionStores.New("redis", extension.Config{"addr": "localhost:6379"})
+package extension
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var ErrUnknownExtension = errors.New("ppcserver: unknown extension")
+
+type (
+	// Config is the configuration of an extension instance, such as decoded from the configuration file.
+	Config map[string]interface{}
+
+	// Factory creates an extension instance from its Config.
+	Factory[T any] func(cfg Config) (T, error)
+
+	// Point is an extension point of the implementations of T by name, safe for concurrent use.
+	Point[T any] struct {
+		kind      string
+		mu        sync.RWMutex // mu guards factories.
+		factories map[string]Factory[T]
+	}
+)
+
+// NewPoint creates a Point of the kind, such as "session_store", which identifies it in the errors.
+func NewPoint[T any](kind string) *Point[T] {
+	return &Point[T]{kind: kind, factories: make(map[string]Factory[T])}
+}
+
+// Kind returns the kind of the Point.
+func (p *Point[T]) Kind() string {
+	return p.kind
+}
+
+// Register makes the Factory available by the name. Like database/sql.Register, it panics if the name is
+// registered twice or the Factory is nil, since it's a programming error found at the startup.
+func (p *Point[T]) Register(name string, f Factory[T]) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if f == nil {
+		panic("ppcserver: extension " + p.kind + " factory is nil: " + name)
+	}
+	if _, ok := p.factories[name]; ok {
+		panic("ppcserver: extension " + p.kind + " registered twice: " + name)
+	}
+	p.factories[name] = f
+}
+
+// New creates an instance by the Factory registered as the name, it returns ErrUnknownExtension if there is none.
+func (p *Point[T]) New(name string, cfg Config) (T, error) {
+	p.mu.RLock()
+	f, ok := p.factories[name]
+	p.mu.RUnlock()
+	if !ok {
+		var zero T
+		return zero, fmt.Errorf("%w: %s %q", ErrUnknownExtension, p.kind, name)
+	}
+	if cfg == nil {
+		cfg = Config{}
+	}
+	return f(cfg)
+}
+
+// Names returns the names registered, in ascending order.
+func (p *Point[T]) Names() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	names := make([]string, 0, len(p.factories))
+	for name := range p.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Decode decodes the Config into v, such as a struct with the json tags of the keys.
+func (c Config) Decode(v interface{}) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,134 @@
+package extension
+
+import (
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"os"
+	"time"
+)
+
+// The extension points of the connector.
+var (
+	Authenticators      = NewPoint[connector.Authenticator]("authenticator")
+	Codecs              = NewPoint[connector.Codec]("codec")
+	SessionStores       = NewPoint[connector.SessionStore]("session_store")
+	OfflineStores       = NewPoint[connector.OfflineStore]("offline_store")
+	RoomHistoryStores   = NewPoint[connector.RoomHistoryStore]("room_history_store")
+	ScheduledPushStores = NewPoint[connector.ScheduledPushStore]("scheduled_push_store")
+	NonceCaches         = NewPoint[connector.NonceCache]("nonce_cache")
+	AppKeyStores        = NewPoint[connector.AppKeyStore]("app_key_store")
+	Lockers             = NewPoint[connector.Locker]("locker")
+	RoomSnapshotStores  = NewPoint[connector.RoomSnapshotStore]("room_snapshot_store")
+	// MessageSinks are such as publishing the messages to a broker topic.
+	MessageSinks = NewPoint[connector.MessageSink]("message_sink")
+	AuditSinks   = NewPoint[connector.AuditSink]("audit_sink")
+)
+
+// The built-in extensions, registered as "memory" for the stores in memory, "json" for the JSON Codec, and
+// "file" for the JSON lines sinks appending to the "path" of the Config.
+func init() {
+	Codecs.Register(
+		"json", func(Config) (connector.Codec, error) {
+			return connector.JSONCodec(), nil
+		},
+	)
+	SessionStores.Register(
+		"memory", func(Config) (connector.SessionStore, error) {
+			return connector.NewMemorySessionStore(), nil
+		},
+	)
+	OfflineStores.Register(
+		"memory", func(cfg Config) (connector.OfflineStore, error) {
+			var c struct {
+				MaxPerUser int    `json:"max_per_user"`
+				TTL        string `json:"ttl"`
+			}
+			if err := cfg.Decode(&c); err != nil {
+				return nil, err
+			}
+			ttl, err := parseDuration(c.TTL)
+			if err != nil {
+				return nil, err
+			}
+			return connector.NewMemoryOfflineStore(c.MaxPerUser, ttl), nil
+		},
+	)
+	RoomHistoryStores.Register(
+		"memory", func(cfg Config) (connector.RoomHistoryStore, error) {
+			var c struct {
+				Size int `json:"size"`
+			}
+			if err := cfg.Decode(&c); err != nil {
+				return nil, err
+			}
+			return connector.NewMemoryRoomHistoryStore(c.Size), nil
+		},
+	)
+	ScheduledPushStores.Register(
+		"file", func(cfg Config) (connector.ScheduledPushStore, error) {
+			var c struct {
+				Path string `json:"path"`
+			}
+			if err := cfg.Decode(&c); err != nil {
+				return nil, err
+			}
+			return connector.NewFileScheduledPushStore(c.Path), nil
+		},
+	)
+	NonceCaches.Register(
+		"memory", func(Config) (connector.NonceCache, error) {
+			return connector.NewMemoryNonceCache(), nil
+		},
+	)
+	AppKeyStores.Register(
+		"memory", func(Config) (connector.AppKeyStore, error) {
+			return connector.NewMemoryAppKeyStore(), nil
+		},
+	)
+	Lockers.Register(
+		"memory", func(Config) (connector.Locker, error) {
+			return connector.NewMemoryLocker(), nil
+		},
+	)
+	RoomSnapshotStores.Register(
+		"memory", func(Config) (connector.RoomSnapshotStore, error) {
+			return connector.NewMemoryRoomSnapshotStore(), nil
+		},
+	)
+	MessageSinks.Register(
+		"file", func(cfg Config) (connector.MessageSink, error) {
+			f, err := openAppend(cfg)
+			if err != nil {
+				return nil, err
+			}
+			return connector.NewJSONMessageSink(f), nil
+		},
+	)
+	AuditSinks.Register(
+		"file", func(cfg Config) (connector.AuditSink, error) {
+			f, err := openAppend(cfg)
+			if err != nil {
+				return nil, err
+			}
+			return connector.NewJSONAuditSink(f), nil
+		},
+	)
+}
+
+// openAppend opens the file at the "path" of the Config for appending, which is kept open for the process lifetime.
+func openAppend(cfg Config) (*os.File, error) {
+	var c struct {
+		Path string `json:"path"`
+	}
+	if err := cfg.Decode(&c); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(c.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+}
+
+// parseDuration parses a duration such as "10m", zero if empty.
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
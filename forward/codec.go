@@ -0,0 +1,26 @@
+package forward
+
+import "encoding/json"
+
+// CodecName is the name of the gRPC codec encoding the forwarding messages as JSON, which is the content-subtype
+// of the forwarded requests. The backend gRPC server must support it, such as by RegisterServer.
+// It's distinct from "json", so that the JSON codec of the other gRPC services in the process is kept.
+const CodecName = "ppcserver-json"
+
+// Codec is the gRPC codec encoding the forwarding messages as JSON, so that no generated protobuf code is needed.
+type Codec struct{}
+
+// Marshal returns the JSON encoding of v.
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal parses the JSON encoded data into v.
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// Name returns CodecName.
+func (Codec) Name() string {
+	return CodecName
+}
@@ -0,0 +1,216 @@
+package forward
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"google.golang.org/grpc/resolver"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// discoveryScheme is the scheme of the gRPC target resolved by a Discovery.
+const discoveryScheme = "ppcserver-discovery"
+
+// roundRobinServiceConfig balances the requests across all the resolved instances.
+const roundRobinServiceConfig = `{"loadBalancingConfig": [{"round_robin": {}}]}`
+
+type (
+	// Discovery resolves the addresses of the healthy instances of a backend service, such as by Consul or DNS.
+	// An adapter for another registry, such as etcd, implements Discovery over its watch API.
+	Discovery interface {
+		// Watch calls update with the "host:port" addresses of the healthy instances of the service
+		// whenever they change, and blocks until ctx is done.
+		Watch(ctx context.Context, service string, update func(addrs []string)) error
+	}
+
+	// discoveryBuilder is a gRPC resolver.Builder resolving the targets by a Discovery.
+	discoveryBuilder struct {
+		d      Discovery
+		logger logging.Logger
+	}
+
+	discoveryResolver struct {
+		cancel context.CancelFunc
+	}
+
+	// dnsDiscovery is a Discovery looking up the hosts of a "host:port" service periodically.
+	dnsDiscovery struct {
+		interval time.Duration
+		resolver *net.Resolver
+	}
+
+	// consulDiscovery is a Discovery watching the passing instances of a service by the Consul blocking queries.
+	consulDiscovery struct {
+		addr   string
+		client *http.Client
+	}
+
+	consulServiceEntry struct {
+		Node struct {
+			Address string
+		}
+		Service struct {
+			Address string
+			Port    int
+		}
+	}
+)
+
+// NewDNSDiscovery creates a Discovery resolving the service "host:port" to the addresses of the host every interval,
+// such as a headless Kubernetes service.
+func NewDNSDiscovery(interval time.Duration) Discovery {
+	return &dnsDiscovery{interval: interval, resolver: net.DefaultResolver}
+}
+
+// NewConsulDiscovery creates a Discovery watching the instances of the service passing the health checks
+// by the Consul HTTP API at addr, such as "http://127.0.0.1:8500".
+func NewConsulDiscovery(addr string) Discovery {
+	return &consulDiscovery{addr: addr, client: &http.Client{}}
+}
+
+func (b *discoveryBuilder) Build(
+	target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions,
+) (resolver.Resolver, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		var prev []string
+		err := b.d.Watch(
+			ctx, target.Endpoint(), func(addrs []string) {
+				publishNodeChanges(target.Endpoint(), prev, addrs)
+				prev = append(prev[:0:0], addrs...)
+				state := resolver.State{Addresses: make([]resolver.Address, 0, len(addrs))}
+				for _, addr := range addrs {
+					state.Addresses = append(state.Addresses, resolver.Address{Addr: addr})
+				}
+				if err := cc.UpdateState(state); err != nil {
+					b.logger.Warn("forward discovery update error", logging.Err(err))
+				}
+			},
+		)
+		if err != nil && ctx.Err() == nil {
+			cc.ReportError(err)
+		}
+	}()
+	return &discoveryResolver{cancel: cancel}, nil
+}
+
+func (b *discoveryBuilder) Scheme() string {
+	return discoveryScheme
+}
+
+func (r *discoveryResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (r *discoveryResolver) Close() {
+	r.cancel()
+}
+
+func (d *dnsDiscovery) Watch(ctx context.Context, service string, update func(addrs []string)) error {
+	host, port, err := net.SplitHostPort(service)
+	if err != nil {
+		return err
+	}
+
+	var last []string
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		if hosts, err := d.resolver.LookupHost(ctx, host); err == nil {
+			addrs := make([]string, 0, len(hosts))
+			for _, h := range hosts {
+				addrs = append(addrs, net.JoinHostPort(h, port))
+			}
+			if !equalAddrs(addrs, last) {
+				update(addrs)
+				last = addrs
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *consulDiscovery) Watch(ctx context.Context, service string, update func(addrs []string)) error {
+	var (
+		index string
+		last  []string
+	)
+	for {
+		addrs, next, err := d.query(ctx, service, index)
+		if err != nil {
+			// Retry after a while, since Consul may be restarting, and the last addresses are kept meanwhile.
+			index = ""
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		index = next
+		if !equalAddrs(addrs, last) {
+			update(addrs)
+			last = addrs
+		}
+	}
+}
+
+// query runs a blocking query of the passing instances of the service, which returns once they change
+// since the index, or after the wait time.
+func (d *consulDiscovery) query(ctx context.Context, service, index string) ([]string, string, error) {
+	q := url.Values{"passing": {"true"}, "wait": {"30s"}}
+	if index != "" {
+		q.Set("index", index)
+	}
+	u := fmt.Sprintf("%s/v1/health/service/%s?%s", d.addr, url.PathEscape(service), q.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("ppcserver: consul health query status %d", resp.StatusCode)
+	}
+
+	var entries []consulServiceEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, "", err
+	}
+	addrs := make([]string, 0, len(entries))
+	for _, e := range entries {
+		host := e.Service.Address
+		if host == "" {
+			host = e.Node.Address
+		}
+		addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(e.Service.Port)))
+	}
+	return addrs, resp.Header.Get("X-Consul-Index"), nil
+}
+
+// equalAddrs reports whether the addresses are the same regardless of the order, it sorts both.
+func equalAddrs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+package forward
+
+import "github.com/pom-pom-crafts/ppcserver/eventbus"
+
+type (
+	// NodeJoined is published to TopicNodeJoined once an instance of a backend service is resolved by the Discovery.
+	NodeJoined struct {
+		Service string
+		Addr    string
+	}
+
+	// NodeLeft is published to TopicNodeLeft once an instance of a backend service is no longer resolved.
+	NodeLeft struct {
+		Service string
+		Addr    string
+	}
+)
+
+// The topics of the backend instances resolved by Options.Discovery on the in-process event bus.
+var (
+	TopicNodeJoined = eventbus.NewTopic[NodeJoined]("forward.node_joined")
+	TopicNodeLeft   = eventbus.NewTopic[NodeLeft]("forward.node_left")
+)
+
+// publishNodeChanges publishes the instances of the service joined and left between the addresses prev and addrs.
+func publishNodeChanges(service string, prev, addrs []string) {
+	seen := make(map[string]bool, len(prev))
+	for _, addr := range prev {
+		seen[addr] = true
+	}
+	for _, addr := range addrs {
+		if !seen[addr] {
+			TopicNodeJoined.Publish(NodeJoined{Service: service, Addr: addr})
+		}
+		delete(seen, addr)
+	}
+	for _, addr := range prev {
+		if seen[addr] {
+			TopicNodeLeft.Publish(NodeLeft{Service: service, Addr: addr})
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// Package forward forwards the messages of the routes with a prefix from the connector to a backend gRPC service,
+// and streams the replies back to the Client, for deploying the connector as a thin gateway:
+//
+//	f, err := forward.New("battle-service:9000")
+//	router.Handle("battle.*", f.Handler())
+package forward
+
+import (
+	"context"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"io"
+)
+
+type (
+	// Option is a function to apply various configurations to customize a Forwarder.
+	Option func(o *Options)
+
+	// Options hold the configurable parts of a Forwarder.
+	Options struct {
+		// DialOptions are passed to grpc.Dial, such as the transport credentials.
+		// Default is insecure transport credentials if not set via WithDialOptions.
+		DialOptions []grpc.DialOption
+
+		// Discovery resolves the target as a service name to the healthy instances, and the messages are
+		// balanced across them by round robin. Default is nil (the target is dialed as is) if not set via
+		// WithDiscovery.
+		Discovery Discovery
+
+		// Logger logs the errors of the replies pushed to the clients.
+		// Default is logging.Default() if not set via WithLogger.
+		Logger logging.Logger
+	}
+
+	// Forwarder forwards the messages received from clients to a backend gRPC service implementing Server.
+	Forwarder struct {
+		opts *Options
+		conn *grpc.ClientConn
+	}
+)
+
+func defaultOptions() *Options {
+	return &Options{
+		DialOptions: []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())},
+		Logger:      logging.Default(),
+	}
+}
+
+// New creates a Forwarder to the backend gRPC service at the target, see grpc.Dial for the format of target,
+// such as "dns:///battle-service:9000". With WithDiscovery, the target is the service name resolved by it.
+func New(target string, opts ...Option) (*Forwarder, error) {
+	f := &Forwarder{
+		opts: defaultOptions(),
+	}
+
+	// Apply opts to customize Forwarder.
+	for _, opt := range opts {
+		opt(f.opts)
+	}
+
+	dialOpts := append(
+		[]grpc.DialOption{grpc.WithDefaultCallOptions(grpc.ForceCodec(Codec{}))}, f.opts.DialOptions...,
+	)
+	if f.opts.Discovery != nil {
+		target = discoveryScheme + ":///" + target
+		dialOpts = append(
+			dialOpts,
+			grpc.WithResolvers(&discoveryBuilder{d: f.opts.Discovery, logger: f.opts.Logger}),
+			grpc.WithDefaultServiceConfig(roundRobinServiceConfig),
+		)
+	}
+	conn, err := grpc.Dial(target, dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+	f.conn = conn
+	return f, nil
+}
+
+// Close closes the connection to the backend.
+func (f *Forwarder) Close() error {
+	return f.conn.Close()
+}
+
+// Handler returns a connector.HandlerFunc forwarding the Message to the backend,
+// to register for the routes with a prefix, such as router.Handle("battle.*", f.Handler()).
+// The HandlerFunc returns once the response Reply is received, and the following replies are pushed
+// to the Client until the backend ends the stream or the Client is closed.
+func (f *Forwarder) Handler() connector.HandlerFunc {
+	return func(ctx context.Context, c *connector.Client, m *connector.Message) (interface{}, error) {
+		req := &Request{
+			ClientID:  c.ID(),
+			UID:       c.UID(),
+			SessionID: c.SessionID(),
+			Metadata:  c.ReplicatedMetadata(),
+			Route:     m.Route,
+			// Copy the data, since m is released after the HandlerFunc returns.
+			Data:   append([]byte(nil), m.Data...),
+			OneWay: m.ID == 0,
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		stream, err := f.conn.NewStream(ctx, &serviceDesc.Streams[0], ForwardMethod)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		if err := stream.SendMsg(req); err != nil {
+			cancel()
+			return nil, err
+		}
+		if err := stream.CloseSend(); err != nil {
+			cancel()
+			return nil, err
+		}
+
+		for {
+			reply := &Reply{}
+			if err := stream.RecvMsg(reply); err != nil {
+				cancel()
+				if err == io.EOF {
+					return nil, nil
+				}
+				return nil, err
+			}
+			if reply.Route != "" {
+				if err := pushReply(c, reply); err != nil {
+					cancel()
+					return nil, nil
+				}
+				continue
+			}
+
+			go f.pushReplies(c, stream, cancel)
+			if reply.Error != "" {
+				return nil, errors.New(reply.Error)
+			}
+			if len(reply.Data) == 0 {
+				return nil, nil
+			}
+			return reply.Data, nil
+		}
+	}
+}
+
+// pushReplies pushes the replies following the response to the Client until the stream or the Client is closed.
+func (f *Forwarder) pushReplies(c *connector.Client, stream grpc.ClientStream, cancel context.CancelFunc) {
+	defer cancel()
+	for {
+		reply := &Reply{}
+		if err := stream.RecvMsg(reply); err != nil {
+			if err != io.EOF && !errors.Is(stream.Context().Err(), context.Canceled) {
+				f.opts.Logger.Warn("forward stream error", logging.Err(err))
+			}
+			return
+		}
+		if reply.Route == "" {
+			continue
+		}
+		if err := pushReply(c, reply); err != nil {
+			return
+		}
+	}
+}
+
+// pushReply pushes the Reply with a Route to the Client as a one-way Message.
+func pushReply(c *connector.Client, reply *Reply) error {
+	if len(reply.Data) == 0 {
+		return c.Push(reply.Route, nil)
+	}
+	return c.Push(reply.Route, reply.Data)
+}
+
+// WithDialOptions is an Option to set the options for dialing the backend, such as the transport credentials.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *Options) {
+		o.DialOptions = opts
+	}
+}
+
+// WithDiscovery is an Option to resolve the target by the Discovery, such as NewConsulDiscovery.
+func WithDiscovery(d Discovery) Option {
+	return func(o *Options) {
+		o.Discovery = d
+	}
+}
+
+// WithLogger is an Option to set the Logger.
+func WithLogger(l logging.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
@@ -0,0 +1,93 @@
+package forward
+
+import (
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"sync"
+)
+
+// Pool shares a Forwarder per backend target, for updating the routes forwarded to the backends at runtime,
+// such as by the admin API or reloading a config, without restarting the connector.
+type Pool struct {
+	opts       []Option
+	mu         sync.Mutex // mu guards forwarders and applied.
+	forwarders map[string]*Forwarder
+	applied    map[string]string // applied is the route table of the last Apply.
+}
+
+// NewPool creates a Pool creating the Forwarders by New with the opts.
+func NewPool(opts ...Option) *Pool {
+	return &Pool{
+		opts:       opts,
+		forwarders: make(map[string]*Forwarder),
+	}
+}
+
+// Handler returns the connector.HandlerFunc forwarding to the backend at the target,
+// the Forwarder is created once per target and kept until Close.
+func (p *Pool) Handler(target string) (connector.HandlerFunc, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f, err := p.forwarder(target)
+	if err != nil {
+		return nil, err
+	}
+	return f.Handler(), nil
+}
+
+// Apply registers the route table mapping the routes to the backend targets to the Router,
+// such as {"battle.*": "battle-v2:9000"}, and removes the routes of the previously applied table not in it.
+// The routes not applied by the Pool are left as is. Nothing is changed if any Forwarder can't be created.
+func (p *Pool) Apply(r *connector.Router, table map[string]string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	handlers := make(map[string]connector.HandlerFunc, len(table))
+	for route, target := range table {
+		f, err := p.forwarder(target)
+		if err != nil {
+			return err
+		}
+		handlers[route] = f.Handler()
+	}
+
+	for route := range p.applied {
+		if _, ok := table[route]; !ok {
+			r.Remove(route)
+		}
+	}
+	for route, h := range handlers {
+		r.Handle(route, h)
+	}
+	p.applied = make(map[string]string, len(table))
+	for route, target := range table {
+		p.applied[route] = target
+	}
+	return nil
+}
+
+// Close closes all the Forwarders of the Pool.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var err error
+	for target, f := range p.forwarders {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		delete(p.forwarders, target)
+	}
+	return err
+}
+
+// forwarder returns the Forwarder of the target, creates it if none, p.mu must be held.
+func (p *Pool) forwarder(target string) (*Forwarder, error) {
+	if f, ok := p.forwarders[target]; ok {
+		return f, nil
+	}
+	f, err := New(target, p.opts...)
+	if err != nil {
+		return nil, err
+	}
+	p.forwarders[target] = f
+	return f, nil
+}
@@ -0,0 +1,87 @@
+package forward
+
+import (
+	"encoding/json"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"sync"
+)
+
+// ForwardMethod is the full name of the server-streaming gRPC method called for every forwarded Message.
+const ForwardMethod = "/ppcserver.forward.Forwarder/Forward"
+
+type (
+	// Request is a Message received from a Client and forwarded to the backend, with the identity of the Client.
+	Request struct {
+		ClientID  uint64          `json:"client_id"`
+		UID       string          `json:"uid,omitempty"`
+		SessionID string          `json:"session_id,omitempty"`
+		Route     string          `json:"route"`
+		Data      json.RawMessage `json:"data,omitempty"`
+		// OneWay is true if the Client expects no response.
+		OneWay bool `json:"one_way,omitempty"`
+		// Metadata is the Client metadata of the keys in connector.Options.ReplicatedMetadata, such as the region,
+		// which is kept across a resume on another connector node.
+		Metadata map[string]string `json:"metadata,omitempty"`
+	}
+
+	// Reply is a message streamed back by the backend for a Request.
+	// A Reply with an empty Route is the response to the Request, and only the first one is used,
+	// a Reply with a Route is pushed to the Client as a one-way Message.
+	Reply struct {
+		Route string          `json:"route,omitempty"`
+		Data  json.RawMessage `json:"data,omitempty"`
+		Error string          `json:"error,omitempty"`
+	}
+
+	// ReplyStream sends the Reply of a Request back to the connector.
+	ReplyStream interface {
+		Send(r *Reply) error
+		grpc.ServerStream
+	}
+
+	// Server is implemented by the backend to handle the forwarded requests.
+	Server interface {
+		Forward(req *Request, stream ReplyStream) error
+	}
+
+	replyStream struct {
+		grpc.ServerStream
+	}
+)
+
+// serviceDesc describes the Forwarder gRPC service, written by hand since the messages are encoded by Codec.
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "ppcserver.forward.Forwarder",
+	HandlerType: (*Server)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Forward",
+			Handler:       forwardHandler,
+			ServerStreams: true,
+		},
+	},
+}
+
+// registerCodecOnce registers Codec to gRPC by the first RegisterServer.
+var registerCodecOnce sync.Once
+
+// RegisterServer registers the Server implemented by a Go backend to the gRPC server. It also registers Codec
+// to gRPC as CodecName, so the gRPC server accepts the requests encoded by it, and thus must be called
+// before any gRPC server of the process is serving.
+func RegisterServer(s *grpc.Server, srv Server) {
+	registerCodecOnce.Do(func() { encoding.RegisterCodec(Codec{}) })
+	s.RegisterService(&serviceDesc, srv)
+}
+
+func forwardHandler(srv interface{}, stream grpc.ServerStream) error {
+	req := &Request{}
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	return srv.(Server).Forward(req, &replyStream{stream})
+}
+
+func (s *replyStream) Send(r *Reply) error {
+	return s.ServerStream.SendMsg(r)
+}
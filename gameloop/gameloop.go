@@ -0,0 +1,249 @@
+// Package gameloop provides a fixed-tick Loop driving the authoritative game logic of a Room, which hands the inbound
+// messages received during a tick to a TickFunc at once, and flushes its outbound messages at the tick boundary,
+// which runs as a ppcserver Component.
+package gameloop
+
+import (
+	"context"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/clock"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotMember     = errors.New("ppcserver: client is not a member of the game room")
+	ErrInputOverflow = errors.New("ppcserver: too many inputs in the game tick")
+)
+
+type (
+	// Option is a function to apply various configurations to customize a Loop.
+	Option func(o *Options)
+
+	// Options hold the configurable parts of a Loop.
+	Options struct {
+		// TickRate is the number of ticks per second.
+		// Default is 20 if not set via WithTickRate.
+		TickRate int
+
+		// MaxInputs is the maximum number of the inputs buffered for a tick, the excess is rejected
+		// with ErrInputOverflow. Default is 1024 if not set via WithMaxInputs.
+		MaxInputs int
+
+		// Logger is the Logger for the panics of the TickFunc and the failures of the flushes.
+		// Default is logging.Default() if not set via WithLogger.
+		Logger logging.Logger
+
+		// Clock is the time source of the ticks, such as a clock.Fake to step the game in tests.
+		// Default is clock.Real() if not set via WithClock.
+		Clock clock.Clock
+	}
+
+	// Input is a Message received from a member of the Room during a tick.
+	Input struct {
+		Client     *connector.Client
+		Message    *connector.Message
+		ReceivedAt time.Time
+	}
+
+	// TickFunc runs the game logic of a tick, it must not retain the Tick after returning.
+	TickFunc func(ctx context.Context, t *Tick)
+
+	// Tick is the state of a tick passed to the TickFunc.
+	Tick struct {
+		// N is the number of the tick, starting from 1.
+		N uint64
+		// At is the scheduled time of the tick.
+		At time.Time
+		// Delta is the time since the previous tick, which exceeds the tick interval if the Loop is behind.
+		Delta time.Duration
+		// Inputs are the messages received since the previous tick, in the order received.
+		Inputs []Input
+		// Room is the Room of the Loop.
+		Room *connector.Room
+
+		outbound []outbound
+	}
+
+	// outbound is a Message sent by the TickFunc, flushed at the end of the tick.
+	outbound struct {
+		c     *connector.Client // c is nil for a broadcast to the Room.
+		route string
+		v     interface{}
+	}
+
+	// Loop calls the TickFunc every tick with the inputs received from the members of its Room.
+	Loop struct {
+		opts   *Options
+		room   *connector.Room
+		f      TickFunc
+		mu     sync.Mutex // mu guards inputs.
+		inputs []Input
+	}
+)
+
+// New creates a new Loop calling f every tick for the room, which should be registered to the Server
+// by ppcserver.WithComponent, or started along with the Room. The inputs are received by Loop.Handler.
+func New(room *connector.Room, f TickFunc, opts ...Option) *Loop {
+	l := &Loop{
+		opts: &Options{
+			TickRate:  20,
+			MaxInputs: 1024,
+			Logger:    logging.Default(),
+			Clock:     clock.Real(),
+		},
+		room: room,
+		f:    f,
+	}
+
+	// Apply opts to customize Loop.
+	for _, opt := range opts {
+		opt(l.opts)
+	}
+
+	return l
+}
+
+// WithTickRate is an Option to set the number of ticks per second.
+func WithTickRate(n int) Option {
+	return func(o *Options) {
+		o.TickRate = n
+	}
+}
+
+// WithMaxInputs is an Option to set the maximum number of the inputs buffered for a tick.
+func WithMaxInputs(n int) Option {
+	return func(o *Options) {
+		o.MaxInputs = n
+	}
+}
+
+// WithLogger is an Option to set the Logger, such as an adapter over zap or slog.
+func WithLogger(l logging.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
+
+// WithClock is an Option to set the time source of the ticks, such as a clock.Fake in tests.
+func WithClock(c clock.Clock) Option {
+	return func(o *Options) {
+		o.Clock = c
+	}
+}
+
+// Handler returns a connector.HandlerFunc buffering the messages of the members of the Room for the next tick,
+// to be registered for the game routes, such as Router.Handle("game.*", l.Handler()).
+// A request is responded once buffered, the results are pushed by the TickFunc.
+func (l *Loop) Handler() connector.HandlerFunc {
+	return func(_ context.Context, c *connector.Client, m *connector.Message) (interface{}, error) {
+		return nil, l.Input(c, m)
+	}
+}
+
+// Input buffers the Message of a member of the Room for the next tick, for dispatching the inputs of several
+// rooms by a custom connector.HandlerFunc.
+func (l *Loop) Input(c *connector.Client, m *connector.Message) error {
+	if !l.isMember(c) {
+		return ErrNotMember
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.opts.MaxInputs > 0 && len(l.inputs) >= l.opts.MaxInputs {
+		return ErrInputOverflow
+	}
+	// Copy the Message, as the received messages are reused once handled.
+	cp := &connector.Message{ID: m.ID, Route: m.Route, Data: append([]byte(nil), m.Data...)}
+	l.inputs = append(l.inputs, Input{Client: c, Message: cp, ReceivedAt: l.opts.Clock.Now()})
+	return nil
+}
+
+func (l *Loop) isMember(c *connector.Client) bool {
+	for _, r := range c.Rooms() {
+		if r == l.room {
+			return true
+		}
+	}
+	return false
+}
+
+// Start runs the ticks at the fixed rate and blocks until ctx is done or the Room is closed.
+// A tick running late is followed by the next one immediately, so the game time catches up.
+func (l *Loop) Start(ctx context.Context) error {
+	interval := time.Second / time.Duration(l.opts.TickRate)
+	// The timer signals instead of a channel timer, so that it works the same on any clock.Clock.
+	fired := make(chan struct{}, 1)
+	timer := l.opts.Clock.AfterFunc(
+		interval, func() {
+			select {
+			case fired <- struct{}{}:
+			default:
+			}
+		},
+	)
+	defer timer.Stop()
+
+	prev := l.opts.Clock.Now()
+	next := prev.Add(interval)
+	for n := uint64(1); ; n++ {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-fired:
+		}
+		if r, ok := l.room.Tenant().GetRoom(l.room.Name()); !ok || r != l.room {
+			// The Room is closed, and maybe replaced by another of the same name.
+			return nil
+		}
+
+		l.tick(ctx, &Tick{N: n, At: next, Delta: next.Sub(prev), Room: l.room})
+		prev, next = next, next.Add(interval)
+		timer.Reset(next.Sub(l.opts.Clock.Now()))
+	}
+}
+
+// Shutdown does nothing, as the members are closed along with the connectors.
+func (l *Loop) Shutdown(_ context.Context) error {
+	return nil
+}
+
+// tick calls the TickFunc with the buffered inputs, and flushes the outbound messages.
+func (l *Loop) tick(ctx context.Context, t *Tick) {
+	l.mu.Lock()
+	t.Inputs, l.inputs = l.inputs, nil
+	l.mu.Unlock()
+
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				l.opts.Logger.Error("Loop TickFunc panic", logging.F("room", l.room.Name()), logging.F("panic", r))
+			}
+		}()
+		l.f(ctx, t)
+	}()
+
+	for _, o := range t.outbound {
+		var err error
+		if o.c == nil {
+			err = l.room.Broadcast(o.route, o.v)
+		} else {
+			err = o.c.Push(o.route, o.v)
+		}
+		if err != nil {
+			l.opts.Logger.Debug("Loop flush error", logging.F("route", o.route), logging.Err(err))
+		}
+	}
+}
+
+// Broadcast queues a one-way Message to all the members of the Room, flushed at the end of the tick.
+func (t *Tick) Broadcast(route string, v interface{}) {
+	t.outbound = append(t.outbound, outbound{route: route, v: v})
+}
+
+// Push queues a one-way Message to the Client, flushed at the end of the tick.
+func (t *Tick) Push(c *connector.Client, route string, v interface{}) {
+	t.outbound = append(t.outbound, outbound{c: c, route: route, v: v})
+}
@@ -0,0 +1,245 @@
+package gameloop_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/clock"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/gameloop"
+	"github.com/pom-pom-crafts/ppcserver/transporttest"
+	"testing"
+	"time"
+)
+
+const interval = 50 * time.Millisecond
+
+// tickRecord is the copy of a Tick seen by the TickFunc.
+type tickRecord struct {
+	n      uint64
+	at     time.Time
+	delta  time.Duration
+	routes []string
+}
+
+// setup starts a Loop of 20 ticks per second on a fake clock for a new Room, and a member sending its game
+// messages to the Loop. Each tick is recorded to the returned channel, and broadcasts and pushes the tick number.
+func setup(t *testing.T, name string, opts ...gameloop.Option) (
+	*clock.Fake, *transporttest.Peer, <-chan tickRecord, <-chan error, context.CancelFunc,
+) {
+	t.Helper()
+	room, err := connector.CreateRoom(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(room.Close)
+
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	ticks := make(chan tickRecord, 16)
+	l := gameloop.New(
+		room, func(_ context.Context, tick *gameloop.Tick) {
+			rec := tickRecord{n: tick.N, at: tick.At, delta: tick.Delta}
+			for _, in := range tick.Inputs {
+				rec.routes = append(rec.routes, in.Message.Route)
+			}
+			tick.Broadcast("tick", tick.N)
+			for _, in := range tick.Inputs {
+				tick.Push(in.Client, "ack", in.Message.Route)
+			}
+			ticks <- rec
+		},
+		append([]gameloop.Option{gameloop.WithTickRate(20), gameloop.WithClock(clk)}, opts...)...,
+	)
+
+	router := connector.NewRouter()
+	router.Handle(
+		"join", func(_ context.Context, c *connector.Client, _ *connector.Message) (interface{}, error) {
+			return nil, room.Join(c)
+		},
+	)
+	router.Handle("game.*", l.Handler())
+	peer, _ := transporttest.Serve(context.Background(), connector.NewOptions(connector.WithRouter(router)))
+	t.Cleanup(func() { _ = peer.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	done := make(chan error, 1)
+	go func() {
+		done <- l.Start(ctx)
+	}()
+	return clk, peer, ticks, done, cancel
+}
+
+// call sends the request and returns its response, skipping the pushes.
+func call(t *testing.T, peer *transporttest.Peer, id uint64, route string) *connector.Message {
+	t.Helper()
+	if err := peer.SendMessage(&connector.Message{ID: id, Route: route}); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		m := receive(t, peer)
+		if m.ID == id {
+			return m
+		}
+	}
+}
+
+func receive(t *testing.T, peer *transporttest.Peer) *connector.Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	m, err := peer.ReceiveMessage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// advance advances clk by a tick once the Loop is waiting for it.
+func advance(t *testing.T, clk *clock.Fake) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for clk.Len() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the Loop never waits for the next tick")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(interval)
+}
+
+// step advances clk by a tick, and returns the record of the tick.
+func step(t *testing.T, clk *clock.Fake, ticks <-chan tickRecord) tickRecord {
+	t.Helper()
+	advance(t, clk)
+	select {
+	case rec := <-ticks:
+		return rec
+	case <-time.After(time.Second):
+		t.Fatal("the tick never runs")
+		return tickRecord{}
+	}
+}
+
+func TestTickOrdering(t *testing.T) {
+	clk, peer, ticks, _, _ := setup(t, "gameloop-ordering")
+	start := clk.Now()
+	call(t, peer, 1, "join")
+	call(t, peer, 2, "game.move")
+	call(t, peer, 3, "game.fire")
+
+	rec := step(t, clk, ticks)
+	if rec.n != 1 || !rec.at.Equal(start.Add(interval)) || rec.delta != interval {
+		t.Fatalf("tick = %+v, want N 1 at %v with delta %v", rec, start.Add(interval), interval)
+	}
+	if len(rec.routes) != 2 || rec.routes[0] != "game.move" || rec.routes[1] != "game.fire" {
+		t.Fatalf("tick inputs = %v, want [game.move game.fire]", rec.routes)
+	}
+	// The outbound messages are flushed after the tick in the order queued.
+	for _, want := range []string{`tick:1`, `ack:"game.move"`, `ack:"game.fire"`} {
+		if m := receive(t, peer); m.Route+":"+string(m.Data) != want {
+			t.Fatalf("received %s:%s, want %s", m.Route, m.Data, want)
+		}
+	}
+
+	rec = step(t, clk, ticks)
+	if rec.n != 2 || !rec.at.Equal(start.Add(2*interval)) || len(rec.routes) != 0 {
+		t.Fatalf("tick = %+v, want N 2 without inputs", rec)
+	}
+	var n uint64
+	if m := receive(t, peer); m.Route != "tick" || json.Unmarshal(m.Data, &n) != nil || n != 2 {
+		t.Fatalf("received %s:%s, want tick:2", m.Route, m.Data)
+	}
+}
+
+func TestInputRejected(t *testing.T) {
+	clk, peer, ticks, _, _ := setup(t, "gameloop-rejected", gameloop.WithMaxInputs(1))
+	if resp := call(t, peer, 1, "game.move"); resp.Error != gameloop.ErrNotMember.Error() {
+		t.Fatalf("error of a non-member = %q, want %q", resp.Error, gameloop.ErrNotMember)
+	}
+
+	call(t, peer, 2, "join")
+	call(t, peer, 3, "game.move")
+	if resp := call(t, peer, 4, "game.fire"); resp.Error != gameloop.ErrInputOverflow.Error() {
+		t.Fatalf("error beyond MaxInputs = %q, want %q", resp.Error, gameloop.ErrInputOverflow)
+	}
+	if rec := step(t, clk, ticks); len(rec.routes) != 1 || rec.routes[0] != "game.move" {
+		t.Fatalf("tick inputs = %v, want [game.move]", rec.routes)
+	}
+}
+
+func TestStop(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		stop func(clk *clock.Fake, room *connector.Room, cancel context.CancelFunc)
+	}{
+		{
+			"context done", func(_ *clock.Fake, _ *connector.Room, cancel context.CancelFunc) {
+				cancel()
+			},
+		},
+		{
+			"room closed", func(clk *clock.Fake, room *connector.Room, _ context.CancelFunc) {
+				room.Close()
+				advance(t, clk)
+			},
+		},
+	} {
+		name := "gameloop-stop-" + tt.name
+		clk, _, ticks, done, cancel := setup(t, name)
+		step(t, clk, ticks)
+		room, _ := connector.GetRoom(name)
+		tt.stop(clk, room, cancel)
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("%s: Start() error = %v", tt.name, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: Start() never returns", tt.name)
+		}
+		select {
+		case rec := <-ticks:
+			t.Fatalf("%s: tick %d runs after stopped", tt.name, rec.n)
+		default:
+		}
+	}
+}
+
+func TestTickFuncPanicKeepsLoop(t *testing.T) {
+	room, err := connector.CreateRoom("gameloop-panic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer room.Close()
+
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	ticks := make(chan uint64, 4)
+	l := gameloop.New(
+		room, func(_ context.Context, tick *gameloop.Tick) {
+			ticks <- tick.N
+			if tick.N == 1 {
+				panic(errors.New("boom"))
+			}
+		},
+		gameloop.WithClock(clk),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = l.Start(ctx)
+	}()
+
+	for want := uint64(1); want <= 2; want++ {
+		advance(t, clk)
+		select {
+		case n := <-ticks:
+			if n != want {
+				t.Fatalf("tick N = %d, want %d", n, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("tick %d never runs", want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package ppcserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrServerNotStarted = errors.New("ppcserver: server is not started")
+	ErrServerDraining   = errors.New("ppcserver: server is draining")
+)
+
+type (
+	// ReadyChecker is optionally implemented by a Component to report whether it is ready to serve,
+	// such as a connector that has bound its listener. Ready returns a non-nil error if not ready.
+	ReadyChecker interface {
+		Ready() error
+	}
+
+	// HealthCheck is a named check for the health endpoints, such as the connectivity to a broker.
+	HealthCheck struct {
+		Name  string
+		Check func(ctx context.Context) error
+	}
+)
+
+// HealthHandler returns an http.Handler serving the health endpoints for Kubernetes probes:
+//
+//	/livez    fails if the event loop is unresponsive or any liveness HealthCheck fails
+//	/readyz   fails before started, while draining, if any ReadyChecker Component is not ready,
+//	          or any readiness HealthCheck fails
+//	/healthz  same as /readyz
+//
+// A failed endpoint responds 503 with the reasons, one per line.
+func (s *Server) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/livez", s.serveHealth(s.Live))
+	mux.HandleFunc("/readyz", s.serveHealth(s.Ready))
+	mux.HandleFunc("/healthz", s.serveHealth(s.Ready))
+	return mux
+}
+
+func (s *Server) serveHealth(check func(ctx context.Context) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), s.opts.HealthCheckTimeout)
+		defer cancel()
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := check(ctx); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, err)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+// Live returns a non-nil error if the event loop has not ticked within Options.MaxEventLoopLag,
+// unless the watchdog is disabled, or any liveness HealthCheck fails.
+func (s *Server) Live(ctx context.Context) error {
+	var errs []string
+	if ns := atomic.LoadInt64(&s.lastTick); ns != 0 {
+		if lag := time.Since(time.Unix(0, ns)); lag > s.opts.MaxEventLoopLag {
+			errs = append(errs, fmt.Sprintf("ppcserver: event loop lag %s exceeds %s", lag, s.opts.MaxEventLoopLag))
+		}
+	}
+	errs = append(errs, runHealthChecks(ctx, s.opts.LivenessChecks)...)
+	return joinHealthErrors(errs)
+}
+
+// Ready returns a non-nil error if the Server is not started or is draining,
+// any ReadyChecker Component is not ready, or any readiness HealthCheck fails.
+func (s *Server) Ready(ctx context.Context) error {
+	if atomic.LoadInt64(&s.startedAt) == 0 {
+		return ErrServerNotStarted
+	}
+	if atomic.LoadInt32(&s.draining) == 1 {
+		return ErrServerDraining
+	}
+
+	var errs []string
+	for _, c := range s.components {
+		if rc, ok := c.(ReadyChecker); ok {
+			if err := rc.Ready(); err != nil {
+				errs = append(errs, fmt.Sprintf("%T: %s", c, err))
+			}
+		}
+	}
+	errs = append(errs, runHealthChecks(ctx, s.opts.ReadinessChecks)...)
+	return joinHealthErrors(errs)
+}
+
+// runEventLoopWatchdog ticks until ctx is done, Live fails when the ticks are delayed,
+// which indicates the runtime is starved or deadlocked. Options.MaxEventLoopLag must be positive.
+func (s *Server) runEventLoopWatchdog(ctx context.Context) {
+	interval := s.opts.MaxEventLoopLag / 4
+	if interval <= 0 {
+		interval = s.opts.MaxEventLoopLag
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	atomic.StoreInt64(&s.lastTick, time.Now().UnixNano())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			atomic.StoreInt64(&s.lastTick, now.UnixNano())
+		}
+	}
+}
+
+func runHealthChecks(ctx context.Context, checks []HealthCheck) []string {
+	var errs []string
+	for _, hc := range checks {
+		if err := hc.Check(ctx); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", hc.Name, err))
+		}
+	}
+	return errs
+}
+
+func joinHealthErrors(errs []string) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(errs, "\n"))
+}
+
+// WithLivenessCheck is a ServerOption to add a HealthCheck to the liveness endpoint, such as pinging a broker.
+func WithLivenessCheck(name string, check func(ctx context.Context) error) ServerOption {
+	return func(s *Server) {
+		s.opts.LivenessChecks = append(s.opts.LivenessChecks, HealthCheck{Name: name, Check: check})
+	}
+}
+
+// WithReadinessCheck is a ServerOption to add a HealthCheck to the readiness endpoint.
+func WithReadinessCheck(name string, check func(ctx context.Context) error) ServerOption {
+	return func(s *Server) {
+		s.opts.ReadinessChecks = append(s.opts.ReadinessChecks, HealthCheck{Name: name, Check: check})
+	}
+}
+
+// WithMaxEventLoopLag is a ServerOption to set the maximum delay of the event loop watchdog before liveness fails,
+// zero or negative d disables the watchdog.
+func WithMaxEventLoopLag(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.opts.MaxEventLoopLag = d
+	}
+}
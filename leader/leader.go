@@ -0,0 +1,237 @@
+// Package leader elects one server node as the leader of a name by a connector.Locker shared by the nodes,
+// so that the cluster-singleton jobs, such as the announcements scheduler or the stale-session reaper, run on
+// exactly one node, and another node takes over once the leader fails:
+//
+//	e := leader.New(redisstore.NewLocker(client, ""), "reaper")
+//	e.Go(func(ctx context.Context) { reapStaleSessions(ctx) })
+//	s := ppcserver.NewServer(ppcserver.WithComponent(e))
+package leader
+
+import (
+	"context"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"sync"
+	"time"
+)
+
+type (
+	// Option is a function to apply various configurations to customize an Elector.
+	Option func(o *Options)
+
+	// Options hold the configurable parts of an Elector.
+	Options struct {
+		// TTL is the time the leadership outlives a failed leader, so a follower takes over within about the TTL.
+		// The followers campaign every TTL. Default is 15 seconds if not set via WithTTL.
+		TTL time.Duration
+
+		// OnElected is called once the current node becomes the leader.
+		// Default is nil if not set via WithOnElected.
+		OnElected func()
+
+		// OnDemoted is called once the current node is no longer the leader, either the leadership is lost or
+		// the Elector is shutting down. Default is nil if not set via WithOnDemoted.
+		OnDemoted func()
+
+		// Logger logs the errors of the campaigns.
+		// Default is logging.Default() if not set via WithLogger.
+		Logger logging.Logger
+	}
+
+	// Elector is a Component campaigning for the leadership of a name among the server nodes, which holds
+	// the lock of the name while the current node is the leader.
+	Elector struct {
+		opts   *Options
+		locker connector.Locker
+		name   string
+		mu     sync.Mutex // mu guards lease, jobs, jobCtx, and cancelJobs.
+		lease  *connector.Lease
+		jobs   []func(ctx context.Context)
+		// jobCtx is the context of the jobs started while the current node is the leader, canceled by cancelJobs
+		// once demoted. cancelJobs is nil while not the leader.
+		jobCtx     context.Context
+		cancelJobs context.CancelFunc
+		running    sync.WaitGroup
+	}
+)
+
+func defaultOptions() *Options {
+	return &Options{
+		TTL:    15 * time.Second,
+		Logger: logging.Default(),
+	}
+}
+
+// New creates an Elector of the name by the Locker shared by the server nodes, such as redisstore.Locker,
+// which should be registered to the Server by ppcserver.WithComponent.
+func New(l connector.Locker, name string, opts ...Option) *Elector {
+	e := &Elector{
+		opts:   defaultOptions(),
+		locker: l,
+		name:   name,
+	}
+
+	// Apply opts to customize Elector.
+	for _, opt := range opts {
+		opt(e.opts)
+	}
+
+	return e
+}
+
+// WithTTL is an Option to set the time the leadership outlives a failed leader.
+func WithTTL(ttl time.Duration) Option {
+	return func(o *Options) {
+		o.TTL = ttl
+	}
+}
+
+// WithOnElected is an Option to set the function called once the current node becomes the leader.
+func WithOnElected(f func()) Option {
+	return func(o *Options) {
+		o.OnElected = f
+	}
+}
+
+// WithOnDemoted is an Option to set the function called once the current node is no longer the leader.
+func WithOnDemoted(f func()) Option {
+	return func(o *Options) {
+		o.OnDemoted = f
+	}
+}
+
+// WithLogger is an Option to set the Logger.
+func WithLogger(l logging.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
+
+// Name returns the name of the leadership.
+func (e *Elector) Name() string {
+	return e.name
+}
+
+// IsLeader reports whether the current node is the leader, such as for scheduler.WithLeader.
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.lease != nil
+}
+
+// Go runs f in a new goroutine whenever the current node becomes the leader, and cancels its ctx once demoted,
+// such as a loop reaping the stale sessions. If the current node is the leader already, f is started at once.
+func (e *Elector) Go(f func(ctx context.Context)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.jobs = append(e.jobs, f)
+	if e.cancelJobs != nil {
+		e.startJobLocked(f)
+	}
+}
+
+// Start campaigns for the leadership every TTL until ctx is done, and holds it until lost.
+func (e *Elector) Start(ctx context.Context) error {
+	ticker := time.NewTicker(e.opts.TTL)
+	defer ticker.Stop()
+	for {
+		lease, err := connector.AcquireLease(ctx, e.locker, "leader:"+e.name, e.opts.TTL)
+		switch {
+		case err == nil:
+			e.elect(lease)
+			select {
+			case <-lease.Done():
+				e.demote(lease)
+			case <-ctx.Done():
+				return nil
+			}
+		case !errors.Is(err, connector.ErrLockHeld) && ctx.Err() == nil:
+			e.opts.Logger.Warn("leader campaign error", logging.F("name", e.name), logging.Err(err))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Shutdown resigns the leadership, so that a follower takes over at its next campaign instead of after the TTL,
+// and waits for the jobs started by Go to return or ctx is done.
+func (e *Elector) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	lease := e.lease
+	e.mu.Unlock()
+	var err error
+	if lease != nil {
+		e.demote(lease)
+		err = lease.Release(ctx)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		e.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// elect makes the current node the leader with the lease, and starts the jobs.
+func (e *Elector) elect(lease *connector.Lease) {
+	e.mu.Lock()
+	e.lease = lease
+	e.jobCtx, e.cancelJobs = context.WithCancel(context.Background())
+	for _, f := range e.jobs {
+		e.startJobLocked(f)
+	}
+	e.mu.Unlock()
+
+	e.opts.Logger.Info("leader elected", logging.F("name", e.name))
+	if e.opts.OnElected != nil {
+		e.opts.OnElected()
+	}
+}
+
+// demote cancels the jobs once the lease is no longer held, it does nothing if already demoted.
+func (e *Elector) demote(lease *connector.Lease) {
+	e.mu.Lock()
+	if e.lease != lease {
+		e.mu.Unlock()
+		return
+	}
+	e.lease = nil
+	e.cancelJobs()
+	e.cancelJobs = nil
+	e.mu.Unlock()
+
+	if err := lease.Err(); err != nil {
+		e.opts.Logger.Warn("leader lost", logging.F("name", e.name), logging.Err(err))
+	} else {
+		e.opts.Logger.Info("leader resigned", logging.F("name", e.name))
+	}
+	if e.opts.OnDemoted != nil {
+		e.opts.OnDemoted()
+	}
+}
+
+// startJobLocked runs f with the context of the current leadership, mu must be held.
+func (e *Elector) startJobLocked(f func(ctx context.Context)) {
+	ctx := e.jobCtx
+	e.running.Add(1)
+	go func() {
+		defer e.running.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				e.opts.Logger.Error("leader job panic", logging.F("name", e.name), logging.F("panic", r))
+			}
+		}()
+		f(ctx)
+	}()
+}
@@ -0,0 +1,143 @@
+package leader_test
+
+import (
+	"context"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/leader"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const ttl = 60 * time.Millisecond
+
+// stealingLocker is a connector.Locker whose locks are held by another owner while stolen is 1.
+type stealingLocker struct {
+	connector.Locker
+	stolen int32
+}
+
+func (l *stealingLocker) Lock(ctx context.Context, key, owner string, ttl time.Duration) error {
+	if atomic.LoadInt32(&l.stolen) == 1 {
+		return connector.ErrLockHeld
+	}
+	return l.Locker.Lock(ctx, key, owner, ttl)
+}
+
+// node is an Elector started with a job, which reports its elections, demotions and the job runs.
+type node struct {
+	*leader.Elector
+	elected, demoted    chan struct{}
+	jobStarted, jobDone chan struct{}
+	cancel              context.CancelFunc
+	done                chan struct{}
+}
+
+func start(t *testing.T, l connector.Locker) *node {
+	t.Helper()
+	n := &node{
+		elected:    make(chan struct{}, 4),
+		demoted:    make(chan struct{}, 4),
+		jobStarted: make(chan struct{}, 4),
+		jobDone:    make(chan struct{}, 4),
+		done:       make(chan struct{}),
+	}
+	n.Elector = leader.New(
+		l, "reaper", leader.WithTTL(ttl),
+		leader.WithOnElected(func() { n.elected <- struct{}{} }),
+		leader.WithOnDemoted(func() { n.demoted <- struct{}{} }),
+	)
+	n.Go(
+		func(ctx context.Context) {
+			n.jobStarted <- struct{}{}
+			<-ctx.Done()
+			n.jobDone <- struct{}{}
+		},
+	)
+
+	var ctx context.Context
+	ctx, n.cancel = context.WithCancel(context.Background())
+	go func() {
+		_ = n.Start(ctx)
+		close(n.done)
+	}()
+	t.Cleanup(n.stop)
+	return n
+}
+
+// stop stops the campaigns and resigns the leadership if held.
+func (n *node) stop() {
+	n.cancel()
+	<-n.done
+	_ = n.Shutdown(context.Background())
+}
+
+// wait fails the test unless ch receives within a second.
+func wait(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatalf("%s never happens", what)
+	}
+}
+
+// never fails the test if ch receives within d.
+func never(t *testing.T, ch <-chan struct{}, d time.Duration, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+		t.Fatalf("%s happens", what)
+	case <-time.After(d):
+	}
+}
+
+func TestSingleLeaderAndTakeover(t *testing.T) {
+	locker := connector.NewMemoryLocker()
+	first := start(t, locker)
+	wait(t, first.elected, "the election of the first node")
+	wait(t, first.jobStarted, "the job of the first node")
+
+	second := start(t, locker)
+	never(t, second.elected, 3*ttl, "the election of the second node while the first leads")
+	if !first.IsLeader() || second.IsLeader() {
+		t.Fatalf("IsLeader() = %v and %v, want only the first node", first.IsLeader(), second.IsLeader())
+	}
+
+	first.stop()
+	wait(t, first.jobDone, "the cancel of the job of the resigned node")
+	wait(t, first.demoted, "the demotion of the resigned node")
+	wait(t, second.elected, "the takeover of the second node")
+	wait(t, second.jobStarted, "the job of the second node")
+	if first.IsLeader() || !second.IsLeader() {
+		t.Fatalf("IsLeader() = %v and %v, want only the second node", first.IsLeader(), second.IsLeader())
+	}
+}
+
+func TestLeadershipLost(t *testing.T) {
+	locker := &stealingLocker{Locker: connector.NewMemoryLocker()}
+	n := start(t, locker)
+	wait(t, n.elected, "the election")
+	wait(t, n.jobStarted, "the job")
+
+	atomic.StoreInt32(&locker.stolen, 1)
+	wait(t, n.demoted, "the demotion once the lock is taken")
+	wait(t, n.jobDone, "the cancel of the job once demoted")
+	if n.IsLeader() {
+		t.Fatal("IsLeader() = true after the lock is taken")
+	}
+	never(t, n.elected, 2*ttl, "the election while the lock is taken")
+
+	atomic.StoreInt32(&locker.stolen, 0)
+	wait(t, n.elected, "the election once the lock is free")
+	wait(t, n.jobStarted, "the restart of the job once elected again")
+}
+
+func TestGoWhileLeader(t *testing.T) {
+	n := start(t, connector.NewMemoryLocker())
+	wait(t, n.elected, "the election")
+
+	started := make(chan struct{}, 1)
+	n.Go(func(context.Context) { started <- struct{}{} })
+	wait(t, started, "the job added to the leader")
+}
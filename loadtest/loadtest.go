@@ -0,0 +1,325 @@
+// Package loadtest simulates many clients against a ppcserver connector and reports the round-trip latency
+// percentiles and resource usage, so that performance regressions are measurable.
+// Each simulated client sends request messages to a route which is expected to respond, such as an echo handler.
+package loadtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrNoClients = errors.New("ppcserver: load test requires at least one client")
+
+type (
+	// Config defines the load generated by Run.
+	Config struct {
+		// URL is the address of the server under test, such as "ws://localhost:8080/ws" or "tcp://localhost:9090".
+		URL string
+		// Clients is the number of simulated clients connected concurrently.
+		Clients int
+		// Rate is the number of messages sent per second by each client, zero sends the next message
+		// as soon as the previous response is received.
+		Rate float64
+		// PayloadSize is the size in bytes of the data of each message.
+		PayloadSize int
+		// Route is the route of the messages sent, the handler should respond to each message.
+		Route string
+		// Duration is the time to generate load, excluding the ramp-up.
+		Duration time.Duration
+		// RampUp spreads the initial connects of the clients evenly over the duration.
+		RampUp time.Duration
+		// Churn is the average lifetime of a connection, after which the client reconnects,
+		// zero keeps the connections until the end of the load test.
+		Churn time.Duration
+		// Timeout is the maximum time of connecting and of waiting for a response.
+		Timeout time.Duration
+	}
+
+	// Report is the result of Run.
+	Report struct {
+		Elapsed       time.Duration
+		Connects      uint64
+		ConnectErrors uint64
+		Sent          uint64
+		Received      uint64
+		// Errors is the number of responses with an error, and connections failed unexpectedly.
+		Errors uint64
+		// Timeouts is the number of messages without a response within Config.Timeout or before the connection closed.
+		Timeouts uint64
+
+		// Latency percentiles of the round-trip time between sending a message and receiving its response.
+		P50, P90, P99, P999, Max, Mean time.Duration
+
+		// Resource usage of the load test process, for comparing with the usage of the server under test.
+		NumGoroutine int
+		HeapAlloc    uint64
+		Sys          uint64
+		NumGC        uint32
+	}
+
+	// recorder collects the round-trip latencies of all the clients.
+	recorder struct {
+		mu        sync.Mutex
+		latencies []time.Duration
+	}
+
+	counters struct {
+		connects, connectErrors, sent, received, errors, timeouts uint64
+	}
+)
+
+// DefaultConfig returns the Config of 100 clients each sending 10 messages of 64 bytes per second to "echo" for 30s.
+func DefaultConfig() Config {
+	return Config{
+		URL:         "ws://localhost:8080/",
+		Clients:     100,
+		Rate:        10,
+		PayloadSize: 64,
+		Route:       "echo",
+		Duration:    30 * time.Second,
+		Timeout:     5 * time.Second,
+	}
+}
+
+// Run generates the load by cfg until cfg.Duration elapses or ctx is done, and returns the Report.
+func Run(ctx context.Context, cfg Config) (*Report, error) {
+	if cfg.Clients <= 0 {
+		return nil, ErrNoClients
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.RampUp+cfg.Duration)
+	defer cancel()
+
+	payload, err := json.Marshal(strings.Repeat("x", cfg.PayloadSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		wg  sync.WaitGroup
+		rec recorder
+		cnt counters
+	)
+	start := time.Now()
+	for i := 0; i < cfg.Clients; i++ {
+		wg.Add(1)
+		delay := time.Duration(0)
+		if cfg.RampUp > 0 {
+			delay = cfg.RampUp * time.Duration(i) / time.Duration(cfg.Clients)
+		}
+		go func() {
+			defer wg.Done()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			runClient(ctx, cfg, payload, &rec, &cnt)
+		}()
+	}
+	wg.Wait()
+
+	r := &Report{
+		Elapsed:       time.Since(start),
+		Connects:      atomic.LoadUint64(&cnt.connects),
+		ConnectErrors: atomic.LoadUint64(&cnt.connectErrors),
+		Sent:          atomic.LoadUint64(&cnt.sent),
+		Received:      atomic.LoadUint64(&cnt.received),
+		Errors:        atomic.LoadUint64(&cnt.errors),
+		Timeouts:      atomic.LoadUint64(&cnt.timeouts),
+	}
+	rec.percentiles(r)
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	r.NumGoroutine = runtime.NumGoroutine()
+	r.HeapAlloc, r.Sys, r.NumGC = ms.HeapAlloc, ms.Sys, ms.NumGC
+	return r, nil
+}
+
+// runClient keeps a simulated client connected, reconnecting by cfg.Churn, until ctx is done.
+func runClient(ctx context.Context, cfg Config, payload json.RawMessage, rec *recorder, cnt *counters) {
+	for ctx.Err() == nil {
+		c, err := dial(cfg.URL, cfg.Timeout)
+		if err != nil {
+			atomic.AddUint64(&cnt.connectErrors, 1)
+			select {
+			case <-ctx.Done():
+			case <-time.After(100 * time.Millisecond):
+			}
+			continue
+		}
+		atomic.AddUint64(&cnt.connects, 1)
+
+		connCtx, cancel := ctx, context.CancelFunc(func() {})
+		if cfg.Churn > 0 {
+			// Randomize the lifetime so that the reconnects of the clients do not synchronize.
+			lifetime := cfg.Churn/2 + time.Duration(rand.Int63n(int64(cfg.Churn)))
+			connCtx, cancel = context.WithTimeout(ctx, lifetime)
+		}
+		runConn(connCtx, cfg, c, payload, rec, cnt)
+		cancel()
+	}
+}
+
+// runConn sends the messages over c at cfg.Rate and records the latency of each response until ctx is done.
+func runConn(ctx context.Context, cfg Config, c conn, payload json.RawMessage, rec *recorder, cnt *counters) {
+	type request struct {
+		ID    uint64          `json:"id"`
+		Route string          `json:"route"`
+		Data  json.RawMessage `json:"data"`
+	}
+	type response struct {
+		ID    uint64 `json:"id"`
+		Error string `json:"error"`
+	}
+
+	var (
+		mu      sync.Mutex
+		pending = make(map[uint64]time.Time)
+		nextID  uint64
+		readyCh = make(chan struct{}, 1) // readyCh signals a response for the closed-loop mode of zero Rate.
+		readErr = make(chan error, 1)
+	)
+	go func() {
+		for {
+			b, err := c.read()
+			if err != nil {
+				readErr <- err
+				return
+			}
+			var resp response
+			if err := json.Unmarshal(b, &resp); err != nil || resp.ID == 0 {
+				continue // Ignore the pushes.
+			}
+			mu.Lock()
+			sentAt, ok := pending[resp.ID]
+			delete(pending, resp.ID)
+			mu.Unlock()
+			if !ok {
+				continue
+			}
+			atomic.AddUint64(&cnt.received, 1)
+			if resp.Error != "" {
+				atomic.AddUint64(&cnt.errors, 1)
+			}
+			rec.record(time.Since(sentAt))
+			if cfg.Rate <= 0 {
+				select {
+				case readyCh <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	var tick <-chan time.Time
+	if cfg.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / cfg.Rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	} else {
+		readyCh <- struct{}{}
+	}
+	timeoutTicker := time.NewTicker(cfg.Timeout / 2)
+	defer timeoutTicker.Stop()
+
+	defer func() {
+		_ = c.close()
+		mu.Lock()
+		atomic.AddUint64(&cnt.timeouts, uint64(len(pending)))
+		mu.Unlock()
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-readErr:
+			if !errors.Is(err, io.EOF) {
+				atomic.AddUint64(&cnt.errors, 1)
+			}
+			return
+		case <-timeoutTicker.C:
+			now := time.Now()
+			mu.Lock()
+			for id, sentAt := range pending {
+				if now.Sub(sentAt) > cfg.Timeout {
+					delete(pending, id)
+					atomic.AddUint64(&cnt.timeouts, 1)
+				}
+			}
+			mu.Unlock()
+			continue
+		case <-tick:
+		case <-readyCh:
+		}
+
+		nextID++
+		b, err := json.Marshal(request{ID: nextID, Route: cfg.Route, Data: payload})
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		pending[nextID] = time.Now()
+		mu.Unlock()
+		if err := c.write(b); err != nil {
+			atomic.AddUint64(&cnt.errors, 1)
+			return
+		}
+		atomic.AddUint64(&cnt.sent, 1)
+	}
+}
+
+func (r *recorder) record(d time.Duration) {
+	r.mu.Lock()
+	r.latencies = append(r.latencies, d)
+	r.mu.Unlock()
+}
+
+// percentiles fills the latency fields of report.
+func (r *recorder) percentiles(report *Report) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := len(r.latencies)
+	if n == 0 {
+		return
+	}
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	at := func(q float64) time.Duration {
+		return r.latencies[int(q*float64(n-1))]
+	}
+	var sum time.Duration
+	for _, d := range r.latencies {
+		sum += d
+	}
+	report.P50, report.P90, report.P99, report.P999 = at(.5), at(.9), at(.99), at(.999)
+	report.Max, report.Mean = r.latencies[n-1], sum/time.Duration(n)
+}
+
+// String formats the Report for printing.
+func (r *Report) String() string {
+	var b strings.Builder
+	secs := r.Elapsed.Seconds()
+	fmt.Fprintf(&b, "elapsed:     %v\n", r.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(&b, "connects:    %d (errors %d)\n", r.Connects, r.ConnectErrors)
+	fmt.Fprintf(&b, "messages:    sent %d, received %d (%.0f/s), errors %d, timeouts %d\n",
+		r.Sent, r.Received, float64(r.Received)/secs, r.Errors, r.Timeouts)
+	fmt.Fprintf(&b, "latency:     p50 %v, p90 %v, p99 %v, p99.9 %v, max %v, mean %v\n",
+		r.P50, r.P90, r.P99, r.P999, r.Max, r.Mean)
+	fmt.Fprintf(&b, "resources:   goroutines %d, heap %d KB, sys %d KB, gc %d\n",
+		r.NumGoroutine, r.HeapAlloc>>10, r.Sys>>10, r.NumGC)
+	return b.String()
+}
@@ -0,0 +1,306 @@
+// Package lockstep provides a Relay for the lockstep frame sync of a Room, which collects the input of each member
+// for a frame, seals the frame on its deadline, and broadcasts the combined frame for every member to simulate
+// the same game deterministically, which runs as a ppcserver Component.
+package lockstep
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/clock"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// RouteInput is the route of the request to submit the input of the member for a frame.
+	RouteInput = "lockstep.input"
+	// RouteFrames is the route of the request to fetch the sealed frames, for a member catching up after a rejoin.
+	RouteFrames = "lockstep.frames"
+	// RouteFrame is the route of the one-way Message broadcast to the members with each sealed Frame.
+	RouteFrame = "lockstep.frame"
+)
+
+var (
+	ErrNotMember     = errors.New("ppcserver: client is not a member of the lockstep room")
+	ErrFrameTooAhead = errors.New("ppcserver: input frame is too far ahead of the current frame")
+	ErrFrameExpired  = errors.New("ppcserver: frame is no longer in the history")
+)
+
+type (
+	// Option is a function to apply various configurations to customize a Relay.
+	Option func(o *Options)
+
+	// Options hold the configurable parts of a Relay.
+	Options struct {
+		// FrameRate is the number of frames sealed per second.
+		// Default is 15 if not set via WithFrameRate.
+		FrameRate int
+
+		// MaxAhead is the number of the frames ahead of the current one a member may submit its input for,
+		// the inputs further ahead are rejected with ErrFrameTooAhead.
+		// Default is 8 if not set via WithMaxAhead.
+		MaxAhead uint64
+
+		// HistorySize is the number of the latest sealed frames kept for RouteFrames, 0 disables RouteFrames.
+		// Default is 300 if not set via WithHistorySize.
+		HistorySize int
+
+		// Logger is the Logger for the failures of the broadcasts.
+		// Default is logging.Default() if not set via WithLogger.
+		Logger logging.Logger
+
+		// Clock is the time source of the frame deadlines, such as a clock.Fake in tests.
+		// Default is clock.Real() if not set via WithClock.
+		Clock clock.Clock
+	}
+
+	// InputRequest is the data of the RouteInput request.
+	InputRequest struct {
+		Frame uint64          `json:"frame"`
+		Data  json.RawMessage `json:"data"`
+	}
+
+	// InputResponse is the data of the RouteInput response, with the frame the input is actually put in,
+	// which is the current frame for an input arriving after its frame is sealed.
+	InputResponse struct {
+		Frame uint64 `json:"frame"`
+	}
+
+	// FramesRequest is the data of the RouteFrames request, for the sealed frames from From on.
+	FramesRequest struct {
+		From uint64 `json:"from"`
+	}
+
+	// Input is the input of a member in a Frame, identified by the UID of the Client.
+	Input struct {
+		UID  string          `json:"uid"`
+		Data json.RawMessage `json:"data"`
+	}
+
+	// Frame is the data of the RouteFrame message, with the inputs of the members sorted by UID.
+	// A member without input for the frame is absent, and the members apply the frames in the order of N.
+	Frame struct {
+		N      uint64  `json:"n"`
+		Inputs []Input `json:"inputs"`
+	}
+
+	// Relay seals and broadcasts the frames of the inputs of the members of a Room at a fixed rate.
+	Relay struct {
+		opts    *Options
+		room    *connector.Room
+		mu      sync.Mutex // mu guards frame, pending and history.
+		frame   uint64     // frame is the current frame collecting the inputs.
+		pending map[uint64]map[string]json.RawMessage
+		history []Frame
+	}
+)
+
+// New creates a new Relay for the room, which should be registered to the Server by ppcserver.WithComponent,
+// or started along with the Room. Its routes are handled once registered by Relay.Register.
+func New(room *connector.Room, opts ...Option) *Relay {
+	r := &Relay{
+		opts: &Options{
+			FrameRate:   15,
+			MaxAhead:    8,
+			HistorySize: 300,
+			Logger:      logging.Default(),
+			Clock:       clock.Real(),
+		},
+		room:    room,
+		frame:   1,
+		pending: make(map[uint64]map[string]json.RawMessage),
+	}
+
+	// Apply opts to customize Relay.
+	for _, opt := range opts {
+		opt(r.opts)
+	}
+
+	return r
+}
+
+// WithFrameRate is an Option to set the number of frames sealed per second.
+func WithFrameRate(n int) Option {
+	return func(o *Options) {
+		o.FrameRate = n
+	}
+}
+
+// WithMaxAhead is an Option to set the number of the frames ahead a member may submit its input for.
+func WithMaxAhead(n uint64) Option {
+	return func(o *Options) {
+		o.MaxAhead = n
+	}
+}
+
+// WithHistorySize is an Option to set the number of the latest sealed frames kept for RouteFrames.
+func WithHistorySize(n int) Option {
+	return func(o *Options) {
+		o.HistorySize = n
+	}
+}
+
+// WithLogger is an Option to set the Logger, such as an adapter over zap or slog.
+func WithLogger(l logging.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
+
+// WithClock is an Option to set the time source of the frame deadlines, such as a clock.Fake in tests.
+func WithClock(c clock.Clock) Option {
+	return func(o *Options) {
+		o.Clock = c
+	}
+}
+
+// Register registers the handlers of RouteInput and RouteFrames of the Relay to the Router.
+func (r *Relay) Register(router *connector.Router) {
+	router.Handle(RouteInput, r.handleInput)
+	router.Handle(RouteFrames, r.handleFrames)
+}
+
+func (r *Relay) handleInput(_ context.Context, c *connector.Client, m *connector.Message) (interface{}, error) {
+	var req InputRequest
+	if err := c.Protocol().Codec.Unmarshal(m.Data, &req); err != nil {
+		return nil, err
+	}
+	n, err := r.Submit(c, req.Frame, req.Data)
+	if err != nil {
+		return nil, err
+	}
+	return InputResponse{Frame: n}, nil
+}
+
+func (r *Relay) handleFrames(_ context.Context, c *connector.Client, m *connector.Message) (interface{}, error) {
+	var req FramesRequest
+	if len(m.Data) > 0 {
+		if err := c.Protocol().Codec.Unmarshal(m.Data, &req); err != nil {
+			return nil, err
+		}
+	}
+	if !r.isMember(c) {
+		return nil, ErrNotMember
+	}
+	return r.Frames(req.From)
+}
+
+// Submit puts the input of the member for the frame, replacing its previous input for the same frame, and returns
+// the frame the input is put in. An input for a sealed frame is put in the current frame instead,
+// so that a late input is delayed rather than lost.
+func (r *Relay) Submit(c *connector.Client, frame uint64, data json.RawMessage) (uint64, error) {
+	if !r.isMember(c) {
+		return 0, ErrNotMember
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if frame < r.frame {
+		frame = r.frame
+	}
+	if frame-r.frame > r.opts.MaxAhead {
+		return 0, ErrFrameTooAhead
+	}
+	inputs, ok := r.pending[frame]
+	if !ok {
+		inputs = make(map[string]json.RawMessage)
+		r.pending[frame] = inputs
+	}
+	// Copy the data, as the received messages are reused once handled.
+	inputs[c.UID()] = append(json.RawMessage(nil), data...)
+	return frame, nil
+}
+
+// Frames returns the sealed frames from the frame on, ErrFrameExpired if the frame is no longer in the history.
+func (r *Relay) Frames(from uint64) ([]Frame, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if from == 0 {
+		from = 1
+	}
+	if from >= r.frame {
+		return nil, nil
+	}
+	if len(r.history) == 0 || from < r.history[0].N {
+		return nil, ErrFrameExpired
+	}
+	i := from - r.history[0].N
+	return append([]Frame(nil), r.history[i:]...), nil
+}
+
+// Current returns the number of the frame collecting the inputs.
+func (r *Relay) Current() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.frame
+}
+
+func (r *Relay) isMember(c *connector.Client) bool {
+	for _, room := range c.Rooms() {
+		if room == r.room {
+			return true
+		}
+	}
+	return false
+}
+
+// Start seals and broadcasts a frame on every deadline, and blocks until ctx is done or the Room is closed.
+// A frame is sealed even without any input, so that the members advance in lockstep.
+func (r *Relay) Start(ctx context.Context) error {
+	interval := time.Second / time.Duration(r.opts.FrameRate)
+	// The timer signals instead of a channel timer, so that it works the same on any clock.Clock.
+	fired := make(chan struct{}, 1)
+	timer := r.opts.Clock.AfterFunc(
+		interval, func() {
+			select {
+			case fired <- struct{}{}:
+			default:
+			}
+		},
+	)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-fired:
+		}
+		if err := r.seal(); err == connector.ErrRoomClosed {
+			return nil
+		} else if err != nil {
+			r.opts.Logger.Warn("Relay broadcast frame error", logging.F("room", r.room.Name()), logging.Err(err))
+		}
+		timer.Reset(interval)
+	}
+}
+
+// Shutdown does nothing, as the members are closed along with the connectors.
+func (r *Relay) Shutdown(_ context.Context) error {
+	return nil
+}
+
+// seal seals the current frame, broadcasts it and moves on to the next frame.
+func (r *Relay) seal() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := Frame{N: r.frame, Inputs: make([]Input, 0, len(r.pending[r.frame]))}
+	for uid, data := range r.pending[r.frame] {
+		f.Inputs = append(f.Inputs, Input{UID: uid, Data: data})
+	}
+	sort.Slice(f.Inputs, func(i, j int) bool { return f.Inputs[i].UID < f.Inputs[j].UID })
+	delete(r.pending, r.frame)
+	r.frame++
+
+	if r.opts.HistorySize > 0 {
+		if len(r.history) >= r.opts.HistorySize {
+			r.history = append(r.history[:0], r.history[len(r.history)-r.opts.HistorySize+1:]...)
+		}
+		r.history = append(r.history, f)
+	}
+	// Broadcast under mu, so that the frames are broadcast in the order of N.
+	return r.room.Broadcast(RouteFrame, f)
+}
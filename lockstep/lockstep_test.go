@@ -0,0 +1,264 @@
+package lockstep_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pom-pom-crafts/ppcserver/clock"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/lockstep"
+	"github.com/pom-pom-crafts/ppcserver/transporttest"
+	"testing"
+	"time"
+)
+
+const interval = time.Second / 10
+
+// member is a peer authorized as its uid.
+type member struct {
+	t    *testing.T
+	peer *transporttest.Peer
+	id   uint64
+}
+
+// setup starts a Relay of 10 frames per second on a fake clock for a new Room, and returns the options of
+// the peers, which are authorized by their tokens as the uids and join the Room by the "join" request.
+func setup(t *testing.T, name string, opts ...lockstep.Option) (*clock.Fake, *lockstep.Relay, *connector.Options) {
+	t.Helper()
+	room, err := connector.CreateRoom(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(room.Close)
+
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	relay := lockstep.New(
+		room, append([]lockstep.Option{lockstep.WithFrameRate(10), lockstep.WithClock(clk)}, opts...)...,
+	)
+	router := connector.NewRouter()
+	router.Handle(
+		"join", func(_ context.Context, c *connector.Client, _ *connector.Message) (interface{}, error) {
+			return nil, room.Join(c)
+		},
+	)
+	relay.Register(router)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() {
+		_ = relay.Start(ctx)
+	}()
+	return clk, relay, connector.NewOptions(
+		connector.WithRouter(router),
+		connector.WithAuthenticator(
+			func(_ context.Context, c *connector.Client, m *connector.Message) (string, error) {
+				var uid string
+				err := c.Protocol().Codec.Unmarshal(m.Data, &uid)
+				return uid, err
+			},
+		),
+	)
+}
+
+// join connects a peer authorized as the uid, and joins it to the Room unless it's an outsider.
+func join(t *testing.T, opts *connector.Options, uid string, outsider bool) *member {
+	t.Helper()
+	peer, _ := transporttest.Serve(context.Background(), opts)
+	t.Cleanup(func() { _ = peer.Close() })
+	m := &member{t: t, peer: peer}
+	if resp := m.call(connector.RouteAuth, uid); resp.Error != "" {
+		t.Fatalf("auth error = %q", resp.Error)
+	}
+	if !outsider {
+		if resp := m.call("join", nil); resp.Error != "" {
+			t.Fatalf("join error = %q", resp.Error)
+		}
+	}
+	return m
+}
+
+// call sends the request with v as its data and returns its response, skipping the pushes.
+func (m *member) call(route string, v interface{}) *connector.Message {
+	m.t.Helper()
+	m.id++
+	data, _ := json.Marshal(v)
+	if err := m.peer.SendMessage(&connector.Message{ID: m.id, Route: route, Data: data}); err != nil {
+		m.t.Fatal(err)
+	}
+	for {
+		resp := m.receive()
+		if resp.ID == m.id {
+			return resp
+		}
+	}
+}
+
+func (m *member) receive() *connector.Message {
+	m.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := m.peer.ReceiveMessage(ctx)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	return resp
+}
+
+// submit submits the input for the frame and returns the frame the input is put in.
+func (m *member) submit(frame uint64, input string) uint64 {
+	m.t.Helper()
+	resp := m.call(lockstep.RouteInput, lockstep.InputRequest{Frame: frame, Data: json.RawMessage(`"` + input + `"`)})
+	var ir lockstep.InputResponse
+	if err := json.Unmarshal(resp.Data, &ir); err != nil || resp.Error != "" {
+		m.t.Fatalf("input response = %+v, %v", resp, err)
+	}
+	return ir.Frame
+}
+
+// frame returns the next Frame broadcast to the member.
+func (m *member) frame() lockstep.Frame {
+	m.t.Helper()
+	for {
+		if msg := m.receive(); msg.Route == lockstep.RouteFrame {
+			var f lockstep.Frame
+			if err := json.Unmarshal(msg.Data, &f); err != nil {
+				m.t.Fatal(err)
+			}
+			return f
+		}
+	}
+}
+
+// seal advances clk by a frame once the Relay is waiting for its deadline.
+func seal(t *testing.T, clk *clock.Fake) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for clk.Len() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the Relay never waits for the next frame")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(interval)
+}
+
+// inputs formats the inputs of the Frame as "uid=data" for comparison.
+func inputs(f lockstep.Frame) []string {
+	s := make([]string, 0, len(f.Inputs))
+	for _, in := range f.Inputs {
+		s = append(s, in.UID+"="+string(in.Data))
+	}
+	return s
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFrameAssembly(t *testing.T) {
+	clk, relay, opts := setup(t, "lockstep-assembly")
+	bob := join(t, opts, "bob", false)
+	alice := join(t, opts, "alice", false)
+
+	// The inputs are put in the frames ahead by the input delay of each member, the last input of a frame wins.
+	for _, in := range []struct {
+		m     *member
+		frame uint64
+		data  string
+	}{
+		{bob, 1, "b1"}, {alice, 2, "a2"}, {alice, 1, "a1"}, {alice, 1, "a1'"}, {bob, 3, "b3"},
+	} {
+		if n := in.m.submit(in.frame, in.data); n != in.frame {
+			t.Fatalf("input %s is put in frame %d, want %d", in.data, n, in.frame)
+		}
+	}
+
+	for _, want := range []struct {
+		n      uint64
+		inputs []string
+	}{
+		{1, []string{`alice="a1'"`, `bob="b1"`}},
+		{2, []string{`alice="a2"`}},
+		{3, []string{`bob="b3"`}},
+		{4, []string{}},
+	} {
+		seal(t, clk)
+		for _, m := range []*member{alice, bob} {
+			if f := m.frame(); f.N != want.n || !equal(inputs(f), want.inputs) {
+				t.Fatalf("frame = %d %v, want %d %v", f.N, inputs(f), want.n, want.inputs)
+			}
+		}
+	}
+	if n := relay.Current(); n != 5 {
+		t.Fatalf("Current() = %d, want 5", n)
+	}
+}
+
+func TestLateAndAheadInputs(t *testing.T) {
+	clk, _, opts := setup(t, "lockstep-late", lockstep.WithMaxAhead(2))
+	alice := join(t, opts, "alice", false)
+	seal(t, clk)
+	alice.frame()
+
+	// An input for a sealed frame is delayed to the current frame instead of lost.
+	if n := alice.submit(1, "late"); n != 2 {
+		t.Fatalf("late input is put in frame %d, want 2", n)
+	}
+	if n := alice.submit(4, "ahead"); n != 4 {
+		t.Fatalf("input within MaxAhead is put in frame %d, want 4", n)
+	}
+	resp := alice.call(lockstep.RouteInput, lockstep.InputRequest{Frame: 5, Data: json.RawMessage(`"far"`)})
+	if resp.Error != lockstep.ErrFrameTooAhead.Error() {
+		t.Fatalf("error beyond MaxAhead = %q, want %q", resp.Error, lockstep.ErrFrameTooAhead)
+	}
+	seal(t, clk)
+	if f := alice.frame(); f.N != 2 || !equal(inputs(f), []string{`alice="late"`}) {
+		t.Fatalf("frame = %d %v, want 2 [alice=\"late\"]", f.N, inputs(f))
+	}
+}
+
+func TestNotMember(t *testing.T) {
+	_, _, opts := setup(t, "lockstep-outsider")
+	mallory := join(t, opts, "mallory", true)
+	resp := mallory.call(lockstep.RouteInput, lockstep.InputRequest{Frame: 1, Data: json.RawMessage(`"x"`)})
+	if resp.Error != lockstep.ErrNotMember.Error() {
+		t.Fatalf("input error of an outsider = %q, want %q", resp.Error, lockstep.ErrNotMember)
+	}
+	if resp := mallory.call(lockstep.RouteFrames, lockstep.FramesRequest{}); resp.Error != lockstep.ErrNotMember.Error() {
+		t.Fatalf("frames error of an outsider = %q, want %q", resp.Error, lockstep.ErrNotMember)
+	}
+}
+
+func TestFramesHistory(t *testing.T) {
+	clk, relay, opts := setup(t, "lockstep-history", lockstep.WithHistorySize(2))
+	alice := join(t, opts, "alice", false)
+	for n := uint64(1); n <= 3; n++ {
+		alice.submit(n, "a")
+		seal(t, clk)
+		alice.frame()
+	}
+
+	frames, err := relay.Frames(2)
+	if err != nil || len(frames) != 2 || frames[0].N != 2 || frames[1].N != 3 {
+		t.Fatalf("Frames(2) = %+v, %v, want frames 2 and 3", frames, err)
+	}
+	if frames, err := relay.Frames(4); err != nil || len(frames) != 0 {
+		t.Fatalf("Frames(4) = %+v, %v, want none", frames, err)
+	}
+	if _, err := relay.Frames(1); err != lockstep.ErrFrameExpired {
+		t.Fatalf("Frames(1) error = %v, want ErrFrameExpired", err)
+	}
+
+	resp := alice.call(lockstep.RouteFrames, lockstep.FramesRequest{From: 3})
+	var fetched []lockstep.Frame
+	if err := json.Unmarshal(resp.Data, &fetched); err != nil || len(fetched) != 1 || fetched[0].N != 3 {
+		t.Fatalf("frames response = %+v, %v, want frame 3", resp, err)
+	}
+}
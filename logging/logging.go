@@ -0,0 +1,171 @@
+// Package logging defines the structured Logger used across ppcserver,
+// with a default implementation over the standard library log package.
+// Adapt zap, slog, or any other structured logging library by implementing the Logger interface.
+package logging
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+type (
+	// Level is the severity of a log entry.
+	Level int32
+
+	// Field is a key-value pair attached to a log entry.
+	Field struct {
+		Key   string
+		Value interface{}
+	}
+
+	// Logger is a leveled, structured logger.
+	Logger interface {
+		Debug(msg string, fields ...Field)
+		Info(msg string, fields ...Field)
+		Warn(msg string, fields ...Field)
+		Error(msg string, fields ...Field)
+		// With returns a Logger that attaches the fields to every log entry.
+		With(fields ...Field) Logger
+	}
+
+	// LevelController is optionally implemented by a Logger whose minimum Level can be changed at runtime.
+	LevelController interface {
+		Level() Level
+		SetLevel(level Level)
+	}
+
+	// StdLogger is the default Logger that writes through a standard library *log.Logger.
+	StdLogger struct {
+		logger *log.Logger
+		level  *int32 // level is shared with the Loggers derived by With, accessed atomically.
+		fields []Field
+	}
+)
+
+// String returns the upper-case name of the Level.
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("LEVEL(%d)", l)
+	}
+}
+
+// ParseLevel parses the case-insensitive name of a Level, such as "debug" or "INFO".
+func ParseLevel(s string) (Level, error) {
+	for l := LevelDebug; l <= LevelError; l++ {
+		if strings.EqualFold(s, l.String()) {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("ppcserver: unknown log level: %q", s)
+}
+
+// F creates a Field.
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err creates a Field with "error" as the key.
+func Err(err error) Field {
+	return Field{Key: "error", Value: err}
+}
+
+// NewStdLogger creates a StdLogger that writes entries at or above level to l.
+// A nil l defaults to a *log.Logger writing to os.Stderr with the standard flags.
+func NewStdLogger(l *log.Logger, level Level) *StdLogger {
+	if l == nil {
+		l = log.New(os.Stderr, "", log.LstdFlags)
+	}
+	lv := int32(level)
+	return &StdLogger{
+		logger: l,
+		level:  &lv,
+	}
+}
+
+// defaultLogger is shared by all the components that are not set with a custom Logger,
+// so changing its Level applies to all of them.
+var defaultLogger = NewStdLogger(nil, LevelInfo)
+
+// Default returns the shared StdLogger writing entries at or above LevelInfo to os.Stderr.
+func Default() *StdLogger {
+	return defaultLogger
+}
+
+// SetLevel changes the minimum Level of the StdLogger and all the Loggers derived from it.
+func (l *StdLogger) SetLevel(level Level) {
+	atomic.StoreInt32(l.level, int32(level))
+}
+
+// Level returns the minimum Level of the StdLogger.
+func (l *StdLogger) Level() Level {
+	return Level(atomic.LoadInt32(l.level))
+}
+
+func (l *StdLogger) Debug(msg string, fields ...Field) { l.log(LevelDebug, msg, fields) }
+func (l *StdLogger) Info(msg string, fields ...Field)  { l.log(LevelInfo, msg, fields) }
+func (l *StdLogger) Warn(msg string, fields ...Field)  { l.log(LevelWarn, msg, fields) }
+func (l *StdLogger) Error(msg string, fields ...Field) { l.log(LevelError, msg, fields) }
+
+// With returns a StdLogger that attaches the fields to every log entry, sharing the Level with l.
+func (l *StdLogger) With(fields ...Field) Logger {
+	merged := make([]Field, 0, len(l.fields)+len(fields))
+	merged = append(merged, l.fields...)
+	merged = append(merged, fields...)
+	return &StdLogger{
+		logger: l.logger,
+		level:  l.level,
+		fields: merged,
+	}
+}
+
+// log formats the entry as "ppcserver: [LEVEL] msg key=value ..." and writes it.
+func (l *StdLogger) log(level Level, msg string, fields []Field) {
+	if level < l.Level() {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("ppcserver: [")
+	b.WriteString(level.String())
+	b.WriteString("] ")
+	b.WriteString(msg)
+	for _, fs := range [][]Field{l.fields, fields} {
+		for _, f := range fs {
+			fmt.Fprintf(&b, " %s=%v", f.Key, f.Value)
+		}
+	}
+	_ = l.logger.Output(3, b.String())
+}
+
+// Nop returns a Logger that discards all log entries.
+func Nop() Logger {
+	return nopLogger{}
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...Field) {}
+func (nopLogger) Info(string, ...Field)  {}
+func (nopLogger) Warn(string, ...Field)  {}
+func (nopLogger) Error(string, ...Field) {}
+func (n nopLogger) With(...Field) Logger { return n }
+func (nopLogger) Enabled(Level) bool     { return false }
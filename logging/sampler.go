@@ -0,0 +1,138 @@
+package logging
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// LevelEnabler is optionally implemented by a Logger to report whether the entries at a Level are written,
+	// so that the callers on the hot paths skip building the fields of the discarded entries.
+	LevelEnabler interface {
+		Enabled(level Level) bool
+	}
+
+	// sampledLogger is a Logger writing a sample of the entries with the same level and message per tick.
+	sampledLogger struct {
+		Logger
+		s *sampler
+	}
+
+	// sampler counts the entries per level and message, shared by the Loggers derived by With.
+	sampler struct {
+		tick       time.Duration
+		first      uint64
+		thereafter uint64
+		mu         sync.Mutex // mu guards counts and resetAt.
+		counts     map[samplerKey]uint64
+		resetAt    time.Time
+	}
+
+	samplerKey struct {
+		level Level
+		msg   string
+	}
+)
+
+// Enabled reports whether the entries at the level are written by l, which is true if l doesn't implement
+// LevelEnabler or LevelController.
+func Enabled(l Logger, level Level) bool {
+	switch l := l.(type) {
+	case LevelEnabler:
+		return l.Enabled(level)
+	case LevelController:
+		return level >= l.Level()
+	}
+	return true
+}
+
+// Enabled reports whether the entries at the level are written.
+func (l *StdLogger) Enabled(level Level) bool {
+	return level >= l.Level()
+}
+
+// NewSampledLogger creates a Logger that writes the first entries with the same level and message per tick
+// through l, and then every thereafter-th entry, such as for the per-message logs on the hot paths.
+// A zero thereafter drops all the entries beyond the first ones, which limits the rate of the entries.
+// The entries at LevelError are never dropped. The Loggers derived by With share the counts.
+func NewSampledLogger(l Logger, tick time.Duration, first, thereafter int) Logger {
+	if first < 0 {
+		first = 0
+	}
+	if thereafter < 0 {
+		thereafter = 0
+	}
+	return sampledLogger{
+		Logger: l,
+		s: &sampler{
+			tick:       tick,
+			first:      uint64(first),
+			thereafter: uint64(thereafter),
+			counts:     make(map[samplerKey]uint64),
+		},
+	}
+}
+
+// sample reports whether the entry with the level and message is written.
+func (s *sampler) sample(level Level, msg string) bool {
+	if level >= LevelError {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now := time.Now(); now.After(s.resetAt) {
+		for k := range s.counts {
+			delete(s.counts, k)
+		}
+		s.resetAt = now.Add(s.tick)
+	}
+	k := samplerKey{level: level, msg: msg}
+	n := s.counts[k] + 1
+	s.counts[k] = n
+	if n <= s.first {
+		return true
+	}
+	return s.thereafter > 0 && (n-s.first)%s.thereafter == 0
+}
+
+func (l sampledLogger) Debug(msg string, fields ...Field) {
+	if l.s.sample(LevelDebug, msg) {
+		l.Logger.Debug(msg, fields...)
+	}
+}
+
+func (l sampledLogger) Info(msg string, fields ...Field) {
+	if l.s.sample(LevelInfo, msg) {
+		l.Logger.Info(msg, fields...)
+	}
+}
+
+func (l sampledLogger) Warn(msg string, fields ...Field) {
+	if l.s.sample(LevelWarn, msg) {
+		l.Logger.Warn(msg, fields...)
+	}
+}
+
+func (l sampledLogger) With(fields ...Field) Logger {
+	return sampledLogger{Logger: l.Logger.With(fields...), s: l.s}
+}
+
+func (l sampledLogger) Enabled(level Level) bool {
+	return Enabled(l.Logger, level)
+}
+
+// Level returns the minimum Level of the underlying Logger, LevelDebug if it doesn't implement LevelController.
+func (l sampledLogger) Level() Level {
+	if lc, ok := l.Logger.(LevelController); ok {
+		return lc.Level()
+	}
+	return LevelDebug
+}
+
+// SetLevel changes the minimum Level of the underlying Logger if it implements LevelController.
+func (l sampledLogger) SetLevel(level Level) {
+	if lc, ok := l.Logger.(LevelController); ok {
+		lc.SetLevel(level)
+	}
+}
@@ -0,0 +1,98 @@
+package matchmaking
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// NewGroupMatcher returns a Matcher grouping the tickets with the same values of the criteria keys into matches
+// of size, in the order they are queued. All the criteria must be the same if no keys are given.
+func NewGroupMatcher(size int, keys ...string) Matcher {
+	return func(tickets []*Ticket, _ time.Time) [][]*Ticket {
+		pending := make(map[string][]*Ticket)
+		var groups [][]*Ticket
+		for _, t := range tickets {
+			k := criteriaKey(t.Criteria, keys)
+			g := append(pending[k], t)
+			if len(g) < size {
+				pending[k] = g
+				continue
+			}
+			groups = append(groups, g)
+			delete(pending, k)
+		}
+		return groups
+	}
+}
+
+// NewRatingMatcher returns a Matcher grouping the tickets with the same values of the criteria keys into matches
+// of size, whose ratings differ by at most window. The window of a ticket widens by widen per second queued,
+// so that a player of an uncommon rating is eventually matched.
+func NewRatingMatcher(size, window int, widen float64, keys ...string) Matcher {
+	return func(tickets []*Ticket, at time.Time) [][]*Ticket {
+		pools := make(map[string][]*Ticket)
+		for _, t := range tickets {
+			k := criteriaKey(t.Criteria, keys)
+			pools[k] = append(pools[k], t)
+		}
+
+		var groups [][]*Ticket
+		for _, pool := range pools {
+			// The oldest ticket anchors each group, and takes the closest ratings within its window.
+			matched := make(map[*Ticket]bool)
+			for _, anchor := range pool {
+				if matched[anchor] {
+					continue
+				}
+				limit := float64(window) + widen*at.Sub(anchor.EnqueuedAt).Seconds()
+				var candidates []*Ticket
+				for _, t := range pool {
+					if t != anchor && !matched[t] && float64(abs(t.Rating-anchor.Rating)) <= limit {
+						candidates = append(candidates, t)
+					}
+				}
+				if len(candidates) < size-1 {
+					continue
+				}
+				sort.SliceStable(
+					candidates, func(i, j int) bool {
+						return abs(candidates[i].Rating-anchor.Rating) < abs(candidates[j].Rating-anchor.Rating)
+					},
+				)
+				g := append([]*Ticket{anchor}, candidates[:size-1]...)
+				for _, t := range g {
+					matched[t] = true
+				}
+				groups = append(groups, g)
+			}
+		}
+		return groups
+	}
+}
+
+// criteriaKey returns the values of the keys in the criteria joined, or all the criteria sorted if no keys.
+func criteriaKey(criteria map[string]string, keys []string) string {
+	if len(keys) == 0 {
+		keys = make([]string, 0, len(criteria))
+		for k := range criteria {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+	}
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(criteria[k])
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
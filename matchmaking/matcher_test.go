@@ -0,0 +1,93 @@
+package matchmaking
+
+import (
+	"testing"
+	"time"
+)
+
+// queue returns the tickets enqueued a second apart before at, with the ratings and the criteria.
+func queue(at time.Time, tickets ...Ticket) []*Ticket {
+	q := make([]*Ticket, len(tickets))
+	for i := range tickets {
+		t := tickets[i]
+		t.EnqueuedAt = at.Add(time.Duration(i-len(tickets)) * time.Second)
+		q[i] = &t
+	}
+	return q
+}
+
+// ids returns the IDs of the tickets of each group.
+func ids(groups [][]*Ticket) [][]string {
+	s := make([][]string, 0, len(groups))
+	for _, g := range groups {
+		var group []string
+		for _, t := range g {
+			group = append(group, t.ID)
+		}
+		s = append(s, group)
+	}
+	return s
+}
+
+func equalIDs(a, b [][]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for j := range a[i] {
+			if a[i][j] != b[i][j] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestGroupMatcher(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	ranked := map[string]string{"mode": "ranked", "region": "eu"}
+	rankedUS := map[string]string{"mode": "ranked", "region": "us"}
+	casual := map[string]string{"mode": "casual", "region": "eu"}
+	tickets := queue(
+		at,
+		Ticket{ID: "a", Criteria: ranked}, Ticket{ID: "b", Criteria: casual}, Ticket{ID: "c", Criteria: rankedUS},
+		Ticket{ID: "d", Criteria: ranked}, Ticket{ID: "e", Criteria: ranked}, Ticket{ID: "f", Criteria: casual},
+	)
+
+	for _, tt := range []struct {
+		name     string
+		matcher  Matcher
+		expected [][]string
+	}{
+		{"all criteria", NewGroupMatcher(2), [][]string{{"a", "d"}, {"b", "f"}}},
+		{"by mode", NewGroupMatcher(2, "mode"), [][]string{{"a", "c"}, {"d", "e"}, {"b", "f"}}},
+		{"groups of 3", NewGroupMatcher(3, "mode"), [][]string{{"a", "c", "d"}}},
+	} {
+		if groups := ids(tt.matcher(tickets, at)); !equalIDs(groups, tt.expected) {
+			t.Errorf("%s: groups = %v, want %v", tt.name, groups, tt.expected)
+		}
+	}
+}
+
+func TestRatingMatcher(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	tickets := queue(at, Ticket{ID: "a", Rating: 1500}, Ticket{ID: "b", Rating: 1700}, Ticket{ID: "c", Rating: 1540})
+
+	// The oldest ticket takes the closest rating within its window.
+	if groups := ids(NewRatingMatcher(2, 50, 0)(tickets, at)); !equalIDs(groups, [][]string{{"a", "c"}}) {
+		t.Fatalf("groups = %v, want [[a c]]", groups)
+	}
+	if groups := NewRatingMatcher(2, 10, 0)(tickets, at); len(groups) != 0 {
+		t.Fatalf("groups = %v, want none within the window", ids(groups))
+	}
+	// The window widens by 10 per second queued, "a" is queued for 3 seconds and reaches "c" in 40.
+	if groups := ids(NewRatingMatcher(2, 10, 10)(tickets, at)); !equalIDs(groups, [][]string{{"a", "c"}}) {
+		t.Fatalf("groups = %v, want [[a c]] with the widened window", groups)
+	}
+	if groups := NewRatingMatcher(3, 50, 0)(tickets, at); len(groups) != 0 {
+		t.Fatalf("groups = %v, want none of 3 within the window", ids(groups))
+	}
+}
@@ -0,0 +1,406 @@
+// Package matchmaking provides a Lobby that queues the clients with their criteria, groups them into matches
+// by a Matcher, creates a Room for each match, and notifies the participants of their assignment,
+// which runs as a ppcserver Component.
+package matchmaking
+
+import (
+	"context"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/clock"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// RouteEnqueue is the route of the request to enqueue the Client with an EnqueueRequest,
+	// which responds an EnqueueResponse.
+	RouteEnqueue = "matchmaking.enqueue"
+	// RouteCancel is the route of the request to leave the queue, it's OK if the Client is not queued.
+	RouteCancel = "matchmaking.cancel"
+	// RouteMatched is the route of the one-way Message pushed to the participants of a Match with the Assignment.
+	RouteMatched = "matchmaking.matched"
+	// RouteTimeout is the route of the one-way Message pushed to a Client queued longer than Options.MaxWait.
+	RouteTimeout = "matchmaking.timeout"
+)
+
+var (
+	ErrUnauthorized    = errors.New("ppcserver: matchmaking requires an authorized client")
+	ErrAlreadyQueued   = errors.New("ppcserver: client is already queued for matchmaking")
+	ErrLobbyNotRunning = errors.New("ppcserver: matchmaking lobby is not running")
+)
+
+type (
+	// Option is a function to apply various configurations to customize a Lobby.
+	Option func(o *Options)
+
+	// Options hold the configurable parts of a Lobby.
+	Options struct {
+		// Matcher groups the queued tickets into matches.
+		// Default is NewGroupMatcher(2) if not set via WithMatcher.
+		Matcher Matcher
+
+		// Interval is the interval of running the Matcher over the queued tickets.
+		// Default is 1 second if not set via WithInterval.
+		Interval time.Duration
+
+		// MaxWait is the maximum time a ticket is queued, the Client is notified by RouteTimeout and dequeued.
+		// Default is 0 (unlimited) if not set via WithMaxWait.
+		MaxWait time.Duration
+
+		// ServerAddr is the address of the game server advertised in the Assignment, such as when the matches
+		// are played on a dedicated server. Default is empty if not set via WithServerAddr.
+		ServerAddr string
+
+		// RoomOptions customize the Room created for each Match, such as connector.WithRoomHistory.
+		RoomOptions []connector.RoomOption
+
+		// OnMatch is invoked with each Match once its Room is created and before the participants are notified,
+		// such as to set up the game state. Return a non-nil error to discard the Match and requeue the tickets.
+		OnMatch func(ctx context.Context, m *Match) error
+
+		// Logger is the Logger for the failures of the matches.
+		// Default is logging.Default() if not set via WithLogger.
+		Logger logging.Logger
+
+		// Clock is the time source of the queue, such as a clock.Fake in tests.
+		// Default is clock.Real() if not set via WithClock.
+		Clock clock.Clock
+	}
+
+	// EnqueueRequest is the data of the RouteEnqueue request.
+	EnqueueRequest struct {
+		// Criteria are matched by the Matcher, such as {"mode": "ranked", "region": "eu"}.
+		Criteria map[string]string `json:"criteria,omitempty"`
+		// Rating is the skill rating of the player, used by a Matcher such as NewRatingMatcher.
+		Rating int `json:"rating,omitempty"`
+	}
+
+	// EnqueueResponse is the response of the RouteEnqueue request.
+	EnqueueResponse struct {
+		TicketID string `json:"ticket_id"`
+	}
+
+	// Ticket is a Client waiting in the queue.
+	Ticket struct {
+		ID         string
+		Client     *connector.Client
+		Criteria   map[string]string
+		Rating     int
+		EnqueuedAt time.Time
+	}
+
+	// Matcher returns the groups of the tickets forming matches, which are taken out of the queue.
+	// The tickets are of the same connector.Tenant ordered by EnqueuedAt, the other tickets stay queued.
+	Matcher func(tickets []*Ticket, at time.Time) [][]*Ticket
+
+	// Match is a group of tickets formed by the Matcher.
+	Match struct {
+		ID      string
+		Room    *connector.Room
+		Tickets []*Ticket
+	}
+
+	// Assignment is the data of the RouteMatched Message pushed to the participants of a Match.
+	Assignment struct {
+		MatchID string `json:"match_id"`
+		// Room is the name of the Room of the Match, which the participants have joined.
+		Room string `json:"room"`
+		// Server is Options.ServerAddr, empty if the Match is played on the current server.
+		Server string `json:"server,omitempty"`
+		// Players are the uids of the participants.
+		Players []string `json:"players"`
+	}
+
+	// Lobby is a Component that runs the Matcher over the queued tickets every Options.Interval.
+	Lobby struct {
+		opts    *Options
+		mu      sync.Mutex         // mu guards tickets.
+		tickets map[uint64]*Ticket // tickets is keyed by connector.Client.ID.
+		running int32              // running is 1 while the Lobby is started, accessed atomically.
+		seq     uint64             // seq generates the ids of the tickets and the matches, accessed atomically.
+	}
+)
+
+// New creates a new Lobby, which should be registered to the Server by ppcserver.WithComponent,
+// and serve the routes by Lobby.Register.
+func New(opts ...Option) *Lobby {
+	l := &Lobby{
+		opts: &Options{
+			Matcher:  NewGroupMatcher(2),
+			Interval: 1 * time.Second,
+			Logger:   logging.Default(),
+			Clock:    clock.Real(),
+		},
+		tickets: make(map[uint64]*Ticket),
+	}
+
+	// Apply opts to customize Lobby.
+	for _, opt := range opts {
+		opt(l.opts)
+	}
+
+	return l
+}
+
+// WithMatcher is an Option to set the Matcher grouping the queued tickets into matches.
+func WithMatcher(m Matcher) Option {
+	return func(o *Options) {
+		o.Matcher = m
+	}
+}
+
+// WithInterval is an Option to set the interval of running the Matcher.
+func WithInterval(d time.Duration) Option {
+	return func(o *Options) {
+		o.Interval = d
+	}
+}
+
+// WithMaxWait is an Option to set the maximum time a ticket is queued.
+func WithMaxWait(d time.Duration) Option {
+	return func(o *Options) {
+		o.MaxWait = d
+	}
+}
+
+// WithServerAddr is an Option to set the address of the game server advertised in the Assignment.
+func WithServerAddr(addr string) Option {
+	return func(o *Options) {
+		o.ServerAddr = addr
+	}
+}
+
+// WithRoomOptions is an Option to customize the Room created for each Match.
+func WithRoomOptions(opts ...connector.RoomOption) Option {
+	return func(o *Options) {
+		o.RoomOptions = append(o.RoomOptions, opts...)
+	}
+}
+
+// WithOnMatch is an Option to set the function invoked with each Match before the participants are notified.
+func WithOnMatch(f func(ctx context.Context, m *Match) error) Option {
+	return func(o *Options) {
+		o.OnMatch = f
+	}
+}
+
+// WithLogger is an Option to set the Logger, such as an adapter over zap or slog.
+func WithLogger(l logging.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
+
+// WithClock is an Option to set the time source of the queue, such as a clock.Fake in tests.
+func WithClock(c clock.Clock) Option {
+	return func(o *Options) {
+		o.Clock = c
+	}
+}
+
+// Register registers the handlers of RouteEnqueue and RouteCancel to the Router.
+func (l *Lobby) Register(r *connector.Router) {
+	r.Handle(RouteEnqueue, l.handleEnqueue)
+	r.Handle(RouteCancel, l.handleCancel)
+}
+
+func (l *Lobby) handleEnqueue(_ context.Context, c *connector.Client, m *connector.Message) (interface{}, error) {
+	var req EnqueueRequest
+	if len(m.Data) > 0 {
+		if err := c.Protocol().Codec.Unmarshal(m.Data, &req); err != nil {
+			return nil, err
+		}
+	}
+	t, err := l.Enqueue(c, req)
+	if err != nil {
+		return nil, err
+	}
+	return EnqueueResponse{TicketID: t.ID}, nil
+}
+
+func (l *Lobby) handleCancel(_ context.Context, c *connector.Client, _ *connector.Message) (interface{}, error) {
+	l.Cancel(c)
+	return nil, nil
+}
+
+// Enqueue queues the authorized Client with the criteria of req until it is matched, cancelled or closed.
+func (l *Lobby) Enqueue(c *connector.Client, req EnqueueRequest) (*Ticket, error) {
+	if atomic.LoadInt32(&l.running) == 0 {
+		return nil, ErrLobbyNotRunning
+	}
+	if c.State() != connector.ClientStateAuthorized {
+		return nil, ErrUnauthorized
+	}
+
+	t := &Ticket{
+		ID:         l.nextID("t"),
+		Client:     c,
+		Criteria:   req.Criteria,
+		Rating:     req.Rating,
+		EnqueuedAt: l.opts.Clock.Now(),
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.tickets[c.ID()]; ok {
+		return nil, ErrAlreadyQueued
+	}
+	l.tickets[c.ID()] = t
+	return t, nil
+}
+
+// Cancel removes the ticket of the Client from the queue, it returns false if the Client is not queued.
+func (l *Lobby) Cancel(c *connector.Client) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.tickets[c.ID()]; !ok {
+		return false
+	}
+	delete(l.tickets, c.ID())
+	return true
+}
+
+// Len returns the number of the queued tickets.
+func (l *Lobby) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.tickets)
+}
+
+// Start runs the Matcher every Options.Interval and blocks until ctx is done.
+func (l *Lobby) Start(ctx context.Context) error {
+	atomic.StoreInt32(&l.running, 1)
+	defer atomic.StoreInt32(&l.running, 0)
+
+	// The timer signals instead of a channel timer, so that it works the same on any clock.Clock.
+	fired := make(chan struct{}, 1)
+	timer := l.opts.Clock.AfterFunc(
+		l.opts.Interval, func() {
+			select {
+			case fired <- struct{}{}:
+			default:
+			}
+		},
+	)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-fired:
+		}
+		l.match(ctx)
+		timer.Reset(l.opts.Interval)
+	}
+}
+
+// Shutdown discards the queued tickets, as their clients are closed along with the connectors.
+func (l *Lobby) Shutdown(_ context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tickets = make(map[uint64]*Ticket)
+	return nil
+}
+
+// match takes the matches formed by the Matcher out of the queue per connector.Tenant, and starts them.
+func (l *Lobby) match(ctx context.Context) {
+	at := l.opts.Clock.Now()
+	l.mu.Lock()
+	pools := make(map[connector.Tenant][]*Ticket)
+	var timedOut []*Ticket
+	for id, t := range l.tickets {
+		switch {
+		case t.Client.State() == connector.ClientStateClosed:
+			delete(l.tickets, id)
+		case l.opts.MaxWait > 0 && at.Sub(t.EnqueuedAt) >= l.opts.MaxWait:
+			delete(l.tickets, id)
+			timedOut = append(timedOut, t)
+		default:
+			pools[t.Client.Tenant()] = append(pools[t.Client.Tenant()], t)
+		}
+	}
+
+	var groups [][]*Ticket
+	for _, pool := range pools {
+		sort.Slice(pool, func(i, j int) bool { return pool[i].EnqueuedAt.Before(pool[j].EnqueuedAt) })
+		for _, g := range l.opts.Matcher(pool, at) {
+			if l.take(g) {
+				groups = append(groups, g)
+			}
+		}
+	}
+	l.mu.Unlock()
+
+	for _, t := range timedOut {
+		_ = t.Client.Push(RouteTimeout, EnqueueResponse{TicketID: t.ID})
+	}
+	for _, g := range groups {
+		if err := l.start(ctx, g); err != nil {
+			l.opts.Logger.Warn("Lobby start match error", logging.Err(err))
+			l.requeue(g)
+		}
+	}
+}
+
+// take removes the tickets of a group from the queue, it returns false if any ticket is not queued,
+// such as returned twice by the Matcher. It must be called while holding mu.
+func (l *Lobby) take(g []*Ticket) bool {
+	if len(g) == 0 {
+		return false
+	}
+	for _, t := range g {
+		if l.tickets[t.Client.ID()] != t {
+			return false
+		}
+	}
+	for _, t := range g {
+		delete(l.tickets, t.Client.ID())
+	}
+	return true
+}
+
+// requeue puts back the tickets of a failed Match, except the ones of the closed clients or queued again.
+func (l *Lobby) requeue(g []*Ticket) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, t := range g {
+		if _, ok := l.tickets[t.Client.ID()]; !ok && t.Client.State() != connector.ClientStateClosed {
+			l.tickets[t.Client.ID()] = t
+		}
+	}
+}
+
+// start creates the Room of the Match, joins the participants, and notifies them of the Assignment.
+func (l *Lobby) start(ctx context.Context, g []*Ticket) error {
+	m := &Match{ID: l.nextID("m"), Tickets: g}
+	tenant := g[0].Client.Tenant()
+	room, err := tenant.CreateRoom("match:"+m.ID, l.opts.RoomOptions...)
+	if err != nil {
+		return err
+	}
+	m.Room = room
+
+	a := Assignment{MatchID: m.ID, Room: room.Name(), Server: l.opts.ServerAddr}
+	for _, t := range g {
+		if err := room.Join(t.Client); err != nil {
+			room.Close()
+			return err
+		}
+		a.Players = append(a.Players, t.Client.UID())
+	}
+	if l.opts.OnMatch != nil {
+		if err := l.opts.OnMatch(ctx, m); err != nil {
+			room.Close()
+			return err
+		}
+	}
+	return room.Broadcast(RouteMatched, a)
+}
+
+func (l *Lobby) nextID(prefix string) string {
+	return prefix + strconv.FormatUint(atomic.AddUint64(&l.seq, 1), 10)
+}
@@ -0,0 +1,227 @@
+package matchmaking_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/clock"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/matchmaking"
+	"github.com/pom-pom-crafts/ppcserver/transporttest"
+	"sort"
+	"testing"
+	"time"
+)
+
+const interval = time.Second
+
+// player is a peer authorized as its uid.
+type player struct {
+	t    *testing.T
+	peer *transporttest.Peer
+	id   uint64
+}
+
+// setup starts a Lobby on a fake clock, and returns the options of the peers, which are authorized by their tokens
+// as the uids.
+func setup(t *testing.T, opts ...matchmaking.Option) (*clock.Fake, *matchmaking.Lobby, *connector.Options) {
+	t.Helper()
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	lobby := matchmaking.New(append([]matchmaking.Option{matchmaking.WithClock(clk)}, opts...)...)
+	router := connector.NewRouter()
+	lobby.Register(router)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() {
+		_ = lobby.Start(ctx)
+	}()
+	waitTimer(t, clk)
+	return clk, lobby, connector.NewOptions(
+		connector.WithRouter(router),
+		connector.WithAuthenticator(
+			func(_ context.Context, c *connector.Client, m *connector.Message) (string, error) {
+				var uid string
+				err := c.Protocol().Codec.Unmarshal(m.Data, &uid)
+				return uid, err
+			},
+		),
+	)
+}
+
+func connect(t *testing.T, opts *connector.Options, uid string) *player {
+	t.Helper()
+	peer, _ := transporttest.Serve(context.Background(), opts)
+	t.Cleanup(func() { _ = peer.Close() })
+	p := &player{t: t, peer: peer}
+	if resp := p.call(connector.RouteAuth, uid); resp.Error != "" {
+		t.Fatalf("auth error = %q", resp.Error)
+	}
+	return p
+}
+
+// call sends the request with v as its data and returns its response, skipping the pushes.
+func (p *player) call(route string, v interface{}) *connector.Message {
+	p.t.Helper()
+	p.id++
+	data, _ := json.Marshal(v)
+	if err := p.peer.SendMessage(&connector.Message{ID: p.id, Route: route, Data: data}); err != nil {
+		p.t.Fatal(err)
+	}
+	for {
+		resp := p.receive()
+		if resp.ID == p.id {
+			return resp
+		}
+	}
+}
+
+func (p *player) receive() *connector.Message {
+	p.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	m, err := p.peer.ReceiveMessage(ctx)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return m
+}
+
+// enqueue enqueues the player with the mode, and returns the ticket ID.
+func (p *player) enqueue(mode string) string {
+	p.t.Helper()
+	resp := p.call(matchmaking.RouteEnqueue, matchmaking.EnqueueRequest{Criteria: map[string]string{"mode": mode}})
+	var er matchmaking.EnqueueResponse
+	if err := json.Unmarshal(resp.Data, &er); err != nil || resp.Error != "" {
+		p.t.Fatalf("enqueue response = %+v, %v", resp, err)
+	}
+	return er.TicketID
+}
+
+// assignment returns the Assignment pushed to the player.
+func (p *player) assignment() matchmaking.Assignment {
+	p.t.Helper()
+	m := p.receive()
+	var a matchmaking.Assignment
+	if m.Route != matchmaking.RouteMatched || json.Unmarshal(m.Data, &a) != nil {
+		p.t.Fatalf("received %s:%s, want %s", m.Route, m.Data, matchmaking.RouteMatched)
+	}
+	return a
+}
+
+// waitTimer waits until the Lobby is waiting for its next run.
+func waitTimer(t *testing.T, clk *clock.Fake) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for clk.Len() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the Lobby never waits for the next run")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// run runs the Matcher once, and waits for the Lobby to wait for the next run.
+func run(t *testing.T, clk *clock.Fake) {
+	t.Helper()
+	clk.Advance(interval)
+	waitTimer(t, clk)
+}
+
+func TestMatchFormation(t *testing.T) {
+	clk, lobby, opts := setup(t, matchmaking.WithMatcher(matchmaking.NewGroupMatcher(2, "mode")))
+	alice, bob, carol := connect(t, opts, "alice"), connect(t, opts, "bob"), connect(t, opts, "carol")
+	alice.enqueue("ranked")
+	carol.enqueue("casual")
+	bob.enqueue("ranked")
+	if resp := bob.call(matchmaking.RouteEnqueue, nil); resp.Error != matchmaking.ErrAlreadyQueued.Error() {
+		t.Fatalf("error of a queued Client = %q, want %q", resp.Error, matchmaking.ErrAlreadyQueued)
+	}
+
+	run(t, clk)
+	a, b := alice.assignment(), bob.assignment()
+	sort.Strings(a.Players)
+	if a.MatchID == "" || a.MatchID != b.MatchID || a.Room != b.Room || len(a.Players) != 2 ||
+		a.Players[0] != "alice" || a.Players[1] != "bob" {
+		t.Fatalf("assignments = %+v and %+v, want the same match of alice and bob", a, b)
+	}
+	room, ok := connector.GetRoom(a.Room)
+	if !ok || room.Len() != 2 {
+		t.Fatalf("room of the match %q = %v, want 2 members", a.Room, room)
+	}
+	defer room.Close()
+	if n := lobby.Len(); n != 1 {
+		t.Fatalf("Len() = %d, want carol queued", n)
+	}
+
+	carol.call(matchmaking.RouteCancel, nil)
+	if n := lobby.Len(); n != 0 {
+		t.Fatalf("Len() after cancel = %d, want 0", n)
+	}
+}
+
+func TestMatchTimeout(t *testing.T) {
+	clk, lobby, opts := setup(t, matchmaking.WithMaxWait(2*interval))
+	alice := connect(t, opts, "alice")
+	ticket := alice.enqueue("ranked")
+
+	run(t, clk)
+	if n := lobby.Len(); n != 1 {
+		t.Fatalf("Len() before MaxWait = %d, want 1", n)
+	}
+	run(t, clk)
+	m := alice.receive()
+	var er matchmaking.EnqueueResponse
+	if m.Route != matchmaking.RouteTimeout || json.Unmarshal(m.Data, &er) != nil || er.TicketID != ticket {
+		t.Fatalf("received %s:%s, want %s of ticket %s", m.Route, m.Data, matchmaking.RouteTimeout, ticket)
+	}
+	if n := lobby.Len(); n != 0 {
+		t.Fatalf("Len() after MaxWait = %d, want 0", n)
+	}
+	// The timed out Client can queue again.
+	alice.enqueue("ranked")
+}
+
+func TestFailedMatchRequeued(t *testing.T) {
+	fail := true
+	clk, lobby, opts := setup(
+		t, matchmaking.WithOnMatch(
+			func(context.Context, *matchmaking.Match) error {
+				if fail {
+					fail = false
+					return errors.New("no game server")
+				}
+				return nil
+			},
+		),
+	)
+	alice, bob := connect(t, opts, "alice"), connect(t, opts, "bob")
+	alice.enqueue("ranked")
+	bob.enqueue("ranked")
+
+	run(t, clk)
+	if n := lobby.Len(); n != 2 {
+		t.Fatalf("Len() after the failed match = %d, want 2", n)
+	}
+	run(t, clk)
+	a := alice.assignment()
+	if room, ok := connector.GetRoom(a.Room); ok {
+		defer room.Close()
+	}
+	if b := bob.assignment(); b.MatchID != a.MatchID {
+		t.Fatalf("match IDs = %s and %s, want the same", a.MatchID, b.MatchID)
+	}
+}
+
+func TestEnqueueRequiresRunningLobby(t *testing.T) {
+	lobby := matchmaking.New()
+	router := connector.NewRouter()
+	lobby.Register(router)
+	peer, _ := transporttest.Serve(context.Background(), connector.NewOptions(connector.WithRouter(router)))
+	defer peer.Close()
+
+	p := &player{t: t, peer: peer}
+	if resp := p.call(matchmaking.RouteEnqueue, nil); resp.Error != matchmaking.ErrLobbyNotRunning.Error() {
+		t.Fatalf("error of a stopped Lobby = %q, want %q", resp.Error, matchmaking.ErrLobbyNotRunning)
+	}
+}
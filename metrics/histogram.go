@@ -0,0 +1,142 @@
+// Package metrics provides the dependency-free metric primitives recorded by ppcserver,
+// which are exported to monitoring systems through a Sink by the sub-packages such as prom and statsd.
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// DefBuckets are the default upper bounds in seconds of the latency Histogram buckets,
+// ranging from 0.5ms to 10s.
+var DefBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type (
+	// Histogram counts the observed values in configurable buckets, safe for concurrent use.
+	Histogram struct {
+		data atomic.Value // data holds *histogramData, replaced as a whole by SetBuckets.
+	}
+
+	histogramData struct {
+		upperBounds []float64
+		counts      []uint64 // counts has one more element than upperBounds for the +Inf bucket.
+		count       uint64
+		sumBits     uint64 // sumBits is the math.Float64bits of the sum of observed values.
+	}
+
+	// HistogramSnapshot is a snapshot of a Histogram in the Prometheus data model.
+	HistogramSnapshot struct {
+		// UpperBounds are the upper bounds of the buckets in ascending order, excluding +Inf.
+		UpperBounds []float64
+		// CumulativeCounts are the number of observed values less than or equal to each of UpperBounds.
+		CumulativeCounts []uint64
+		// Count is the number of observed values, which is also the count of the +Inf bucket.
+		Count uint64
+		// Sum is the sum of observed values.
+		Sum float64
+	}
+
+	// HistogramVec is a set of Histogram with the same buckets, partitioned by a label value.
+	HistogramVec struct {
+		mu          sync.RWMutex // mu guards upperBounds and histograms.
+		upperBounds []float64
+		histograms  map[string]*Histogram
+	}
+)
+
+// NewHistogram creates a Histogram with the upper bounds of the buckets.
+func NewHistogram(upperBounds []float64) *Histogram {
+	h := &Histogram{}
+	h.SetBuckets(upperBounds)
+	return h
+}
+
+// SetBuckets replaces the upper bounds of the buckets, which also resets all the observed values.
+func (h *Histogram) SetBuckets(upperBounds []float64) {
+	bounds := append([]float64(nil), upperBounds...)
+	sort.Float64s(bounds)
+	h.data.Store(
+		&histogramData{
+			upperBounds: bounds,
+			counts:      make([]uint64, len(bounds)+1),
+		},
+	)
+}
+
+// Observe adds a single observed value to the Histogram.
+func (h *Histogram) Observe(v float64) {
+	d := h.data.Load().(*histogramData)
+	// SearchFloat64s returns the index of the first upper bound >= v, or len(upperBounds) for the +Inf bucket.
+	atomic.AddUint64(&d.counts[sort.SearchFloat64s(d.upperBounds, v)], 1)
+	atomic.AddUint64(&d.count, 1)
+	for {
+		old := atomic.LoadUint64(&d.sumBits)
+		sum := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&d.sumBits, old, sum) {
+			return
+		}
+	}
+}
+
+// Snapshot returns a snapshot of the Histogram.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	d := h.data.Load().(*histogramData)
+	s := HistogramSnapshot{
+		UpperBounds:      d.upperBounds,
+		CumulativeCounts: make([]uint64, len(d.upperBounds)),
+		Count:            atomic.LoadUint64(&d.count),
+		Sum:              math.Float64frombits(atomic.LoadUint64(&d.sumBits)),
+	}
+	var cumulative uint64
+	for i := range d.upperBounds {
+		cumulative += atomic.LoadUint64(&d.counts[i])
+		s.CumulativeCounts[i] = cumulative
+	}
+	return s
+}
+
+// NewHistogramVec creates a HistogramVec with the upper bounds of the buckets.
+func NewHistogramVec(upperBounds []float64) *HistogramVec {
+	return &HistogramVec{
+		upperBounds: upperBounds,
+		histograms:  make(map[string]*Histogram),
+	}
+}
+
+// Observe adds a single observed value to the Histogram of the label value.
+func (v *HistogramVec) Observe(label string, value float64) {
+	v.mu.RLock()
+	h, ok := v.histograms[label]
+	v.mu.RUnlock()
+
+	if !ok {
+		v.mu.Lock()
+		if h, ok = v.histograms[label]; !ok {
+			h = NewHistogram(v.upperBounds)
+			v.histograms[label] = h
+		}
+		v.mu.Unlock()
+	}
+	h.Observe(value)
+}
+
+// SetBuckets replaces the upper bounds of the buckets, which also resets all the observed values.
+func (v *HistogramVec) SetBuckets(upperBounds []float64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.upperBounds = upperBounds
+	v.histograms = make(map[string]*Histogram)
+}
+
+// Snapshot returns the snapshots of the Histogram keyed by the label value.
+func (v *HistogramVec) Snapshot() map[string]HistogramSnapshot {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	s := make(map[string]HistogramSnapshot, len(v.histograms))
+	for label, h := range v.histograms {
+		s[label] = h.Snapshot()
+	}
+	return s
+}
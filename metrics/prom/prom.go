@@ -0,0 +1,155 @@
+// Package prom exports the ppcserver metrics in the Prometheus text exposition format,
+// without depending on the Prometheus client library.
+package prom
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/metrics"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Option is a function to apply various configurations to customize the exported metrics.
+	Option func(o *Options)
+
+	// Options hold the configurable parts of the exported metrics.
+	// The metric names are joined as namespace_subsystem_name, skipping the empty parts.
+	// The latency histogram buckets are configured via connector.SetLatencyBuckets.
+	Options struct {
+		// Namespace is the first part of the metric names.
+		// Default is "ppcserver" if not set via WithNamespace.
+		Namespace string
+
+		// Subsystem is the second part of the metric names.
+		// Default is "connector" if not set via WithSubsystem.
+		Subsystem string
+	}
+
+	// writer is a metrics.Sink writing the metrics in the Prometheus text exposition format.
+	writer struct {
+		opts *Options
+		w    *bufio.Writer
+		last string // last is the name of the metric whose header is written last.
+	}
+)
+
+func defaultOptions() *Options {
+	return &Options{
+		Namespace: "ppcserver",
+		Subsystem: "connector",
+	}
+}
+
+// NewHandler creates an http.Handler serving the metrics for Prometheus to scrape, usually mounted at /metrics.
+func NewHandler(opts ...Option) http.Handler {
+	o := defaultOptions()
+
+	// Apply opts to customize Options.
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+			_ = Write(w, o)
+		},
+	)
+}
+
+// Write writes the metrics in the Prometheus text exposition format into w.
+func Write(w io.Writer, o *Options) error {
+	pw := &writer{opts: o, w: bufio.NewWriter(w)}
+	connector.CollectMetrics(pw)
+	return pw.w.Flush()
+}
+
+func (pw *writer) name(name string) string {
+	parts := make([]string, 0, 3)
+	for _, p := range []string{pw.opts.Namespace, pw.opts.Subsystem, name} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, "_")
+}
+
+// header writes the HELP and TYPE lines once before the first sample of the metric.
+func (pw *writer) header(name, help, typ string) {
+	if name == pw.last {
+		return
+	}
+	pw.last = name
+	fmt.Fprintf(pw.w, "# HELP %s %s\n# TYPE %s %s\n", pw.name(name), help, pw.name(name), typ)
+}
+
+func (pw *writer) sample(name string, labels []metrics.Label, v float64) {
+	fmt.Fprintf(pw.w, "%s%s %s\n", pw.name(name), braces(labelPairs(labels)), formatFloat(v))
+}
+
+func (pw *writer) Gauge(name, help string, labels []metrics.Label, v float64) {
+	pw.header(name, help, "gauge")
+	pw.sample(name, labels, v)
+}
+
+func (pw *writer) Counter(name, help string, labels []metrics.Label, v uint64) {
+	pw.header(name, help, "counter")
+	pw.sample(name, labels, float64(v))
+}
+
+// Histogram writes the _bucket, _sum, and _count samples.
+func (pw *writer) Histogram(name, help string, labels []metrics.Label, s metrics.HistogramSnapshot) {
+	pw.header(name, help, "histogram")
+	pairs := labelPairs(labels)
+	for i, ub := range s.UpperBounds {
+		le := labelPair("le", formatFloat(ub))
+		fmt.Fprintf(pw.w, "%s_bucket%s %d\n", pw.name(name), braces(append(pairs, le)), s.CumulativeCounts[i])
+	}
+	fmt.Fprintf(pw.w, "%s_bucket%s %d\n", pw.name(name), braces(append(pairs, labelPair("le", "+Inf"))), s.Count)
+	fmt.Fprintf(pw.w, "%s_sum%s %s\n", pw.name(name), braces(pairs), formatFloat(s.Sum))
+	fmt.Fprintf(pw.w, "%s_count%s %d\n", pw.name(name), braces(pairs), s.Count)
+}
+
+// labelPairs formats the labels by labelPair.
+func labelPairs(labels []metrics.Label) []string {
+	pairs := make([]string, 0, len(labels)+1)
+	for _, l := range labels {
+		pairs = append(pairs, labelPair(l.Key, l.Value))
+	}
+	return pairs
+}
+
+// labelPair formats a label pair with the value escaped.
+func labelPair(key, value string) string {
+	return fmt.Sprintf(`%s="%s"`, key, strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value))
+}
+
+func braces(pairs []string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// WithNamespace is an Option to set the first part of the metric names.
+func WithNamespace(ns string) Option {
+	return func(o *Options) {
+		o.Namespace = ns
+	}
+}
+
+// WithSubsystem is an Option to set the second part of the metric names.
+func WithSubsystem(s string) Option {
+	return func(o *Options) {
+		o.Subsystem = s
+	}
+}
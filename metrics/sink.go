@@ -0,0 +1,22 @@
+package metrics
+
+type (
+	// Sink receives the metrics collected by connector.CollectMetrics, so that the same metrics are exported to
+	// the monitoring systems either pulled, such as by the prom package, or pushed, such as by the statsd package.
+	// The metric names are in the snake case without any namespace, such as "messages_sent_total".
+	// The samples of a metric are reported consecutively.
+	Sink interface {
+		// Gauge reports the current value of a metric.
+		Gauge(name, help string, labels []Label, v float64)
+		// Counter reports the cumulative value of a metric since the process started.
+		Counter(name, help string, labels []Label, v uint64)
+		// Histogram reports the snapshot of a Histogram.
+		Histogram(name, help string, labels []Label, s HistogramSnapshot)
+	}
+
+	// Label is a dimension of a metric sample, such as the route of a handler.
+	Label struct {
+		Key   string
+		Value string
+	}
+)
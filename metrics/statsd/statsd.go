@@ -0,0 +1,290 @@
+// Package statsd pushes the ppcserver metrics to a StatsD or DogStatsD agent over UDP, such as the Datadog agent,
+// for the deployments without a Prometheus server to scrape the metrics.
+package statsd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"github.com/pom-pom-crafts/ppcserver/metrics"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxPacketSize is the maximum size of a UDP packet, to avoid the IP fragmentation on an Ethernet network.
+const maxPacketSize = 1432
+
+var ErrExporterStarted = errors.New("ppcserver: statsd exporter is already started")
+
+type (
+	// Option is a function to apply various configurations to customize an Exporter.
+	Option func(o *Options)
+
+	// Options hold the configurable parts of an Exporter.
+	Options struct {
+		// Addr is the UDP address of the StatsD agent, in the form "host:port".
+		// Default is "127.0.0.1:8125" if not set via WithAddr.
+		Addr string
+
+		// Prefix is prepended to the metric names, such as "ppcserver.connector.clients".
+		// Default is "ppcserver.connector." if not set via WithPrefix.
+		Prefix string
+
+		// Interval is the time between the pushes of the metrics.
+		// Default is 10 seconds if not set via WithInterval.
+		Interval time.Duration
+
+		// DogStatsD sends the labels of the metrics as the DogStatsD tags, instead of appending the label values
+		// to the metric names for a plain StatsD agent. Default is false if not set via WithDogStatsD.
+		DogStatsD bool
+
+		// Tags are the DogStatsD tags added to all the metrics, such as "env:prod", set via WithDogStatsD.
+		Tags []string
+
+		// Logger is the Logger for the push errors.
+		// Default is logging.Default() if not set via WithLogger.
+		Logger logging.Logger
+	}
+
+	// Exporter is a Component pushing the metrics collected by connector.CollectMetrics to a StatsD agent
+	// every Options.Interval. The counters are sent as the increments since the previous push, the histograms
+	// as the increments of the _count and _sum counters.
+	Exporter struct {
+		opts *Options
+		mu   sync.Mutex // mu guards conn, stop, and done.
+		conn net.Conn
+		stop chan struct{}
+		done chan struct{}
+		// sent are the cumulative values of the counters at the previous push by the metric key, only accessed by
+		// the push goroutine.
+		sent map[string]float64
+	}
+
+	// packetWriter is a metrics.Sink writing the metrics in the StatsD line protocol,
+	// in as few packets as possible.
+	packetWriter struct {
+		e    *Exporter
+		conn net.Conn
+		buf  bytes.Buffer
+	}
+)
+
+func defaultOptions() *Options {
+	return &Options{
+		Addr:     "127.0.0.1:8125",
+		Prefix:   "ppcserver.connector.",
+		Interval: 10 * time.Second,
+		Logger:   logging.Default(),
+	}
+}
+
+// NewExporter creates a new Exporter.
+func NewExporter(opts ...Option) *Exporter {
+	e := &Exporter{
+		opts: defaultOptions(),
+		sent: make(map[string]float64),
+	}
+
+	// Apply opts to customize Exporter.
+	for _, opt := range opts {
+		opt(e.opts)
+	}
+
+	return e
+}
+
+// Start connects to the StatsD agent and starts pushing the metrics.
+func (e *Exporter) Start(_ context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conn != nil {
+		return ErrExporterStarted
+	}
+	conn, err := net.Dial("udp", e.opts.Addr)
+	if err != nil {
+		return err
+	}
+	e.conn = conn
+	e.stop = make(chan struct{})
+	e.done = make(chan struct{})
+	go e.run(conn, e.stop, e.done)
+	return nil
+}
+
+// Shutdown pushes the metrics a last time and stops the Exporter, or returns ctx.Err() if ctx is done first.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	conn, stop, done := e.conn, e.stop, e.done
+	e.conn = nil
+	e.mu.Unlock()
+	if conn == nil {
+		return nil
+	}
+
+	close(stop)
+	select {
+	case <-done:
+	case <-ctx.Done():
+		_ = conn.Close()
+		return ctx.Err()
+	}
+	return conn.Close()
+}
+
+func (e *Exporter) run(conn net.Conn, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(e.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.push(conn)
+		case <-stop:
+			e.push(conn)
+			return
+		}
+	}
+}
+
+// push sends the metrics collected once, split into the packets of at most maxPacketSize.
+func (e *Exporter) push(conn net.Conn) {
+	pw := &packetWriter{e: e, conn: conn}
+	connector.CollectMetrics(pw)
+	pw.flush()
+}
+
+func (pw *packetWriter) Gauge(name, _ string, labels []metrics.Label, v float64) {
+	pw.line(name, labels, v, "g")
+}
+
+func (pw *packetWriter) Counter(name, _ string, labels []metrics.Label, v uint64) {
+	pw.delta(name, labels, float64(v))
+}
+
+func (pw *packetWriter) Histogram(name, _ string, labels []metrics.Label, s metrics.HistogramSnapshot) {
+	pw.delta(name+"_count", labels, float64(s.Count))
+	pw.delta(name+"_sum", labels, s.Sum)
+}
+
+// delta writes the increment of the cumulative value v since the previous push as a counter.
+func (pw *packetWriter) delta(name string, labels []metrics.Label, v float64) {
+	key := pw.e.name(name, labels)
+	prev, ok := pw.e.sent[key]
+	pw.e.sent[key] = v
+	// The first push has no baseline, and a reset, such as by connector.SetLatencyBuckets, starts a new one.
+	if !ok || v < prev {
+		prev = 0
+	}
+	if v == prev {
+		return
+	}
+	pw.line(name, labels, v-prev, "c")
+}
+
+// line writes a metric line, the lines written so far are sent once the packet is full.
+func (pw *packetWriter) line(name string, labels []metrics.Label, v float64, typ string) {
+	var l strings.Builder
+	l.WriteString(pw.e.name(name, labels))
+	l.WriteByte(':')
+	l.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+	l.WriteByte('|')
+	l.WriteString(typ)
+	if pw.e.opts.DogStatsD {
+		tags := append([]string(nil), pw.e.opts.Tags...)
+		for _, label := range labels {
+			tags = append(tags, sanitize(label.Key)+":"+sanitize(label.Value))
+		}
+		if len(tags) > 0 {
+			l.WriteString("|#")
+			l.WriteString(strings.Join(tags, ","))
+		}
+	}
+
+	if pw.buf.Len() > 0 && pw.buf.Len()+1+l.Len() > maxPacketSize {
+		pw.flush()
+	}
+	if pw.buf.Len() > 0 {
+		pw.buf.WriteByte('\n')
+	}
+	pw.buf.WriteString(l.String())
+}
+
+// flush sends the lines written so far as a packet.
+func (pw *packetWriter) flush() {
+	if pw.buf.Len() == 0 {
+		return
+	}
+	if _, err := pw.conn.Write(pw.buf.Bytes()); err != nil {
+		pw.e.opts.Logger.Warn("StatsD Exporter write error", logging.Err(err))
+	}
+	pw.buf.Reset()
+}
+
+// name returns the metric name with the prefix, and the label values appended for a plain StatsD agent.
+func (e *Exporter) name(name string, labels []metrics.Label) string {
+	if e.opts.DogStatsD || len(labels) == 0 {
+		return e.opts.Prefix + name
+	}
+	parts := make([]string, 0, len(labels)+1)
+	parts = append(parts, e.opts.Prefix+name)
+	for _, label := range labels {
+		parts = append(parts, sanitize(label.Value))
+	}
+	return strings.Join(parts, ".")
+}
+
+// sanitize replaces the characters reserved by the StatsD line protocol.
+func sanitize(s string) string {
+	return strings.Map(
+		func(r rune) rune {
+			switch r {
+			case ':', '|', '@', '#', ',', '\n', ' ':
+				return '_'
+			}
+			return r
+		}, s,
+	)
+}
+
+// WithAddr is an Option to set the UDP address of the StatsD agent.
+func WithAddr(addr string) Option {
+	return func(o *Options) {
+		o.Addr = addr
+	}
+}
+
+// WithPrefix is an Option to set the prefix of the metric names, such as "game.".
+func WithPrefix(prefix string) Option {
+	return func(o *Options) {
+		o.Prefix = prefix
+	}
+}
+
+// WithInterval is an Option to set the time between the pushes of the metrics.
+func WithInterval(d time.Duration) Option {
+	return func(o *Options) {
+		if d > 0 {
+			o.Interval = d
+		}
+	}
+}
+
+// WithDogStatsD is an Option to send the labels as the DogStatsD tags, with the tags added to all the metrics.
+func WithDogStatsD(tags ...string) Option {
+	return func(o *Options) {
+		o.DogStatsD = true
+		o.Tags = tags
+	}
+}
+
+// WithLogger is an Option to set the Logger for the push errors.
+func WithLogger(l logging.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
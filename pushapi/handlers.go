@@ -0,0 +1,163 @@
+package pushapi
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"net/http"
+)
+
+type (
+	// UserPushRequest is the request body of POST /push/user.
+	UserPushRequest struct {
+		UID   string          `json:"uid"`
+		Route string          `json:"route"`
+		Data  json.RawMessage `json:"data,omitempty"`
+		// IdempotencyKey drops the push to the clients already delivered the key, see connector.PushToUserWithKey.
+		IdempotencyKey string `json:"idempotency_key,omitempty"`
+	}
+
+	// UserPushResponse is the response body of POST /push/user.
+	UserPushResponse struct {
+		// Clients is the number of the online clients of the user, zero means the message is queued
+		// if an OfflineStore is set via connector.SetOfflineStore, otherwise dropped.
+		Clients int `json:"clients"`
+	}
+
+	// RoomPushRequest is the request body of POST /push/room.
+	RoomPushRequest struct {
+		Room  string          `json:"room"`
+		Route string          `json:"route"`
+		Data  json.RawMessage `json:"data,omitempty"`
+	}
+
+	// TagPushRequest is the request body of POST /push/tag.
+	TagPushRequest struct {
+		Tag   string          `json:"tag"`
+		Route string          `json:"route"`
+		Data  json.RawMessage `json:"data,omitempty"`
+	}
+
+	// TagPushResponse is the response body of POST /push/tag.
+	TagPushResponse struct {
+		// Clients is the number of the online clients with the tag.
+		Clients int `json:"clients"`
+	}
+
+	// BroadcastPushRequest is the request body of POST /push/broadcast.
+	BroadcastPushRequest struct {
+		Route string          `json:"route"`
+		Data  json.RawMessage `json:"data,omitempty"`
+	}
+
+	errorResponse struct {
+		Error string `json:"error"`
+	}
+)
+
+func pushUser(w http.ResponseWriter, r *http.Request) {
+	var req UserPushRequest
+	if !decodePost(w, r, &req) {
+		return
+	}
+	if req.UID == "" || req.Route == "" {
+		writeError(w, http.StatusBadRequest, errors.New("uid and route are required"))
+		return
+	}
+
+	clients := len(connector.ClientsByUID(req.UID))
+	if err := connector.PushToUserWithKey(req.UID, req.IdempotencyKey, req.Route, payload(req.Data)); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, UserPushResponse{Clients: clients})
+}
+
+func pushRoom(w http.ResponseWriter, r *http.Request) {
+	var req RoomPushRequest
+	if !decodePost(w, r, &req) {
+		return
+	}
+	if req.Room == "" || req.Route == "" {
+		writeError(w, http.StatusBadRequest, errors.New("room and route are required"))
+		return
+	}
+
+	room, ok := connector.GetRoom(req.Room)
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("room not found"))
+		return
+	}
+	if err := room.Broadcast(req.Route, payload(req.Data)); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func pushTag(w http.ResponseWriter, r *http.Request) {
+	var req TagPushRequest
+	if !decodePost(w, r, &req) {
+		return
+	}
+	if req.Tag == "" || req.Route == "" {
+		writeError(w, http.StatusBadRequest, errors.New("tag and route are required"))
+		return
+	}
+
+	clients := len(connector.ClientsByTag(req.Tag))
+	if err := connector.PushToTag(req.Tag, req.Route, payload(req.Data)); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, TagPushResponse{Clients: clients})
+}
+
+func pushBroadcast(w http.ResponseWriter, r *http.Request) {
+	var req BroadcastPushRequest
+	if !decodePost(w, r, &req) {
+		return
+	}
+	if req.Route == "" {
+		writeError(w, http.StatusBadRequest, errors.New("route is required"))
+		return
+	}
+
+	if err := connector.Broadcast(req.Route, payload(req.Data)); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// payload returns the data to push as is, or nil for a push without data.
+func payload(data json.RawMessage) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return data
+}
+
+// decodePost decodes the JSON body of a POST request into v,
+// writes an error response and returns false on failure.
+func decodePost(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
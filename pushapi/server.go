@@ -0,0 +1,130 @@
+// Package pushapi provides an authenticated HTTP API for the trusted backend services to push messages to
+// the clients of a running ppcserver, so that the game logic servers don't need to link the connector package.
+package pushapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var ErrNoToken = errors.New("ppcserver: push api server requires at least one token")
+
+type (
+	// Option is a function to apply various configurations to customize a push API Server.
+	Option func(o *Options)
+
+	// Options hold the configurable parts of a push API Server.
+	Options struct {
+		// Addr specifies the TCP address for the push API server to listen on, in the form "host:port".
+		// Default is "localhost:7071" if not set via WithAddr.
+		Addr string
+
+		// Tokens are the bearer tokens of the backend services accepted in the "Authorization: Bearer <token>"
+		// request header. At least one token is required, set via WithTokens.
+		Tokens []string
+	}
+
+	// Server is a Component that serves the push API:
+	//
+	//	POST /push/user        push {"route": "r", "data": {...}} to the clients of a "uid", queued if offline
+	//	POST /push/room        push {"route": "r", "data": {...}} to the members of a "room"
+	//	POST /push/tag         push {"route": "r", "data": {...}} to the clients with a "tag"
+	//	POST /push/broadcast   push {"route": "r", "data": {...}} to all the authorized clients
+	Server struct {
+		opts   *Options
+		server *http.Server
+	}
+)
+
+func defaultOptions() *Options {
+	return &Options{
+		Addr: "localhost:7071",
+	}
+}
+
+// NewServer creates a new push API Server.
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		opts: defaultOptions(),
+	}
+
+	// Apply opts to customize Server.
+	for _, opt := range opts {
+		opt(s.opts)
+	}
+
+	s.server = &http.Server{
+		Addr:    s.opts.Addr,
+		Handler: s.Handler(),
+	}
+	return s
+}
+
+// Handler returns an http.Handler serving the push API with authentication,
+// for mounting on a custom server instead of starting a push API Server.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/push/user", pushUser)
+	mux.HandleFunc("/push/room", pushRoom)
+	mux.HandleFunc("/push/tag", pushTag)
+	mux.HandleFunc("/push/broadcast", pushBroadcast)
+	return s.authenticate(mux)
+}
+
+// Start starts the push API HTTP server and blocks until the server is closed.
+func (s *Server) Start(_ context.Context) error {
+	if len(s.opts.Tokens) == 0 {
+		return ErrNoToken
+	}
+	if err := s.server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Shutdown gracefully shuts down the push API HTTP server.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// authenticate rejects the requests without a valid bearer token.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if token == "" || !s.validToken(token) {
+				writeError(w, http.StatusUnauthorized, errors.New("invalid token"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		},
+	)
+}
+
+// validToken compares in constant time to avoid leaking the tokens through timing.
+func (s *Server) validToken(token string) bool {
+	valid := false
+	for _, t := range s.opts.Tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// WithAddr is an Option to set the TCP address for the push API server to listen on.
+func WithAddr(a string) Option {
+	return func(o *Options) {
+		o.Addr = a
+	}
+}
+
+// WithTokens is an Option to set the bearer tokens of the backend services accepted by the push API.
+func WithTokens(tokens ...string) Option {
+	return func(o *Options) {
+		o.Tokens = append(o.Tokens, tokens...)
+	}
+}
@@ -0,0 +1,59 @@
+package ppcserver
+
+import (
+	"context"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"sync/atomic"
+	"time"
+)
+
+// WithReconnectHint is a ServerOption to push a connector.ReconnectHint to the authorized clients on SIGINT/SIGTERM,
+// telling them to reconnect to addr after a delay randomized in after±jitter, such as during a rolling deploy.
+// The Server stops accepting new connections, and waits up to after+jitter for the clients to leave
+// before shutting down the components, which closes the remaining clients.
+func WithReconnectHint(addr string, after, jitter time.Duration) ServerOption {
+	return func(s *Server) {
+		s.opts.ReconnectHint = true
+		s.opts.ReconnectAddr = addr
+		s.opts.ReconnectAfter = after
+		s.opts.ReconnectJitter = jitter
+	}
+}
+
+// handOffClients returns a context done once the clients are handed off after parent is done,
+// or the returned cancel is called.
+func (s *Server) handOffClients(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		defer cancel()
+		select {
+		case <-ctx.Done():
+			return
+		case <-parent.Done():
+		}
+
+		atomic.StoreInt32(&s.draining, 1)
+		connector.SetDraining(true)
+		n := connector.SendReconnectHints(s.opts.ReconnectAddr, s.opts.ReconnectAfter, s.opts.ReconnectJitter)
+		s.opts.Logger.Info(
+			"sent reconnect hints", logging.F("clients", n), logging.F("addr", s.opts.ReconnectAddr),
+		)
+
+		// Poll for the clients leaving, which is cheap enough for the few seconds of a hand-off.
+		deadline := time.NewTimer(s.opts.ReconnectAfter + s.opts.ReconnectJitter)
+		defer deadline.Stop()
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for connector.NumClients() > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-deadline.C:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return ctx, cancel
+}
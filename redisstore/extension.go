@@ -0,0 +1,77 @@
+package redisstore
+
+import (
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/extension"
+	"github.com/redis/go-redis/v9"
+)
+
+// redisConfig is the extension.Config of the stores registered as "redis".
+type redisConfig struct {
+	Addr      string `json:"addr"`
+	Password  string `json:"password"`
+	DB        int    `json:"db"`
+	KeyPrefix string `json:"key_prefix"`
+}
+
+// The stores are registered as "redis" by importing the package, configured by the "addr", "password", "db",
+// and "key_prefix" of the extension.Config.
+func init() {
+	extension.SessionStores.Register(
+		"redis", func(cfg extension.Config) (connector.SessionStore, error) {
+			c, client, err := newRedisClient(cfg)
+			if err != nil {
+				return nil, err
+			}
+			var opts []Option
+			if c.KeyPrefix != "" {
+				opts = append(opts, WithKeyPrefix(c.KeyPrefix))
+			}
+			return New(client, opts...), nil
+		},
+	)
+	extension.NonceCaches.Register(
+		"redis", func(cfg extension.Config) (connector.NonceCache, error) {
+			c, client, err := newRedisClient(cfg)
+			if err != nil {
+				return nil, err
+			}
+			return NewNonceCache(client, c.KeyPrefix), nil
+		},
+	)
+	extension.AppKeyStores.Register(
+		"redis", func(cfg extension.Config) (connector.AppKeyStore, error) {
+			c, client, err := newRedisClient(cfg)
+			if err != nil {
+				return nil, err
+			}
+			return NewAppKeyStore(client, c.KeyPrefix), nil
+		},
+	)
+	extension.Lockers.Register(
+		"redis", func(cfg extension.Config) (connector.Locker, error) {
+			c, client, err := newRedisClient(cfg)
+			if err != nil {
+				return nil, err
+			}
+			return NewLocker(client, c.KeyPrefix), nil
+		},
+	)
+	extension.RoomSnapshotStores.Register(
+		"redis", func(cfg extension.Config) (connector.RoomSnapshotStore, error) {
+			c, client, err := newRedisClient(cfg)
+			if err != nil {
+				return nil, err
+			}
+			return NewRoomSnapshotStore(client, c.KeyPrefix), nil
+		},
+	)
+}
+
+func newRedisClient(cfg extension.Config) (redisConfig, *redis.Client, error) {
+	c := redisConfig{Addr: "localhost:6379"}
+	if err := cfg.Decode(&c); err != nil {
+		return c, nil, err
+	}
+	return c, redis.NewClient(&redis.Options{Addr: c.Addr, Password: c.Password, DB: c.DB}), nil
+}
@@ -0,0 +1,307 @@
+// Package redisstore provides the connector.SessionStore backed by Redis,
+// so that the sessions are shared by the server nodes and survive the restarts.
+// It also provides the connector.NonceCache, the connector.AppKeyStore, the connector.Locker, and
+// the connector.RoomSnapshotStore shared by the server nodes.
+package redisstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/redis/go-redis/v9"
+	"sort"
+	"time"
+)
+
+type (
+	// Option is a function to apply various configurations to customize a Store.
+	Option func(s *Store)
+
+	// Store is a connector.SessionStore saving each Session as a JSON string with the TTL in Redis.
+	Store struct {
+		client    redis.UniversalClient
+		keyPrefix string
+	}
+)
+
+// New creates a Store over the Redis client, such as *redis.Client or *redis.ClusterClient.
+func New(client redis.UniversalClient, opts ...Option) *Store {
+	s := &Store{
+		client:    client,
+		keyPrefix: "ppcserver:session:",
+	}
+
+	// Apply opts to customize Store.
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// WithKeyPrefix is an Option to set the prefix of the Redis keys, default is "ppcserver:session:".
+func WithKeyPrefix(p string) Option {
+	return func(s *Store) {
+		s.keyPrefix = p
+	}
+}
+
+// Load returns the Session with the id, or connector.ErrSessionNotFound if there is none or it is expired.
+func (s *Store) Load(ctx context.Context, id string) (*connector.Session, error) {
+	data, err := s.client.Get(ctx, s.keyPrefix+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, connector.ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sess := &connector.Session{}
+	if err := json.Unmarshal(data, sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// Save persists the Session, which expires after ttl.
+func (s *Store) Save(ctx context.Context, sess *connector.Session, ttl time.Duration) error {
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.keyPrefix+sess.ID, data, ttl).Err()
+}
+
+// Delete removes the Session with the id.
+func (s *Store) Delete(ctx context.Context, id string) error {
+	return s.client.Del(ctx, s.keyPrefix+id).Err()
+}
+
+// NonceCache is a connector.NonceCache recording each nonce by SET NX with the TTL in Redis,
+// so that a replayed auth message is rejected by any server node.
+type NonceCache struct {
+	client    redis.UniversalClient
+	keyPrefix string
+}
+
+// NewNonceCache creates a NonceCache over the Redis client, the keys are prefixed with keyPrefix,
+// default is "ppcserver:nonce:" if empty.
+func NewNonceCache(client redis.UniversalClient, keyPrefix string) *NonceCache {
+	if keyPrefix == "" {
+		keyPrefix = "ppcserver:nonce:"
+	}
+	return &NonceCache{client: client, keyPrefix: keyPrefix}
+}
+
+// Add records the nonce for ttl, it returns false if the nonce is already recorded and not expired.
+func (n *NonceCache) Add(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	return n.client.SetNX(ctx, n.keyPrefix+nonce, 1, ttl).Result()
+}
+
+// AppKeyStore is a connector.AppKeyStore saving each connector.AppKey as a JSON string in Redis,
+// which expires at its ExpiresAt, with a set of the keys per tenant, so that the keys are rotated for all
+// the server nodes at once.
+type AppKeyStore struct {
+	client    redis.UniversalClient
+	keyPrefix string
+}
+
+// NewAppKeyStore creates an AppKeyStore over the Redis client, the keys are prefixed with keyPrefix,
+// default is "ppcserver:appkey:" if empty.
+func NewAppKeyStore(client redis.UniversalClient, keyPrefix string) *AppKeyStore {
+	if keyPrefix == "" {
+		keyPrefix = "ppcserver:appkey:"
+	}
+	return &AppKeyStore{client: client, keyPrefix: keyPrefix}
+}
+
+func (s *AppKeyStore) keyOf(key string) string {
+	return s.keyPrefix + "key:" + key
+}
+
+func (s *AppKeyStore) tenantOf(t connector.Tenant) string {
+	return s.keyPrefix + "tenant:" + string(t)
+}
+
+// Lookup returns the connector.AppKey of the key, connector.ErrUnknownAppKey if there is none or it is expired.
+func (s *AppKeyStore) Lookup(ctx context.Context, key string) (connector.AppKey, error) {
+	data, err := s.client.Get(ctx, s.keyOf(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return connector.AppKey{}, connector.ErrUnknownAppKey
+	}
+	if err != nil {
+		return connector.AppKey{}, err
+	}
+
+	var k connector.AppKey
+	if err := json.Unmarshal(data, &k); err != nil {
+		return connector.AppKey{}, err
+	}
+	return k, nil
+}
+
+// Put adds the connector.AppKey, or replaces the one with the same Key.
+func (s *AppKeyStore) Put(ctx context.Context, k connector.AppKey) error {
+	data, err := json.Marshal(k)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.TxPipelined(
+		ctx, func(p redis.Pipeliner) error {
+			p.Set(ctx, s.keyOf(k.Key), data, 0)
+			if !k.ExpiresAt.IsZero() {
+				p.PExpireAt(ctx, s.keyOf(k.Key), k.ExpiresAt)
+			}
+			p.SAdd(ctx, s.tenantOf(k.Tenant), k.Key)
+			return nil
+		},
+	)
+	return err
+}
+
+// Revoke removes the connector.AppKey of the key immediately.
+func (s *AppKeyStore) Revoke(ctx context.Context, key string) error {
+	k, err := s.Lookup(ctx, key)
+	if errors.Is(err, connector.ErrUnknownAppKey) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = s.client.TxPipelined(
+		ctx, func(p redis.Pipeliner) error {
+			p.Del(ctx, s.keyOf(key))
+			p.SRem(ctx, s.tenantOf(k.Tenant), key)
+			return nil
+		},
+	)
+	return err
+}
+
+// Keys returns the unexpired connector.AppKey of the tenant, and removes the expired ones from the set of the tenant.
+func (s *AppKeyStore) Keys(ctx context.Context, t connector.Tenant) ([]connector.AppKey, error) {
+	members, err := s.client.SMembers(ctx, s.tenantOf(t)).Result()
+	if err != nil || len(members) == 0 {
+		return nil, err
+	}
+	sort.Strings(members)
+
+	keys := make([]connector.AppKey, 0, len(members))
+	var expired []interface{}
+	for _, m := range members {
+		k, err := s.Lookup(ctx, m)
+		if errors.Is(err, connector.ErrUnknownAppKey) {
+			expired = append(expired, m)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	if len(expired) > 0 {
+		if err := s.client.SRem(ctx, s.tenantOf(t), expired...).Err(); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+var (
+	// lockScript sets the lock to the owner with the TTL if it's free or already held by the owner.
+	lockScript = redis.NewScript(`
+local v = redis.call("GET", KEYS[1])
+if v == false or v == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+return 0`)
+	// unlockScript deletes the lock only if it's held by the owner.
+	unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+// Locker is a connector.Locker keeping each lock as a string of the owner with the TTL in Redis,
+// so that a Room created with connector.WithRoomLock is open on one server node at a time.
+type Locker struct {
+	client    redis.UniversalClient
+	keyPrefix string
+}
+
+// NewLocker creates a Locker over the Redis client, the keys are prefixed with keyPrefix,
+// default is "ppcserver:lock:" if empty.
+func NewLocker(client redis.UniversalClient, keyPrefix string) *Locker {
+	if keyPrefix == "" {
+		keyPrefix = "ppcserver:lock:"
+	}
+	return &Locker{client: client, keyPrefix: keyPrefix}
+}
+
+// Lock acquires the lock of the key for the owner, which expires after ttl, or extends the lock already
+// held by the owner. It returns connector.ErrLockHeld if the lock is held by another owner.
+func (l *Locker) Lock(ctx context.Context, key, owner string, ttl time.Duration) error {
+	ok, err := lockScript.Run(ctx, l.client, []string{l.keyPrefix + key}, owner, ttl.Milliseconds()).Bool()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return connector.ErrLockHeld
+	}
+	return nil
+}
+
+// Unlock releases the lock of the key if it's held by the owner.
+func (l *Locker) Unlock(ctx context.Context, key, owner string) error {
+	return unlockScript.Run(ctx, l.client, []string{l.keyPrefix + key}, owner).Err()
+}
+
+// RoomSnapshotStore is a connector.RoomSnapshotStore saving each connector.RoomSnapshot as a JSON string in Redis,
+// so that a Room created with connector.WithRoomFailover is recovered by another server node.
+type RoomSnapshotStore struct {
+	client    redis.UniversalClient
+	keyPrefix string
+}
+
+// NewRoomSnapshotStore creates a RoomSnapshotStore over the Redis client, the keys are prefixed with keyPrefix,
+// default is "ppcserver:room:" if empty.
+func NewRoomSnapshotStore(client redis.UniversalClient, keyPrefix string) *RoomSnapshotStore {
+	if keyPrefix == "" {
+		keyPrefix = "ppcserver:room:"
+	}
+	return &RoomSnapshotStore{client: client, keyPrefix: keyPrefix}
+}
+
+// Save saves the connector.RoomSnapshot of the room, replacing the previous one.
+func (s *RoomSnapshotStore) Save(ctx context.Context, room string, snap connector.RoomSnapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.keyPrefix+room, data, 0).Err()
+}
+
+// Load returns the connector.RoomSnapshot of the room, or connector.ErrRoomSnapshotNotFound if there is none.
+func (s *RoomSnapshotStore) Load(ctx context.Context, room string) (connector.RoomSnapshot, error) {
+	data, err := s.client.Get(ctx, s.keyPrefix+room).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return connector.RoomSnapshot{}, connector.ErrRoomSnapshotNotFound
+	}
+	if err != nil {
+		return connector.RoomSnapshot{}, err
+	}
+
+	var snap connector.RoomSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return connector.RoomSnapshot{}, err
+	}
+	return snap, nil
+}
+
+// Delete removes the connector.RoomSnapshot of the room.
+func (s *RoomSnapshotStore) Delete(ctx context.Context, room string) error {
+	return s.client.Del(ctx, s.keyPrefix+room).Err()
+}
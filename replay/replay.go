@@ -0,0 +1,180 @@
+// Package replay feeds the frames recorded by connector.NewJSONFrameRecorder back through a Router
+// at the original pacing, for reproducing the bugs reported from production:
+//
+//	frames, err := replay.Load(file)
+//	for _, session := range replay.Sessions(frames) {
+//		out, err := replay.New(replay.WithSpeed(10)).Run(ctx, session, connector.NewOptions(connector.WithRouter(r)))
+//	}
+package replay
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/transporttest"
+	"io"
+	"sort"
+	"time"
+)
+
+type (
+	// Option is a function to apply various configurations to customize a Replayer.
+	Option func(o *Options)
+
+	// Options hold the configurable parts of a Replayer.
+	Options struct {
+		// Speed scales the original pacing, such as 2 for replaying twice as fast, zero for no delay.
+		// Default is 1 (the original pacing) if not set via WithSpeed.
+		Speed float64
+
+		// Settle is the time to wait for the outbound frames after the last inbound frame is replayed.
+		// Default is 100 milliseconds if not set via WithSettle.
+		Settle time.Duration
+	}
+
+	// Replayer replays the inbound frames of a recorded session to a Client over an in-memory Transport.
+	Replayer struct {
+		opts *Options
+	}
+)
+
+func defaultOptions() *Options {
+	return &Options{
+		Speed:  1,
+		Settle: 100 * time.Millisecond,
+	}
+}
+
+// New creates a Replayer.
+func New(opts ...Option) *Replayer {
+	r := &Replayer{
+		opts: defaultOptions(),
+	}
+
+	// Apply opts to customize Replayer.
+	for _, opt := range opts {
+		opt(r.opts)
+	}
+
+	return r
+}
+
+// Load reads the frames written as JSON lines by connector.NewJSONFrameRecorder.
+func Load(r io.Reader) ([]connector.Frame, error) {
+	var frames []connector.Frame
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var f connector.Frame
+		if err := dec.Decode(&f); err != nil {
+			if errors.Is(err, io.EOF) {
+				return frames, nil
+			}
+			return frames, err
+		}
+		frames = append(frames, f)
+	}
+}
+
+// Sessions groups the frames by the recorded Client, ordered by the time of their first frame,
+// and each session is ordered by time.
+func Sessions(frames []connector.Frame) [][]connector.Frame {
+	index := make(map[uint64]int)
+	var sessions [][]connector.Frame
+	for _, f := range frames {
+		i, ok := index[f.ClientID]
+		if !ok {
+			i = len(sessions)
+			index[f.ClientID] = i
+			sessions = append(sessions, nil)
+		}
+		sessions[i] = append(sessions[i], f)
+	}
+	for _, s := range sessions {
+		sort.SliceStable(s, func(i, j int) bool { return s[i].Time.Before(s[j].Time) })
+	}
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i][0].Time.Before(sessions[j][0].Time) })
+	return sessions
+}
+
+// Run starts a Client with the opts over an in-memory Transport, sends the inbound frames of the session
+// at the recorded pacing, and returns the outbound frames written by the Client, which can be compared
+// with the recorded ones. The Client is closed once the Settle time after the last inbound frame passes.
+func (r *Replayer) Run(ctx context.Context, session []connector.Frame, opts *connector.Options) ([]connector.Frame, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	peer, done := transporttest.Serve(ctx, opts)
+
+	outCh := make(chan []connector.Frame, 1)
+	go func() {
+		var out []connector.Frame
+		for {
+			data, err := peer.Receive(context.Background())
+			if err != nil {
+				outCh <- out
+				return
+			}
+			out = append(out, connector.Frame{Direction: connector.MessageDirectionOutbound, Time: time.Now(), Data: data})
+		}
+	}()
+
+	var (
+		start time.Time
+		err   error
+	)
+	replayStart := time.Now()
+	for _, f := range session {
+		if f.Direction != connector.MessageDirectionInbound {
+			continue
+		}
+		if start.IsZero() {
+			start = f.Time
+		}
+		if r.opts.Speed > 0 {
+			at := replayStart.Add(time.Duration(float64(f.Time.Sub(start)) / r.opts.Speed))
+			if err = sleep(ctx, time.Until(at)); err != nil {
+				break
+			}
+		}
+		if err = peer.Send(f.Data); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = sleep(ctx, r.opts.Settle)
+	}
+
+	_ = peer.Close()
+	<-done
+	return <-outCh, err
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WithSpeed is an Option to scale the original pacing, zero for no delay.
+func WithSpeed(s float64) Option {
+	return func(o *Options) {
+		o.Speed = s
+	}
+}
+
+// WithSettle is an Option to set the time to wait for the outbound frames after the last inbound frame.
+func WithSettle(d time.Duration) Option {
+	return func(o *Options) {
+		o.Settle = d
+	}
+}
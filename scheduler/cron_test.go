@@ -0,0 +1,98 @@
+package scheduler
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// at returns the time of the date in UTC, 2024-01-01 is a Monday.
+func at(year int, month time.Month, day, hour, min int) time.Time {
+	return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+}
+
+func TestCronNext(t *testing.T) {
+	for _, tt := range []struct {
+		spec     string
+		from     time.Time
+		expected time.Time
+	}{
+		// Values, lists, ranges, and steps.
+		{"30 10 * * *", at(2024, 1, 1, 10, 30), at(2024, 1, 2, 10, 30)},
+		{"5,10,50 * * * *", at(2024, 1, 1, 10, 10), at(2024, 1, 1, 10, 50)},
+		{"*/15 * * * *", at(2024, 1, 1, 10, 7), at(2024, 1, 1, 10, 15)},
+		{"10/20 * * * *", at(2024, 1, 1, 10, 31), at(2024, 1, 1, 10, 50)},
+		{"0 9-17/4 * * *", at(2024, 1, 1, 14, 0), at(2024, 1, 1, 17, 0)},
+		{"0 9-17/4 * * *", at(2024, 1, 1, 17, 0), at(2024, 1, 2, 9, 0)},
+		{"0 0 1 */3 *", at(2024, 11, 1, 0, 0), at(2025, 1, 1, 0, 0)},
+
+		// Day of month and day of week.
+		{"30 8 * * 1-5", at(2024, 1, 5, 9, 0), at(2024, 1, 8, 8, 30)},
+		{"0 0 * * 7", at(2024, 1, 1, 0, 0), at(2024, 1, 7, 0, 0)},
+		{"0 0 * * 0", at(2024, 1, 1, 0, 0), at(2024, 1, 7, 0, 0)},
+		{"0 0 15 * 5", at(2024, 1, 1, 0, 0), at(2024, 1, 5, 0, 0)},
+		{"0 0 15 * 5", at(2024, 1, 13, 0, 0), at(2024, 1, 15, 0, 0)},
+		{"0 0 13 * *", at(2024, 1, 13, 0, 0), at(2024, 2, 13, 0, 0)},
+		{"0 0 31 * *", at(2024, 2, 1, 0, 0), at(2024, 3, 31, 0, 0)},
+
+		// Month and year rollover.
+		{"59 23 31 12 *", at(2024, 12, 31, 23, 59), at(2025, 12, 31, 23, 59)},
+		{"0 0 29 2 *", at(2024, 3, 1, 0, 0), at(2028, 2, 29, 0, 0)},
+		{"0 0 30 2 *", at(2024, 1, 1, 0, 0), time.Time{}},
+
+		// Descriptors.
+		{"@yearly", at(2024, 6, 15, 12, 0), at(2025, 1, 1, 0, 0)},
+		{"@weekly", at(2024, 1, 1, 0, 0), at(2024, 1, 7, 0, 0)},
+		{"@hourly", at(2024, 1, 1, 10, 7), at(2024, 1, 1, 11, 0)},
+		{"@every 90s", at(2024, 1, 1, 10, 7), at(2024, 1, 1, 10, 8).Add(30 * time.Second)},
+	} {
+		s, err := parseCron(tt.spec, time.UTC)
+		if err != nil {
+			t.Errorf("parseCron(%q) error = %v", tt.spec, err)
+			continue
+		}
+		if next := s.next(tt.from); !next.Equal(tt.expected) {
+			t.Errorf("%q next(%v) = %v, want %v", tt.spec, tt.from, next, tt.expected)
+		}
+	}
+}
+
+func TestCronNextInLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*60*60)
+	s, err := parseCron("0 9 * * *", loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next, expected := s.next(at(2024, 1, 1, 0, 0)), at(2024, 1, 1, 1, 0); !next.Equal(expected) {
+		t.Fatalf("next = %v, want %v", next, expected)
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"1,,2 * * * *",
+		"a * * * *",
+		"-1 * * * *",
+		"@every",
+		"@every -1s",
+		"@every x",
+		"@fortnightly",
+	} {
+		if _, err := parseCron(spec, time.UTC); !errors.Is(err, ErrInvalidCronSpec) {
+			t.Errorf("parseCron(%q) error = %v, want ErrInvalidCronSpec", spec, err)
+		}
+	}
+}
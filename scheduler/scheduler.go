@@ -0,0 +1,303 @@
+// Package scheduler provides a server-owned Scheduler for the delayed and recurring tasks,
+// such as game ticks, cleanups, and timed events, which runs as a ppcserver Component.
+package scheduler
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"github.com/pom-pom-crafts/ppcserver/clock"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Option is a function to apply various configurations to customize a Scheduler.
+	Option func(o *Options)
+
+	// Options hold the configurable parts of a Scheduler.
+	Options struct {
+		// Location is the time zone of the cron specs.
+		// Default is time.Local if not set via WithLocation.
+		Location *time.Location
+
+		// Logger is the Logger for the panics of the tasks.
+		// Default is logging.Default() if not set via WithLogger.
+		Logger logging.Logger
+
+		// Clock is the time source of the tasks, such as a clock.Fake to run the tasks deterministically in tests,
+		// where the due tasks are started by clock.Fake.Advance but still run in their own goroutines.
+		// Default is clock.Real() if not set via WithClock.
+		Clock clock.Clock
+
+		// Leader reports whether the current node is the leader of the cluster, such as leader.Elector.IsLeader,
+		// so that the tasks run on exactly one node. The runs due while not the leader are skipped.
+		// Default is nil (always run) if not set via WithLeader.
+		Leader func() bool
+	}
+
+	// TaskFunc is the function of a Task, ctx is done when the Scheduler is shutting down.
+	TaskFunc func(ctx context.Context)
+
+	// Scheduler runs the tasks at their scheduled time, each run in its own goroutine.
+	// Tasks can be added before the Scheduler is started, and they are run once started.
+	// A recurring Task skips a run while its previous run is still running, so slow runs never pile up.
+	Scheduler struct {
+		opts   *Options
+		mu     sync.Mutex // mu guards tasks.
+		tasks  taskHeap
+		wakeCh chan struct{}
+		runs   sync.WaitGroup
+	}
+
+	// Task is a function scheduled on a Scheduler.
+	Task struct {
+		s        *Scheduler
+		f        TaskFunc
+		schedule schedule // schedule is nil for a one-shot Task.
+		next     time.Time
+		index    int   // index is the position in Scheduler.tasks, -1 if not scheduled, guarded by Scheduler.mu.
+		running  int32 // running is 1 while a run of the Task is running, accessed atomically.
+	}
+
+	// schedule computes the next run time after t, zero time means no more runs.
+	schedule interface {
+		next(t time.Time) time.Time
+	}
+
+	taskHeap []*Task
+)
+
+// New creates a new Scheduler, which should be registered to the Server by ppcserver.WithComponent.
+func New(opts ...Option) *Scheduler {
+	s := &Scheduler{
+		opts: &Options{
+			Location: time.Local,
+			Logger:   logging.Default(),
+			Clock:    clock.Real(),
+		},
+		wakeCh: make(chan struct{}, 1),
+	}
+
+	// Apply opts to customize Scheduler.
+	for _, opt := range opts {
+		opt(s.opts)
+	}
+
+	return s
+}
+
+// WithLocation is an Option to set the time zone of the cron specs.
+func WithLocation(loc *time.Location) Option {
+	return func(o *Options) {
+		o.Location = loc
+	}
+}
+
+// WithLogger is an Option to set the Logger, such as an adapter over zap or slog.
+func WithLogger(l logging.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
+
+// WithClock is an Option to set the time source of the tasks, such as a clock.Fake in tests.
+func WithClock(c clock.Clock) Option {
+	return func(o *Options) {
+		o.Clock = c
+	}
+}
+
+// WithLeader is an Option to run the tasks only while leader reports the current node is the leader,
+// such as leader.Elector.IsLeader for the cluster-singleton tasks.
+func WithLeader(leader func() bool) Option {
+	return func(o *Options) {
+		o.Leader = leader
+	}
+}
+
+// After runs f once after the duration d.
+func (s *Scheduler) After(d time.Duration, f TaskFunc) *Task {
+	return s.add(&Task{f: f, next: s.opts.Clock.Now().Add(d)})
+}
+
+// At runs f once at the time t.
+func (s *Scheduler) At(t time.Time, f TaskFunc) *Task {
+	return s.add(&Task{f: f, next: t})
+}
+
+// Every runs f every interval d, starting after d.
+func (s *Scheduler) Every(d time.Duration, f TaskFunc) *Task {
+	if d <= 0 {
+		panic("scheduler: non-positive interval for Every")
+	}
+	return s.add(&Task{f: f, schedule: everySchedule(d), next: s.opts.Clock.Now().Add(d)})
+}
+
+// Cron runs f at the times matching the cron spec in Options.Location,
+// such as "*/5 * * * *" for every 5 minutes, "0 4 * * 1" for 4am every Monday, or "@every 1h30m".
+func (s *Scheduler) Cron(spec string, f TaskFunc) (*Task, error) {
+	sch, err := parseCron(spec, s.opts.Location)
+	if err != nil {
+		return nil, err
+	}
+	next := sch.next(s.opts.Clock.Now())
+	if next.IsZero() {
+		return nil, fmt.Errorf("%w %q: never matches", ErrInvalidCronSpec, spec)
+	}
+	return s.add(&Task{f: f, schedule: sch, next: next}), nil
+}
+
+// Start runs the scheduled tasks and blocks until ctx is done.
+func (s *Scheduler) Start(ctx context.Context) error {
+	// The timer signals instead of a channel timer, so that it works the same on any clock.Clock.
+	// A stale signal only makes the loop recompute the wait.
+	fired := make(chan struct{}, 1)
+	timer := s.opts.Clock.AfterFunc(
+		time.Hour, func() {
+			select {
+			case fired <- struct{}{}:
+			default:
+			}
+		},
+	)
+	defer timer.Stop()
+	for {
+		wait := s.runDue(ctx, s.opts.Clock.Now())
+
+		timer.Reset(wait)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-fired:
+		case <-s.wakeCh:
+		}
+	}
+}
+
+// Shutdown waits for the running tasks to return or ctx is done, the pending runs are discarded.
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.runs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Len returns the number of scheduled tasks.
+func (s *Scheduler) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.tasks)
+}
+
+// Cancel removes the Task from the Scheduler, a running run is not interrupted.
+// It returns false if the Task has already run or been cancelled.
+func (t *Task) Cancel() bool {
+	t.s.mu.Lock()
+	defer t.s.mu.Unlock()
+	if t.index < 0 {
+		return false
+	}
+	heap.Remove(&t.s.tasks, t.index)
+	return true
+}
+
+// Next returns the next run time of the Task, zero if it is not scheduled anymore.
+func (t *Task) Next() time.Time {
+	t.s.mu.Lock()
+	defer t.s.mu.Unlock()
+	if t.index < 0 {
+		return time.Time{}
+	}
+	return t.next
+}
+
+func (s *Scheduler) add(t *Task) *Task {
+	t.s = s
+	s.mu.Lock()
+	heap.Push(&s.tasks, t)
+	s.mu.Unlock()
+
+	// Wake up Start to recompute the wait if the Task is the earliest.
+	select {
+	case s.wakeCh <- struct{}{}:
+	default:
+	}
+	return t
+}
+
+// runDue starts the runs of the due tasks and returns the wait until the next due Task.
+func (s *Scheduler) runDue(ctx context.Context, now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.tasks) > 0 {
+		t := s.tasks[0]
+		if t.next.After(now) {
+			return t.next.Sub(now)
+		}
+
+		if t.schedule == nil {
+			heap.Pop(&s.tasks)
+		} else if t.next = t.schedule.next(now); t.next.IsZero() {
+			heap.Pop(&s.tasks)
+		} else {
+			heap.Fix(&s.tasks, 0)
+		}
+		s.run(ctx, t)
+	}
+	return time.Hour
+}
+
+// run runs the Task in a new goroutine unless its previous run is still running, or the current node is not
+// the leader with Options.Leader.
+func (s *Scheduler) run(ctx context.Context, t *Task) {
+	if s.opts.Leader != nil && !s.opts.Leader() {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&t.running, 0, 1) {
+		return
+	}
+	s.runs.Add(1)
+	go func() {
+		defer s.runs.Done()
+		defer atomic.StoreInt32(&t.running, 0)
+		defer func() {
+			if r := recover(); r != nil {
+				s.opts.Logger.Error("scheduler Task panic", logging.F("panic", r))
+			}
+		}()
+		t.f(ctx)
+	}()
+}
+
+func (h taskHeap) Len() int           { return len(h) }
+func (h taskHeap) Less(i, j int) bool { return h[i].next.Before(h[j].next) }
+func (h taskHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *taskHeap) Push(x interface{}) {
+	t := x.(*Task)
+	t.index = len(*h)
+	*h = append(*h, t)
+}
+
+func (h *taskHeap) Pop() interface{} {
+	old := *h
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	t.index = -1
+	*h = old[:len(old)-1]
+	return t
+}
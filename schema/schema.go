@@ -0,0 +1,168 @@
+// Package schema exports the message contract declared by connector.Router.Describe as a machine-readable
+// Document of JSON Schema, and optionally generates the TypeScript types, so the client SDKs stay in sync
+// with the server.
+package schema
+
+import (
+	"encoding/json"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+	timeType       = reflect.TypeOf(time.Time{})
+)
+
+type (
+	// Document describes the routes of a Router, the named types are defined once in Defs and referenced by $ref.
+	Document struct {
+		Routes []Route            `json:"routes"`
+		Defs   map[string]*Schema `json:"$defs,omitempty"`
+	}
+
+	// Route describes the data of a route, see connector.RouteSchema.
+	Route struct {
+		Route       string  `json:"route"`
+		Description string  `json:"description,omitempty"`
+		Push        bool    `json:"push,omitempty"`
+		Request     *Schema `json:"request,omitempty"`
+		Response    *Schema `json:"response,omitempty"`
+	}
+
+	// Schema is the subset of JSON Schema describing the Go types encoded by encoding/json.
+	Schema struct {
+		Ref                  string             `json:"$ref,omitempty"`
+		Type                 string             `json:"type,omitempty"`
+		Format               string             `json:"format,omitempty"`
+		Properties           map[string]*Schema `json:"properties,omitempty"`
+		Required             []string           `json:"required,omitempty"`
+		Items                *Schema            `json:"items,omitempty"`
+		AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+
+		// order is the order of Properties as the struct fields, for generating the code deterministically.
+		order []string
+	}
+
+	generator struct {
+		defs map[string]*Schema
+	}
+)
+
+// Generate returns the Document of the RouteSchema declared to the Router.
+func Generate(r *connector.Router) *Document {
+	g := &generator{defs: make(map[string]*Schema)}
+	doc := &Document{Routes: make([]Route, 0)}
+	for _, s := range r.Schemas() {
+		route := Route{Route: s.Route, Description: s.Description, Push: s.Push}
+		if s.Request != nil {
+			route.Request = g.schema(reflect.TypeOf(s.Request))
+		}
+		if s.Response != nil {
+			route.Response = g.schema(reflect.TypeOf(s.Response))
+		}
+		doc.Routes = append(doc.Routes, route)
+	}
+	if len(g.defs) > 0 {
+		doc.Defs = g.defs
+	}
+	return doc
+}
+
+// JSON returns the indented JSON encoding of the Document.
+func (d *Document) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
+
+// schema returns the Schema of the type, the named struct types are defined in defs and referenced.
+func (g *generator) schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == rawMessageType:
+		return &Schema{}
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json encodes []byte as a base64 string.
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name := t.Name()
+		if _, ok := g.defs[name]; !ok {
+			// Define before generating the fields, so that a recursive type references itself.
+			g.defs[name] = &Schema{}
+			*g.defs[name] = *g.structSchema(t)
+		}
+		return &Schema{Ref: "#/$defs/" + name}
+	default:
+		// Such as interface{}, which can be any JSON value.
+		return &Schema{}
+	}
+}
+
+// structSchema returns the Schema of the struct type, with the fields encoded by encoding/json as the properties.
+func (g *generator) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() && !f.Anonymous {
+			continue
+		}
+		tag, tagged := f.Tag.Lookup("json")
+		if f.Anonymous && !tagged {
+			// encoding/json promotes the fields of an embedded struct without a name in its tag.
+			ft := f.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded := g.structSchema(ft)
+				for _, name := range embedded.order {
+					s.Properties[name] = embedded.Properties[name]
+					s.order = append(s.order, name)
+				}
+				s.Required = append(s.Required, embedded.Required...)
+				continue
+			}
+		}
+		name, opts := f.Name, ""
+		if tagged {
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ = strings.Cut(tag, ",")
+			if name == "" {
+				name = f.Name
+			}
+		}
+		s.Properties[name] = g.schema(f.Type)
+		s.order = append(s.order, name)
+		if !strings.Contains(opts, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s
+}
@@ -0,0 +1,120 @@
+package schema
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TypeScript generates the TypeScript declarations of the Document: an interface per type in Defs,
+// and the Requests, Responses and Pushes interfaces mapping the routes to the types of their data.
+func (d *Document) TypeScript() string {
+	var b strings.Builder
+	b.WriteString("// Code generated by ppcserver schema. DO NOT EDIT.\n")
+
+	names := make([]string, 0, len(d.Defs))
+	for name := range d.Defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "\nexport interface %s %s\n", name, tsObject(d.Defs[name], ""))
+	}
+
+	writeRouteMap := func(name string, include func(r Route) *Schema) {
+		fmt.Fprintf(&b, "\nexport interface %s {\n", name)
+		for _, r := range d.Routes {
+			if s := include(r); s != nil {
+				fmt.Fprintf(&b, "  %q: %s;\n", r.Route, tsType(s, "  "))
+			}
+		}
+		b.WriteString("}\n")
+	}
+	writeRouteMap(
+		"Requests", func(r Route) *Schema {
+			if r.Push {
+				return nil
+			}
+			return orAny(r.Request)
+		},
+	)
+	writeRouteMap(
+		"Responses", func(r Route) *Schema {
+			if r.Push {
+				return nil
+			}
+			return orAny(r.Response)
+		},
+	)
+	writeRouteMap(
+		"Pushes", func(r Route) *Schema {
+			if !r.Push {
+				return nil
+			}
+			return orAny(r.Response)
+		},
+	)
+	return b.String()
+}
+
+// orAny returns the Schema, or a Schema of any value for nil.
+func orAny(s *Schema) *Schema {
+	if s == nil {
+		return &Schema{}
+	}
+	return s
+}
+
+// tsType returns the TypeScript type of the Schema, indent is the indentation of the enclosing line.
+func tsType(s *Schema, indent string) string {
+	if s.Ref != "" {
+		return strings.TrimPrefix(s.Ref, "#/$defs/")
+	}
+	switch s.Type {
+	case "boolean":
+		return "boolean"
+	case "integer", "number":
+		return "number"
+	case "string":
+		return "string"
+	case "array":
+		return tsType(s.Items, indent) + "[]"
+	case "object":
+		if s.AdditionalProperties != nil {
+			return "Record<string, " + tsType(s.AdditionalProperties, indent) + ">"
+		}
+		return tsObject(s, indent)
+	default:
+		return "unknown"
+	}
+}
+
+// tsObject returns the TypeScript object type of the struct Schema.
+func tsObject(s *Schema, indent string) string {
+	required := make(map[string]bool, len(s.Required))
+	for _, name := range s.Required {
+		required[name] = true
+	}
+
+	names := s.order
+	if len(names) != len(s.Properties) {
+		// Such as a Document decoded from JSON, which loses the order of the struct fields.
+		names = make([]string, 0, len(s.Properties))
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	var b strings.Builder
+	b.WriteString("{\n")
+	for _, name := range names {
+		optional := "?"
+		if required[name] {
+			optional = ""
+		}
+		fmt.Fprintf(&b, "%s  %q%s: %s;\n", indent, name, optional, tsType(s.Properties[name], indent+"  "))
+	}
+	b.WriteString(indent + "}")
+	return b.String()
+}
@@ -3,9 +3,11 @@ package ppcserver
 import (
 	"context"
 	"fmt"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/logging"
 	"golang.org/x/sync/errgroup"
-	"log"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -19,6 +21,36 @@ type (
 		// ShutdownTimeout is the maximum time for Component.Shutdown() to complete.
 		// Defaults to 1 minute if not set via WithShutdownTimeout.
 		ShutdownTimeout time.Duration
+
+		// Logger is the Logger for the Server.
+		// Defaults to logging.Default() if not set via WithLogger.
+		Logger logging.Logger
+
+		// MaxEventLoopLag is the maximum delay of the event loop watchdog ticks before the liveness fails,
+		// the watchdog is disabled if not positive. Defaults to 5 seconds if not set via WithMaxEventLoopLag.
+		MaxEventLoopLag time.Duration
+
+		// HealthCheckTimeout is the maximum time for the health endpoints to run their HealthCheck.
+		// Defaults to 3 seconds.
+		HealthCheckTimeout time.Duration
+
+		// LivenessChecks are the additional HealthCheck of the liveness endpoint, set via WithLivenessCheck.
+		LivenessChecks []HealthCheck
+
+		// ReadinessChecks are the additional HealthCheck of the readiness endpoint, set via WithReadinessCheck.
+		ReadinessChecks []HealthCheck
+
+		// ReconnectHint enables pushing a connector.ReconnectHint to the authorized clients on SIGINT/SIGTERM,
+		// before the components are shut down, see WithReconnectHint. Default is false.
+		ReconnectHint bool
+
+		// ReconnectAddr is the address in the connector.ReconnectHint, empty for the same address.
+		ReconnectAddr string
+
+		// ReconnectAfter is the delay of the clients to reconnect, and ReconnectJitter randomizes it per Client.
+		// The Server waits up to ReconnectAfter+ReconnectJitter for the clients to leave before shutting down.
+		ReconnectAfter  time.Duration
+		ReconnectJitter time.Duration
 	}
 
 	Component interface {
@@ -29,12 +61,27 @@ type (
 	Server struct {
 		opts       *ServerOptions
 		components []Component
+		startedAt  int64 // startedAt is the UnixNano when Start is invoked, accessed atomically.
+		lastTick   int64 // lastTick is the UnixNano of the last event loop watchdog tick, accessed atomically.
+		draining   int32 // draining is 1 once the Server begins shutting down, accessed atomically.
+	}
+
+	// Stats is a snapshot of the Server statistics for embedding into application dashboards.
+	Stats struct {
+		// StartedAt is the time when Server.Start() is invoked, zero if the Server is not started.
+		StartedAt time.Time
+		// Connector is the connection statistics of all the clients in the current process.
+		Connector connector.Stats
 	}
 )
 
 func defaultServerOptions() *ServerOptions {
 	return &ServerOptions{
 		ShutdownTimeout: 1 * time.Minute,
+		Logger:          logging.Default(),
+
+		MaxEventLoopLag:    5 * time.Second,
+		HealthCheckTimeout: 3 * time.Second,
 	}
 }
 
@@ -52,22 +99,38 @@ func NewServer(opts ...ServerOption) *Server {
 }
 
 func (s *Server) Start() {
+	atomic.StoreInt64(&s.startedAt, time.Now().UnixNano())
+
 	// The ctx.Done channel returns from signal.NotifyContext() will be closed when SIGINT/SIGTERM signal is received.
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
+	if s.opts.ReconnectHint {
+		var cancel context.CancelFunc
+		ctx, cancel = s.handOffClients(ctx)
+		defer cancel()
+	}
+
+	// The watchdog keeps ticking until the Server is shutdown complete, so liveness holds while draining.
+	watchdogCtx, stopWatchdog := context.WithCancel(context.Background())
+	defer stopWatchdog()
+	if s.opts.MaxEventLoopLag > 0 {
+		go s.runEventLoopWatchdog(watchdogCtx)
+	}
 
 	// The ctx.Done channel returns from errgroup.WithContext() will be closed when SIGINT/SIGTERM signal is received,
 	// or the first time any Component.Start() method which passed to g.Go() returns a non-nil error,
 	// or g.Wait() returns, whichever occurs first.
 	g, ctx := errgroup.WithContext(ctx)
 	for _, c := range s.components {
+		c := c // Capture the loop variable for the closures below.
+
 		// g.Go(f func() error) runs each f in a goroutine.
 		g.Go(
 			func() error {
 				// TODO, should we recover panic and log with error here?
 
 				// Component.Start() may block here, and its implementation should return when ctx.Done is closed.
-				log.Printf("ppcserver: starting component: %T", c)
+				s.opts.Logger.Info("starting component", logging.F("component", fmt.Sprintf("%T", c)))
 				return c.Start(ctx)
 			},
 		)
@@ -75,7 +138,8 @@ func (s *Server) Start() {
 			func() error {
 				// Component.Shutdown() will not be invoked until ctx.Done is closed.
 				<-ctx.Done()
-				log.Printf("ppcserver: shutting down component: %T", c)
+				atomic.StoreInt32(&s.draining, 1)
+				s.opts.Logger.Info("shutting down component", logging.F("component", fmt.Sprintf("%T", c)))
 
 				// This goroutine returns when either Component.Shutdown() is complete before ShutdownTimeout,
 				// or the ShutdownTimeout has passed.
@@ -89,18 +153,46 @@ func (s *Server) Start() {
 					shutdownErrCh <- timeoutCtx.Err()
 				case shutdownErrCh <- c.Shutdown(timeoutCtx):
 				}
-				return fmt.Errorf("ppcserver: %T.Shutdown() error: %w", c, <-shutdownErrCh)
+				if err := <-shutdownErrCh; err != nil {
+					return fmt.Errorf("ppcserver: %T.Shutdown() error: %w", c, err)
+				}
+				return nil
 			},
 		)
 	}
 	// g.Wait() waits until all the blocking functions in g.Go() returns.
 	if err := g.Wait(); err != nil {
-		log.Println("ppcserver: server shutdown complete with error:", err)
+		s.opts.Logger.Error("server shutdown complete with error", logging.Err(err))
 	} else {
-		log.Println("ppcserver: server shutdown complete")
+		s.opts.Logger.Info("server shutdown complete")
 	}
 }
 
+// Stats returns a snapshot of the Server statistics,
+// including counts per ClientState and transport, message throughput, and queue depths.
+func (s *Server) Stats() Stats {
+	var startedAt time.Time
+	if ns := atomic.LoadInt64(&s.startedAt); ns != 0 {
+		startedAt = time.Unix(0, ns)
+	}
+	return Stats{
+		StartedAt: startedAt,
+		Connector: connector.CollectStats(),
+	}
+}
+
+// PushToTag pushes a one-way Message with the route and the encoded v to the authorized clients of
+// connector.DefaultTenant with the tag in the current process, see connector.Tenant.PushToTag for the others.
+func (s *Server) PushToTag(tag, route string, v interface{}) error {
+	return connector.PushToTag(tag, route, v)
+}
+
+// FindClients returns the clients started in the current process, of all the tenants, for which match returns
+// true, see connector.Tenant.FindClients for the indexed lookups within a Tenant.
+func (s *Server) FindClients(match func(c *connector.Client) bool) []*connector.Client {
+	return connector.FindClients(match)
+}
+
 // WithComponent is a ServerOption to register a Component to Server.components.
 func WithComponent(c Component) ServerOption {
 	return func(s *Server) {
@@ -114,3 +206,10 @@ func WithShutdownTimeout(d time.Duration) ServerOption {
 		s.opts.ShutdownTimeout = d
 	}
 }
+
+// WithLogger is a ServerOption to set the Logger, such as an adapter over zap or slog.
+func WithLogger(l logging.Logger) ServerOption {
+	return func(s *Server) {
+		s.opts.Logger = l
+	}
+}
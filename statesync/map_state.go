@@ -0,0 +1,77 @@
+package statesync
+
+import "sort"
+
+type (
+	// MapState is a State of the keyed values, such as the entities of a game by id, whose deltas carry
+	// the values set and the keys deleted since the previous tick only.
+	MapState struct {
+		values  map[string]interface{}
+		changed map[string]bool // changed is the keys set or deleted since the previous Delta.
+	}
+
+	// MapDelta is the Delta of a MapState.
+	MapDelta struct {
+		Set     map[string]interface{} `json:"set,omitempty"`
+		Deleted []string               `json:"deleted,omitempty"`
+	}
+)
+
+// NewMapState creates an empty MapState.
+func NewMapState() *MapState {
+	return &MapState{
+		values:  make(map[string]interface{}),
+		changed: make(map[string]bool),
+	}
+}
+
+// Set sets the value of the key.
+func (s *MapState) Set(key string, v interface{}) {
+	s.values[key] = v
+	s.changed[key] = true
+}
+
+// Delete deletes the key, it's OK if the key does not exist.
+func (s *MapState) Delete(key string) {
+	if _, ok := s.values[key]; !ok {
+		return
+	}
+	delete(s.values, key)
+	s.changed[key] = true
+}
+
+// Get returns the value of the key, or false if the key does not exist.
+func (s *MapState) Get(key string) (interface{}, bool) {
+	v, ok := s.values[key]
+	return v, ok
+}
+
+// Snapshot returns a copy of all the values.
+func (s *MapState) Snapshot() interface{} {
+	values := make(map[string]interface{}, len(s.values))
+	for k, v := range s.values {
+		values[k] = v
+	}
+	return values
+}
+
+// Delta returns the MapDelta since the previous call, nil if nothing is changed.
+func (s *MapState) Delta() interface{} {
+	if len(s.changed) == 0 {
+		return nil
+	}
+	d := &MapDelta{}
+	for k := range s.changed {
+		if v, ok := s.values[k]; ok {
+			if d.Set == nil {
+				d.Set = make(map[string]interface{})
+			}
+			d.Set[k] = v
+		} else {
+			d.Deleted = append(d.Deleted, k)
+		}
+	}
+	sort.Strings(d.Deleted)
+	s.changed = make(map[string]bool)
+	return d
+}
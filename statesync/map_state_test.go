@@ -0,0 +1,50 @@
+package statesync
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMapStateDelta(t *testing.T) {
+	s := NewMapState()
+	s.Set("a", 1)
+	s.Set("b", 2)
+	s.Delta()
+
+	for _, tt := range []struct {
+		name     string
+		change   func()
+		expected interface{}
+	}{
+		{"unchanged", func() {}, nil},
+		{"set", func() { s.Set("c", 3) }, &MapDelta{Set: map[string]interface{}{"c": 3}}},
+		{"overwritten", func() { s.Set("a", 10); s.Set("a", 11) }, &MapDelta{Set: map[string]interface{}{"a": 11}}},
+		{"deleted", func() { s.Delete("b"); s.Delete("c") }, &MapDelta{Deleted: []string{"b", "c"}}},
+		{"deleted absent", func() { s.Delete("missing") }, nil},
+		{"set then deleted", func() { s.Set("a", 12); s.Delete("a") }, &MapDelta{Deleted: []string{"a"}}},
+		{"deleted then set", func() { s.Set("d", 4); s.Delta(); s.Delete("d"); s.Set("d", 5) },
+			&MapDelta{Set: map[string]interface{}{"d": 5}}},
+	} {
+		tt.change()
+		if d := s.Delta(); !reflect.DeepEqual(d, tt.expected) {
+			t.Errorf("%s: Delta() = %+v, want %+v", tt.name, d, tt.expected)
+		}
+	}
+	if d := s.Delta(); d != nil {
+		t.Fatalf("Delta() after the changes are taken = %+v, want nil", d)
+	}
+}
+
+func TestMapStateSnapshot(t *testing.T) {
+	s := NewMapState()
+	s.Set("a", 1)
+	snapshot := s.Snapshot().(map[string]interface{})
+	s.Set("a", 2)
+	s.Set("b", 3)
+	if !reflect.DeepEqual(snapshot, map[string]interface{}{"a": 1}) {
+		t.Fatalf("snapshot = %v, want a copy of {a: 1}", snapshot)
+	}
+	if v, ok := s.Get("a"); !ok || v != 2 {
+		t.Fatalf("Get(a) = %v, %v, want 2", v, ok)
+	}
+}
@@ -0,0 +1,182 @@
+// Package statesync provides a Sync that keeps the members of a Room in sync with an application state,
+// by pushing a full snapshot to each new member and the compact deltas to all the members at a fixed tick rate,
+// which runs as a ppcserver Component.
+package statesync
+
+import (
+	"context"
+	"github.com/pom-pom-crafts/ppcserver/clock"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/logging"
+	"sync"
+	"time"
+)
+
+const (
+	// RouteSnapshot is the route of the one-way Message pushed to a new member with the full state in a Frame.
+	RouteSnapshot = "state.snapshot"
+	// RouteDelta is the route of the one-way Message broadcast to the members with the changes of a tick in a Frame.
+	RouteDelta = "state.delta"
+)
+
+type (
+	// Option is a function to apply various configurations to customize a Sync.
+	Option func(o *Options)
+
+	// Options hold the configurable parts of a Sync.
+	Options struct {
+		// TickRate is the number of ticks per second, each broadcasts the changes since the previous tick.
+		// Tick numbers the ticks with changes only, so an idle State costs nothing.
+		// Default is 10 if not set via WithTickRate.
+		TickRate int
+
+		// Logger is the Logger for the failures of the broadcasts.
+		// Default is logging.Default() if not set via WithLogger.
+		Logger logging.Logger
+
+		// Clock is the time source of the ticks, such as a clock.Fake in tests.
+		// Default is clock.Real() if not set via WithClock.
+		Clock clock.Clock
+	}
+
+	// State is the application state synced to the members of a Room, such as a MapState.
+	// Its methods are called while holding the lock of the Sync, so they need no locking of their own
+	// as long as the state is only changed by Sync.Update.
+	State interface {
+		// Snapshot returns the full state encoded for a new member.
+		Snapshot() interface{}
+		// Delta returns the changes since the previous call to Delta, nil if nothing is changed.
+		Delta() interface{}
+	}
+
+	// Frame is the data of the RouteSnapshot and the RouteDelta messages. A member applies the deltas in the order
+	// of Tick after its snapshot, a gap in Tick means a delta is lost and the member should rejoin for a snapshot.
+	Frame struct {
+		Tick uint64      `json:"tick"`
+		Data interface{} `json:"data"`
+	}
+
+	// Sync broadcasts the changes of a State to the members of a Room every tick.
+	Sync struct {
+		opts  *Options
+		room  *connector.Room
+		mu    sync.Mutex // mu guards state and tick.
+		state State
+		tick  uint64
+	}
+)
+
+// New creates a new Sync of the state to the members of the room, which should be registered to the Server
+// by ppcserver.WithComponent, or started along with the Room.
+func New(room *connector.Room, state State, opts ...Option) *Sync {
+	s := &Sync{
+		opts: &Options{
+			TickRate: 10,
+			Logger:   logging.Default(),
+			Clock:    clock.Real(),
+		},
+		room:  room,
+		state: state,
+	}
+
+	// Apply opts to customize Sync.
+	for _, opt := range opts {
+		opt(s.opts)
+	}
+
+	return s
+}
+
+// WithTickRate is an Option to set the number of ticks per second.
+func WithTickRate(n int) Option {
+	return func(o *Options) {
+		o.TickRate = n
+	}
+}
+
+// WithLogger is an Option to set the Logger, such as an adapter over zap or slog.
+func WithLogger(l logging.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
+
+// WithClock is an Option to set the time source of the ticks, such as a clock.Fake in tests.
+func WithClock(c clock.Clock) Option {
+	return func(o *Options) {
+		o.Clock = c
+	}
+}
+
+// Update calls f to change the State, the changes are broadcast by the next tick.
+func (s *Sync) Update(f func(state State)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f(s.state)
+}
+
+// Join adds the Client to the Room and pushes the snapshot of the State to it, so that it receives
+// the deltas from the next tick on.
+func (s *Sync) Join(c *connector.Client) error {
+	// Hold mu so that no tick happens in between, which would be missed by the snapshot or the Client.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.room.Join(c); err != nil {
+		return err
+	}
+	return c.Push(RouteSnapshot, Frame{Tick: s.tick, Data: s.state.Snapshot()})
+}
+
+// Tick returns the number of the ticks broadcast so far.
+func (s *Sync) Tick() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tick
+}
+
+// Start broadcasts the changes of the State every tick and blocks until ctx is done or the Room is closed.
+func (s *Sync) Start(ctx context.Context) error {
+	interval := time.Second / time.Duration(s.opts.TickRate)
+	// The timer signals instead of a channel timer, so that it works the same on any clock.Clock.
+	fired := make(chan struct{}, 1)
+	timer := s.opts.Clock.AfterFunc(
+		interval, func() {
+			select {
+			case fired <- struct{}{}:
+			default:
+			}
+		},
+	)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-fired:
+		}
+		if err := s.broadcastDelta(); err == connector.ErrRoomClosed {
+			return nil
+		} else if err != nil {
+			s.opts.Logger.Warn("Sync broadcast delta error", logging.F("room", s.room.Name()), logging.Err(err))
+		}
+		timer.Reset(interval)
+	}
+}
+
+// Shutdown does nothing, as the members are closed along with the connectors.
+func (s *Sync) Shutdown(_ context.Context) error {
+	return nil
+}
+
+// broadcastDelta broadcasts the changes since the previous tick, a tick without changes broadcasts nothing
+// and keeps Tick, so the members see no gap.
+func (s *Sync) broadcastDelta() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delta := s.state.Delta()
+	if delta == nil {
+		return nil
+	}
+	s.tick++
+	return s.room.Broadcast(RouteDelta, Frame{Tick: s.tick, Data: delta})
+}
@@ -0,0 +1,173 @@
+package statesync_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pom-pom-crafts/ppcserver/clock"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"github.com/pom-pom-crafts/ppcserver/statesync"
+	"github.com/pom-pom-crafts/ppcserver/transporttest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const interval = time.Second / 10
+
+// frame is a statesync.Frame of a MapState as received by a member.
+type frame struct {
+	Tick uint64 `json:"tick"`
+	Data struct {
+		Set     map[string]float64 `json:"set"`
+		Deleted []string           `json:"deleted"`
+	} `json:"data"`
+}
+
+// replica is the MapState of a member, rebuilt from its snapshot and the deltas.
+type replica struct {
+	t      *testing.T
+	peer   *transporttest.Peer
+	tick   uint64
+	values map[string]float64
+}
+
+// setup starts a Sync of a MapState of 10 ticks per second on a fake clock for a new Room.
+func setup(t *testing.T, name string) (*clock.Fake, *statesync.Sync, *connector.Options) {
+	t.Helper()
+	room, err := connector.CreateRoom(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(room.Close)
+
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	s := statesync.New(room, statesync.NewMapState(), statesync.WithTickRate(10), statesync.WithClock(clk))
+	router := connector.NewRouter()
+	router.Handle(
+		"join", func(_ context.Context, c *connector.Client, _ *connector.Message) (interface{}, error) {
+			return nil, s.Join(c)
+		},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() {
+		_ = s.Start(ctx)
+	}()
+	return clk, s, connector.NewOptions(connector.WithRouter(router))
+}
+
+// join connects a member, and rebuilds its replica from the snapshot.
+func join(t *testing.T, opts *connector.Options) *replica {
+	t.Helper()
+	peer, _ := transporttest.Serve(context.Background(), opts)
+	t.Cleanup(func() { _ = peer.Close() })
+	if err := peer.SendMessage(&connector.Message{ID: 1, Route: "join"}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &replica{t: t, peer: peer}
+	m := r.receive()
+	var snapshot struct {
+		Tick uint64             `json:"tick"`
+		Data map[string]float64 `json:"data"`
+	}
+	if m.Route != statesync.RouteSnapshot || json.Unmarshal(m.Data, &snapshot) != nil {
+		t.Fatalf("received %s:%s, want %s", m.Route, m.Data, statesync.RouteSnapshot)
+	}
+	r.tick, r.values = snapshot.Tick, snapshot.Data
+	if r.values == nil {
+		r.values = make(map[string]float64)
+	}
+	if m := r.receive(); m.ID != 1 || m.Error != "" {
+		t.Fatalf("join response = %+v", m)
+	}
+	return r
+}
+
+func (r *replica) receive() *connector.Message {
+	r.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	m, err := r.peer.ReceiveMessage(ctx)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return m
+}
+
+// apply applies the next delta received, which must follow the tick of the replica without a gap.
+func (r *replica) apply() {
+	r.t.Helper()
+	m := r.receive()
+	var f frame
+	if m.Route != statesync.RouteDelta || json.Unmarshal(m.Data, &f) != nil {
+		r.t.Fatalf("received %s:%s, want %s", m.Route, m.Data, statesync.RouteDelta)
+	}
+	if f.Tick != r.tick+1 {
+		r.t.Fatalf("delta of tick %d after tick %d", f.Tick, r.tick)
+	}
+	r.tick = f.Tick
+	for k, v := range f.Data.Set {
+		r.values[k] = v
+	}
+	for _, k := range f.Data.Deleted {
+		delete(r.values, k)
+	}
+}
+
+// tick advances clk by a tick once the Sync is waiting for it, and waits for the tick to complete.
+func tick(t *testing.T, clk *clock.Fake) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for clk.Len() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the Sync never waits for the next tick")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(interval)
+	for clk.Len() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the tick never completes")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func update(s *statesync.Sync, f func(m *statesync.MapState)) {
+	s.Update(func(state statesync.State) { f(state.(*statesync.MapState)) })
+}
+
+func TestSnapshotAndDeltas(t *testing.T) {
+	clk, s, opts := setup(t, "statesync-deltas")
+	update(s, func(m *statesync.MapState) { m.Set("a", 1); m.Set("b", 2) })
+	tick(t, clk)
+
+	alice := join(t, opts)
+	if alice.tick != 1 || !reflect.DeepEqual(alice.values, map[string]float64{"a": 1, "b": 2}) {
+		t.Fatalf("snapshot = %d %v, want 1 {a: 1, b: 2}", alice.tick, alice.values)
+	}
+
+	update(s, func(m *statesync.MapState) { m.Set("a", 3); m.Delete("b"); m.Set("c", 4) })
+	tick(t, clk)
+	alice.apply()
+	// An idle tick broadcasts nothing and keeps the Tick, so the next delta follows without a gap.
+	tick(t, clk)
+	if n := s.Tick(); n != 2 {
+		t.Fatalf("Tick() after an idle tick = %d, want 2", n)
+	}
+
+	bob := join(t, opts)
+	update(s, func(m *statesync.MapState) { m.Set("d", 5) })
+	tick(t, clk)
+	alice.apply()
+	bob.apply()
+
+	want := map[string]float64{"a": 3, "c": 4, "d": 5}
+	for name, r := range map[string]*replica{"alice": alice, "bob": bob} {
+		if r.tick != 3 || !reflect.DeepEqual(r.values, want) {
+			t.Fatalf("replica of %s = %d %v, want 3 %v", name, r.tick, r.values, want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// Package timingwheel provides a hashed timing wheel, which schedules a large number of timers
+// of coarse precision at a constant cost, instead of overwhelming the runtime timer heap
+// with a timer per client for heartbeats and timeouts.
+package timingwheel
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// TimingWheel is a hashed timing wheel, safe for concurrent use.
+	// The expiry of a Timer is rounded up to the tick of the TimingWheel,
+	// and all the timers of the same slot are expired together in the TimingWheel goroutine.
+	TimingWheel struct {
+		tick   time.Duration
+		mu     sync.Mutex // mu guards slots, pos, and the timers in the slots.
+		slots  []Timer    // slots are the sentinels of the circular doubly linked lists of timers.
+		pos    int
+		stopCh chan struct{}
+		once   sync.Once
+	}
+
+	// Timer is a single event scheduled on a TimingWheel, created by TimingWheel.AfterFunc.
+	Timer struct {
+		w          *TimingWheel
+		f          func()
+		rounds     int // rounds is the number of full revolutions left before the Timer expires.
+		prev, next *Timer
+	}
+)
+
+// New creates and starts a TimingWheel advancing every tick with numSlots slots,
+// a Timer with a duration longer than tick*numSlots stays in its slot for multiple revolutions.
+func New(tick time.Duration, numSlots int) *TimingWheel {
+	if tick <= 0 {
+		panic("timingwheel: non-positive tick")
+	}
+	if numSlots <= 0 {
+		panic("timingwheel: non-positive number of slots")
+	}
+
+	w := &TimingWheel{
+		tick:   tick,
+		slots:  make([]Timer, numSlots),
+		stopCh: make(chan struct{}),
+	}
+	for i := range w.slots {
+		w.slots[i].next = &w.slots[i]
+		w.slots[i].prev = &w.slots[i]
+	}
+	go w.run()
+	return w
+}
+
+// Tick returns the precision of the TimingWheel.
+func (w *TimingWheel) Tick() time.Duration {
+	return w.tick
+}
+
+// AfterFunc waits for at least the duration d to elapse, rounded up to the tick,
+// and then calls f in the TimingWheel goroutine.
+// f should return quickly since it delays the other timers, start a goroutine for the long-running work.
+func (w *TimingWheel) AfterFunc(d time.Duration, f func()) *Timer {
+	t := &Timer{w: w, f: f}
+	w.mu.Lock()
+	w.schedule(t, d)
+	w.mu.Unlock()
+	return t
+}
+
+// Stop stops the TimingWheel goroutine, the pending timers never expire afterwards.
+func (w *TimingWheel) Stop() {
+	w.once.Do(func() { close(w.stopCh) })
+}
+
+// Stop prevents the Timer from firing,
+// it returns false if the Timer has already expired or been stopped.
+func (t *Timer) Stop() bool {
+	t.w.mu.Lock()
+	defer t.w.mu.Unlock()
+	if t.next == nil {
+		return false
+	}
+	t.unlink()
+	return true
+}
+
+// Reset changes the Timer to expire after the duration d,
+// it returns true if the Timer had been active, or false if the Timer had expired or been stopped.
+func (t *Timer) Reset(d time.Duration) bool {
+	t.w.mu.Lock()
+	defer t.w.mu.Unlock()
+	active := t.next != nil
+	if active {
+		t.unlink()
+	}
+	t.w.schedule(t, d)
+	return active
+}
+
+// schedule links t to the slot that expires after the duration d, w.mu must be held.
+func (w *TimingWheel) schedule(t *Timer, d time.Duration) {
+	ticks := int((d + w.tick - 1) / w.tick)
+	if ticks < 1 {
+		ticks = 1
+	}
+	n := len(w.slots)
+	t.rounds = (ticks - 1) / n
+
+	head := &w.slots[(w.pos+ticks)%n]
+	t.prev, t.next = head.prev, head
+	head.prev.next = t
+	head.prev = t
+}
+
+// unlink removes t from its slot, w.mu must be held.
+func (t *Timer) unlink() {
+	t.prev.next = t.next
+	t.next.prev = t.prev
+	t.prev, t.next = nil, nil
+}
+
+func (w *TimingWheel) run() {
+	ticker := time.NewTicker(w.tick)
+	defer ticker.Stop()
+
+	var expired []func()
+	for {
+		select {
+		case <-w.stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		w.mu.Lock()
+		w.pos = (w.pos + 1) % len(w.slots)
+		head := &w.slots[w.pos]
+		for t := head.next; t != head; {
+			next := t.next
+			if t.rounds > 0 {
+				t.rounds--
+			} else {
+				t.unlink()
+				expired = append(expired, t.f)
+			}
+			t = next
+		}
+		w.mu.Unlock()
+
+		// Call f without holding w.mu, so that f can schedule or stop the timers.
+		for i, f := range expired {
+			f()
+			expired[i] = nil
+		}
+		expired = expired[:0]
+	}
+}
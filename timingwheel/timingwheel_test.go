@@ -0,0 +1,94 @@
+package timingwheel
+
+import (
+	"testing"
+	"time"
+)
+
+const testTick = 10 * time.Millisecond
+
+// fired returns a func for AfterFunc sending the time it's called to the channel.
+func fired() (func(), <-chan time.Time) {
+	ch := make(chan time.Time, 1)
+	return func() { ch <- time.Now() }, ch
+}
+
+func TestAfterFunc(t *testing.T) {
+	w := New(testTick, 4)
+	defer w.Stop()
+
+	// The durations below, equal to and longer than a revolution, stay in their slots for more rounds.
+	for _, d := range []time.Duration{testTick, 3 * testTick, 4 * testTick, 9 * testTick} {
+		f, ch := fired()
+		start := time.Now()
+		w.AfterFunc(d, f)
+		select {
+		case at := <-ch:
+			if elapsed := at.Sub(start); elapsed < d-testTick {
+				t.Errorf("AfterFunc(%v) fired after %v", d, elapsed)
+			}
+		case <-time.After(d + time.Second):
+			t.Fatalf("AfterFunc(%v) never fired", d)
+		}
+	}
+}
+
+func TestTimerStop(t *testing.T) {
+	w := New(testTick, 4)
+	defer w.Stop()
+
+	f, ch := fired()
+	timer := w.AfterFunc(2*testTick, f)
+	if !timer.Stop() {
+		t.Fatal("Stop() of an active Timer = false")
+	}
+	if timer.Stop() {
+		t.Fatal("Stop() of a stopped Timer = true")
+	}
+	select {
+	case <-ch:
+		t.Fatal("a stopped Timer fired")
+	case <-time.After(10 * testTick):
+	}
+}
+
+func TestTimerReset(t *testing.T) {
+	w := New(testTick, 4)
+	defer w.Stop()
+
+	f, ch := fired()
+	timer := w.AfterFunc(2*testTick, f)
+	start := time.Now()
+	if !timer.Reset(20 * testTick) {
+		t.Fatal("Reset() of an active Timer = false")
+	}
+	select {
+	case at := <-ch:
+		if elapsed := at.Sub(start); elapsed < 19*testTick {
+			t.Fatalf("reset Timer fired after %v", elapsed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reset Timer never fired")
+	}
+	if timer.Reset(testTick) {
+		t.Fatal("Reset() of an expired Timer = true")
+	}
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("Timer reset after expiring never fired")
+	}
+}
+
+func TestStopWheel(t *testing.T) {
+	w := New(testTick, 4)
+	f, ch := fired()
+	w.AfterFunc(2*testTick, f)
+	w.Stop()
+	w.Stop()
+	select {
+	case <-ch:
+		t.Fatal("a Timer fired after the TimingWheel is stopped")
+	case <-time.After(10 * testTick):
+	}
+}
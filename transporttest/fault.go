@@ -0,0 +1,142 @@
+package transporttest
+
+import (
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var ErrInjectedDisconnect = errors.New("ppcserver: injected disconnect")
+
+type (
+	// Faults configures the faults injected by a FaultTransport into every message read and written.
+	// The rates are probabilities between 0 and 1.
+	Faults struct {
+		// Latency delays every message, the writer or the reader blocks meanwhile as over a slow link.
+		Latency time.Duration
+		// Jitter adds a random delay up to Jitter to Latency.
+		Jitter time.Duration
+		// DropRate is the probability of silently dropping a message.
+		DropRate float64
+		// ReorderRate is the probability of holding a message and passing it after the next one.
+		// A held message is lost if no message follows.
+		ReorderRate float64
+		// DisconnectRate is the probability of closing the connection instead of passing a message.
+		DisconnectRate float64
+		// DisconnectAfter closes the connection once the number of messages read and written reaches it,
+		// zero for never.
+		DisconnectAfter int
+		// Seed seeds the random faults, so that a failing test can be reproduced.
+		Seed int64
+	}
+
+	// FaultTransport wraps a connector.Transport to inject the Faults, for exercising the reconnection and
+	// reliability logic in tests, such as around the server side Transport of New.
+	FaultTransport struct {
+		connector.Transport
+		faults     Faults
+		mu         sync.Mutex // mu guards rnd, count, heldRead and heldWrite.
+		rnd        *rand.Rand
+		count      int
+		heldRead   []byte
+		heldWrite  []byte
+		disconnect sync.Once
+	}
+)
+
+// WithFaults wraps the Transport to inject the Faults.
+func WithFaults(t connector.Transport, f Faults) *FaultTransport {
+	return &FaultTransport{
+		Transport: t,
+		faults:    f,
+		rnd:       rand.New(rand.NewSource(f.Seed)),
+	}
+}
+
+// Read reads the next message passing the faults.
+func (t *FaultTransport) Read() ([]byte, error) {
+	for {
+		t.mu.Lock()
+		if held := t.heldRead; held != nil {
+			t.heldRead = nil
+			t.mu.Unlock()
+			return held, nil
+		}
+		t.mu.Unlock()
+
+		data, err := t.Transport.Read()
+		if err != nil {
+			return nil, err
+		}
+		pass, hold, err := t.inject()
+		if err != nil {
+			return nil, err
+		}
+		if !pass {
+			continue
+		}
+		if hold {
+			t.mu.Lock()
+			t.heldRead = data
+			t.mu.Unlock()
+			continue
+		}
+		return data, nil
+	}
+}
+
+// Write writes the data passing the faults.
+func (t *FaultTransport) Write(data []byte) error {
+	pass, hold, err := t.inject()
+	if err != nil || !pass {
+		return err
+	}
+
+	t.mu.Lock()
+	held := t.heldWrite
+	if hold {
+		// Copy, since the caller may reuse the data once Write returns.
+		t.heldWrite = append([]byte(nil), data...)
+	} else {
+		t.heldWrite = nil
+	}
+	t.mu.Unlock()
+	if hold {
+		return nil
+	}
+
+	if err := t.Transport.Write(data); err != nil {
+		return err
+	}
+	if held != nil {
+		return t.Transport.Write(held)
+	}
+	return nil
+}
+
+// inject applies the faults to a message, it reports whether the message passes and whether it's held
+// for reordering, and returns ErrInjectedDisconnect once the connection is closed by the faults.
+func (t *FaultTransport) inject() (pass, hold bool, err error) {
+	t.mu.Lock()
+	t.count++
+	delay := t.faults.Latency
+	if t.faults.Jitter > 0 {
+		delay += time.Duration(t.rnd.Int63n(int64(t.faults.Jitter)))
+	}
+	disconnect := t.rnd.Float64() < t.faults.DisconnectRate ||
+		(t.faults.DisconnectAfter > 0 && t.count >= t.faults.DisconnectAfter)
+	drop := t.rnd.Float64() < t.faults.DropRate
+	hold = t.rnd.Float64() < t.faults.ReorderRate
+	t.mu.Unlock()
+
+	if disconnect {
+		t.disconnect.Do(func() { _ = t.Transport.Close() })
+		return false, false, ErrInjectedDisconnect
+	}
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	return !drop, hold, nil
+}
@@ -0,0 +1,188 @@
+// Package transporttest provides an in-memory connector.Transport pair, for unit testing the handlers and
+// the Client state machine without opening sockets:
+//
+//	peer, done := transporttest.Serve(ctx, connector.NewOptions(connector.WithRouter(router)))
+//	_ = peer.SendMessage(&connector.Message{ID: 1, Route: "echo", Data: []byte(`"hi"`)})
+//	resp, err := peer.ReceiveMessage(ctx)
+//
+// WithFaults wraps any Transport to inject latency, drops, reorders, and disconnects.
+package transporttest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/pom-pom-crafts/ppcserver/connector"
+	"io"
+	"net"
+	"sync"
+)
+
+// ProtocolType is the TransportProtocolType of the in-memory Transport.
+const ProtocolType connector.TransportProtocolType = "memory"
+
+var ErrClosed = errors.New("ppcserver: in-memory transport is closed")
+
+type (
+	// Transport is the server side of an in-memory connection, which implements connector.Transport.
+	Transport struct {
+		in, out *pipe
+	}
+
+	// Peer is the client side of an in-memory connection.
+	Peer struct {
+		in, out *pipe
+	}
+
+	// pipe is an unbounded queue of the messages in one direction.
+	pipe struct {
+		mu     sync.Mutex // mu guards queue and closed.
+		queue  [][]byte
+		closed bool
+		ready  chan struct{} // ready is signalled when a message is pushed or the pipe is closed.
+	}
+)
+
+// New creates a connected pair of the server side Transport and the client side Peer.
+func New() (*Transport, *Peer) {
+	toServer, toPeer := newPipe(), newPipe()
+	return &Transport{in: toServer, out: toPeer}, &Peer{in: toPeer, out: toServer}
+}
+
+// Serve creates a connected pair and starts a Client over the Transport by connector.StartClient,
+// the returned channel receives the error of StartClient once the Client is closed.
+func Serve(ctx context.Context, opts *connector.Options) (*Peer, <-chan error) {
+	t, p := New()
+	done := make(chan error, 1)
+	go func() {
+		done <- connector.StartClient(ctx, t, opts)
+	}()
+	return p, done
+}
+
+func newPipe() *pipe {
+	return &pipe{ready: make(chan struct{}, 1)}
+}
+
+// ProtocolType returns ProtocolType.
+func (t *Transport) ProtocolType() connector.TransportProtocolType {
+	return ProtocolType
+}
+
+// NetConn returns nil, since there is no network connection.
+func (t *Transport) NetConn() net.Conn {
+	return nil
+}
+
+// Encoding returns connector.EncodingTypeJSON.
+func (t *Transport) Encoding() connector.EncodingType {
+	return connector.EncodingTypeJSON
+}
+
+// Read blocks until a message is sent by the Peer, it returns io.EOF once the connection is closed.
+func (t *Transport) Read() ([]byte, error) {
+	return t.in.pop(context.Background())
+}
+
+// Write sends a copy of the data to the Peer.
+func (t *Transport) Write(data []byte) error {
+	return t.out.push(data)
+}
+
+// Close closes the connection in both directions, the messages already sent can still be received.
+func (t *Transport) Close() error {
+	t.in.close()
+	t.out.close()
+	return nil
+}
+
+// Send sends a copy of the data to the Transport.
+func (p *Peer) Send(data []byte) error {
+	return p.out.push(data)
+}
+
+// SendMessage sends the Message encoded as JSON to the Transport.
+func (p *Peer) SendMessage(m *connector.Message) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return p.Send(data)
+}
+
+// Receive blocks until a message is written by the Transport or ctx is done,
+// it returns io.EOF once the connection is closed and all the messages are received.
+func (p *Peer) Receive(ctx context.Context) ([]byte, error) {
+	return p.in.pop(ctx)
+}
+
+// ReceiveMessage receives a message and decodes it as a JSON encoded Message.
+func (p *Peer) ReceiveMessage(ctx context.Context) (*connector.Message, error) {
+	data, err := p.Receive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m := &connector.Message{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Close closes the connection in both directions, as if the client disconnects.
+func (p *Peer) Close() error {
+	p.in.close()
+	p.out.close()
+	return nil
+}
+
+func (p *pipe) push(data []byte) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrClosed
+	}
+	p.queue = append(p.queue, append([]byte(nil), data...))
+	p.mu.Unlock()
+	p.signal()
+	return nil
+}
+
+func (p *pipe) pop(ctx context.Context) ([]byte, error) {
+	for {
+		p.mu.Lock()
+		if len(p.queue) > 0 {
+			data := p.queue[0]
+			p.queue[0] = nil
+			p.queue = p.queue[1:]
+			p.mu.Unlock()
+			return data, nil
+		}
+		closed := p.closed
+		p.mu.Unlock()
+		if closed {
+			return nil, io.EOF
+		}
+
+		select {
+		case <-p.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (p *pipe) close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	p.signal()
+}
+
+// signal wakes up the reader without blocking, a pending signal is enough since the reader checks the queue again.
+func (p *pipe) signal() {
+	select {
+	case p.ready <- struct{}{}:
+	default:
+	}
+}